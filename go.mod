@@ -2,4 +2,4 @@ module github.com/neet-007/git_in_go
 
 go 1.23.2
 
-require gopkg.in/ini.v1 v1.67.0 // indirect
+require gopkg.in/ini.v1 v1.67.0
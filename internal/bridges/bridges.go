@@ -1,14 +1,18 @@
 package bridges
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/neet-007/git_in_go/internal/diff"
 	"github.com/neet-007/git_in_go/internal/repository"
 )
 
@@ -24,6 +28,41 @@ func CmdAdd(paths ...string) {
 	}
 }
 
+func CmdBlame(revs []string, paths []string, opts repository.BlameOptions) {
+	/*
+		git's blame [<rev>] [--] <file>, without a rev the worktree file is blamed with
+		HEAD as its parent
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while blame: %v\n", err)
+	}
+
+	if len(paths) == 0 && len(revs) > 0 {
+		paths = revs[len(revs)-1:]
+		revs = revs[:len(revs)-1]
+	}
+	if len(paths) != 1 || len(revs) > 1 {
+		log.Fatalf("Error while blame: expected [<rev>] [--] <file>\n")
+	}
+
+	paths, err = repo.WorktreePathspec(paths)
+	if err != nil {
+		log.Fatalf("Error while blame: %v\n", err)
+	}
+
+	rev := ""
+	if len(revs) == 1 {
+		rev = revs[0]
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if err := repo.Blame(out, rev, paths[0], opts); err != nil {
+		log.Fatalf("Error while blame: %v\n", err)
+	}
+	out.Flush()
+}
+
 func CmdCatFile(args ...string) {
 	repo, err := repository.FindRepo(".", true)
 	if err != nil {
@@ -55,12 +94,65 @@ func CmdCheckIgnore(paths ...string) {
 	}
 }
 
+func CmdCheckMailmap(contacts []string, stdin bool) {
+	/*
+		stdin: default val is false, reads one contact per line after the args
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while check-mailmap: %v\n", err)
+	}
+
+	check := func(contact string) {
+		mapped, err := repo.CheckMailmap(contact)
+		if err != nil {
+			log.Fatalf("Error while check-mailmap: %v\n", err)
+		}
+		fmt.Println(mapped)
+	}
+
+	for _, contact := range contacts {
+		check(contact)
+	}
+
+	if !stdin {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		check(scanner.Text())
+	}
+}
+
 func CmdCheckout(commit string, path string) {
+	/*
+		path: default val is "", switches the worktree and HEAD to commit when empty
+	*/
 	repo, err := repository.FindRepo(".", true)
 	if err != nil {
 		log.Fatalf("Error with checkout: %v\n", err)
 	}
 
+	if path == "" {
+		branch, err := repo.Checkout(commit)
+		if err != nil {
+			log.Fatalf("Error with checkout: %v\n", err)
+		}
+
+		if branch != "" {
+			fmt.Printf("Switched to branch '%s'\n", branch)
+			return
+		}
+
+		sha, err := repo.ObjectFind("HEAD", "", true)
+		if err != nil {
+			log.Fatalf("Error with checkout: %v\n", err)
+		}
+		fmt.Printf("HEAD is now at %s\n", sha[:7])
+		return
+	}
+
 	objSha, err := repo.ObjectFind(commit, "", true)
 	if err != nil {
 		log.Fatalf("Error with checkout: %v\n", err)
@@ -115,7 +207,7 @@ func CmdCheckout(commit string, path string) {
 
 	realPath, err := filepath.EvalSymlinks(absPath)
 	if err != nil {
-		log.Fatalf("Error resolving real path:\n", err)
+		log.Fatalf("Error resolving real path: %v\n", err)
 		return
 	}
 
@@ -126,39 +218,84 @@ func CmdCheckout(commit string, path string) {
 
 	err = repo.TreeCheckout(objTree, realPath)
 	if err != nil {
-		log.Fatalf("Error resolving real path:\n", err)
+		log.Fatalf("Error resolving real path: %v\n", err)
 	}
 }
 
-func CmdCommit(message string) {
+func CmdCherryPick(revs []string, cont bool, skip bool, abort bool, opts repository.SequencerOptions) {
+	/*
+		also revert with opts.Revert, exits with 1 when a pick stops on conflicts
+	*/
+	action := "cherry-pick"
+	if opts.Revert {
+		action = "revert"
+	}
+
 	repo, err := repository.FindRepo(".", true)
 	if err != nil {
-		log.Fatalf("Error while commit:%v\n", err)
+		log.Fatalf("Error while %s: %v\n", action, err)
 	}
 
-	index, err := repo.IndexRead()
-	if err != nil {
-		log.Fatalf("Error while commit:%v\n", err)
+	out := bufio.NewWriter(os.Stdout)
+	switch {
+	case abort:
+		err = repo.SequencerAbort(action)
+	case skip:
+		err = repo.SequencerSkip(out, action)
+	case cont:
+		err = repo.SequencerContinue(out, action)
+	default:
+		var commits []string
+		if commits, err = repo.PickCommits(revs, !opts.Revert); err == nil {
+			err = repo.Sequencer(out, commits, opts)
+		}
 	}
+	out.Flush()
 
-	tree, err := repo.TreeFromIndex(index)
+	if errors.Is(err, repository.PickConflict) {
+		os.Exit(1)
+	}
 	if err != nil {
-		log.Fatalf("Error while commit:%v\n", err)
+		log.Fatalf("Error while %s: %v\n", action, err)
 	}
+}
 
-	head, err := repo.ObjectFind("HEAD", "", true)
+func CmdCheckRefFormat(name string, branch bool, opts repository.RefFormatOptions) {
+	if branch {
+		repo, err := repository.FindRepo(".", true)
+		if err != nil {
+			log.Fatalf("Error while check-ref-format: %v\n", err)
+		}
+
+		name, err = repo.CheckBranchName(name)
+		if err != nil {
+			log.Fatalf("Error while check-ref-format: %v\n", err)
+		}
+
+		fmt.Printf("%s\n", name)
+		return
+	}
+
+	name, err := repository.CheckRefFormat(name, opts)
 	if err != nil {
-		log.Fatalf("Error while commit:%v\n", err)
+		os.Exit(1)
 	}
 
-	config, err := repository.GitConfigRead()
+	if opts.Normalize {
+		fmt.Printf("%s\n", name)
+	}
+}
+
+func CmdCommit(message string) {
+	/*
+		a merge in progress is concluded with MERGE_HEAD as the second parent
+	*/
+	repo, err := repository.FindRepo(".", true)
 	if err != nil {
 		log.Fatalf("Error while commit:%v\n", err)
 	}
 
-	user := repository.GitConfigUserGet(config)
-
-	commit, err := repo.CommitCreate(tree, head, user, message, time.Now())
+	commit, err := repo.CommitIndex(message, "")
 	if err != nil {
 		log.Fatalf("Error while commit:%v\n", err)
 	}
@@ -168,33 +305,192 @@ func CmdCommit(message string) {
 		log.Fatalf("Error while commit:%v\n", err)
 	}
 
-	if activeBranch != "" {
-		repoFile, err := repo.RepoFile(false, filepath.Join("refs/heads", activeBranch))
+	if activeBranch == "" {
+		activeBranch = "detached HEAD"
+	}
+	fmt.Printf("[%s %s] %s\n", activeBranch, commit[:7], strings.SplitN(message, "\n", 2)[0])
+}
+
+func CmdDescribe(commits []string, opts repository.DescribeOptions) {
+	/*
+		describes HEAD when no commit is given, the dirty mark is only kept when the
+		worktree differs from HEAD
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while describe: %v\n", err)
+	}
+
+	if opts.Dirty != "" {
+		if len(commits) > 0 {
+			log.Fatalf("Error while describe: --dirty is incompatible with commit-ishes\n")
+		}
+
+		dirty, err := repo.WorktreeDirty()
 		if err != nil {
-			log.Fatalf("Error while commit:%v\n", err)
+			log.Fatalf("Error while describe: %v\n", err)
 		}
+		if !dirty {
+			opts.Dirty = ""
+		}
+	}
+
+	if len(commits) == 0 {
+		commits = []string{"HEAD"}
+	}
 
-		file, err := os.Open(repoFile)
+	for _, commit := range commits {
+		sha, err := repo.ObjectFind(commit, "commit", true)
 		if err != nil {
-			log.Fatalf("Error while commit:%v\n", err)
+			log.Fatalf("Error while describe: %v\n", err)
 		}
-		defer file.Close()
 
-		file.Write([]byte(commit + "\n"))
+		name, err := repo.Describe(sha, opts)
+		if err != nil {
+			log.Fatalf("Error while describe: %v\n", err)
+		}
+
+		fmt.Printf("%s\n", name)
+	}
+}
+
+func CmdDiff(revs []string, paths []string, cached bool, exitCode bool, opts repository.DiffOptions) {
+	/*
+		no rev compares the worktree to the index, --cached the index to HEAD or the rev,
+		one rev the worktree to it and two revs, <a>..<b> or <a>...<b> two trees
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while diff: %v\n", err)
+	}
+
+	for i, rev := range revs {
+		if strings.Contains(rev, "..") {
+			continue
+		}
+		if _, err := repo.ObjectFind(rev, "", true); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(rev); err == nil {
+			paths = append(slices.Clone(revs[i:]), paths...)
+			revs = revs[:i]
+			break
+		}
+	}
+
+	if len(revs) == 1 {
+		if left, right, ok := strings.Cut(revs[0], "..."); ok {
+			revs = []string{left, right}
+			if revs[0] == "" {
+				revs[0] = "HEAD"
+			}
+			if revs[1] == "" {
+				revs[1] = "HEAD"
+			}
+
+			a, err := repo.ObjectFind(revs[0], "commit", true)
+			if err != nil {
+				log.Fatalf("Error while diff: %v\n", err)
+			}
+			b, err := repo.ObjectFind(revs[1], "commit", true)
+			if err != nil {
+				log.Fatalf("Error while diff: %v\n", err)
+			}
+
+			bases, err := repo.MergeBases(a, b)
+			if err != nil {
+				log.Fatalf("Error while diff: %v\n", err)
+			}
+			if len(bases) == 0 {
+				log.Fatalf("Error while diff: %s: no merge base\n", revs[0]+"..."+revs[1])
+			}
+			revs[0] = bases[0]
+		} else if left, right, ok := strings.Cut(revs[0], ".."); ok {
+			revs = []string{left, right}
+			if revs[0] == "" {
+				revs[0] = "HEAD"
+			}
+			if revs[1] == "" {
+				revs[1] = "HEAD"
+			}
+		}
+	}
+
+	if len(revs) > 2 || cached && len(revs) > 1 {
+		log.Fatalf("Error while diff: too many revisions\n")
+	}
+
+	paths, err = repo.WorktreePathspec(paths)
+	if err != nil {
+		log.Fatalf("Error while diff: %v\n", err)
+	}
 
+	var old, new map[string]repository.DiffEntry
+	if len(revs) == 2 {
+		if old, err = repo.DiffTreeEntries(revs[0]); err != nil {
+			log.Fatalf("Error while diff: %v\n", err)
+		}
+		if new, err = repo.DiffTreeEntries(revs[1]); err != nil {
+			log.Fatalf("Error while diff: %v\n", err)
+		}
 	} else {
-		repoFile, err := repo.RepoFile(false, "HEAD")
+		index, err := repo.IndexRead()
 		if err != nil {
-			log.Fatalf("Error while commit:%v\n", err)
+			log.Fatalf("Error while diff: %v\n", err)
 		}
 
-		file, err := os.Open(repoFile)
+		switch {
+		case len(revs) == 1:
+			old, err = repo.DiffTreeEntries(revs[0])
+		case cached:
+			old = map[string]repository.DiffEntry{}
+			if _, err = repo.RefResolve("HEAD"); err == nil {
+				old, err = repo.DiffTreeEntries("HEAD")
+			} else {
+				err = nil
+			}
+		default:
+			old = repo.DiffIndexEntries(index)
+		}
 		if err != nil {
-			log.Fatalf("Error while commit:%v\n", err)
+			log.Fatalf("Error while diff: %v\n", err)
+		}
+
+		if cached {
+			new = repo.DiffIndexEntries(index)
+		} else if new, err = repo.DiffWorktreeEntries(index); err != nil {
+			log.Fatalf("Error while diff: %v\n", err)
 		}
-		defer file.Close()
+	}
+
+	pairs := repository.DiffPairs(old, new, paths)
+	if opts.Renames || opts.Copies {
+		pairs, err = repo.DiffRenames(pairs, opts.Copies, opts.RenameScore)
+		if err != nil {
+			log.Fatalf("Error while diff: %v\n", err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if err := repo.DiffWrite(out, pairs, opts); err != nil {
+		log.Fatalf("Error while diff: %v\n", err)
+	}
+	out.Flush()
 
-		file.Write([]byte("\n"))
+	if exitCode && len(pairs) > 0 {
+		os.Exit(1)
+	}
+}
+
+func CmdForEachRef(opts repository.ForEachRefOptions) {
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while for-each-ref: %v\n", err)
+	}
+
+	err = repo.ForEachRef(opts)
+	if err != nil {
+		log.Fatalf("Error while for-each-ref: %v\n", err)
 	}
 }
 
@@ -226,29 +522,409 @@ func CmdHashObject(write bool, typeName string, path string) {
 	fmt.Printf("%s\n", sha)
 }
 
-func CmdInit(args ...string) {
-	_, err := repository.CreateRepo(args[1])
+func CmdInit(path string, refFormat string) {
+	/*
+		path: default val is "."
+		refFormat: default val is "files"
+	*/
+	_, err := repository.CreateRepo(path, refFormat)
 	if err != nil {
 		log.Fatalf("Error while initlizaing repo: %v\n", err)
 	}
 
-	fmt.Println("empty repo is initinlized\n")
+	fmt.Println("empty repo is initinlized")
+}
+
+func mergeStat(repo *repository.Repository, out *bufio.Writer, from string, to string) error {
+	/*
+		the diffstat and summary git prints after a merge
+	*/
+	old, err := repo.DiffTreeEntries(from)
+	if err != nil {
+		return err
+	}
+	new, err := repo.DiffTreeEntries(to)
+	if err != nil {
+		return err
+	}
+
+	pairs, err := repo.DiffRenames(repository.DiffPairs(old, new, nil), false, repository.DefaultRenameScore)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DiffWriteStat(out, pairs, repository.DiffOptions{Renames: true}); err != nil {
+		return err
+	}
+
+	return repository.DiffWriteSummary(out, pairs)
+}
+
+func CmdMerge(name string, abort bool, cont bool, opts repository.MergeOptions) {
+	/*
+		exits with 1 when the merge stops on conflicts
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while merge: %v\n", err)
+	}
+
+	switch {
+	case abort:
+		if err := repo.MergeAbort(); err != nil {
+			log.Fatalf("Error while merge: %v\n", err)
+		}
+		return
+	case cont:
+		if _, err := repo.MergeContinue(opts.Message); err != nil {
+			log.Fatalf("Error while merge: %v\n", err)
+		}
+		return
+	}
+
+	outcome, err := repo.Merge(name, opts)
+	if err != nil {
+		log.Fatalf("Error while merge: %v\n", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if outcome.UpToDate {
+		fmt.Fprintf(out, "Already up to date.\n")
+		return
+	}
+
+	if outcome.Result != nil {
+		for _, message := range outcome.Result.Messages {
+			fmt.Fprintf(out, "%s\n", message)
+		}
+
+		if !outcome.Result.Clean() {
+			if opts.Squash {
+				fmt.Fprintf(out, "Squash commit -- not updating HEAD\n")
+			}
+			fmt.Fprintf(out, "Automatic merge failed; fix conflicts and then commit the result.\n")
+			out.Flush()
+			os.Exit(1)
+		}
+	}
+
+	if opts.Squash {
+		fmt.Fprintf(out, "Automatic merge went well; stopped before committing as requested\n")
+		fmt.Fprintf(out, "Squash commit -- not updating HEAD\n")
+		return
+	}
+	if outcome.Head == "" {
+		return
+	}
+
+	if outcome.FastForward {
+		fmt.Fprintf(out, "Updating %s..%s\nFast-forward\n", repo.ObjectAbbrev(outcome.Head, 7), repo.ObjectAbbrev(outcome.Merged, 7))
+	} else {
+		fmt.Fprintf(out, "Merge made by the 'ort' strategy.\n")
+	}
+
+	if err := mergeStat(repo, out, outcome.Head, outcome.Commit); err != nil {
+		log.Fatalf("Error while merge: %v\n", err)
+	}
+}
+
+func CmdMergeBase(commits []string, all bool, octopus bool, isAncestor bool, forkPoint bool) {
+	/*
+		exits with 1 when there is no merge base, or with --is-ancestor when it is not one
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while merge-base: %v\n", err)
+	}
+
+	if forkPoint {
+		commit := "HEAD"
+		if len(commits) == 2 {
+			commit = commits[1]
+		}
+
+		sha, err := repo.ObjectFind(commit, "commit", true)
+		if err != nil {
+			log.Fatalf("Error while merge-base: %v\n", err)
+		}
+
+		base, err := repo.ForkPoint(commits[0], sha)
+		if err != nil {
+			log.Fatalf("Error while merge-base: %v\n", err)
+		}
+		if base == "" {
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s\n", base)
+		return
+	}
+
+	shas := []string{}
+	for _, commit := range commits {
+		sha, err := repo.ObjectFind(commit, "commit", true)
+		if err != nil {
+			log.Fatalf("Error while merge-base: %v\n", err)
+		}
+		shas = append(shas, sha)
+	}
+
+	if isAncestor {
+		ok, err := repo.IsAncestor(shas[0], shas[1])
+		if err != nil {
+			log.Fatalf("Error while merge-base: %v\n", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var bases []string
+	if octopus {
+		bases, err = repo.OctopusMergeBases(shas)
+	} else {
+		bases, err = repo.MergeBasesMany(shas[0], shas[1:])
+	}
+	if err != nil {
+		log.Fatalf("Error while merge-base: %v\n", err)
+	}
+
+	if len(bases) == 0 {
+		os.Exit(1)
+	}
+	if !all {
+		bases = bases[:1]
+	}
+
+	for _, base := range bases {
+		fmt.Printf("%s\n", base)
+	}
+}
+
+func CmdMergeFile(current string, base string, other string, stdout bool, opts diff.MergeOptions) {
+	/*
+		stdout: default val is false, the result replaces current otherwise
+		exits with the number of conflicts like git
+	*/
+	files := [][]string{}
+	for _, name := range []string{current, base, other} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatalf("Error while merge-file: %v\n", err)
+		}
+		if diff.IsBinary(data) {
+			log.Fatalf("Error while merge-file: Cannot merge binary files: %s\n", name)
+		}
+		files = append(files, diff.Split(data))
+	}
+
+	if opts.OursLabel == "" {
+		opts.OursLabel = current
+	}
+	if opts.BaseLabel == "" {
+		opts.BaseLabel = base
+	}
+	if opts.TheirsLabel == "" {
+		opts.TheirsLabel = other
+	}
+
+	merged, conflicts := diff.Merge3(files[1], files[0], files[2], opts)
+	if stdout {
+		os.Stdout.Write(merged)
+	} else if err := os.WriteFile(current, merged, 0o644); err != nil {
+		log.Fatalf("Error while merge-file: %v\n", err)
+	}
+
+	os.Exit(min(conflicts, 127))
+}
+
+func CmdMergeTree(branch1 string, branch2 string, nameOnly bool, messages bool, opts repository.MergeTreeOptions) {
+	/*
+		git's merge-tree --write-tree, prints the merged tree, the conflicted paths with their
+		stages and the conflict messages, exits with 1 when the merge is not clean
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while merge-tree: %v\n", err)
+	}
+
+	shas := []string{}
+	for _, branch := range []string{branch1, branch2} {
+		sha, err := repo.ObjectFind(branch, "commit", true)
+		if err != nil {
+			log.Fatalf("Error while merge-tree: %v\n", err)
+		}
+		shas = append(shas, sha)
+	}
+
+	if opts.OursLabel == "" {
+		opts.OursLabel = branch1
+	}
+	if opts.TheirsLabel == "" {
+		opts.TheirsLabel = branch2
+	}
+
+	result, err := repo.MergeCommits(shas[0], shas[1], opts)
+	if err != nil {
+		log.Fatalf("Error while merge-tree: %v\n", err)
+	}
+	tree, err := repo.MergeTreeWrite(result)
+	if err != nil {
+		log.Fatalf("Error while merge-tree: %v\n", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(out, "%s\n", tree)
+
+	if !result.Clean() {
+		printed := map[string]bool{}
+		for _, e := range result.IndexEntries() {
+			if e.FlagStage == 0 || nameOnly && printed[e.Name] {
+				continue
+			}
+			printed[e.Name] = true
+
+			if nameOnly {
+				fmt.Fprintf(out, "%s\n", e.Name)
+			} else {
+				fmt.Fprintf(out, "%06o %s %d\t%s\n", uint32(e.ModeType)<<12|uint32(e.ModePerms), e.Sha, e.FlagStage, e.Name)
+			}
+		}
+	}
+
+	if messages && !result.Clean() {
+		fmt.Fprintf(out, "\n")
+		for _, message := range result.Messages {
+			fmt.Fprintf(out, "%s\n", message)
+		}
+	}
+	out.Flush()
+
+	if !result.Clean() {
+		os.Exit(1)
+	}
+}
+
+func CmdNameRev(commits []string, all bool, opts repository.NameRevOptions) {
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while name-rev: %v\n", err)
+	}
+
+	namer, err := repo.NewRevNamer(opts)
+	if err != nil {
+		log.Fatalf("Error while name-rev: %v\n", err)
+	}
+
+	if all {
+		for _, sha := range namer.Named() {
+			if opts.NameOnly {
+				fmt.Printf("%s\n", namer.Name(sha))
+			} else {
+				fmt.Printf("%s %s\n", sha, namer.Name(sha))
+			}
+		}
+		return
+	}
+
+	for _, commit := range commits {
+		sha, err := repo.ObjectFind(commit, "commit", true)
+		if err != nil {
+			log.Fatalf("Error while name-rev: %v\n", err)
+		}
+
+		name := namer.Name(sha)
+		if name == "" {
+			name = "undefined"
+		}
+
+		if opts.NameOnly {
+			fmt.Printf("%s\n", name)
+		} else {
+			fmt.Printf("%s %s\n", commit, name)
+		}
+	}
+}
+
+func CmdPackRefs() {
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while pack-refs: %v\n", err)
+	}
+
+	if err := repo.Refs.Pack(); err != nil {
+		log.Fatalf("Error while pack-refs: %v\n", err)
+	}
 }
 
-func CmdLog(commit string) {
+func CmdLog(revs []string, paths []string, walkOpts repository.RevWalkOptions, since string, until string, opts repository.LogOptions, graphviz bool) {
+	/*
+		revs: default val is HEAD
+		paths: default val is [], relative to the current directory
+		graphviz: default val is false, prints a DOT digraph instead of text
+	*/
 	repo, err := repository.FindRepo(".", true)
 	if err != nil {
 		log.Fatalf("Error while logging: %v\n", err)
 	}
 
-	fmt.Println("digraph gitlog{\n node[shape=rect]")
-	path, err := repo.ObjectFind(commit, "", true)
+	walkOpts.Paths, err = repo.WorktreePathspec(paths)
 	if err != nil {
 		log.Fatalf("Error while logging: %v\n", err)
 	}
 
-	repository.LogGraphviz(repo, path, &map[string]byte{})
-	fmt.Println("}")
+	if since != "" {
+		walkOpts.Since, err = repository.ParseDateSpec(since, time.Now())
+		if err != nil {
+			log.Fatalf("Error while logging: %v\n", err)
+		}
+	}
+	if until != "" {
+		walkOpts.Until, err = repository.ParseDateSpec(until, time.Now())
+		if err != nil {
+			log.Fatalf("Error while logging: %v\n", err)
+		}
+	}
+
+	walker := repo.NewRevWalker(walkOpts)
+	if len(revs) == 0 && !walkOpts.All {
+		if _, err := repo.RefResolve("HEAD"); err != nil {
+			branch, _ := repo.GetActiveBranch()
+			log.Fatalf("Error while logging: your current branch '%s' does not have any commits yet\n", branch)
+		}
+		revs = []string{"HEAD"}
+	}
+
+	for _, rev := range revs {
+		if err := walker.AddRevision(rev); err != nil {
+			log.Fatalf("Error while logging: %v\n", err)
+		}
+	}
+
+	commits, err := walker.Walk()
+	if err != nil {
+		log.Fatalf("Error while logging: %v\n", err)
+	}
+
+	if graphviz {
+		commits = slices.DeleteFunc(commits, func(c *repository.WalkCommit) bool {
+			return walker.Hidden(c.Sha)
+		})
+
+		fmt.Println("digraph gitlog{\n node[shape=rect]")
+		if err := repository.LogGraphviz(repo, commits); err != nil {
+			log.Fatalf("Error while logging: %v\n", err)
+		}
+		fmt.Println("}")
+		return
+	}
+
+	if err := repo.Log(walker, commits, opts); err != nil {
+		log.Fatalf("Error while logging: %v\n", err)
+	}
 }
 
 func CmdLsFiles(verbose bool) {
@@ -281,28 +957,163 @@ func CmdLsFiles(verbose bool) {
 func CmdLsTree(path string, recursive bool) {
 	repo, err := repository.FindRepo(".", true)
 	if err != nil {
-		log.Fatalf("Error while ls-tree for path:%s err:%w\n", path, err)
+		log.Fatalf("Error while ls-tree for path:%s err:%v\n", path, err)
 	}
 
 	err = repo.LsTree(path, recursive, "")
 	if err != nil {
-		log.Fatalf("Error while ls-tree for path:%s err:%w\n", path, err)
+		log.Fatalf("Error while ls-tree for path:%s err:%v\n", path, err)
 	}
 
 }
 
-func CmdRevParse(typeArg string, name string) {
+func CmdRebase(upstream string, branch string, cont bool, skip bool, abort bool, opts repository.RebaseOptions) {
+	/*
+		exits with 1 when the rebase stops on conflicts or a failed exec
+	*/
 	repo, err := repository.FindRepo(".", true)
 	if err != nil {
-		log.Fatalf("Error while rev-parse name:%s, type:%s, %v", name, typeArg, err)
+		log.Fatalf("Error while rebase: %v\n", err)
 	}
 
-	sha, err := repo.ObjectFind(name, typeArg, true)
+	out := bufio.NewWriter(os.Stdout)
+	switch {
+	case abort:
+		err = repo.RebaseAbort()
+	case skip:
+		err = repo.RebaseSkip(out)
+	case cont:
+		err = repo.RebaseContinue(out)
+	default:
+		err = repo.Rebase(out, upstream, branch, opts)
+	}
+	out.Flush()
+
+	if errors.Is(err, repository.PickConflict) || errors.Is(err, repository.RebaseStopped) {
+		os.Exit(1)
+	}
 	if err != nil {
-		log.Fatalf("Error while rev-parse name:%s, type:%s, %v", name, typeArg, err)
+		log.Fatalf("Error while rebase: %v\n", err)
 	}
+}
 
-	fmt.Printf("%s\n", sha)
+func CmdRevList(revs []string, paths []string, opts repository.RevWalkOptions, since string, until string, objects bool, count bool) {
+	/*
+		paths: default val is [], relative to the current directory
+		since, until: default val is "", no limit
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while rev-list: %v\n", err)
+	}
+
+	opts.Paths, err = repo.WorktreePathspec(paths)
+	if err != nil {
+		log.Fatalf("Error while rev-list: %v\n", err)
+	}
+
+	if since != "" {
+		opts.Since, err = repository.ParseDateSpec(since, time.Now())
+		if err != nil {
+			log.Fatalf("Error while rev-list: %v\n", err)
+		}
+	}
+	if until != "" {
+		opts.Until, err = repository.ParseDateSpec(until, time.Now())
+		if err != nil {
+			log.Fatalf("Error while rev-list: %v\n", err)
+		}
+	}
+
+	walker := repo.NewRevWalker(opts)
+	for _, rev := range revs {
+		if err := walker.AddRevision(rev); err != nil {
+			log.Fatalf("Error while rev-list: %v\n", err)
+		}
+	}
+
+	commits, err := walker.Walk()
+	if err != nil {
+		log.Fatalf("Error while rev-list: %v\n", err)
+	}
+
+	if count {
+		fmt.Println(len(commits))
+		return
+	}
+
+	for _, c := range commits {
+		fmt.Println(c.Sha)
+	}
+
+	if !objects {
+		return
+	}
+
+	walkObjects, err := walker.Objects(commits)
+	if err != nil {
+		log.Fatalf("Error while rev-list: %v\n", err)
+	}
+
+	for _, obj := range walkObjects {
+		fmt.Printf("%s %s\n", obj.Sha, obj.Path)
+	}
+}
+
+func CmdRevParse(typeArg string, names []string, verify bool, short int, abbrevRef bool, showToplevel bool, gitDir bool) {
+	/*
+		short: default val is 0, prints the full sha when 0
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while rev-parse names:%v, type:%s, %v", names, typeArg, err)
+	}
+
+	if showToplevel {
+		fmt.Printf("%s\n", repo.Worktree)
+	}
+
+	if gitDir {
+		cwd, err := os.Getwd()
+		if err == nil {
+			cwd, err = filepath.EvalSymlinks(cwd)
+		}
+		if err == nil && cwd == repo.Worktree {
+			fmt.Println(".git")
+		} else {
+			fmt.Printf("%s\n", repo.Gitdir)
+		}
+	}
+
+	if verify && len(names) != 1 {
+		log.Fatalf("Error while rev-parse: Needed a single revision\n")
+	}
+
+	for _, name := range names {
+		if abbrevRef {
+			ref, err := repo.RevParseAbbrevRef(name)
+			if err != nil {
+				log.Fatalf("Error while rev-parse name:%s, type:%s, %v", name, typeArg, err)
+			}
+
+			fmt.Printf("%s\n", ref)
+			continue
+		}
+
+		sha, err := repo.ObjectFind(name, typeArg, true)
+		if err != nil {
+			if verify {
+				log.Fatalf("Error while rev-parse: Needed a single revision\n")
+			}
+			log.Fatalf("Error while rev-parse name:%s, type:%s, %v", name, typeArg, err)
+		}
+
+		if short > 0 {
+			sha = repo.ObjectAbbrev(sha, short)
+		}
+
+		fmt.Printf("%s\n", sha)
+	}
 }
 
 func CmdRm(paths ...string) {
@@ -317,21 +1128,72 @@ func CmdRm(paths ...string) {
 	}
 }
 
-func CmdShowRef(args string) {
+func CmdShow(names []string, opts repository.ShowOptions) {
 	repo, err := repository.FindRepo(".", true)
 	if err != nil {
-		log.Fatalf("Error while show-ref %v\n", err)
+		log.Fatalf("Error while show: %v\n", err)
 	}
 
-	refs, err := repo.RefList("")
+	out := bufio.NewWriter(os.Stdout)
+	if err := repo.Show(out, names, opts); err != nil {
+		out.Flush()
+		log.Fatalf("Error while show: %v\n", err)
+	}
+	out.Flush()
+}
+
+func CmdShortlog(revs []string, paths []string, opts repository.ShortlogOptions) {
+	/*
+		revs: default val is HEAD
+		paths: default val is [], relative to the current directory
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while shortlog: %v\n", err)
+	}
+
+	walkOpts := repository.RevWalkOptions{MaxCount: -1}
+	walkOpts.Paths, err = repo.WorktreePathspec(paths)
+	if err != nil {
+		log.Fatalf("Error while shortlog: %v\n", err)
+	}
+
+	walker := repo.NewRevWalker(walkOpts)
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+	for _, rev := range revs {
+		if err := walker.AddRevision(rev); err != nil {
+			log.Fatalf("Error while shortlog: %v\n", err)
+		}
+	}
+
+	commits, err := walker.Walk()
+	if err != nil {
+		log.Fatalf("Error while shortlog: %v\n", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if err := repo.Shortlog(out, commits, opts); err != nil {
+		log.Fatalf("Error while shortlog: %v\n", err)
+	}
+	out.Flush()
+}
+
+func CmdShowRef(args string) {
+	repo, err := repository.FindRepo(".", true)
 	if err != nil {
 		log.Fatalf("Error while show-ref %v\n", err)
 	}
 
-	err = repo.ShowRefs(refs, true, "refs")
+	refs, err := repo.RefListFlat("refs/")
 	if err != nil {
 		log.Fatalf("Error while show-ref %v\n", err)
 	}
+
+	for _, ref := range refs {
+		fmt.Printf("%s %s\n", ref.Sha, ref.Name)
+	}
 }
 
 func CmdStatus() {
@@ -351,6 +1213,115 @@ func CmdStatus() {
 	repo.StatusIndexWorktree(index)
 }
 
+func CmdStash(command string, args []string, opts repository.StashOptions, index bool, diffOpts repository.DiffOptions) {
+	/*
+		command is one of push, list, show, apply, pop, drop and branch, args are the stash
+		or for branch the branch name and the stash, apply and pop print the status after
+		and exit with 1 when they leave conflicts
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while stash: %v\n", err)
+	}
+
+	rev := ""
+	if len(args) > 0 {
+		rev = args[len(args)-1]
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	switch command {
+	case "push":
+		err = repo.StashPush(out, opts)
+	case "list":
+		err = repo.StashList(out)
+	case "show":
+		err = repo.StashShow(out, rev, diffOpts)
+	case "drop":
+		err = repo.StashDrop(out, rev)
+	case "apply", "pop", "branch":
+		if command == "branch" {
+			rev = ""
+			if len(args) > 1 {
+				rev = args[1]
+			}
+			if err = repo.StashBranch(out, args[0], rev); err != nil {
+				break
+			}
+			index = true
+		}
+
+		err = repo.StashApply(out, rev, index)
+		if err == nil || errors.Is(err, repository.StashConflict) {
+			out.Flush()
+			if index, err := repo.IndexRead(); err == nil {
+				repo.StatusBranch()
+				repo.StatusHeadIndex(index)
+				fmt.Println()
+				repo.StatusIndexWorktree(index)
+			}
+		}
+
+		if errors.Is(err, repository.StashConflict) && command != "apply" {
+			fmt.Fprintf(out, "The stash entry is kept in case you need it again.\n")
+		}
+		if err == nil && command != "apply" {
+			err = repo.StashDrop(out, rev)
+		}
+	}
+	out.Flush()
+
+	if errors.Is(err, repository.StashConflict) {
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("Error while stash: %v\n", err)
+	}
+}
+
+func CmdSymbolicRef(name string, target string, deleteRef bool, short bool, quiet bool) {
+	/*
+		target: default val is "", reads the ref when empty
+	*/
+	repo, err := repository.FindRepo(".", true)
+	if err != nil {
+		log.Fatalf("Error while symbolic-ref: %v\n", err)
+	}
+
+	if deleteRef {
+		err = repo.SymbolicRefDelete(name)
+		if err != nil {
+			if quiet {
+				os.Exit(1)
+			}
+			log.Fatalf("Error while symbolic-ref: %v\n", err)
+		}
+		return
+	}
+
+	if target != "" {
+		err = repo.SymbolicRefCreate(name, target)
+		if err != nil {
+			log.Fatalf("Error while symbolic-ref: %v\n", err)
+		}
+		return
+	}
+
+	ref, err := repo.SymbolicRefRead(name)
+	if err != nil {
+		if quiet && errors.Is(err, repository.RefNotSymbolic) {
+			os.Exit(1)
+		}
+		log.Fatalf("Error while symbolic-ref: %v\n", err)
+	}
+
+	if short {
+		ref = strings.TrimPrefix(ref, "refs/heads/")
+	}
+
+	fmt.Printf("%s\n", ref)
+}
+
 func CmdTag(name string, object string, createTagObject bool) {
 	/*
 		name: default val is ""
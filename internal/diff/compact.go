@@ -0,0 +1,292 @@
+package diff
+
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+	indentHeuristicMaxSliding       = 100
+)
+
+type group struct {
+	start int
+	end   int
+}
+
+func (f *file) groupInit() group {
+	g := group{}
+	for f.changed(g.end) {
+		g.end++
+	}
+
+	return g
+}
+
+func (f *file) groupNext(g *group) bool {
+	if g.end == len(f.recs) {
+		return false
+	}
+
+	g.start = g.end + 1
+	for g.end = g.start; f.changed(g.end); g.end++ {
+	}
+
+	return true
+}
+
+func (f *file) groupPrevious(g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+
+	g.end = g.start - 1
+	for g.start = g.end; f.changed(g.start - 1); g.start-- {
+	}
+
+	return true
+}
+
+func (f *file) groupSlideDown(g *group) bool {
+	if g.end < len(f.recs) && f.ha[g.start] == f.ha[g.end] {
+		f.setChanged(g.start, false)
+		f.setChanged(g.end, true)
+		g.start++
+		g.end++
+
+		for f.changed(g.end) {
+			g.end++
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func (f *file) groupSlideUp(g *group) bool {
+	if g.start > 0 && f.ha[g.start-1] == f.ha[g.end-1] {
+		g.start--
+		g.end--
+		f.setChanged(g.start, true)
+		f.setChanged(g.end, false)
+
+		for f.changed(g.start - 1) {
+			g.start--
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func indentOf(line string) int {
+	/*
+		-1 for a line of only whitespace
+	*/
+	ret := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			ret++
+		case '\t':
+			ret += 8 - ret%8
+		case '\n', '\v', '\f', '\r':
+		default:
+			return ret
+		}
+
+		if ret >= maxIndent {
+			return maxIndent
+		}
+	}
+
+	return -1
+}
+
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func (f *file) measureSplit(split int) splitMeasurement {
+	m := splitMeasurement{indent: -1, preIndent: -1, postIndent: -1}
+	if split >= len(f.recs) {
+		m.endOfFile = true
+	} else {
+		m.indent = indentOf(f.recs[split])
+	}
+
+	for i := split - 1; i >= 0; i-- {
+		m.preIndent = indentOf(f.recs[i])
+		if m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	for i := split + 1; i < len(f.recs); i++ {
+		m.postIndent = indentOf(f.recs[i])
+		if m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+
+	return m
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+
+	s.effectiveIndent += indent
+
+	pick := func(withBlank int, without int) int {
+		if anyBlanks {
+			return withBlank
+		}
+		return without
+	}
+
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+	case indent > m.preIndent:
+		s.penalty += pick(relativeIndentWithBlankPenalty, relativeIndentPenalty)
+	case m.postIndent != -1 && m.postIndent > indent:
+		s.penalty += pick(relativeOutdentWithBlankPenalty, relativeOutdentPenalty)
+	default:
+		s.penalty += pick(relativeDedentWithBlankPenalty, relativeDedentPenalty)
+	}
+}
+
+func (s splitScore) cmp(other splitScore) int {
+	cmpIndents := 0
+	if s.effectiveIndent > other.effectiveIndent {
+		cmpIndents = 1
+	} else if s.effectiveIndent < other.effectiveIndent {
+		cmpIndents = -1
+	}
+
+	return indentWeight*cmpIndents + (s.penalty - other.penalty)
+}
+
+func (f *file) compact(other *file, indentHeuristic bool) {
+	/*
+		git's xdl_change_compact, every group of changes is slid as far as it goes, merging
+		with its neighbours, then put back in line with a change on the other side or, with the
+		indent heuristic, where the split looks most like a block boundary
+	*/
+	g := f.groupInit()
+	gother := other.groupInit()
+
+	for {
+		if g.end != g.start {
+			var groupSize, earliestEnd, endMatchingOther int
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+
+				for f.groupSlideUp(&g) {
+					other.groupPrevious(&gother)
+				}
+
+				earliestEnd = g.end
+				if gother.end > gother.start {
+					endMatchingOther = g.end
+				}
+
+				for f.groupSlideDown(&g) {
+					other.groupNext(&gother)
+					if gother.end > gother.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+			case endMatchingOther != -1:
+				for gother.end == gother.start {
+					f.groupSlideUp(&g)
+					other.groupPrevious(&gother)
+				}
+			case indentHeuristic:
+				shift := max(earliestEnd, g.end-groupSize-1, g.end-indentHeuristicMaxSliding)
+				bestShift := -1
+				var bestScore splitScore
+
+				for ; shift <= g.end; shift++ {
+					score := splitScore{}
+					score.add(f.measureSplit(shift))
+					score.add(f.measureSplit(shift - groupSize))
+
+					if bestShift == -1 || score.cmp(bestScore) <= 0 {
+						bestScore = score
+						bestShift = shift
+					}
+				}
+
+				for g.end > bestShift {
+					f.groupSlideUp(&g)
+					other.groupPrevious(&gother)
+				}
+			}
+		}
+
+		if !f.groupNext(&g) {
+			break
+		}
+		other.groupNext(&gother)
+	}
+}
@@ -0,0 +1,238 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	Myers     = "myers"
+	Minimal   = "minimal"
+	Patience  = "patience"
+	Histogram = "histogram"
+)
+
+type Options struct {
+	Algorithm        string
+	Context          int
+	InterHunkContext int
+	IndentHeuristic  bool
+	IgnoreWhitespace bool
+}
+
+func DefaultOptions() Options {
+	return Options{Algorithm: Myers, Context: 3, IndentHeuristic: true}
+}
+
+func ParseAlgorithm(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case Myers, "default":
+		return Myers, nil
+	case Minimal, Patience, Histogram:
+		return strings.ToLower(name), nil
+	}
+
+	return "", fmt.Errorf("option diff-algorithm accepts \"myers\", \"minimal\", \"patience\" and \"histogram\"\n")
+}
+
+func IsBinary(data []byte) bool {
+	/*
+		like git, a NUL in the first 8000 bytes makes the data binary
+	*/
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) != -1
+}
+
+func Split(data []byte) []string {
+	/*
+		the lines of data, each keeps its "\n" so a missing newline at the end counts as a change
+	*/
+	ret := []string{}
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			ret = append(ret, string(data))
+			break
+		}
+		ret = append(ret, string(data[:i+1]))
+		data = data[i+1:]
+	}
+
+	return ret
+}
+
+type Change struct {
+	Old      int
+	New      int
+	OldLines int
+	NewLines int
+}
+
+func Diff(a []string, b []string, opts Options) []Change {
+	/*
+		the changed ranges between a and b, 0 based and in order
+	*/
+	e := prepare(a, b, opts.IgnoreWhitespace)
+
+	switch opts.Algorithm {
+	case Patience:
+		e.patience(1, len(a), 1, len(b))
+	case Histogram:
+		e.histogram(1, len(a), 1, len(b))
+	default:
+		e.optimize()
+		e.myers(opts.Algorithm == Minimal)
+	}
+
+	e.a.compact(e.b, opts.IndentHeuristic)
+	e.b.compact(e.a, opts.IndentHeuristic)
+
+	return e.script()
+}
+
+type HunkLine struct {
+	Op   byte
+	Text string
+}
+
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Function string
+	Lines    []HunkLine
+}
+
+func (h Hunk) Header() string {
+	rangeOf := func(start int, count int) string {
+		if count == 0 {
+			return fmt.Sprintf("%d,0", start-1)
+		}
+		if count == 1 {
+			return fmt.Sprintf("%d", start)
+		}
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+
+	header := fmt.Sprintf("@@ -%s +%s @@", rangeOf(h.OldStart, h.OldLines), rangeOf(h.NewStart, h.NewLines))
+	if h.Function != "" {
+		header += " " + h.Function
+	}
+
+	return header
+}
+
+func funcName(line string) string {
+	/*
+		git's default funcname rule, a line starting with a letter, '_' or '$'
+	*/
+	if line == "" {
+		return ""
+	}
+
+	c := line[0]
+	if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$') {
+		return ""
+	}
+
+	return strings.TrimRight(line[:min(len(line), 80)], " \t\n\v\f\r")
+}
+
+func Hunks(a []string, b []string, changes []Change, opts Options) []Hunk {
+	/*
+		groups changes closer than twice the context into hunks, the hunk header names the
+		nearest line above it that looks like a function, carried over from the previous hunk
+		when there is none in between
+	*/
+	ret := []Hunk{}
+	maxCommon := 2*opts.Context + opts.InterHunkContext
+
+	function := ""
+	funcPrev := -1
+	for i := 0; i < len(changes); {
+		last := i
+		for last+1 < len(changes) && changes[last+1].Old-(changes[last].Old+changes[last].OldLines) <= maxCommon {
+			last++
+		}
+		first, end := changes[i], changes[last]
+
+		s1 := max(first.Old-opts.Context, 0)
+		s2 := max(first.New-opts.Context, 0)
+		e1 := min(end.Old+end.OldLines+opts.Context, len(a))
+		e2 := min(end.New+end.NewLines+opts.Context, len(b))
+
+		start := s1 - 1
+		step := 1
+		if start > funcPrev {
+			step = -1
+		}
+		for l := start; l != funcPrev && l >= 0 && l < len(a); l += step {
+			if name := funcName(a[l]); name != "" {
+				function = name
+				break
+			}
+		}
+		funcPrev = start
+
+		hunk := Hunk{OldStart: s1 + 1, OldLines: e1 - s1, NewStart: s2 + 1, NewLines: e2 - s2, Function: function}
+		for ; s2 < first.New; s2++ {
+			hunk.Lines = append(hunk.Lines, HunkLine{Op: ' ', Text: b[s2]})
+		}
+
+		s1, s2 = first.Old, first.New
+		for j := i; j <= last; j++ {
+			c := changes[j]
+			for ; s1 < c.Old && s2 < c.New; s1, s2 = s1+1, s2+1 {
+				hunk.Lines = append(hunk.Lines, HunkLine{Op: ' ', Text: b[s2]})
+			}
+			for s1 = c.Old; s1 < c.Old+c.OldLines; s1++ {
+				hunk.Lines = append(hunk.Lines, HunkLine{Op: '-', Text: a[s1]})
+			}
+			for s2 = c.New; s2 < c.New+c.NewLines; s2++ {
+				hunk.Lines = append(hunk.Lines, HunkLine{Op: '+', Text: b[s2]})
+			}
+		}
+
+		for s2 = end.New + end.NewLines; s2 < e2; s2++ {
+			hunk.Lines = append(hunk.Lines, HunkLine{Op: ' ', Text: b[s2]})
+		}
+
+		ret = append(ret, hunk)
+		i = last + 1
+	}
+
+	return ret
+}
+
+func WriteUnified(w io.Writer, hunks []Hunk) error {
+	/*
+		the hunks without file headers, a last line without newline gets git's marker
+	*/
+	for _, hunk := range hunks {
+		if _, err := fmt.Fprintf(w, "%s\n", hunk.Header()); err != nil {
+			return err
+		}
+
+		for _, line := range hunk.Lines {
+			if _, err := fmt.Fprintf(w, "%c%s", line.Op, line.Text); err != nil {
+				return err
+			}
+			if !strings.HasSuffix(line.Text, "\n") {
+				if _, err := io.WriteString(w, "\n\\ No newline at end of file\n"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func Unified(a []string, b []string, opts Options) string {
+	var buf bytes.Buffer
+	WriteUnified(&buf, Hunks(a, b, Diff(a, b, opts), opts))
+
+	return buf.String()
+}
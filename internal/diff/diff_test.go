@@ -0,0 +1,185 @@
+package diff_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/diff"
+)
+
+func gitUnified(t *testing.T, a string, b string, algorithm string, context string) string {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a")
+	pathB := filepath.Join(dir, "b")
+	if err := os.WriteFile(pathA, []byte(a), 0644); err != nil {
+		t.Fatalf("Failed to write a: %v", err)
+	}
+	if err := os.WriteFile(pathB, []byte(b), 0644); err != nil {
+		t.Fatalf("Failed to write b: %v", err)
+	}
+
+	cmd := exec.Command("git", "diff", "--no-index", "--diff-algorithm="+algorithm, "-U"+context, pathA, pathB)
+	out, _ := cmd.Output()
+
+	_, hunks, _ := strings.Cut(string(out), "\n@@")
+	if hunks == "" {
+		return ""
+	}
+
+	return "@@" + hunks
+}
+
+func TestUnifiedMatchesGit(t *testing.T) {
+	cases := []struct {
+		name string
+		a    string
+		b    string
+	}{
+		{"empty to lines", "", "a\nb\n"},
+		{"lines to empty", "a\nb\n", ""},
+		{"change in the middle", "a\nb\nc\nd\ne\nf\ng\nh\n", "a\nb\nc\nD\ne\nf\ng\nh\n"},
+		{"missing newline", "a\nb", "a\nb\n"},
+		{"two hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"},
+		{"function header", "func a() {\n\tx := 1\n\ty := 2\n\tz := 3\n\treturn\n}\n", "func a() {\n\tx := 1\n\ty := 2\n\tz := 4\n\treturn\n}\n"},
+		{"slider", "if a {\n\tb()\n}\n\nif c {\n\td()\n}\n", "if a {\n\tb()\n}\n\nif x {\n\ty()\n}\n\nif c {\n\td()\n}\n"},
+		{"moved block", "a\nb\nc\nd\ne\nf\ng\n", "e\nf\ng\na\nb\nc\nd\n"},
+		{"repeated lines", "x\ny\nx\ny\nx\nz\n", "y\nx\nz\nx\ny\nx\n"},
+	}
+
+	for _, c := range cases {
+		for _, algorithm := range []string{diff.Myers, diff.Minimal, diff.Patience, diff.Histogram} {
+			for _, context := range []int{0, 1, 3} {
+				opts := diff.DefaultOptions()
+				opts.Algorithm = algorithm
+				opts.Context = context
+
+				got := diff.Unified(diff.Split([]byte(c.a)), diff.Split([]byte(c.b)), opts)
+				exp := gitUnified(t, c.a, c.b, algorithm, strconv.Itoa(context))
+				if got != exp {
+					t.Fatalf("%s with %s -U%d: exp\n%s\ngot\n%s", c.name, algorithm, context, exp, got)
+				}
+			}
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if diff.IsBinary([]byte("plain text\n")) {
+		t.Fatalf("text detected as binary")
+	}
+	if !diff.IsBinary([]byte("a\x00b")) {
+		t.Fatalf("NUL not detected as binary")
+	}
+
+	late := append(bytes.Repeat([]byte("a"), 8000), 0)
+	if diff.IsBinary(late) {
+		t.Fatalf("NUL after 8000 bytes detected as binary")
+	}
+}
+
+func TestWordDiffMatchesGit(t *testing.T) {
+	cases := []struct {
+		name  string
+		a     string
+		b     string
+		regex string
+	}{
+		{"changed word", "a b c\n", "a x c\n", ""},
+		{"added words", "one two\n", "one and two three\n", ""},
+		{"lines joined", "foo bar\nbaz qux\n", "foo bar baz qux\n", ""},
+		{"removed line", "keep this\ndrop that\n", "kept this\n", ""},
+		{"regex", "f(a,b)\n", "f(a,c)\n", "[a-z]+|[^[:space:]]"},
+	}
+
+	for _, c := range cases {
+		for _, mode := range []string{diff.WordsPlain, diff.WordsPorcelain} {
+			dir := t.TempDir()
+			pathA := filepath.Join(dir, "a")
+			pathB := filepath.Join(dir, "b")
+			if err := os.WriteFile(pathA, []byte(c.a), 0644); err != nil {
+				t.Fatalf("Failed to write a: %v", err)
+			}
+			if err := os.WriteFile(pathB, []byte(c.b), 0644); err != nil {
+				t.Fatalf("Failed to write b: %v", err)
+			}
+
+			args := []string{"diff", "--no-index", "--word-diff=" + mode}
+			if c.regex != "" {
+				args = append(args, "--word-diff-regex="+c.regex)
+			}
+			out, _ := exec.Command("git", append(args, pathA, pathB)...).Output()
+			_, exp, _ := strings.Cut(string(out), "@@\n")
+
+			var re *regexp.Regexp
+			if c.regex != "" {
+				var err error
+				if re, err = diff.CompileWordRegex(c.regex); err != nil {
+					t.Fatalf("Failed to compile %s: %v", c.regex, err)
+				}
+			}
+
+			style, err := diff.NewWordStyle(mode)
+			if err != nil {
+				t.Fatalf("Failed to get style: %v", err)
+			}
+
+			var got strings.Builder
+			if err := diff.WriteWordDiff(&got, c.a, c.b, re, style); err != nil {
+				t.Fatalf("Failed to write word diff: %v", err)
+			}
+			if got.String() != exp {
+				t.Fatalf("%s with %s: exp\n%s\ngot\n%s", c.name, mode, exp, got.String())
+			}
+		}
+	}
+}
+
+func TestMerge3MatchesGit(t *testing.T) {
+	cases := []struct {
+		name   string
+		base   string
+		ours   string
+		theirs string
+	}{
+		{"clean", "a\nb\nc\nd\ne\nf\ng\n", "A\nb\nc\nd\ne\nf\ng\n", "a\nb\nc\nd\ne\nf\nG\n"},
+		{"same change", "a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n"},
+		{"conflict", "a\nb\nc\n", "a\nours\nc\n", "a\ntheirs\nc\n"},
+		{"adjacent", "a\nb\nc\nd\n", "a\nB\nc\nd\n", "a\nb\nC\nd\n"},
+		{"refined", "a\nb\nc\nd\ne\n", "a\nx\nc\ny\ne\n", "a\nx\nc\nz\ne\n"},
+		{"common ends", "1\n2\n3\n", "1\nx\nmid\ny\n3\n", "1\nx\nother\ny\n3\n"},
+		{"delete and edit", "a\nb\nc\nd\n", "a\nd\n", "a\nb\nC\nd\n"},
+		{"both add", "", "one\ntwo\n", "one\nthree\n"},
+		{"missing newline", "a\nb", "a\nc", "a\nd"},
+		{"near conflicts", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "x\n2\n3\n4\nx\n6\n7\n8\n9\n", "y\n2\n3\n4\ny\n6\n7\n8\n9\n"},
+	}
+
+	for _, c := range cases {
+		for _, style := range []string{diff.StyleMerge, diff.StyleDiff3, diff.StyleZdiff3} {
+			dir := t.TempDir()
+			paths := []string{filepath.Join(dir, "ours"), filepath.Join(dir, "base"), filepath.Join(dir, "theirs")}
+			for i, content := range []string{c.ours, c.base, c.theirs} {
+				if err := os.WriteFile(paths[i], []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", paths[i], err)
+				}
+			}
+
+			args := []string{"merge-file", "-p", "-L", "ours", "-L", "base", "-L", "theirs"}
+			if style != diff.StyleMerge {
+				args = append(args, "--"+style)
+			}
+			out, _ := exec.Command("git", append(args, paths...)...).Output()
+
+			opts := diff.MergeOptions{Diff: diff.Options{Algorithm: diff.Myers}, Style: style, OursLabel: "ours", BaseLabel: "base", TheirsLabel: "theirs"}
+			got, _ := diff.Merge3(diff.Split([]byte(c.base)), diff.Split([]byte(c.ours)), diff.Split([]byte(c.theirs)), opts)
+			if string(got) != string(out) {
+				t.Fatalf("%s with %s: exp\n%s\ngot\n%s", c.name, style, out, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package diff
+
+const histogramMaxChain = 64
+
+type histogramRecord struct {
+	ptr  int
+	cnt  int
+	next *histogramRecord
+}
+
+type histogramIndex struct {
+	e         *env
+	records   []*histogramRecord
+	lineMap   []*histogramRecord
+	nextPtrs  []int
+	tableBits int
+	ptrShift  int
+	cnt       int
+	hasCommon bool
+}
+
+type region struct {
+	begin1 int
+	end1   int
+	begin2 int
+	end2   int
+}
+
+func hashBits(size int) int {
+	val, bits := 1, 0
+	for ; val < size && bits < 32; bits++ {
+		val <<= 1
+	}
+
+	return max(bits, 1)
+}
+
+func (idx *histogramIndex) tableHash(ha int) int {
+	return (ha + ha>>idx.tableBits) & (1<<idx.tableBits - 1)
+}
+
+func (idx *histogramIndex) scanA(line1 int, count1 int) bool {
+	/*
+		buckets the lines of a by class from the end, so every chain starts at the first
+		occurrence, false when a bucket grows too long
+	*/
+	for ptr := line1 + count1 - 1; line1 <= ptr; ptr-- {
+		bucket := idx.tableHash(idx.e.a.ha[ptr-1])
+
+		chainLen := 0
+		found := false
+		for rec := idx.records[bucket]; rec != nil; rec = rec.next {
+			if idx.e.a.ha[rec.ptr-1] == idx.e.a.ha[ptr-1] {
+				idx.nextPtrs[ptr-idx.ptrShift] = rec.ptr
+				rec.ptr = ptr
+				rec.cnt++
+				idx.lineMap[ptr-idx.ptrShift] = rec
+				found = true
+				break
+			}
+			chainLen++
+		}
+		if found {
+			continue
+		}
+
+		if chainLen == histogramMaxChain {
+			return false
+		}
+
+		rec := &histogramRecord{ptr: ptr, cnt: 1, next: idx.records[bucket]}
+		idx.records[bucket] = rec
+		idx.lineMap[ptr-idx.ptrShift] = rec
+	}
+
+	return true
+}
+
+func (idx *histogramIndex) tryLCS(lcs *region, bPtr int, line1 int, count1 int, line2 int, count2 int) int {
+	/*
+		grows every match of line bPtr of b into a common region, keeping the longest one made
+		of the rarest lines
+	*/
+	a, b := idx.e.a, idx.e.b
+	bNext := bPtr + 1
+	end1, end2 := line1+count1-1, line2+count2-1
+
+	for rec := idx.records[idx.tableHash(b.ha[bPtr-1])]; rec != nil; rec = rec.next {
+		if rec.cnt > idx.cnt {
+			if !idx.hasCommon {
+				idx.hasCommon = a.ha[rec.ptr-1] == b.ha[bPtr-1]
+			}
+			continue
+		}
+
+		as := rec.ptr
+		if a.ha[as-1] != b.ha[bPtr-1] {
+			continue
+		}
+
+		idx.hasCommon = true
+		for {
+			np := idx.nextPtrs[as-idx.ptrShift]
+			bs := bPtr
+			ae := as
+			be := bs
+			rc := rec.cnt
+
+			for line1 < as && line2 < bs && a.ha[as-2] == b.ha[bs-2] {
+				as--
+				bs--
+				if 1 < rc {
+					rc = min(rc, idx.lineMap[as-idx.ptrShift].cnt)
+				}
+			}
+			for ae < end1 && be < end2 && a.ha[ae] == b.ha[be] {
+				ae++
+				be++
+				if 1 < rc {
+					rc = min(rc, idx.lineMap[ae-idx.ptrShift].cnt)
+				}
+			}
+
+			if bNext <= be {
+				bNext = be + 1
+			}
+			if lcs.end1-lcs.begin1 < ae-as || rc < idx.cnt {
+				lcs.begin1, lcs.begin2 = as, bs
+				lcs.end1, lcs.end2 = ae, be
+				idx.cnt = rc
+			}
+
+			if np == 0 {
+				break
+			}
+
+			for np != 0 && np <= ae {
+				np = idx.nextPtrs[np-idx.ptrShift]
+			}
+			if np == 0 {
+				break
+			}
+
+			as = np
+		}
+	}
+
+	return bNext
+}
+
+func (e *env) findLCS(lcs *region, line1 int, count1 int, line2 int, count2 int) (bool, bool) {
+	/*
+		the first result is false when the ranges share only lines that are too frequent, the
+		second when the index could not be built, both mean falling back to myers
+	*/
+	idx := &histogramIndex{
+		e:         e,
+		tableBits: hashBits(count1),
+		lineMap:   make([]*histogramRecord, count1),
+		nextPtrs:  make([]int, count1),
+		ptrShift:  line1,
+	}
+	idx.records = make([]*histogramRecord, 1<<idx.tableBits)
+
+	if !idx.scanA(line1, count1) {
+		return false, false
+	}
+
+	idx.cnt = histogramMaxChain + 1
+	for bPtr := line2; bPtr <= line2+count2-1; {
+		bPtr = idx.tryLCS(lcs, bPtr, line1, count1, line2, count2)
+	}
+
+	return !(idx.hasCommon && histogramMaxChain < idx.cnt), true
+}
+
+func (e *env) histogram(line1 int, count1 int, line2 int, count2 int) {
+	/*
+		git's histogram diff of the 1 based ranges, the longest common region of the rarest
+		lines splits the ranges and both sides are diffed again
+	*/
+	for {
+		if count1 <= 0 && count2 <= 0 {
+			return
+		}
+
+		if count1 == 0 {
+			for i := 0; i < count2; i++ {
+				e.b.setChanged(line2+i-1, true)
+			}
+			return
+		}
+		if count2 == 0 {
+			for i := 0; i < count1; i++ {
+				e.a.setChanged(line1+i-1, true)
+			}
+			return
+		}
+
+		lcs := region{}
+		found, ok := e.findLCS(&lcs, line1, count1, line2, count2)
+		if !ok || !found {
+			e.fallback(line1, count1, line2, count2)
+			return
+		}
+
+		if lcs.begin1 == 0 && lcs.begin2 == 0 {
+			for i := 0; i < count1; i++ {
+				e.a.setChanged(line1+i-1, true)
+			}
+			for i := 0; i < count2; i++ {
+				e.b.setChanged(line2+i-1, true)
+			}
+			return
+		}
+
+		e.histogram(line1, lcs.begin1-line1, line2, lcs.begin2-line2)
+
+		end1, end2 := line1+count1-1, line2+count2-1
+		count1 = end1 - lcs.end1
+		line1 = lcs.end1 + 1
+		count2 = end2 - lcs.end2
+		line2 = lcs.end2 + 1
+	}
+}
@@ -0,0 +1,296 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	StyleMerge  = "merge"
+	StyleDiff3  = "diff3"
+	StyleZdiff3 = "zdiff3"
+
+	FavorOurs   = "ours"
+	FavorTheirs = "theirs"
+	FavorUnion  = "union"
+
+	DefaultMarkerSize = 7
+)
+
+type MergeOptions struct {
+	Diff        Options
+	Style       string
+	Favor       string
+	MarkerSize  int
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
+}
+
+func ParseMergeStyle(name string) (string, error) {
+	switch name {
+	case StyleMerge, StyleDiff3, StyleZdiff3:
+		return name, nil
+	}
+
+	return "", fmt.Errorf("unknown conflict style '%s'\n", name)
+}
+
+/*
+mode of a merge chunk like xdiff's xdmerge_t: 0 is a conflict, 1 takes ours, 2 takes theirs,
+3 takes both and 4 is the same change on both sides
+*/
+type mergeChunk struct {
+	mode int
+	i0   int
+	chg0 int
+	i1   int
+	chg1 int
+	i2   int
+	chg2 int
+}
+
+func appendMerge(chunks []mergeChunk, mode int, i0 int, chg0 int, i1 int, chg1 int, i2 int, chg2 int) []mergeChunk {
+	/*
+		xdl_append_merge, a chunk touching the previous one is folded into it
+	*/
+	if len(chunks) > 0 {
+		m := &chunks[len(chunks)-1]
+		if i1 <= m.i1+m.chg1 || i2 <= m.i2+m.chg2 {
+			if mode != m.mode {
+				m.mode = 0
+			}
+			m.chg0 = i0 + chg0 - m.i0
+			m.chg1 = i1 + chg1 - m.i1
+			m.chg2 = i2 + chg2 - m.i2
+			return chunks
+		}
+	}
+
+	return append(chunks, mergeChunk{mode: mode, i0: i0, chg0: chg0, i1: i1, chg1: chg1, i2: i2, chg2: chg2})
+}
+
+func mergeChunks(base []string, ours []string, theirs []string, opts Options) []mergeChunk {
+	/*
+		xdl_do_merge, walks the changes of both sides against base, a change that overlaps or
+		touches one of the other side is a conflict unless both made the same change, the
+		positions are in base (i0), ours (i1) and theirs (i2)
+	*/
+	x1 := Diff(base, ours, opts)
+	x2 := Diff(base, theirs, opts)
+
+	chunks := []mergeChunk{}
+	a, b := 0, 0
+	for a < len(x1) && b < len(x2) {
+		c1, c2 := x1[a], x2[b]
+
+		if c1.Old+c1.OldLines < c2.Old {
+			chunks = appendMerge(chunks, 1, c1.Old, c1.OldLines, c1.New, c1.NewLines, c2.New-c2.Old+c1.Old, c1.OldLines)
+			a++
+			continue
+		}
+		if c2.Old+c2.OldLines < c1.Old {
+			chunks = appendMerge(chunks, 2, c2.Old, c2.OldLines, c1.New-c1.Old+c2.Old, c2.OldLines, c2.New, c2.NewLines)
+			b++
+			continue
+		}
+
+		same := c1.Old == c2.Old && c1.OldLines == c2.OldLines && c1.NewLines == c2.NewLines &&
+			slices.Equal(ours[c1.New:c1.New+c1.NewLines], theirs[c2.New:c2.New+c2.NewLines])
+		if !same {
+			i0, i1, i2 := c1.Old, c1.New, c2.New
+			if i0 > c2.Old {
+				i1 -= i0 - c2.Old
+				i0 = c2.Old
+			} else {
+				i2 -= c2.Old - i0
+			}
+
+			chg0 := c1.Old + c1.OldLines - i0
+			chg1 := c1.New + c1.NewLines - i1
+			chg2 := c2.New + c2.NewLines - i2
+			if ffo := c1.Old + c1.OldLines - (c2.Old + c2.OldLines); ffo < 0 {
+				chg0 -= ffo
+				chg1 -= ffo
+			} else {
+				chg2 += ffo
+			}
+
+			chunks = appendMerge(chunks, 0, i0, chg0, i1, chg1, i2, chg2)
+		}
+
+		end1, end2 := c1.Old+c1.OldLines, c2.Old+c2.OldLines
+		if end1 >= end2 {
+			b++
+		}
+		if end2 >= end1 {
+			a++
+		}
+	}
+
+	for ; a < len(x1); a++ {
+		c1 := x1[a]
+		chunks = appendMerge(chunks, 1, c1.Old, c1.OldLines, c1.New, c1.NewLines, c1.Old+len(theirs)-len(base), c1.OldLines)
+	}
+	for ; b < len(x2); b++ {
+		c2 := x2[b]
+		chunks = appendMerge(chunks, 2, c2.Old, c2.OldLines, c2.Old+len(ours)-len(base), c2.OldLines, c2.New, c2.NewLines)
+	}
+
+	return chunks
+}
+
+func refineConflicts(chunks []mergeChunk, ours []string, theirs []string, opts Options) []mergeChunk {
+	/*
+		xdl_refine_conflicts, a conflict is diffed between the two sides and only what still
+		differs stays conflicted
+	*/
+	ret := []mergeChunk{}
+	for _, m := range chunks {
+		if m.mode != 0 || m.chg1 == 0 || m.chg2 == 0 {
+			ret = append(ret, m)
+			continue
+		}
+
+		changes := Diff(ours[m.i1:m.i1+m.chg1], theirs[m.i2:m.i2+m.chg2], opts)
+		if len(changes) == 0 {
+			m.mode = 4
+			ret = append(ret, m)
+			continue
+		}
+
+		for _, c := range changes {
+			ret = append(ret, mergeChunk{mode: 0, i0: m.i0, chg0: m.chg0, i1: m.i1 + c.Old, chg1: c.OldLines, i2: m.i2 + c.New, chg2: c.NewLines})
+		}
+	}
+
+	return ret
+}
+
+func simplifyNonConflicts(chunks []mergeChunk) []mergeChunk {
+	/*
+		xdl_simplify_non_conflicts, conflicts separated by three lines or less become one
+	*/
+	ret := []mergeChunk{}
+	for _, m := range chunks {
+		if len(ret) > 0 {
+			last := &ret[len(ret)-1]
+			if last.mode == 0 && m.mode == 0 && m.i1-(last.i1+last.chg1) <= 3 {
+				last.chg0 = m.i0 + m.chg0 - last.i0
+				last.chg1 = m.i1 + m.chg1 - last.i1
+				last.chg2 = m.i2 + m.chg2 - last.i2
+				continue
+			}
+		}
+		ret = append(ret, m)
+	}
+
+	return ret
+}
+
+func refineZdiff3Conflicts(chunks []mergeChunk, ours []string, theirs []string) []mergeChunk {
+	/*
+		xdl_refine_zdiff3_conflicts, lines both sides start or end a conflict with are moved
+		out of it, the base part is kept whole
+	*/
+	for i := range chunks {
+		m := &chunks[i]
+		if m.mode != 0 {
+			continue
+		}
+
+		for m.chg1 > 0 && m.chg2 > 0 && ours[m.i1] == theirs[m.i2] {
+			m.i1, m.i2 = m.i1+1, m.i2+1
+			m.chg1, m.chg2 = m.chg1-1, m.chg2-1
+		}
+		for m.chg1 > 0 && m.chg2 > 0 && ours[m.i1+m.chg1-1] == theirs[m.i2+m.chg2-1] {
+			m.chg1, m.chg2 = m.chg1-1, m.chg2-1
+		}
+	}
+
+	return chunks
+}
+
+func copyLines(b *bytes.Buffer, lines []string, addNewline bool) {
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+	if addNewline && len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		b.WriteString("\n")
+	}
+}
+
+func writeMarker(b *bytes.Buffer, marker byte, size int, label string) {
+	b.WriteString(strings.Repeat(string(marker), size))
+	if label != "" {
+		b.WriteString(" " + label)
+	}
+	b.WriteString("\n")
+}
+
+func Merge3(base []string, ours []string, theirs []string, opts MergeOptions) ([]byte, int) {
+	/*
+		git's xdl_merge, returns the merged text and the number of conflicts left in it
+		opts.Style: default val is StyleMerge, conflicts are refined like git's zealous level
+		except with StyleDiff3 where the base would no longer fit them
+		opts.Favor: default val is "", resolves conflicts to ours, theirs or both
+		opts.MarkerSize: default val is DefaultMarkerSize
+	*/
+	if opts.Style == "" {
+		opts.Style = StyleMerge
+	}
+	if opts.MarkerSize <= 0 {
+		opts.MarkerSize = DefaultMarkerSize
+	}
+
+	chunks := mergeChunks(base, ours, theirs, opts.Diff)
+	switch opts.Style {
+	case StyleZdiff3:
+		chunks = refineZdiff3Conflicts(chunks, ours, theirs)
+	case StyleMerge:
+		chunks = simplifyNonConflicts(refineConflicts(chunks, ours, theirs, opts.Diff))
+	}
+
+	favor := map[string]int{FavorOurs: 1, FavorTheirs: 2, FavorUnion: 3}[opts.Favor]
+
+	var b bytes.Buffer
+	conflicts := 0
+	i := 0
+	for _, m := range chunks {
+		if favor != 0 && m.mode == 0 {
+			m.mode = favor
+		}
+		if m.mode == 4 {
+			continue
+		}
+
+		copyLines(&b, ours[i:m.i1], false)
+		i = m.i1 + m.chg1
+
+		if m.mode != 0 {
+			if m.mode&1 != 0 {
+				copyLines(&b, ours[m.i1:m.i1+m.chg1], m.mode&2 != 0)
+			}
+			if m.mode&2 != 0 {
+				copyLines(&b, theirs[m.i2:m.i2+m.chg2], false)
+			}
+			continue
+		}
+
+		conflicts++
+		writeMarker(&b, '<', opts.MarkerSize, opts.OursLabel)
+		copyLines(&b, ours[m.i1:m.i1+m.chg1], true)
+		if opts.Style == StyleDiff3 || opts.Style == StyleZdiff3 {
+			writeMarker(&b, '|', opts.MarkerSize, opts.BaseLabel)
+			copyLines(&b, base[m.i0:m.i0+m.chg0], true)
+		}
+		writeMarker(&b, '=', opts.MarkerSize, "")
+		copyLines(&b, theirs[m.i2:m.i2+m.chg2], true)
+		writeMarker(&b, '>', opts.MarkerSize, opts.TheirsLabel)
+	}
+	copyLines(&b, ours[i:], false)
+
+	return b.Bytes(), conflicts
+}
@@ -0,0 +1,461 @@
+package diff
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	maxEqLimit    = 1024
+	simscanWindow = 100
+	kpdisRun      = 4
+	maxCostMin    = 256
+	snakeCount    = 20
+	heurMinCost   = 256
+	kHeur         = 4
+)
+
+type file struct {
+	recs []string
+	ha   []int
+	/*
+		changed flags shifted by one, rchg[0] and rchg[len(recs)+1] stay false
+	*/
+	rchg   []bool
+	dstart int
+	dend   int
+	/*
+		the records left for the myers walk after trimming and discarding
+	*/
+	rindex []int
+	reffHa []int
+}
+
+func (f *file) changed(i int) bool {
+	return f.rchg[i+1]
+}
+
+func (f *file) setChanged(i int, changed bool) {
+	f.rchg[i+1] = changed
+}
+
+type env struct {
+	a                *file
+	b                *file
+	countA           map[int]int
+	countB           map[int]int
+	ignoreWhitespace bool
+}
+
+func withoutWhitespace(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\v' || r == '\f' || r == '\r' {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+func prepare(a []string, b []string, ignoreWhitespace bool) *env {
+	/*
+		every distinct line gets a class, numbered in order of first appearance in a then b,
+		lines only differing in whitespace share a class when it is ignored
+	*/
+	classes := map[string]int{}
+	e := &env{countA: map[int]int{}, countB: map[int]int{}, ignoreWhitespace: ignoreWhitespace}
+
+	classify := func(recs []string, count map[int]int) *file {
+		f := &file{recs: recs, ha: make([]int, len(recs)), rchg: make([]bool, len(recs)+2), dstart: 0, dend: len(recs) - 1}
+		for i, rec := range recs {
+			if ignoreWhitespace {
+				rec = withoutWhitespace(rec)
+			}
+			class, ok := classes[rec]
+			if !ok {
+				class = len(classes)
+				classes[rec] = class
+			}
+			f.ha[i] = class
+			count[class]++
+		}
+		return f
+	}
+
+	e.a = classify(a, e.countA)
+	e.b = classify(b, e.countB)
+
+	return e
+}
+
+func bogosqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+
+	return i
+}
+
+func (e *env) optimize() {
+	/*
+		git's xdl_trim_ends and xdl_cleanup_records, the common head and tail are cut and lines
+		without a match on the other side are marked changed before the walk
+	*/
+	a, b := e.a, e.b
+
+	lim := min(len(a.recs), len(b.recs))
+	i := 0
+	for ; i < lim && a.ha[i] == b.ha[i]; i++ {
+	}
+	a.dstart, b.dstart = i, i
+
+	lim -= i
+	for i = 0; i < lim && a.ha[len(a.recs)-1-i] == b.ha[len(b.recs)-1-i]; i++ {
+	}
+	a.dend = len(a.recs) - i - 1
+	b.dend = len(b.recs) - i - 1
+
+	discards := func(f *file, other map[int]int) []int {
+		dis := make([]int, len(f.recs))
+		mlim := min(bogosqrt(len(f.recs)), maxEqLimit)
+		for i := f.dstart; i <= f.dend; i++ {
+			nm := other[f.ha[i]]
+			switch {
+			case nm == 0:
+				dis[i] = 0
+			case nm >= mlim:
+				dis[i] = 2
+			default:
+				dis[i] = 1
+			}
+		}
+		return dis
+	}
+	disA := discards(a, e.countB)
+	disB := discards(b, e.countA)
+
+	keep := func(f *file, dis []int) {
+		for i := f.dstart; i <= f.dend; i++ {
+			if dis[i] == 1 || dis[i] == 2 && !cleanMatch(dis, i, f.dstart, f.dend) {
+				f.rindex = append(f.rindex, i)
+				f.reffHa = append(f.reffHa, f.ha[i])
+			} else {
+				f.setChanged(i, true)
+			}
+		}
+	}
+	keep(a, disA)
+	keep(b, disB)
+}
+
+func cleanMatch(dis []int, i int, s int, e int) bool {
+	/*
+		a line with many matches is discarded only inside a run of lines that have no match
+	*/
+	if i-s > simscanWindow {
+		s = i - simscanWindow
+	}
+	if e-i > simscanWindow {
+		e = i + simscanWindow
+	}
+
+	rdis0, rpdis0 := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			rdis0++
+		} else if dis[i-r] == 2 {
+			rpdis0++
+		} else {
+			break
+		}
+	}
+	if rdis0 == 0 {
+		return false
+	}
+
+	rdis1, rpdis1 := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			rdis1++
+		} else if dis[i+r] == 2 {
+			rpdis1++
+		} else {
+			break
+		}
+	}
+	if rdis1 == 0 {
+		return false
+	}
+	rdis1 += rdis0
+	rpdis1 += rpdis0
+
+	return rpdis1*kpdisRun < rpdis1+rdis1
+}
+
+type myersWalk struct {
+	ha1     []int
+	ha2     []int
+	kv      []int
+	fbase   int
+	bbase   int
+	maxCost int
+}
+
+func (e *env) myers(minimal bool) {
+	/*
+		needs optimize to have picked the records to walk
+	*/
+	a, b := e.a, e.b
+
+	ndiags := len(a.rindex) + len(b.rindex) + 3
+	w := &myersWalk{
+		ha1:     a.reffHa,
+		ha2:     b.reffHa,
+		kv:      make([]int, 2*ndiags+2),
+		fbase:   len(b.rindex) + 1,
+		bbase:   ndiags + len(b.rindex) + 1,
+		maxCost: max(bogosqrt(ndiags), maxCostMin),
+	}
+
+	w.compare(a, 0, len(a.rindex), b, 0, len(b.rindex), minimal)
+}
+
+func (w *myersWalk) compare(a *file, off1 int, lim1 int, b *file, off2 int, lim2 int, minimal bool) {
+	for off1 < lim1 && off2 < lim2 && w.ha1[off1] == w.ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && w.ha1[lim1-1] == w.ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			b.setChanged(b.rindex[off2], true)
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			a.setChanged(a.rindex[off1], true)
+		}
+	default:
+		i1, i2, minLo, minHi := w.split(off1, lim1, off2, lim2, minimal)
+		w.compare(a, off1, i1, b, off2, i2, minLo)
+		w.compare(a, i1, lim1, b, i2, lim2, minHi)
+	}
+}
+
+func (w *myersWalk) split(off1 int, lim1 int, off2 int, lim2 int, minimal bool) (int, int, bool, bool) {
+	/*
+		git's xdl_split, the middle snake of the box, or a good enough split once the cost
+		grows too high unless minimal
+	*/
+	ha1, ha2 := w.ha1, w.ha2
+	kvdf := func(d int) *int { return &w.kv[w.fbase+d] }
+	kvdb := func(d int) *int { return &w.kv[w.bbase+d] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kvdf(fmid) = off1
+	*kvdb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			*kvdf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kvdf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kvdf(d - 1) >= *kvdf(d + 1) {
+				i1 = *kvdf(d - 1) + 1
+			} else {
+				i1 = *kvdf(d + 1)
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > snakeCount {
+				gotSnake = true
+			}
+			*kvdf(d) = i1
+			if odd && bmin <= d && d <= bmax && *kvdb(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			*kvdb(bmin - 1) = math.MaxInt
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kvdb(bmax + 1) = math.MaxInt
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kvdb(d - 1) < *kvdb(d + 1) {
+				i1 = *kvdb(d - 1)
+			} else {
+				i1 = *kvdb(d + 1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > snakeCount {
+				gotSnake = true
+			}
+			*kvdb(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *kvdf(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if minimal {
+			continue
+		}
+
+		if gotSnake && ec > heurMinCost {
+			best, s1, s2 := 0, 0, 0
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+
+				if v > kHeur*ec && v > best && off1+snakeCount <= i1 && i1 < lim1 && off2+snakeCount <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == snakeCount {
+							best, s1, s2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return s1, s2, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+
+				if v > kHeur*ec && v > best && off1 < i1 && i1 <= lim1-snakeCount && off2 < i2 && i2 <= lim2-snakeCount {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == snakeCount-1 {
+							best, s1, s2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return s1, s2, false, true
+			}
+		}
+
+		if ec >= w.maxCost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := min(*kvdf(d), lim1)
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+
+			bbest, bbest1 := math.MaxInt, math.MaxInt
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := max(off1, *kvdb(d))
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
+
+func (e *env) fallback(line1 int, count1 int, line2 int, count2 int) {
+	/*
+		a plain myers diff of the 1 based ranges, with its own classes and trimming
+	*/
+	sub := prepare(e.a.recs[line1-1:line1-1+count1], e.b.recs[line2-1:line2-1+count2], e.ignoreWhitespace)
+	sub.optimize()
+	sub.myers(false)
+
+	copy(e.a.rchg[line1:line1+count1], sub.a.rchg[1:count1+1])
+	copy(e.b.rchg[line2:line2+count2], sub.b.rchg[1:count2+1])
+}
+
+func (e *env) script() []Change {
+	/*
+		collects the runs of changed lines, walking backwards like xdl_build_script
+	*/
+	ret := []Change{}
+	a, b := e.a, e.b
+
+	for i1, i2 := len(a.recs), len(b.recs); i1 > 0 || i2 > 0; i1, i2 = i1-1, i2-1 {
+		if a.rchg[i1] || b.rchg[i2] {
+			l1, l2 := i1, i2
+			for a.rchg[i1] {
+				i1--
+			}
+			for b.rchg[i2] {
+				i2--
+			}
+			ret = append(ret, Change{Old: i1, New: i2, OldLines: l1 - i1, NewLines: l2 - i2})
+		}
+	}
+
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+
+	return ret
+}
@@ -0,0 +1,185 @@
+package diff
+
+const nonUnique = -1
+
+type patienceEntry struct {
+	line1    int
+	line2    int
+	next     *patienceEntry
+	previous *patienceEntry
+}
+
+type patienceMap struct {
+	entries    map[int]*patienceEntry
+	first      *patienceEntry
+	last       *patienceEntry
+	nr         int
+	hasMatches bool
+}
+
+func (e *env) patienceFill(line1 int, count1 int, line2 int, count2 int) *patienceMap {
+	/*
+		the lines of the ranges keyed by class, line2 is nonUnique when the line shows up more
+		than once on either side, the entries are chained in the order of a
+	*/
+	m := &patienceMap{entries: map[int]*patienceEntry{}}
+
+	for line := line1; line < line1+count1; line++ {
+		ha := e.a.ha[line-1]
+		if entry, ok := m.entries[ha]; ok {
+			entry.line2 = nonUnique
+			continue
+		}
+
+		entry := &patienceEntry{line1: line}
+		m.entries[ha] = entry
+		if m.first == nil {
+			m.first = entry
+		}
+		if m.last != nil {
+			m.last.next = entry
+			entry.previous = m.last
+		}
+		m.last = entry
+		m.nr++
+	}
+
+	for line := line2; line < line2+count2; line++ {
+		entry, ok := m.entries[e.b.ha[line-1]]
+		if !ok {
+			continue
+		}
+
+		m.hasMatches = true
+		if entry.line2 != 0 {
+			entry.line2 = nonUnique
+		} else {
+			entry.line2 = line
+		}
+	}
+
+	return m
+}
+
+func (m *patienceMap) longestCommonSequence() *patienceEntry {
+	/*
+		patience sorting of the unique common lines by their line in b, the sequence list keeps
+		the entry with the smallest line2 for every length
+	*/
+	sequence := make([]*patienceEntry, m.nr)
+	longest := 0
+
+	for entry := m.first; entry != nil; entry = entry.next {
+		if entry.line2 == 0 || entry.line2 == nonUnique {
+			continue
+		}
+
+		left, right := -1, longest
+		for left+1 < right {
+			middle := left + (right-left)/2
+			if sequence[middle].line2 > entry.line2 {
+				right = middle
+			} else {
+				left = middle
+			}
+		}
+
+		entry.previous = nil
+		if left >= 0 {
+			entry.previous = sequence[left]
+		}
+		i := left + 1
+		sequence[i] = entry
+		if i == longest {
+			longest++
+		}
+	}
+
+	if longest == 0 {
+		return nil
+	}
+
+	entry := sequence[longest-1]
+	entry.next = nil
+	for entry.previous != nil {
+		entry.previous.next = entry
+		entry = entry.previous
+	}
+
+	return entry
+}
+
+func (e *env) patienceWalk(first *patienceEntry, line1 int, count1 int, line2 int, count2 int) {
+	end1, end2 := line1+count1, line2+count2
+
+	for {
+		var next1, next2 int
+		if first != nil {
+			next1, next2 = first.line1, first.line2
+			for next1 > line1 && next2 > line2 && e.a.ha[next1-2] == e.b.ha[next2-2] {
+				next1--
+				next2--
+			}
+		} else {
+			next1, next2 = end1, end2
+		}
+		for line1 < next1 && line2 < next2 && e.a.ha[line1-1] == e.b.ha[line2-1] {
+			line1++
+			line2++
+		}
+
+		if next1 > line1 || next2 > line2 {
+			e.patience(line1, next1-line1, line2, next2-line2)
+		}
+
+		if first == nil {
+			return
+		}
+
+		for first.next != nil && first.next.line1 == first.line1+1 && first.next.line2 == first.line2+1 {
+			first = first.next
+		}
+
+		line1 = first.line1 + 1
+		line2 = first.line2 + 1
+
+		first = first.next
+	}
+}
+
+func (e *env) patience(line1 int, count1 int, line2 int, count2 int) {
+	/*
+		git's patience diff of the 1 based ranges, the unique lines common to both sides anchor
+		the diff and the gaps between them are diffed on their own, with myers when they share
+		no unique line
+	*/
+	if count1 == 0 {
+		for i := 0; i < count2; i++ {
+			e.b.setChanged(line2+i-1, true)
+		}
+		return
+	}
+	if count2 == 0 {
+		for i := 0; i < count1; i++ {
+			e.a.setChanged(line1+i-1, true)
+		}
+		return
+	}
+
+	m := e.patienceFill(line1, count1, line2, count2)
+	if !m.hasMatches {
+		for i := 0; i < count1; i++ {
+			e.a.setChanged(line1+i-1, true)
+		}
+		for i := 0; i < count2; i++ {
+			e.b.setChanged(line2+i-1, true)
+		}
+		return
+	}
+
+	if first := m.longestCommonSequence(); first != nil {
+		e.patienceWalk(first, line1, count1, line2, count2)
+	} else {
+		e.fallback(line1, count1, line2, count2)
+	}
+}
@@ -0,0 +1,195 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	WordsPlain     = "plain"
+	WordsColor     = "color"
+	WordsPorcelain = "porcelain"
+)
+
+type WordElem struct {
+	Color  string
+	Prefix string
+	Suffix string
+}
+
+type WordStyle struct {
+	New     WordElem
+	Old     WordElem
+	Context WordElem
+	Newline string
+	Reset   string
+}
+
+func NewWordStyle(mode string) (WordStyle, error) {
+	/*
+		the markers of git's word diff modes, the colors are left for the caller
+	*/
+	switch mode {
+	case WordsPlain:
+		return WordStyle{New: WordElem{Prefix: "{+", Suffix: "+}"}, Old: WordElem{Prefix: "[-", Suffix: "-]"}, Newline: "\n"}, nil
+	case WordsColor:
+		return WordStyle{Newline: "\n"}, nil
+	case WordsPorcelain:
+		return WordStyle{New: WordElem{Prefix: "+", Suffix: "\n"}, Old: WordElem{Prefix: "-", Suffix: "\n"}, Context: WordElem{Prefix: " ", Suffix: "\n"}, Newline: "~\n"}, nil
+	}
+
+	return WordStyle{}, fmt.Errorf("bad --word-diff argument: %s\n", mode)
+}
+
+func CompileWordRegex(expr string) (*regexp.Regexp, error) {
+	/*
+		like git's extended regex with REG_NEWLINE, the longest match wins
+	*/
+	re, err := regexp.Compile("(?m)" + expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %s\n", expr)
+	}
+	re.Longest()
+
+	return re, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func splitWords(text string, re *regexp.Regexp) [][2]int {
+	/*
+		the start and end of every word, runs of non space without a regex, otherwise the
+		matches of the regex cut at the first newline, an empty match ends the words
+	*/
+	ret := [][2]int{}
+	for i := 0; i < len(text); i++ {
+		var begin, end int
+		if re != nil {
+			loc := re.FindStringIndex(text[i:])
+			if loc == nil {
+				return ret
+			}
+
+			begin, end = i+loc[0], i+loc[1]
+			if nl := strings.IndexByte(text[begin:end], '\n'); nl != -1 {
+				end = begin + nl
+			}
+			if begin >= end {
+				return ret
+			}
+		} else {
+			begin = i
+			for begin < len(text) && isSpace(text[begin]) {
+				begin++
+			}
+			if begin >= len(text) {
+				return ret
+			}
+
+			end = begin + 1
+			for end < len(text) && !isSpace(text[end]) {
+				end++
+			}
+		}
+
+		ret = append(ret, [2]int{begin, end})
+		i = end - 1
+	}
+
+	return ret
+}
+
+func (style WordStyle) write(w io.Writer, el WordElem, text string) error {
+	/*
+		every line of text gets the markers of el, the newlines in between become
+		style.Newline
+	*/
+	var b strings.Builder
+	for len(text) > 0 {
+		i := strings.IndexByte(text, '\n')
+		if i != 0 {
+			segment := text
+			if i != -1 {
+				segment = text[:i]
+			}
+
+			b.WriteString(el.Color)
+			b.WriteString(el.Prefix + segment + el.Suffix)
+			if el.Color != "" {
+				b.WriteString(style.Reset)
+			}
+		}
+		if i == -1 {
+			break
+		}
+
+		b.WriteString(style.Newline)
+		text = text[i+1:]
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func WriteWordDiff(w io.Writer, minus string, plus string, re *regexp.Regexp, style WordStyle) error {
+	/*
+		git's diff_words_show, the words of the removed and added lines of a hunk are diffed
+		with myers, the text between the words is taken from the added side
+	*/
+	if plus == "" {
+		return style.write(w, style.Old, minus)
+	}
+
+	spansMinus, spansPlus := splitWords(minus, re), splitWords(plus, re)
+	wordsMinus, wordsPlus := []string{}, []string{}
+	for _, span := range spansMinus {
+		wordsMinus = append(wordsMinus, minus[span[0]:span[1]]+"\n")
+	}
+	for _, span := range spansPlus {
+		wordsPlus = append(wordsPlus, plus[span[0]:span[1]]+"\n")
+	}
+
+	bounds := func(spans [][2]int, first int, count int) (int, int) {
+		if count > 0 {
+			return spans[first][0], spans[first+count-1][1]
+		}
+		if first == 0 {
+			return 0, 0
+		}
+		return spans[first-1][1], spans[first-1][1]
+	}
+
+	current := 0
+	for _, c := range Diff(wordsMinus, wordsPlus, Options{Algorithm: Myers}) {
+		minusBegin, minusEnd := bounds(spansMinus, c.Old, c.OldLines)
+		plusBegin, plusEnd := bounds(spansPlus, c.New, c.NewLines)
+
+		if current != plusBegin {
+			if err := style.write(w, style.Context, plus[current:plusBegin]); err != nil {
+				return err
+			}
+		}
+		if minusBegin != minusEnd {
+			if err := style.write(w, style.Old, minus[minusBegin:minusEnd]); err != nil {
+				return err
+			}
+		}
+		if plusBegin != plusEnd {
+			if err := style.write(w, style.New, plus[plusBegin:plusEnd]); err != nil {
+				return err
+			}
+		}
+
+		current = plusEnd
+	}
+
+	if current != len(plus) {
+		return style.write(w, style.Context, plus[current:])
+	}
+
+	return nil
+}
@@ -0,0 +1,398 @@
+package repository
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+	"time"
+)
+
+func (repo *Repository) CommitRead(sha string) (*GitCommit, error) {
+	obj, err := repo.ObjectRead(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, ok := obj.(*GitCommit)
+	if !ok {
+		objFmt, _ := obj.GetFmt()
+		return nil, fmt.Errorf("expected commit for sha:%s got:%s\n", sha, string(objFmt))
+	}
+
+	return commit, nil
+}
+
+func (repo *Repository) CommitParents(sha string) ([]string, error) {
+	commit, err := repo.CommitRead(sha)
+	if err != nil {
+		return []string{}, err
+	}
+
+	parents := []string{}
+	for _, p := range (*(*commit.Kvlm).Map)["parent"] {
+		parents = append(parents, string(p))
+	}
+
+	return parents, nil
+}
+
+func (repo *Repository) IsAncestor(ancestor string, descendant string) (bool, error) {
+	/*
+		a commit is its own ancestor, with a commit graph the walk stops below the
+		generation of ancestor
+	*/
+	minGen := repo.CommitGeneration(ancestor)
+	if minGen != generationInfinity && repo.CommitGeneration(descendant) < minGen {
+		return false, nil
+	}
+
+	seen := map[string]bool{}
+	queue := []string{descendant}
+
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+
+		if sha == ancestor {
+			return true, nil
+		}
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+
+		if minGen != generationInfinity && repo.CommitGeneration(sha) < minGen {
+			continue
+		}
+
+		parents, err := repo.CommitParents(sha)
+		if err != nil {
+			return false, err
+		}
+		queue = append(queue, parents...)
+	}
+
+	return false, nil
+}
+
+const (
+	paintParent1 = 1 << iota
+	paintParent2
+	paintStale
+	paintResult
+)
+
+type paintCommit struct {
+	sha     string
+	parents []string
+	date    time.Time
+	gen     uint64
+	flags   int
+	seq     int
+}
+
+type paintQueue []*paintCommit
+
+func (q paintQueue) Len() int { return len(q) }
+func (q paintQueue) Less(i, j int) bool {
+	if q[i].gen != q[j].gen {
+		return q[i].gen > q[j].gen
+	}
+	if !q[i].date.Equal(q[j].date) {
+		return q[i].date.After(q[j].date)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q paintQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *paintQueue) Push(x any)   { *q = append(*q, x.(*paintCommit)) }
+func (q *paintQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+func (q paintQueue) hasNonStale() bool {
+	for _, c := range q {
+		if c.flags&paintStale == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+type paintWalk struct {
+	repo    *Repository
+	commits map[string]*paintCommit
+	seq     int
+}
+
+func (p *paintWalk) commit(sha string) (*paintCommit, error) {
+	if c, ok := p.commits[sha]; ok {
+		return c, nil
+	}
+
+	commit, err := p.repo.CommitRead(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &paintCommit{sha: sha, gen: p.repo.CommitGeneration(sha)}
+	for _, parent := range (*(*commit.Kvlm).Map)["parent"] {
+		c.parents = append(c.parents, string(parent))
+	}
+	if committer, ok := (*(*commit.Kvlm).Map)["committer"]; ok && len(committer) > 0 {
+		if sig, err := ParseSignature(committer[0]); err == nil {
+			c.date = sig.When
+		}
+	}
+
+	p.commits[sha] = c
+	return c, nil
+}
+
+func (p *paintWalk) push(queue *paintQueue, c *paintCommit) {
+	c.seq = p.seq
+	p.seq++
+	heap.Push(queue, c)
+}
+
+func insertByDate(list []*paintCommit, c *paintCommit) []*paintCommit {
+	/*
+		newest first, a commit goes after the ones with the same date
+	*/
+	i := 0
+	for i < len(list) && !list[i].date.Before(c.date) {
+		i++
+	}
+
+	return slices.Insert(list, i, c)
+}
+
+func (p *paintWalk) paintDownToCommon(one string, twos []string) ([]*paintCommit, error) {
+	/*
+		git's paint_down_to_common, everything reachable from one is painted PARENT1 and from
+		twos PARENT2, a commit with both colors is a candidate and its ancestors become stale
+	*/
+	queue := &paintQueue{}
+
+	c, err := p.commit(one)
+	if err != nil {
+		return nil, err
+	}
+	c.flags |= paintParent1
+	p.push(queue, c)
+
+	for _, two := range twos {
+		c, err := p.commit(two)
+		if err != nil {
+			return nil, err
+		}
+		c.flags |= paintParent2
+		p.push(queue, c)
+	}
+
+	result := []*paintCommit{}
+	for queue.hasNonStale() {
+		c := heap.Pop(queue).(*paintCommit)
+
+		flags := c.flags & (paintParent1 | paintParent2 | paintStale)
+		if flags == paintParent1|paintParent2 {
+			if c.flags&paintResult == 0 {
+				c.flags |= paintResult
+				result = insertByDate(result, c)
+			}
+			flags |= paintStale
+		}
+
+		for _, sha := range c.parents {
+			parent, err := p.commit(sha)
+			if err != nil {
+				return nil, err
+			}
+			if parent.flags&flags == flags {
+				continue
+			}
+			parent.flags |= flags
+			p.push(queue, parent)
+		}
+	}
+
+	return result, nil
+}
+
+func (repo *Repository) removeRedundant(commits []string) ([]string, error) {
+	/*
+		drops the commits that are an ancestor of another one in the list, keeps the order
+	*/
+	ret := []string{}
+	for i, sha := range commits {
+		redundant := false
+		for j, other := range commits {
+			if i == j || sha == other {
+				if sha == other && j < i {
+					redundant = true
+				}
+				continue
+			}
+
+			ok, err := repo.IsAncestor(sha, other)
+			if err != nil {
+				return []string{}, err
+			}
+			if ok {
+				redundant = true
+				break
+			}
+		}
+
+		if !redundant {
+			ret = append(ret, sha)
+		}
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) MergeBasesMany(one string, twos []string) ([]string, error) {
+	/*
+		the best common ancestors of one and a merge of all twos, newest first
+	*/
+	for _, two := range twos {
+		if one == two {
+			return []string{one}, nil
+		}
+	}
+
+	p := &paintWalk{repo: repo, commits: map[string]*paintCommit{}}
+	painted, err := p.paintDownToCommon(one, twos)
+	if err != nil {
+		return []string{}, err
+	}
+
+	candidates := []*paintCommit{}
+	for _, c := range painted {
+		if c.flags&paintStale == 0 {
+			candidates = insertByDate(candidates, c)
+		}
+	}
+
+	if len(candidates) <= 1 {
+		ret := []string{}
+		for _, c := range candidates {
+			ret = append(ret, c.sha)
+		}
+		return ret, nil
+	}
+
+	shas := []string{}
+	for _, c := range candidates {
+		shas = append(shas, c.sha)
+	}
+	shas, err = repo.removeRedundant(shas)
+	if err != nil {
+		return []string{}, err
+	}
+
+	ret := []*paintCommit{}
+	for _, sha := range shas {
+		ret = insertByDate(ret, p.commits[sha])
+	}
+
+	shas = []string{}
+	for _, c := range ret {
+		shas = append(shas, c.sha)
+	}
+
+	return shas, nil
+}
+
+func (repo *Repository) MergeBases(a string, b string) ([]string, error) {
+	return repo.MergeBasesMany(a, []string{b})
+}
+
+func (repo *Repository) ReduceHeads(commits []string) ([]string, error) {
+	/*
+		the commits that are not reachable from another one, duplicates removed
+	*/
+	return repo.removeRedundant(commits)
+}
+
+func (repo *Repository) OctopusMergeBases(commits []string) ([]string, error) {
+	/*
+		folds the commits in one at a time, the bases so far against the next commit
+	*/
+	if len(commits) == 0 {
+		return []string{}, nil
+	}
+
+	ret := []string{commits[0]}
+	for _, next := range commits[1:] {
+		bases := []string{}
+		for _, sha := range ret {
+			found, err := repo.MergeBases(next, sha)
+			if err != nil {
+				return []string{}, err
+			}
+			bases = append(bases, found...)
+		}
+		ret = bases
+	}
+
+	return repo.ReduceHeads(ret)
+}
+
+func (repo *Repository) ForkPoint(ref string, commit string) (string, error) {
+	/*
+		the point where commit forked from ref, looking at every value ref had in its reflog,
+		"" when there is none
+	*/
+	name := repo.RefDwim(ref)
+	if name == "" {
+		return "", fmt.Errorf("No such ref: '%s'\n", ref)
+	}
+
+	entries, err := repo.ReflogRead(name)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{}
+	add := func(sha string) {
+		if sha == "" || sha == nullSha {
+			return
+		}
+		sha, err := repo.ObjectPeelTo(sha, "commit")
+		if err != nil || slices.Contains(candidates, sha) {
+			return
+		}
+		candidates = append(candidates, sha)
+	}
+
+	for i, entry := range entries {
+		if i == 0 {
+			add(entry.Old)
+		}
+		add(entry.New)
+	}
+
+	if len(candidates) == 0 {
+		sha, err := repo.RefResolve(name)
+		if err != nil {
+			return "", err
+		}
+		add(sha)
+	}
+
+	bases, err := repo.MergeBasesMany(commit, candidates)
+	if err != nil {
+		return "", err
+	}
+
+	if len(bases) != 1 || !slices.Contains(candidates, bases[0]) {
+		return "", nil
+	}
+
+	return bases[0], nil
+}
@@ -0,0 +1,933 @@
+package repository
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/neet-007/git_in_go/internal/diff"
+)
+
+const DefaultBlameMoveScore = 20
+
+type BlameOptions struct {
+	Ranges           []string
+	IgnoreWhitespace bool
+	Moves            bool
+	MoveScore        int
+	Porcelain        bool
+}
+
+type blameCommit struct {
+	sha      string
+	commit   *GitCommit
+	tree     string
+	parents  []string
+	date     int64
+	origins  []*blameOrigin
+	boundary bool
+	shown    bool
+}
+
+type blameOrigin struct {
+	commit   *blameCommit
+	entry    DiffEntry
+	lines    []string
+	loaded   bool
+	suspects []*blameEntry
+	previous *blameOrigin
+	guilty   bool
+}
+
+type blameEntry struct {
+	lno      int
+	numLines int
+	sLno     int
+	suspect  *blameOrigin
+}
+
+type blameQueueItem struct {
+	commit *blameCommit
+	order  int
+}
+
+type blameQueue []blameQueueItem
+
+func (q blameQueue) Len() int { return len(q) }
+func (q blameQueue) Less(i, j int) bool {
+	if q[i].commit.date != q[j].commit.date {
+		return q[i].commit.date > q[j].commit.date
+	}
+	return q[i].order < q[j].order
+}
+func (q blameQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *blameQueue) Push(x any)   { *q = append(*q, x.(blameQueueItem)) }
+func (q *blameQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+type blameScoreboard struct {
+	repo     *Repository
+	opts     BlameOptions
+	diffOpts diff.Options
+	path     string
+	final    []string
+	commits  map[string]*blameCommit
+	queue    blameQueue
+	pushed   int
+	entries  []*blameEntry
+}
+
+func (sb *blameScoreboard) commit(sha string) (*blameCommit, error) {
+	if c, ok := sb.commits[sha]; ok {
+		return c, nil
+	}
+
+	commit, err := sb.repo.CommitRead(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &blameCommit{sha: sha, commit: commit, tree: commitTree(commit), date: commitSignature(commit, "committer").When.Unix()}
+	for _, p := range (*(*commit.Kvlm).Map)["parent"] {
+		c.parents = append(c.parents, string(p))
+	}
+
+	sb.commits[sha] = c
+	return c, nil
+}
+
+func (sb *blameScoreboard) origin(c *blameCommit, entry DiffEntry) *blameOrigin {
+	/*
+		one origin per commit and path, like git the last one asked for moves to the front
+	*/
+	for i, o := range c.origins {
+		if o.entry.Path == entry.Path {
+			copy(c.origins[1:i+1], c.origins[:i])
+			c.origins[0] = o
+			return o
+		}
+	}
+
+	o := &blameOrigin{commit: c, entry: entry}
+	c.origins = append([]*blameOrigin{o}, c.origins...)
+	return o
+}
+
+func (sb *blameScoreboard) load(o *blameOrigin) error {
+	if o.loaded {
+		return nil
+	}
+
+	data, err := sb.repo.diffContent(o.entry)
+	if err != nil {
+		return err
+	}
+
+	o.lines = diff.Split(data)
+	o.loaded = true
+	return nil
+}
+
+func (sb *blameScoreboard) push(c *blameCommit) {
+	heap.Push(&sb.queue, blameQueueItem{commit: c, order: sb.pushed})
+	sb.pushed++
+}
+
+func (sb *blameScoreboard) queueBlames(porigin *blameOrigin, sorted []*blameEntry) {
+	/*
+		a commit goes into the queue when none of its origins had anything to blame yet
+	*/
+	if len(porigin.suspects) > 0 {
+		porigin.suspects = append(porigin.suspects, sorted...)
+		slices.SortStableFunc(porigin.suspects, func(a *blameEntry, b *blameEntry) int {
+			return a.sLno - b.sLno
+		})
+		return
+	}
+
+	for _, o := range porigin.commit.origins {
+		if len(o.suspects) > 0 {
+			porigin.suspects = sorted
+			return
+		}
+	}
+
+	porigin.suspects = sorted
+	sb.push(porigin.commit)
+}
+
+func (sb *blameScoreboard) findOrigin(parent *blameCommit, origin *blameOrigin) (*blameOrigin, error) {
+	/*
+		the same path in parent, nil when it is missing there or is not the same kind of file
+	*/
+	for _, o := range parent.origins {
+		if o.entry.Path == origin.entry.Path {
+			return o, nil
+		}
+	}
+
+	leaf, err := sb.repo.TreePathLookup(parent.tree, origin.entry.Path)
+	if err != nil || string(leaf.Mode[:2]) == "04" {
+		return nil, nil
+	}
+
+	mode := string(leaf.Mode)
+	if diffModeType(mode) != diffModeType(origin.entry.Mode) {
+		return nil, nil
+	}
+
+	return sb.origin(parent, DiffEntry{Path: origin.entry.Path, Mode: mode, Sha: leaf.Sha}), nil
+}
+
+func (sb *blameScoreboard) findRename(parent *blameCommit, origin *blameOrigin) (*blameOrigin, error) {
+	/*
+		the file of parent that was renamed to the path of origin, the deleted files are the
+		only candidates like with git's single follow
+	*/
+	before, err := sb.repo.DiffTreeEntries(parent.tree)
+	if err != nil {
+		return nil, err
+	}
+
+	after := map[string]DiffEntry{}
+	if origin.commit.commit != nil {
+		if after, err = sb.repo.DiffTreeEntries(origin.commit.tree); err != nil {
+			return nil, err
+		}
+	} else {
+		index, err := sb.repo.IndexRead()
+		if err != nil {
+			return nil, err
+		}
+		after = sb.repo.DiffIndexEntries(index)
+		after[origin.entry.Path] = origin.entry
+	}
+
+	candidates := []DiffFilePair{}
+	for _, pair := range DiffPairs(before, after, nil) {
+		if pair.Status == 'D' || pair.Status == 'A' && pair.New.Path == origin.entry.Path {
+			candidates = append(candidates, pair)
+		}
+	}
+
+	pairs, err := sb.repo.DiffRenames(candidates, false, DefaultRenameScore)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pair := range pairs {
+		if pair.Status == 'R' && pair.New.Path == origin.entry.Path {
+			return sb.origin(parent, pair.Old), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (sb *blameScoreboard) passWhole(origin *blameOrigin, porigin *blameOrigin) {
+	suspects := origin.suspects
+	origin.suspects = nil
+	for _, e := range suspects {
+		e.suspect = porigin
+	}
+
+	sb.queueBlames(porigin, suspects)
+}
+
+func (sb *blameScoreboard) passToParent(target *blameOrigin, parent *blameOrigin) error {
+	/*
+		the lines of target that did not change against parent are passed on, split where the
+		entries cross the edges of the changes
+	*/
+	if len(target.suspects) == 0 {
+		return nil
+	}
+	if err := sb.load(parent); err != nil {
+		return err
+	}
+	if err := sb.load(target); err != nil {
+		return err
+	}
+
+	type region struct {
+		start  int
+		end    int
+		offset int
+		same   bool
+	}
+	regions := []region{}
+	start, offset := 0, 0
+	for _, c := range diff.Diff(parent.lines, target.lines, sb.diffOpts) {
+		regions = append(regions, region{start, c.New, c.Old - c.New, true}, region{c.New, c.New + c.NewLines, 0, false})
+		start = c.New + c.NewLines
+		offset = c.Old + c.OldLines - start
+	}
+	regions = append(regions, region{start, len(target.lines) + 1, offset, true})
+
+	passed, kept := []*blameEntry{}, []*blameEntry{}
+	for _, e := range target.suspects {
+		for _, r := range regions {
+			from, to := max(e.sLno, r.start), min(e.sLno+e.numLines, r.end)
+			if from >= to {
+				continue
+			}
+
+			piece := &blameEntry{lno: e.lno + from - e.sLno, numLines: to - from, sLno: from, suspect: target}
+			if r.same {
+				piece.sLno += r.offset
+				piece.suspect = parent
+				passed = append(passed, piece)
+			} else {
+				kept = append(kept, piece)
+			}
+		}
+	}
+
+	target.suspects = kept
+	slices.SortStableFunc(passed, func(a *blameEntry, b *blameEntry) int {
+		return a.sLno - b.sLno
+	})
+	sb.queueBlames(parent, passed)
+
+	return nil
+}
+
+func (sb *blameScoreboard) entryScore(e *blameEntry) int {
+	/*
+		git's blame_entry_score, one more than the alphanumeric chars of the lines
+	*/
+	score := 1
+	for _, line := range sb.final[e.lno : e.lno+e.numLines] {
+		for i := 0; i < len(line); i++ {
+			if c := line[i]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+				score++
+			}
+		}
+	}
+
+	return score
+}
+
+func (sb *blameScoreboard) filterSmall(entries []*blameEntry) ([]*blameEntry, []*blameEntry) {
+	small, rest := []*blameEntry{}, []*blameEntry{}
+	for _, e := range entries {
+		if sb.entryScore(e) <= sb.opts.MoveScore {
+			small = append(small, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+
+	return small, rest
+}
+
+func splitOverlap(e *blameEntry, tlno int, plno int, same int, parent *blameOrigin) [3]*blameEntry {
+	/*
+		git's split_overlap, the lines of e from tlno up to same match parent from plno, the
+		parts before and after stay with e
+	*/
+	var split [3]*blameEntry
+	middle := &blameEntry{}
+
+	if e.sLno < tlno {
+		split[0] = &blameEntry{lno: e.lno, sLno: e.sLno, numLines: tlno - e.sLno, suspect: e.suspect}
+		middle.lno = e.lno + tlno - e.sLno
+		middle.sLno = plno
+	} else {
+		middle.lno = e.lno
+		middle.sLno = plno + e.sLno - tlno
+	}
+
+	end := e.lno + e.numLines
+	if same < e.sLno+e.numLines {
+		split[2] = &blameEntry{lno: e.lno + same - e.sLno, sLno: same, numLines: e.sLno + e.numLines - same, suspect: e.suspect}
+		end = split[2].lno
+	}
+	middle.numLines = end - middle.lno
+
+	if middle.numLines < 1 {
+		return [3]*blameEntry{}
+	}
+	middle.suspect = parent
+	split[1] = middle
+
+	return split
+}
+
+func (sb *blameScoreboard) findCopyInBlob(e *blameEntry, parent *blameOrigin) [3]*blameEntry {
+	/*
+		the best stretch of parent matching the lines of e, by their score
+	*/
+	var best [3]*blameEntry
+	handle := func(tlno int, plno int, same int) {
+		if e.numLines <= tlno || tlno >= same {
+			return
+		}
+
+		potential := splitOverlap(e, tlno+e.sLno, plno, same+e.sLno, parent)
+		if potential[1] == nil {
+			return
+		}
+		if best[1] != nil && sb.entryScore(potential[1]) < sb.entryScore(best[1]) {
+			return
+		}
+		best = potential
+	}
+
+	tlno, plno := 0, 0
+	for _, c := range diff.Diff(parent.lines, sb.final[e.lno:e.lno+e.numLines], sb.diffOpts) {
+		handle(tlno, plno, c.New)
+		plno = c.Old + c.OldLines
+		tlno = c.New + c.NewLines
+	}
+	handle(tlno, plno, e.numLines)
+
+	return best
+}
+
+func (sb *blameScoreboard) findMoveInParent(blamed *[]*blameEntry, toosmall *[]*blameEntry, target *blameOrigin, parent *blameOrigin) error {
+	/*
+		git's find_move_in_parent, lines still blamed on target that moved within the file of
+		parent, what is left of a matched entry is tried again
+	*/
+	unblamed := target.suspects
+	if len(unblamed) == 0 {
+		return nil
+	}
+	if err := sb.load(parent); err != nil {
+		return err
+	}
+
+	leftover := []*blameEntry{}
+	for len(unblamed) > 0 {
+		again := []*blameEntry{}
+		for _, e := range unblamed {
+			split := sb.findCopyInBlob(e, parent)
+			if split[1] == nil || sb.opts.MoveScore >= sb.entryScore(split[1]) {
+				leftover = append(leftover, e)
+				continue
+			}
+
+			*blamed = append(*blamed, split[1])
+			for _, part := range []*blameEntry{split[0], split[2]} {
+				if part != nil {
+					again = append(again, part)
+				}
+			}
+		}
+
+		small, rest := sb.filterSmall(again)
+		*toosmall = append(*toosmall, small...)
+		unblamed = rest
+	}
+
+	target.suspects = leftover
+	return nil
+}
+
+func (sb *blameScoreboard) pass(origin *blameOrigin) error {
+	/*
+		git's pass_blame, the parents are first searched for the same path and then for a
+		rename, a parent with the same blob takes all of the blame
+	*/
+	c := origin.commit
+	porigins := make([]*blameOrigin, len(c.parents))
+	blamed, toosmall := []*blameEntry{}, []*blameEntry{}
+
+	for pass := 0; pass < 2; pass++ {
+		for i, sha := range c.parents {
+			if porigins[i] != nil {
+				continue
+			}
+
+			parent, err := sb.commit(sha)
+			if err != nil {
+				return err
+			}
+
+			var porigin *blameOrigin
+			if pass == 0 {
+				porigin, err = sb.findOrigin(parent, origin)
+			} else {
+				porigin, err = sb.findRename(parent, origin)
+			}
+			if err != nil {
+				return err
+			}
+			if porigin == nil {
+				continue
+			}
+
+			if porigin.entry.Sha == origin.entry.Sha {
+				sb.passWhole(origin, porigin)
+				return nil
+			}
+
+			same := false
+			for j := 0; j < i; j++ {
+				if porigins[j] != nil && porigins[j].entry.Sha == porigin.entry.Sha {
+					same = true
+					break
+				}
+			}
+			if !same {
+				porigins[i] = porigin
+			}
+		}
+	}
+
+	for _, porigin := range porigins {
+		if porigin == nil {
+			continue
+		}
+		if origin.previous == nil {
+			origin.previous = porigin
+		}
+
+		if err := sb.passToParent(origin, porigin); err != nil {
+			return err
+		}
+		if len(origin.suspects) == 0 {
+			break
+		}
+	}
+
+	if sb.opts.Moves && len(origin.suspects) > 0 {
+		toosmall, origin.suspects = sb.filterSmall(origin.suspects)
+		for _, porigin := range porigins {
+			if len(origin.suspects) == 0 {
+				break
+			}
+			if porigin == nil {
+				continue
+			}
+
+			if err := sb.findMoveInParent(&blamed, &toosmall, origin, porigin); err != nil {
+				return err
+			}
+		}
+	}
+
+	for len(blamed) > 0 {
+		porigin := blamed[0].suspect
+		mine, rest := []*blameEntry{}, []*blameEntry{}
+		for _, e := range blamed {
+			if e.suspect == porigin {
+				mine = append(mine, e)
+			} else {
+				rest = append(rest, e)
+			}
+		}
+
+		slices.SortStableFunc(mine, func(a *blameEntry, b *blameEntry) int {
+			return a.sLno - b.sLno
+		})
+		sb.queueBlames(porigin, mine)
+		blamed = rest
+	}
+
+	origin.suspects = append(toosmall, origin.suspects...)
+	return nil
+}
+
+func (sb *blameScoreboard) assign() error {
+	/*
+		newest commits first, whatever a commit cannot pass on to its parents is its own
+	*/
+	for sb.queue.Len() > 0 {
+		c := heap.Pop(&sb.queue).(blameQueueItem).commit
+
+		for {
+			var suspect *blameOrigin
+			for _, o := range c.origins {
+				if len(o.suspects) > 0 {
+					suspect = o
+					break
+				}
+			}
+			if suspect == nil {
+				break
+			}
+
+			if !c.boundary {
+				if err := sb.pass(suspect); err != nil {
+					return err
+				}
+			}
+			if len(c.parents) == 0 {
+				c.boundary = true
+			}
+
+			if len(suspect.suspects) > 0 {
+				suspect.guilty = true
+				sb.entries = append(sb.entries, suspect.suspects...)
+				suspect.suspects = nil
+			}
+		}
+	}
+
+	slices.SortFunc(sb.entries, func(a *blameEntry, b *blameEntry) int {
+		return a.lno - b.lno
+	})
+
+	ret := []*blameEntry{}
+	for _, e := range sb.entries {
+		if len(ret) > 0 {
+			last := ret[len(ret)-1]
+			if last.suspect == e.suspect && last.sLno+last.numLines == e.sLno && last.lno+last.numLines == e.lno {
+				last.numLines += e.numLines
+				continue
+			}
+		}
+		ret = append(ret, e)
+	}
+	sb.entries = ret
+
+	return nil
+}
+
+func parseBlameRange(arg string, lines int, path string) (int, int, error) {
+	/*
+		"start,end", "start,+count", "start,-count", "start" or "start," up to the end or ",end"
+		from the first line, 1 based and inclusive like git, returned 0 based and exclusive
+	*/
+	number := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid -L argument '%s'\n", arg)
+		}
+		return n, nil
+	}
+
+	begin, end, hasEnd := strings.Cut(arg, ",")
+	bottom, top := 1, 0
+	var err error
+	if begin != "" || !hasEnd {
+		if bottom, err = number(begin); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	switch {
+	case !hasEnd, end == "":
+	case strings.HasPrefix(end, "+"):
+		n, err := number(end[1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		top = bottom + max(n, 1) - 1
+	case strings.HasPrefix(end, "-"):
+		n, err := number(end[1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		top = bottom
+		bottom = max(bottom-max(n, 1)+1, 1)
+	default:
+		if top, err = number(end); err != nil {
+			return 0, 0, err
+		}
+		if top != 0 && top < bottom {
+			bottom, top = top, bottom
+		}
+	}
+
+	if lines < top || (lines > 0 || bottom > 0) && lines < bottom {
+		if lines == 1 {
+			return 0, 0, fmt.Errorf("file %s has only %d line\n", path, lines)
+		}
+		return 0, 0, fmt.Errorf("file %s has only %d lines\n", path, lines)
+	}
+
+	if bottom < 1 {
+		bottom = 1
+	}
+	if top < 1 || lines < top {
+		top = lines
+	}
+
+	return bottom - 1, top, nil
+}
+
+func (repo *Repository) blameWorktreeCommit(path string) (*blameCommit, DiffEntry, error) {
+	/*
+		git's fake commit for the worktree, its parents are HEAD and during a merge the
+		MERGE_HEAD commits, it is dated now
+	*/
+	index, err := repo.IndexRead()
+	if err != nil {
+		return nil, DiffEntry{}, err
+	}
+
+	entries, err := repo.DiffWorktreeEntries(index)
+	if err != nil {
+		return nil, DiffEntry{}, err
+	}
+
+	entry, ok := entries[path]
+	if !ok {
+		entry, err = repo.blameUntrackedEntry(path)
+		if err != nil {
+			return nil, DiffEntry{}, err
+		}
+	}
+
+	c := &blameCommit{sha: nullSha, date: time.Now().Unix()}
+	if head, err := repo.ObjectFind("HEAD", "commit", true); err == nil {
+		c.parents = []string{head}
+	}
+
+	heads, err := repo.MergeHeads()
+	if err != nil {
+		return nil, DiffEntry{}, err
+	}
+	c.parents = append(c.parents, heads...)
+
+	return c, entry, nil
+}
+
+func (repo *Repository) blameUntrackedEntry(path string) (DiffEntry, error) {
+	sha, err := repo.worktreeFileSha(path)
+	if err != nil {
+		return DiffEntry{}, fmt.Errorf("no such path '%s' in the working tree\n", path)
+	}
+
+	return DiffEntry{Path: path, Mode: "100644", Sha: sha, worktree: true}, nil
+}
+
+func (repo *Repository) Blame(w io.Writer, rev string, path string, opts BlameOptions) error {
+	/*
+		rev: default val is "", the worktree with HEAD as its parent
+		opts.MoveScore: default val is DefaultBlameMoveScore
+	*/
+	sb := &blameScoreboard{
+		repo:     repo,
+		opts:     opts,
+		diffOpts: diff.Options{Algorithm: diff.Myers, IndentHeuristic: true, IgnoreWhitespace: opts.IgnoreWhitespace},
+		path:     path,
+		commits:  map[string]*blameCommit{},
+	}
+	if sb.opts.MoveScore <= 0 {
+		sb.opts.MoveScore = DefaultBlameMoveScore
+	}
+
+	var final *blameOrigin
+	if rev == "" {
+		c, entry, err := repo.blameWorktreeCommit(path)
+		if err != nil {
+			return err
+		}
+		sb.commits[c.sha] = c
+		final = sb.origin(c, entry)
+	} else {
+		sha, err := repo.ObjectFind(rev, "commit", true)
+		if err != nil {
+			return err
+		}
+		c, err := sb.commit(sha)
+		if err != nil {
+			return err
+		}
+
+		leaf, err := repo.TreePathLookup(c.tree, path)
+		if err != nil || string(leaf.Mode[:2]) == "04" {
+			return fmt.Errorf("no such path %s in %s\n", path, rev)
+		}
+		final = sb.origin(c, DiffEntry{Path: path, Mode: string(leaf.Mode), Sha: leaf.Sha})
+	}
+
+	if err := sb.load(final); err != nil {
+		return err
+	}
+	sb.final = final.lines
+
+	ranges := [][2]int{}
+	if len(opts.Ranges) == 0 && len(sb.final) > 0 {
+		ranges = append(ranges, [2]int{0, len(sb.final)})
+	}
+	for _, arg := range opts.Ranges {
+		start, end, err := parseBlameRange(arg, len(sb.final), path)
+		if err != nil {
+			return err
+		}
+		if start < end {
+			ranges = append(ranges, [2]int{start, end})
+		}
+	}
+
+	slices.SortFunc(ranges, func(a [2]int, b [2]int) int {
+		return a[0] - b[0]
+	})
+	for i, r := range ranges {
+		if i > 0 {
+			last := final.suspects[len(final.suspects)-1]
+			if r[0] <= last.lno+last.numLines {
+				last.numLines = max(last.numLines, r[1]-last.lno)
+				continue
+			}
+		}
+		final.suspects = append(final.suspects, &blameEntry{lno: r[0], sLno: r[0], numLines: r[1] - r[0], suspect: final})
+	}
+
+	if len(final.suspects) > 0 {
+		sb.push(final.commit)
+	}
+	if err := sb.assign(); err != nil {
+		return err
+	}
+
+	if opts.Porcelain {
+		return sb.writePorcelain(w)
+	}
+
+	return sb.write(w)
+}
+
+type blameCommitInfo struct {
+	author    Signature
+	committer Signature
+	summary   string
+}
+
+func (sb *blameScoreboard) commitInfo(c *blameCommit) blameCommitInfo {
+	if c.commit == nil {
+		now := time.Unix(c.date, 0)
+		sig := Signature{Name: "Not Committed Yet", Email: "not.committed.yet", When: now}
+		return blameCommitInfo{author: sig, committer: sig, summary: "Version of " + sb.path + " from " + sb.path}
+	}
+
+	message := objectMessage(c.commit)
+	summary, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n")
+	if summary == "" {
+		summary = "(" + c.sha + ")"
+	}
+
+	return blameCommitInfo{
+		author:    sb.repo.MailmapRead().MapSignature(commitSignature(c.commit, "author")),
+		committer: sb.repo.MailmapRead().MapSignature(commitSignature(c.commit, "committer")),
+		summary:   summary,
+	}
+}
+
+func (sb *blameScoreboard) writeLines(b *strings.Builder, e *blameEntry, line func(int)) {
+	for i := 0; i < e.numLines; i++ {
+		line(i)
+		b.WriteString(sb.final[e.lno+i])
+		if !strings.HasSuffix(sb.final[e.lno+i], "\n") {
+			b.WriteString("\n")
+		}
+	}
+}
+
+func (sb *blameScoreboard) writePorcelain(w io.Writer) error {
+	/*
+		the commit details are written with the first group of lines of a commit, the file
+		names every time when the commit is blamed for more than one path
+	*/
+	var b strings.Builder
+	for _, e := range sb.entries {
+		c := e.suspect.commit
+
+		paths := 0
+		for _, o := range c.origins {
+			if o.guilty {
+				paths++
+			}
+		}
+
+		fmt.Fprintf(&b, "%s %d %d %d\n", c.sha, e.sLno+1, e.lno+1, e.numLines)
+		if !c.shown {
+			c.shown = true
+			info := sb.commitInfo(c)
+			fmt.Fprintf(&b, "author %s\nauthor-mail <%s>\nauthor-time %d\nauthor-tz %s\n", info.author.Name, info.author.Email, info.author.When.Unix(), info.author.When.Format("-0700"))
+			fmt.Fprintf(&b, "committer %s\ncommitter-mail <%s>\ncommitter-time %d\ncommitter-tz %s\n", info.committer.Name, info.committer.Email, info.committer.When.Unix(), info.committer.When.Format("-0700"))
+			fmt.Fprintf(&b, "summary %s\n", info.summary)
+			if c.boundary {
+				b.WriteString("boundary\n")
+			}
+			paths = 2
+		}
+		if paths > 1 {
+			if prev := e.suspect.previous; prev != nil {
+				fmt.Fprintf(&b, "previous %s %s\n", prev.commit.sha, prev.entry.Path)
+			}
+			fmt.Fprintf(&b, "filename %s\n", e.suspect.entry.Path)
+		}
+
+		sb.writeLines(&b, e, func(i int) {
+			if i > 0 {
+				fmt.Fprintf(&b, "%s %d %d\n", c.sha, e.sLno+1+i, e.lno+1+i)
+			}
+			b.WriteString("\t")
+		})
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (sb *blameScoreboard) write(w io.Writer) error {
+	/*
+		git's default format, the abbreviation gets one more char for the ^ of boundary
+		commits and the file name is shown once any line comes from another path
+	*/
+	abbrev, longestAuthor, longestFile := 7, 0, 0
+	showName := false
+	infos := map[*blameCommit]blameCommitInfo{}
+	for _, e := range sb.entries {
+		c := e.suspect.commit
+		if c.commit != nil {
+			abbrev = max(abbrev, len(sb.repo.ObjectAbbrev(c.sha, 7)))
+		}
+		if e.suspect.entry.Path != sb.path {
+			showName = true
+		}
+		longestFile = max(longestFile, len(e.suspect.entry.Path))
+
+		if _, ok := infos[c]; !ok {
+			infos[c] = sb.commitInfo(c)
+			longestAuthor = max(longestAuthor, utf8.RuneCountInString(infos[c].author.Name))
+		}
+	}
+	abbrev++
+
+	maxDigits := 0
+	if len(sb.entries) > 0 {
+		last := sb.entries[len(sb.entries)-1]
+		maxDigits = len(strconv.Itoa(last.lno + last.numLines))
+	}
+
+	var b strings.Builder
+	for _, e := range sb.entries {
+		c := e.suspect.commit
+		info := infos[c]
+
+		sb.writeLines(&b, e, func(i int) {
+			length := abbrev
+			if c.boundary {
+				b.WriteString("^")
+				length--
+			}
+			b.WriteString(c.sha[:length])
+
+			if showName {
+				fmt.Fprintf(&b, " %-*s", longestFile, e.suspect.entry.Path)
+			}
+
+			pad := longestAuthor - utf8.RuneCountInString(info.author.Name)
+			fmt.Fprintf(&b, " (%s%*s %s %*d) ", info.author.Name, pad, "", info.author.When.Format("2006-01-02 15:04:05 -0700"), maxDigits, e.lno+1+i)
+		})
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
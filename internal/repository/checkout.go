@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func (repo *Repository) treeToLeafDict(ref, prefix string) (*map[string]GitTreeLeaf, error) {
+	/*
+		prefix: default val is ""
+		same as treeToDict but keeps the mode of every leaf, leaf.Path is the full path
+	*/
+	ret := &map[string]GitTreeLeaf{}
+	sha, err := repo.ObjectFind(ref, "tree", true)
+	if err != nil {
+		return &map[string]GitTreeLeaf{}, err
+	}
+
+	obj, err := repo.ObjectRead(sha)
+	if err != nil {
+		return &map[string]GitTreeLeaf{}, err
+	}
+
+	tree, ok := obj.(*GitTree)
+	if !ok {
+		return &map[string]GitTreeLeaf{}, fmt.Errorf("could not read obj as tree for sha:%s ref:%s prefix:%s\n", sha, ref, prefix)
+	}
+
+	for _, leaf := range tree.Items {
+		fullPath := leaf.Path
+		if prefix != "" {
+			fullPath = prefix + "/" + leaf.Path
+		}
+
+		if string(leaf.Mode[:2]) == "04" {
+			subtreeDict, err := repo.treeToLeafDict(leaf.Sha, fullPath)
+			if err != nil {
+				return &map[string]GitTreeLeaf{}, err
+			}
+
+			for k, v := range *subtreeDict {
+				(*ret)[k] = v
+			}
+		} else {
+			(*ret)[fullPath] = GitTreeLeaf{Mode: leaf.Mode, Path: fullPath, Sha: leaf.Sha}
+		}
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) worktreeFileSha(name string) (string, error) {
+	fullPath := filepath.Join(repo.Worktree, name)
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return "", err
+		}
+
+		blob := &GitBlob{}
+		blob.Init([]byte(target))
+		return ObjectWrite(blob, nil)
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return ObjectHash(file, "blob", nil)
+}
+
+func (repo *Repository) worktreeWriteLeaf(leaf GitTreeLeaf) error {
+	dest := filepath.Join(repo.Worktree, filepath.FromSlash(leaf.Path))
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	mode := string(leaf.Mode)
+	if mode == "160000" {
+		return os.MkdirAll(dest, 0755)
+	}
+
+	obj, err := repo.ObjectRead(leaf.Sha)
+	if err != nil {
+		return err
+	}
+
+	blob, ok := obj.(*GitBlob)
+	if !ok {
+		return fmt.Errorf("expected blob for path:%s sha:%s\n", leaf.Path, leaf.Sha)
+	}
+
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+
+	if mode == "120000" {
+		return os.Symlink(string(blob.BlobData), dest)
+	}
+
+	var perm os.FileMode = 0644
+	if mode == "100755" {
+		perm = 0755
+	}
+
+	return os.WriteFile(dest, blob.BlobData, perm)
+}
+
+func (repo *Repository) worktreeRemoveFile(name string) error {
+	fullPath := filepath.Join(repo.Worktree, filepath.FromSlash(name))
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(fullPath)
+	for dir != repo.Worktree && strings.HasPrefix(dir, repo.Worktree) {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			break
+		}
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return nil
+}
+
+func (repo *Repository) WorktreeSwitch(fromTree string, toTree string) error {
+	/*
+		fromTree: "" when HEAD is unborn
+		moves the worktree and the index from fromTree to toTree, keeping local changes
+		to paths that are the same in both trees
+	*/
+	from := &map[string]GitTreeLeaf{}
+	var err error
+	if fromTree != "" {
+		from, err = repo.treeToLeafDict(fromTree, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	to, err := repo.treeToLeafDict(toTree, "")
+	if err != nil {
+		return err
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+
+	indexEntries := map[string]GitIndexEntry{}
+	for _, e := range index.Entries {
+		indexEntries[e.Name] = e
+	}
+
+	changed := []string{}
+	for name, leaf := range *to {
+		old, ok := (*from)[name]
+		if !ok || old.Sha != leaf.Sha || string(old.Mode) != string(leaf.Mode) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range *from {
+		if _, ok := (*to)[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	slices.Sort(changed)
+
+	dirty := []string{}
+	for _, name := range changed {
+		old, inFrom := (*from)[name]
+		entry, inIndex := indexEntries[name]
+
+		if inIndex && (!inFrom || entry.Sha != old.Sha) {
+			dirty = append(dirty, name)
+			continue
+		}
+
+		sha, err := repo.worktreeFileSha(name)
+		if err != nil {
+			continue
+		}
+
+		if !inIndex || sha != entry.Sha {
+			dirty = append(dirty, name)
+		}
+	}
+
+	if len(dirty) > 0 {
+		return fmt.Errorf("your local changes to the following files would be overwritten:\n\t%s\n", strings.Join(dirty, "\n\t"))
+	}
+
+	newEntries := []GitIndexEntry{}
+	for name, e := range indexEntries {
+		_, inFrom := (*from)[name]
+		_, inTo := (*to)[name]
+		if !inFrom && !inTo {
+			newEntries = append(newEntries, e)
+		}
+	}
+
+	for _, name := range changed {
+		if _, ok := (*to)[name]; !ok {
+			if err := repo.worktreeRemoveFile(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, leaf := range *to {
+		if !slices.Contains(changed, name) {
+			if e, ok := indexEntries[name]; ok {
+				newEntries = append(newEntries, e)
+				continue
+			}
+		}
+
+		if err := repo.worktreeWriteLeaf(leaf); err != nil {
+			return err
+		}
+
+		entry, err := indexEntryFromFile(filepath.Join(repo.Worktree, filepath.FromSlash(name)), name, leaf.Sha)
+		if err != nil {
+			return err
+		}
+		entry.ModeType, entry.ModePerms = treeModeToIndexMode(leaf.Mode)
+
+		newEntries = append(newEntries, entry)
+	}
+
+	index.Entries = newEntries
+	return repo.IndexWrite(index)
+}
+
+func treeModeToIndexMode(mode []byte) (uint16, uint16) {
+	switch string(mode) {
+	case "100755":
+		return 0b1000, 0o755
+	case "120000":
+		return 0b1010, 0
+	case "160000":
+		return 0b1110, 0
+	default:
+		return 0b1000, 0o644
+	}
+}
+
+func (repo *Repository) Checkout(name string) (string, error) {
+	/*
+		returns the branch that was checked out or "" when HEAD got detached
+	*/
+	if name == "-" {
+		name = "@{-1}"
+	}
+	if strings.HasPrefix(name, "@{-") && strings.HasSuffix(name, "}") {
+		n, err := strconv.Atoi(name[3 : len(name)-1])
+		if err != nil {
+			return "", fmt.Errorf("invalid previous branch selector %s\n", name)
+		}
+
+		name, err = repo.previousBranch(n)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	branch := ""
+	sha, err := repo.RefResolve("refs/heads/" + name)
+	if err == nil {
+		branch = name
+	} else {
+		sha, err = repo.ObjectFind(name, "commit", true)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fromTree := ""
+	oldSha, err := repo.RefResolve("HEAD")
+	if err == nil {
+		fromTree = "HEAD"
+	}
+
+	from, err := repo.GetActiveBranch()
+	if err != nil {
+		return "", err
+	}
+	if from == "" && oldSha != "" {
+		from = oldSha
+	}
+
+	if err := repo.WorktreeSwitch(fromTree, sha); err != nil {
+		return "", err
+	}
+
+	if branch != "" {
+		err = repo.SymbolicRefCreate("HEAD", "refs/heads/"+branch)
+	} else {
+		err = repo.HeadDetach(sha)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return branch, repo.ReflogAppend("HEAD", oldSha, sha, fmt.Sprintf("checkout: moving from %s to %s", from, name))
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const generationInfinity = math.MaxUint64
+
+func commitGraphParse(data []byte) (map[string]uint64, error) {
+	/*
+		reads the topological levels out of the CDAT chunk of a commit-graph file,
+		the other chunks are not needed for generation numbers
+	*/
+	ret := map[string]uint64{}
+	if len(data) < 8 || string(data[:4]) != "CGPH" {
+		return ret, fmt.Errorf("bad commit-graph signature\n")
+	}
+	if data[4] != 1 || data[5] != 1 {
+		return ret, fmt.Errorf("unsupported commit-graph version %d hash %d\n", data[4], data[5])
+	}
+
+	chunks := map[string]uint64{}
+	numChunks := int(data[6])
+	for i := 0; i < numChunks; i++ {
+		pos := 8 + i*12
+		if pos+12 > len(data) {
+			return ret, fmt.Errorf("commit-graph chunk table is truncated\n")
+		}
+		chunks[string(data[pos:pos+4])] = binary.BigEndian.Uint64(data[pos+4 : pos+12])
+	}
+
+	fanout, okFanout := chunks["OIDF"]
+	lookup, okLookup := chunks["OIDL"]
+	commitData, okData := chunks["CDAT"]
+	if !okFanout || !okLookup || !okData || fanout+256*4 > uint64(len(data)) {
+		return ret, fmt.Errorf("commit-graph is missing required chunks\n")
+	}
+
+	count := uint64(binary.BigEndian.Uint32(data[fanout+255*4 : fanout+256*4]))
+	if lookup+count*20 > uint64(len(data)) || commitData+count*36 > uint64(len(data)) {
+		return ret, fmt.Errorf("commit-graph is truncated\n")
+	}
+
+	for i := uint64(0); i < count; i++ {
+		sha := hex.EncodeToString(data[lookup+i*20 : lookup+(i+1)*20])
+		pos := commitData + i*36 + 28
+		ret[sha] = uint64(binary.BigEndian.Uint32(data[pos:pos+4]) >> 2)
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) commitGraphLoad() map[string]uint64 {
+	/*
+		objects/info/commit-graph or the split graphs of commit-graphs/commit-graph-chain,
+		a broken or missing graph just means no generation numbers
+	*/
+	ret := map[string]uint64{}
+	info := filepath.Join(repo.Gitdir, "objects", "info")
+
+	files := []string{filepath.Join(info, "commit-graph")}
+	if chain, err := os.ReadFile(filepath.Join(info, "commit-graphs", "commit-graph-chain")); err == nil {
+		for _, line := range strings.Split(string(bytes.TrimSpace(chain)), "\n") {
+			if line != "" {
+				files = append(files, filepath.Join(info, "commit-graphs", "graph-"+line+".graph"))
+			}
+		}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		generations, err := commitGraphParse(data)
+		if err != nil {
+			continue
+		}
+		for sha, gen := range generations {
+			ret[sha] = gen
+		}
+	}
+
+	return ret
+}
+
+func (repo *Repository) CommitGeneration(sha string) uint64 {
+	/*
+		the generation number from the commit graph, generationInfinity for commits it does not know
+	*/
+	if repo.generations == nil {
+		repo.generations = repo.commitGraphLoad()
+	}
+
+	if gen, ok := repo.generations[sha]; ok {
+		return gen
+	}
+
+	return generationInfinity
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -14,69 +15,6 @@ import (
 	"gopkg.in/ini.v1"
 )
 
-func LogGraphviz(repo *Repository, sha string, seen *map[string]byte) error {
-	if seen == nil {
-		return fmt.Errorf("seen map is nil for commit:%s", sha)
-	}
-
-	if _, ok := (*seen)[sha]; ok {
-		return nil
-	}
-
-	(*seen)[sha] = ' '
-	commit, err := repo.ObjectRead(sha)
-	if err != nil {
-		return fmt.Errorf("could not find repo in loggin for sha:%s", sha)
-	}
-
-	commitFmt, err := commit.GetFmt()
-	if err != nil {
-		return fmt.Errorf("error in fmt for commit with sha:%s", sha)
-	}
-
-	if string(commitFmt) != "commit" {
-		return fmt.Errorf("the git object does not have type commit for sha:%s type:%s", sha, string(commitFmt))
-	}
-
-	gitCommit, ok := commit.(*GitCommit)
-	if !ok {
-		return fmt.Errorf("expected *GitCommit type but got something else for sha:%s", sha)
-	}
-
-	shortHash := sha[:8]
-
-	var messageBytes []byte
-	for _, line := range (*(*gitCommit.Kvlm).Map)[""] {
-		messageBytes = append(messageBytes, line...)
-	}
-	message := string(messageBytes)
-
-	message = strings.ReplaceAll(message, "\\", "\\\\")
-	message = strings.ReplaceAll(message, "\"", "\\\"")
-
-	if newlineIndex := strings.Index(message, "\n"); newlineIndex != -1 {
-		message = message[:newlineIndex]
-	}
-
-	fmt.Printf("  c_%s [label=\"%s: %s\"]\n", sha, shortHash, message)
-
-	parents, ok := (*(*gitCommit.Kvlm).Map)["parent"]
-	if !ok {
-		return nil
-	}
-
-	for _, p := range parents {
-		parentHash := string(p)
-		fmt.Printf("  c_%s -> c_%s;\n", sha, parentHash)
-
-		if err := LogGraphviz(repo, parentHash, seen); err != nil {
-			return fmt.Errorf("error in logGraphviz for parent %s: %w", parentHash, err)
-		}
-	}
-
-	return nil
-}
-
 func (repo *Repository) Rm(paths []string, withDelete bool, skipMissing bool) error {
 	/*
 		withDelete: default val is true
@@ -108,17 +46,24 @@ func (repo *Repository) Rm(paths []string, withDelete bool, skipMissing bool) er
 	for _, e := range index.Entries {
 		eFull := filepath.Join(workTree, e.Name)
 
-		if slices.Contains(absPaths, eFull) {
-			remove = append(remove, eFull)
-			i := slices.Index(absPaths, eFull)
-			slices.Delete(absPaths, i, i+1)
-		} else {
+		if !slices.Contains(absPaths, eFull) {
 			keep = append(keep, e)
+			continue
+		}
+		if !slices.Contains(remove, eFull) {
+			remove = append(remove, eFull)
+		}
+	}
+
+	missing := []string{}
+	for _, path := range absPaths {
+		if !slices.Contains(remove, path) {
+			missing = append(missing, path)
 		}
 	}
 
-	if len(absPaths) > 0 && !skipMissing {
-		return fmt.Errorf("Cannot remove paths not in the index: %v", absPaths)
+	if len(missing) > 0 && !skipMissing {
+		return fmt.Errorf("Cannot remove paths not in the index: %v", missing)
 	}
 
 	if withDelete {
@@ -164,10 +109,10 @@ func (repo *Repository) Add(paths []string) error {
 			return err
 		}
 
-		if !(strings.HasPrefix(abs, workTree) || isFile) {
+		if !(strings.HasPrefix(abs, workTree) && isFile) {
 			return fmt.Errorf("Not a file, or outside the worktree: %v\n", paths)
 		}
-		rel, err := filepath.Rel(abs, repo.Worktree)
+		rel, err := filepath.Rel(repo.Worktree, abs)
 		if err != nil {
 			return err
 		}
@@ -191,38 +136,12 @@ func (repo *Repository) Add(paths []string) error {
 		if err != nil {
 			return err
 		}
-		stat, err := os.Stat(pair.Abs)
+
+		entry, err := indexEntryFromFile(pair.Abs, pair.Rel, sha)
 		if err != nil {
 			return err
 		}
 
-		sysStat := stat.Sys().(*syscall.Stat_t)
-
-		ctime := fTime{
-			Seconds:     uint32(sysStat.Ctim.Sec),
-			Nanoseconds: uint32(sysStat.Ctim.Nsec % int64(1e9)),
-		}
-		mtime := fTime{
-			Seconds:     uint32(sysStat.Mtim.Sec),
-			Nanoseconds: uint32(sysStat.Mtim.Nsec % int64(1e9)),
-		}
-
-		entry := GitIndexEntry{
-			CTime:            ctime,
-			MTime:            mtime,
-			Dev:              uint32(sysStat.Dev),
-			Ino:              uint32(sysStat.Ino),
-			ModeType:         0b1000,
-			ModePerms:        0o644,
-			UId:              sysStat.Uid,
-			GId:              sysStat.Gid,
-			FSize:            uint32(stat.Size()),
-			Sha:              sha,
-			FlagAssumedValid: false,
-			FlagStage:        0,
-			Name:             pair.Rel,
-		}
-
 		index.Entries = append(index.Entries, entry)
 	}
 
@@ -234,6 +153,49 @@ func (repo *Repository) Add(paths []string) error {
 	return nil
 }
 
+func indexEntryFromFile(abs string, rel string, sha string) (GitIndexEntry, error) {
+	stat, err := os.Lstat(abs)
+	if err != nil {
+		return GitIndexEntry{}, err
+	}
+
+	sysStat := stat.Sys().(*syscall.Stat_t)
+
+	ctime := fTime{
+		Seconds:     uint32(sysStat.Ctim.Sec),
+		Nanoseconds: uint32(sysStat.Ctim.Nsec % int64(1e9)),
+	}
+	mtime := fTime{
+		Seconds:     uint32(sysStat.Mtim.Sec),
+		Nanoseconds: uint32(sysStat.Mtim.Nsec % int64(1e9)),
+	}
+
+	var modeType uint16 = 0b1000
+	var modePerms uint16 = 0o644
+	if stat.Mode()&os.ModeSymlink != 0 {
+		modeType = 0b1010
+		modePerms = 0
+	} else if stat.Mode().Perm()&0o111 != 0 {
+		modePerms = 0o755
+	}
+
+	return GitIndexEntry{
+		CTime:            ctime,
+		MTime:            mtime,
+		Dev:              uint32(sysStat.Dev),
+		Ino:              uint32(sysStat.Ino),
+		ModeType:         modeType,
+		ModePerms:        modePerms,
+		UId:              sysStat.Uid,
+		GId:              sysStat.Gid,
+		FSize:            uint32(stat.Size()),
+		Sha:              sha,
+		FlagAssumedValid: false,
+		FlagStage:        0,
+		Name:             filepath.ToSlash(rel),
+	}, nil
+}
+
 func GitConfigRead() (*ini.File, error) {
 	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
 	if xdgConfigHome == "" {
@@ -241,11 +203,10 @@ func GitConfigRead() (*ini.File, error) {
 	}
 
 	configFiles := []interface{}{
-		filepath.Join(xdgConfigHome, "git", "config"),
 		filepath.Join(os.Getenv("HOME"), ".gitconfig"),
 	}
 
-	conf, err := ini.LoadSources(ini.LoadOptions{Loose: true}, nil, configFiles...)
+	conf, err := ini.LoadSources(ini.LoadOptions{Loose: true}, filepath.Join(xdgConfigHome, "git", "config"), configFiles...)
 	if err != nil {
 		return &ini.File{}, fmt.Errorf("failed to load config files: %w", err)
 	}
@@ -269,6 +230,28 @@ func GitConfigUserGet(conf *ini.File) string {
 	return ""
 }
 
+func (repo *Repository) UserIdent() (string, error) {
+	/*
+		"Name <email>" from the repo config, then from the global one
+	*/
+	if repo.Conf != nil {
+		if user := GitConfigUserGet(repo.Conf); user != "" {
+			return user, nil
+		}
+	}
+
+	config, err := GitConfigRead()
+	if err != nil {
+		return "", err
+	}
+
+	if user := GitConfigUserGet(config); user != "" {
+		return user, nil
+	}
+
+	return "", fmt.Errorf("user.name and user.email are not set\n")
+}
+
 func (repo *Repository) TreeFromIndex(index *GitIndex) (string, error) {
 	if index == nil {
 		return "", fmt.Errorf("index is nil\n")
@@ -278,20 +261,30 @@ func (repo *Repository) TreeFromIndex(index *GitIndex) (string, error) {
 	contents[""] = []GitIndexEntry{}
 
 	for _, e := range index.Entries {
-		dirName := filepath.Dir(e.Name)
+		if e.FlagStage != 0 {
+			return "", fmt.Errorf("index has unmerged entry:%s\n", e.Name)
+		}
+
+		dirName := path.Dir(e.Name)
+		if dirName == "." {
+			dirName = ""
+		}
 
 		key := dirName
-		for key != "" && key != "." {
+		for key != "" {
 			if _, ok := contents[key]; !ok {
 				contents[key] = []GitIndexEntry{}
 			}
-			key = filepath.Dir(key)
+			key = path.Dir(key)
+			if key == "." {
+				key = ""
+			}
 		}
 
 		contents[dirName] = append(contents[dirName], e)
 	}
 
-	sortedPaths := make([]string, len(contents))
+	sortedPaths := make([]string, 0, len(contents))
 	for key := range contents {
 		sortedPaths = append(sortedPaths, key)
 	}
@@ -303,31 +296,23 @@ func (repo *Repository) TreeFromIndex(index *GitIndex) (string, error) {
 		} else if lenA > lenB {
 			return -1
 		}
-		return 0
+		return strings.Compare(a, b)
 	})
 
 	sha := ""
 
-	for _, path := range sortedPaths {
+	for _, dir := range sortedPaths {
 		tree := &GitTree{
+			Fmt:   "tree",
 			Items: []*GitTreeLeaf{},
 		}
 
-		for _, e := range contents[path] {
-			var leaf *GitTreeLeaf
-			if true {
-				leafMode := fmt.Sprintf("%02o%04o", e.ModeType, e.ModePerms)
-				leaf = &GitTreeLeaf{
-					Mode: []byte(leafMode),
-					Path: filepath.Base(e.Name),
-					Sha:  e.Sha,
-				}
-			} else {
-				leaf = &GitTreeLeaf{
-					Mode: []byte("040000"),
-					Path: filepath.Base(e.Name),
-					Sha:  e.Sha,
-				}
+		for _, e := range contents[dir] {
+			leafMode := fmt.Sprintf("%02o%04o", e.ModeType, e.ModePerms)
+			leaf := &GitTreeLeaf{
+				Mode: []byte(leafMode),
+				Path: path.Base(e.Name),
+				Sha:  e.Sha,
 			}
 
 			tree.Items = append(tree.Items, leaf)
@@ -338,47 +323,77 @@ func (repo *Repository) TreeFromIndex(index *GitIndex) (string, error) {
 			return "", err
 		}
 
-		parent := filepath.Dir(path)
-		base := filepath.Base(path)
-		_ = base
+		if dir == "" {
+			break
+		}
+
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
 
-		contents[parent] = append(contents[parent], GitIndexEntry{})
+		contents[parent] = append(contents[parent], GitIndexEntry{
+			ModeType: 0b0100,
+			Name:     dir,
+			Sha:      sha,
+		})
 	}
 
 	return sha, nil
 }
 
-func (repo *Repository) CommitCreate(tree, parent, author, message string, timestamp time.Time) (string, error) {
+func (repo *Repository) CommitCreate(tree string, parents []string, author string, message string, timestamp time.Time) (string, error) {
+	/*
+		parents: empty for a root commit, the first one is the branch the commit goes on
+		author is the committer as well, both at timestamp
+	*/
+	ident := fmt.Sprintf("%s %s", author, FormatSignatureTime(timestamp))
+	return repo.CommitCreateAuthored(tree, parents, ident, ident, message)
+}
+
+func (repo *Repository) CommitCreateAuthored(tree string, parents []string, author string, committer string, message string) (string, error) {
+	/*
+		author and committer are whole signatures, "Name <email> 1700000000 +0100"
+	*/
 	commit := &GitCommit{
+		Fmt:  "commit",
 		Kvlm: sharedtypes.NewKvlm(),
 	}
 
-	(*(*commit.Kvlm).Map)["tree"] = [][]byte{[]byte(tree)}
-	if parent != "" {
-		(*(*commit.Kvlm).Map)["parent"] = [][]byte{[]byte(parent)}
+	commit.Kvlm.Insert("tree", [][]byte{[]byte(tree)})
+	if len(parents) > 0 {
+		values := [][]byte{}
+		for _, parent := range parents {
+			values = append(values, []byte(parent))
+		}
+		commit.Kvlm.Insert("parent", values)
+	}
+
+	commit.Kvlm.Insert("author", [][]byte{[]byte(author)})
+	commit.Kvlm.Insert("committer", [][]byte{[]byte(committer)})
+
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
 	}
+	commit.Kvlm.Insert("", [][]byte{[]byte(message)})
 
-	timestamp = time.Now()
+	return ObjectWrite(commit, repo)
+}
 
+func FormatSignatureTime(timestamp time.Time) string {
 	epochTime := timestamp.Unix()
 
-	_, offset := timestamp.In(time.Local).Zone()
+	_, offset := timestamp.Zone()
 
 	hours := offset / 3600
 	minutes := (offset % 3600) / 60
 
 	var tz string
-	if offset > 0 {
+	if offset >= 0 {
 		tz = fmt.Sprintf("+%02d%02d", hours, minutes)
 	} else {
 		tz = fmt.Sprintf("-%02d%02d", -hours, -minutes)
 	}
 
-	author = fmt.Sprintf("%s %d %s", author, epochTime, tz)
-
-	(*(*commit.Kvlm).Map)["author"] = [][]byte{[]byte(author)}
-	(*(*commit.Kvlm).Map)["committer"] = [][]byte{[]byte(author)}
-	(*(*commit.Kvlm).Map)[""] = [][]byte{[]byte(message)}
-
-	return ObjectWrite(commit, repo)
+	return fmt.Sprintf("%d %s", epochTime, tz)
 }
@@ -0,0 +1,598 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DescribeOptions struct {
+	Tags   bool
+	All    bool
+	Long   bool
+	Always bool
+	Abbrev int
+	Match  []string
+	Dirty  string
+}
+
+type describeName struct {
+	path     string
+	sha      string
+	prio     int
+	tag      string
+	tagDate  time.Time
+	misnamed bool
+	checked  bool
+}
+
+const describeSeen = 1
+
+const describeMaxCandidates = 10
+
+func (repo *Repository) tagRead(sha string) (*GitTag, error) {
+	obj, err := repo.ObjectRead(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, ok := obj.(*GitTag)
+	if !ok {
+		return nil, fmt.Errorf("expected tag for sha:%s\n", sha)
+	}
+
+	return tag, nil
+}
+
+func tagField(tag *GitTag, key string) string {
+	values := (*(*tag.Kvlm).Map)[key]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return string(values[0])
+}
+
+func (repo *Repository) describeNames(opts DescribeOptions) (map[string]*describeName, error) {
+	/*
+		maps a commit to the best ref naming it: annotated tags, then lightweight tags, then
+		other refs with All, between annotated tags the newest one wins
+	*/
+	ret := map[string]*describeName{}
+
+	refs, err := repo.RefListFlat("refs/")
+	if err != nil {
+		return ret, err
+	}
+
+	for _, ref := range refs {
+		isTag := strings.HasPrefix(ref.Name, "refs/tags/")
+		toMatch := strings.TrimPrefix(ref.Name, "refs/tags/")
+		if !isTag {
+			if !opts.All {
+				continue
+			}
+			if len(opts.Match) > 0 {
+				short, ok := strings.CutPrefix(ref.Name, "refs/heads/")
+				if !ok {
+					if short, ok = strings.CutPrefix(ref.Name, "refs/remotes/"); !ok {
+						continue
+					}
+				}
+				toMatch = short
+			}
+		}
+
+		if len(opts.Match) > 0 && !slices.ContainsFunc(opts.Match, func(pattern string) bool {
+			ok, err := path.Match(pattern, toMatch)
+			return err == nil && ok
+		}) {
+			continue
+		}
+
+		peeled, err := repo.ObjectPeel(ref.Sha)
+		if err != nil {
+			peeled = ref.Sha
+		}
+
+		name := &describeName{sha: ref.Sha, prio: 0}
+		if opts.All {
+			name.path = strings.TrimPrefix(ref.Name, "refs/")
+		} else {
+			name.path = strings.TrimPrefix(ref.Name, "refs/tags/")
+		}
+
+		switch {
+		case peeled != ref.Sha:
+			name.prio = 2
+			tag, err := repo.tagRead(ref.Sha)
+			if err != nil {
+				return ret, err
+			}
+			name.tag = tagField(tag, "tag")
+			if sig, err := ParseSignature([]byte(tagField(tag, "tagger"))); err == nil {
+				name.tagDate = sig.When
+			}
+		case isTag:
+			name.prio = 1
+		}
+
+		old, ok := ret[peeled]
+		if !ok || old.prio < name.prio || old.prio == 2 && name.prio == 2 && old.tagDate.Before(name.tagDate) {
+			ret[peeled] = name
+		}
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) describeAppendName(name *describeName, all bool) string {
+	if name.tag == "" {
+		return name.path
+	}
+
+	if !name.checked {
+		expected := name.path
+		if all {
+			expected = strings.TrimPrefix(name.path, "tags/")
+		}
+		if name.tag != expected {
+			fmt.Fprintf(os.Stderr, "warning: tag '%s' is externally known as '%s'\n", name.path, name.tag)
+			name.misnamed = true
+		}
+		name.checked = true
+	}
+
+	if all {
+		return "tags/" + name.tag
+	}
+
+	return name.tag
+}
+
+func (repo *Repository) describeSuffix(depth int, sha string, abbrev int) string {
+	if abbrev == 0 {
+		return fmt.Sprintf("-%d-g%s", depth, sha)
+	}
+
+	return fmt.Sprintf("-%d-g%s", depth, repo.ObjectAbbrev(sha, abbrev))
+}
+
+type describeCandidate struct {
+	name   *describeName
+	depth  int
+	within int
+	order  int
+}
+
+func describeFinishDepth(p *paintWalk, list []*paintCommit, best *describeCandidate) ([]*paintCommit, error) {
+	/*
+		keeps walking until everything left is reachable from the best tag, counting the
+		commits that are not
+	*/
+	for len(list) > 0 {
+		c := list[0]
+		list = list[1:]
+
+		if c.flags&best.within != 0 {
+			if !slices.ContainsFunc(list, func(other *paintCommit) bool {
+				return other.flags&best.within == 0
+			}) {
+				break
+			}
+		} else {
+			best.depth++
+		}
+
+		for _, parent := range c.parents {
+			pc, err := p.commit(parent)
+			if err != nil {
+				return list, err
+			}
+			if pc.flags&describeSeen == 0 {
+				list = insertByDate(list, pc)
+			}
+			pc.flags |= c.flags
+		}
+	}
+
+	return list, nil
+}
+
+func (repo *Repository) Describe(sha string, opts DescribeOptions) (string, error) {
+	/*
+		opts.Abbrev: default val is 7, 0 prints the tag only
+		git's describe, a breadth first walk by date from sha collects up to ten tags, the one
+		with the fewest commits not reachable from it wins
+	*/
+	names, err := repo.describeNames(opts)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 && !opts.Always {
+		return "", fmt.Errorf("No names found, cannot describe anything.\n")
+	}
+
+	if name, ok := names[sha]; ok && (opts.Tags || opts.All || name.prio == 2) {
+		ret := repo.describeAppendName(name, opts.All)
+		if name.misnamed || opts.Long {
+			ret += repo.describeSuffix(0, sha, opts.Abbrev)
+		}
+		return ret + opts.Dirty, nil
+	}
+
+	p := &paintWalk{repo: repo, commits: map[string]*paintCommit{}}
+	start, err := p.commit(sha)
+	if err != nil {
+		return "", err
+	}
+	start.flags = describeSeen
+
+	candidates := []*describeCandidate{}
+	annotated := 0
+	unannotated := 0
+	seen := 0
+	var gaveUpOn *paintCommit
+
+	list := []*paintCommit{start}
+	for len(list) > 0 {
+		c := list[0]
+		list = list[1:]
+		seen++
+
+		if name, ok := names[c.sha]; ok {
+			if !opts.Tags && !opts.All && name.prio < 2 {
+				unannotated++
+			} else if len(candidates) < describeMaxCandidates {
+				candidate := &describeCandidate{name: name, depth: seen - 1, within: 1 << (len(candidates) + 1), order: len(candidates) + 1}
+				candidates = append(candidates, candidate)
+				c.flags |= candidate.within
+				if name.prio == 2 {
+					annotated++
+				}
+			} else {
+				gaveUpOn = c
+				break
+			}
+		}
+
+		for _, candidate := range candidates {
+			if c.flags&candidate.within == 0 {
+				candidate.depth++
+			}
+		}
+
+		if annotated > 0 && len(list) == 0 {
+			bestDepth := math.MaxInt
+			bestWithin := 0
+			for _, candidate := range candidates {
+				if candidate.depth < bestDepth {
+					bestDepth = candidate.depth
+					bestWithin = candidate.within
+				} else if candidate.depth == bestDepth {
+					bestWithin |= candidate.within
+				}
+			}
+			if c.flags&bestWithin == bestWithin {
+				break
+			}
+		}
+
+		for _, parent := range c.parents {
+			pc, err := p.commit(parent)
+			if err != nil {
+				return "", err
+			}
+			if pc.flags&describeSeen == 0 {
+				list = insertByDate(list, pc)
+			}
+			pc.flags |= c.flags
+		}
+	}
+
+	if len(candidates) == 0 {
+		if opts.Always {
+			return repo.ObjectAbbrev(sha, max(opts.Abbrev, 7)) + opts.Dirty, nil
+		}
+		if unannotated > 0 {
+			return "", fmt.Errorf("No annotated tags can describe '%s'.\nHowever, there were unannotated tags: try --tags.\n", sha)
+		}
+		return "", fmt.Errorf("No tags can describe '%s'.\nTry --always, or create some tags.\n", sha)
+	}
+
+	slices.SortStableFunc(candidates, func(a, b *describeCandidate) int {
+		if a.depth != b.depth {
+			return a.depth - b.depth
+		}
+		return a.order - b.order
+	})
+
+	if gaveUpOn != nil {
+		list = insertByDate(list, gaveUpOn)
+	}
+	if _, err := describeFinishDepth(p, list, candidates[0]); err != nil {
+		return "", err
+	}
+
+	best := candidates[0]
+	ret := repo.describeAppendName(best.name, opts.All)
+	if best.name.misnamed || opts.Abbrev != 0 {
+		ret += repo.describeSuffix(best.depth, sha, opts.Abbrev)
+	}
+
+	return ret + opts.Dirty, nil
+}
+
+type NameRevOptions struct {
+	Tags     bool
+	NameOnly bool
+	Refs     []string
+}
+
+type revName struct {
+	tip      string
+	date     time.Time
+	gen      int
+	distance int
+	fromTag  bool
+}
+
+type RevNamer struct {
+	repo  *Repository
+	names map[string]*revName
+}
+
+const nameRevMergeWeight = 65535
+
+func (n *revName) isBetter(date time.Time, distance int, fromTag bool) bool {
+	/*
+		tags beat other refs and older tags beat newer ones even when they are farther away,
+		between other refs the shorter hop wins
+	*/
+	if fromTag && n.fromTag {
+		return n.date.After(date) || n.date.Equal(date) && n.distance > distance
+	}
+	if n.fromTag != fromTag {
+		return fromTag
+	}
+	if n.distance != distance {
+		return n.distance > distance
+	}
+
+	return n.date.After(date)
+}
+
+func (r *RevNamer) update(sha string, date time.Time, gen int, distance int, fromTag bool) *revName {
+	name, ok := r.names[sha]
+	if ok && !name.isBetter(date, distance, fromTag) {
+		return nil
+	}
+	if !ok {
+		name = &revName{}
+		r.names[sha] = name
+	}
+
+	name.date = date
+	name.gen = gen
+	name.distance = distance
+	name.fromTag = fromTag
+
+	return name
+}
+
+func (r *RevNamer) parentName(name *revName, parent int) string {
+	tip := strings.TrimSuffix(name.tip, "^0")
+	if name.gen > 0 {
+		return fmt.Sprintf("%s~%d^%d", tip, name.gen, parent)
+	}
+
+	return fmt.Sprintf("%s^%d", tip, parent)
+}
+
+func (r *RevNamer) nameFrom(p *paintWalk, sha string, tip string, date time.Time, fromTag bool, deref bool) error {
+	start := r.update(sha, date, 0, 0, fromTag)
+	if start == nil {
+		return nil
+	}
+	start.tip = tip
+	if deref {
+		start.tip = tip + "^0"
+	}
+
+	stack := []string{sha}
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		c, err := p.commit(sha)
+		if err != nil {
+			return err
+		}
+		name := r.names[sha]
+
+		toPush := []string{}
+		for i, parent := range c.parents {
+			gen := name.gen + 1
+			distance := name.distance + 1
+			if i > 0 {
+				gen = 0
+				distance = name.distance + nameRevMergeWeight
+			}
+
+			parentName := r.update(parent, date, gen, distance, fromTag)
+			if parentName == nil {
+				continue
+			}
+
+			if i > 0 {
+				parentName.tip = r.parentName(name, i+1)
+			} else {
+				parentName.tip = name.tip
+			}
+			toPush = append(toPush, parent)
+		}
+
+		for i := len(toPush) - 1; i >= 0; i-- {
+			stack = append(stack, toPush[i])
+		}
+	}
+
+	return nil
+}
+
+func nameRevSubpathMatch(name string, pattern string) int {
+	/*
+		-1 when pattern matches no tail of name, otherwise the offset of the matching tail
+	*/
+	for offset := 0; ; {
+		if ok, err := path.Match(pattern, name[offset:]); err == nil && ok {
+			return offset
+		}
+
+		next := strings.IndexByte(name[offset:], '/')
+		if next < 0 {
+			return -1
+		}
+		offset += next + 1
+	}
+}
+
+func (repo *Repository) NewRevNamer(opts NameRevOptions) (*RevNamer, error) {
+	/*
+		git's name-rev, every ref tip names its history as tip~gen^parent, tags and older tips
+		go first so the worse names spread less
+	*/
+	r := &RevNamer{repo: repo, names: map[string]*revName{}}
+
+	refs, err := repo.RefListFlat("refs/")
+	if err != nil {
+		return r, err
+	}
+
+	type tip struct {
+		name    string
+		sha     string
+		date    time.Time
+		fromTag bool
+		deref   bool
+	}
+
+	p := &paintWalk{repo: repo, commits: map[string]*paintCommit{}}
+	tips := []tip{}
+	for _, ref := range refs {
+		if opts.Tags && !strings.HasPrefix(ref.Name, "refs/tags/") {
+			continue
+		}
+
+		shorten := opts.Tags && opts.NameOnly
+		if len(opts.Refs) > 0 {
+			matched := false
+			for _, pattern := range opts.Refs {
+				switch nameRevSubpathMatch(ref.Name, pattern) {
+				case -1:
+				case 0:
+					matched = true
+				default:
+					matched = true
+					shorten = true
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		t := tip{sha: ref.Sha}
+		date := time.Time{}
+		hasDate := false
+		for {
+			obj, err := repo.ObjectRead(t.sha)
+			if err != nil {
+				return r, err
+			}
+			tag, ok := obj.(*GitTag)
+			if !ok {
+				break
+			}
+
+			t.sha = tagField(tag, "object")
+			t.deref = true
+			if sig, err := ParseSignature([]byte(tagField(tag, "tagger"))); err == nil {
+				date = sig.When
+				hasDate = true
+			}
+		}
+
+		c, err := p.commit(t.sha)
+		if err != nil {
+			continue
+		}
+		if !hasDate {
+			date = c.date
+		}
+		t.date = date
+		t.fromTag = strings.HasPrefix(ref.Name, "refs/tags/")
+
+		switch {
+		case shorten:
+			t.name = RefShortName(ref.Name)
+		case strings.HasPrefix(ref.Name, "refs/heads/"):
+			t.name = strings.TrimPrefix(ref.Name, "refs/heads/")
+		default:
+			t.name = strings.TrimPrefix(ref.Name, "refs/")
+		}
+
+		tips = append(tips, t)
+	}
+
+	slices.SortStableFunc(tips, func(a, b tip) int {
+		if a.fromTag != b.fromTag {
+			if a.fromTag {
+				return -1
+			}
+			return 1
+		}
+		return a.date.Compare(b.date)
+	})
+
+	for _, t := range tips {
+		if err := r.nameFrom(p, t.sha, t.name, t.date, t.fromTag, t.deref); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *RevNamer) Name(sha string) string {
+	/*
+		"" when no ref reaches sha
+	*/
+	name, ok := r.names[sha]
+	if !ok {
+		return ""
+	}
+	if name.gen == 0 {
+		return name.tip
+	}
+
+	return strings.TrimSuffix(name.tip, "^0") + "~" + strconv.Itoa(name.gen)
+}
+
+func (r *RevNamer) Named() []string {
+	/*
+		every named commit, sorted by sha
+	*/
+	ret := []string{}
+	for sha := range r.names {
+		ret = append(ret, sha)
+	}
+	slices.Sort(ret)
+
+	return ret
+}
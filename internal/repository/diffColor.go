@@ -0,0 +1,613 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/neet-007/git_in_go/internal/diff"
+)
+
+const (
+	ColorMovedNo          = "no"
+	ColorMovedPlain       = "plain"
+	ColorMovedBlocks      = "blocks"
+	ColorMovedZebra       = "zebra"
+	ColorMovedDimmedZebra = "dimmed-zebra"
+
+	colorMovedMinAlnum = 20
+)
+
+func ParseColorMoved(mode string) (string, error) {
+	switch mode {
+	case "default", ColorMovedZebra:
+		return ColorMovedZebra, nil
+	case "dimmed_zebra", ColorMovedDimmedZebra:
+		return ColorMovedDimmedZebra, nil
+	case ColorMovedNo, ColorMovedPlain, ColorMovedBlocks:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("color moved setting must be one of 'no', 'default', 'blocks', 'zebra', 'dimmed-zebra', 'plain'\n")
+}
+
+type diffColors struct {
+	reset      string
+	context    string
+	meta       string
+	frag       string
+	function   string
+	old        string
+	new        string
+	whitespace string
+
+	// indexed by the moved flags of a line, moved, moved and alt, moved and dim, all three
+	oldMoved []string
+	newMoved []string
+}
+
+func newDiffColors(color bool) diffColors {
+	/*
+		git's default colors, every color is empty without color so the same code writes both
+	*/
+	if !color {
+		return diffColors{oldMoved: make([]string, 4), newMoved: make([]string, 4)}
+	}
+
+	return diffColors{
+		reset:      "\033[m",
+		meta:       "\033[1m",
+		frag:       "\033[36m",
+		old:        "\033[31m",
+		new:        "\033[32m",
+		whitespace: "\033[41m",
+		oldMoved:   []string{"\033[1;35m", "\033[1;34m", "\033[2m", "\033[2;3m"},
+		newMoved:   []string{"\033[1;36m", "\033[1;33m", "\033[2m", "\033[2;3m"},
+	}
+}
+
+const (
+	symbolMeta = iota
+	symbolFilePair
+	symbolFrag
+	symbolContext
+	symbolPlus
+	symbolMinus
+	symbolIncomplete
+	symbolPlain
+	symbolWords
+	symbolWordsContext
+	symbolWordsPorcelain
+)
+
+const (
+	movedLine = 1 << iota
+	movedAlt
+	movedDim
+	blankAtEOF
+)
+
+type diffSymbol struct {
+	kind     int
+	line     string
+	function string
+	flags    int
+	id       int
+}
+
+type diffEmitter struct {
+	symbols []diffSymbol
+	colors  diffColors
+}
+
+func (e *diffEmitter) emit(kind int, line string, flags int) {
+	e.symbols = append(e.symbols, diffSymbol{kind: kind, line: line, flags: flags})
+}
+
+func (e *diffEmitter) writeLine(b *strings.Builder, color string, first byte, line string) {
+	/*
+		git's emit_line_0, the newline and a CR before it stay outside of the color
+	*/
+	newline := strings.HasSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\n")
+	cr := strings.HasSuffix(line, "\r")
+	line = strings.TrimSuffix(line, "\r")
+
+	if line != "" || first != 0 {
+		b.WriteString(color)
+		if first != 0 {
+			b.WriteByte(first)
+		}
+		b.WriteString(line)
+		b.WriteString(e.colors.reset)
+	}
+
+	if cr {
+		b.WriteByte('\r')
+	}
+	if newline {
+		b.WriteByte('\n')
+	}
+}
+
+func (e *diffEmitter) writeWhitespace(b *strings.Builder, color string, line string) {
+	/*
+		git's ws_check_emit for the default whitespace rules, spaces before a tab in the indent
+		and whitespace at the end of the line are highlighted
+	*/
+	newline := strings.HasSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\n")
+
+	trailing := len(line)
+	for trailing > 0 && isSpaceByte(line[trailing-1]) {
+		trailing--
+	}
+
+	written := 0
+	for i := 0; i < trailing; i++ {
+		if line[i] == ' ' {
+			continue
+		}
+		if line[i] != '\t' {
+			break
+		}
+
+		if written < i {
+			b.WriteString(e.colors.whitespace + line[written:i] + e.colors.reset + "\t")
+		} else {
+			b.WriteString(line[written : i+1])
+		}
+		written = i + 1
+	}
+
+	if trailing > written {
+		b.WriteString(color + line[written:trailing] + e.colors.reset)
+	}
+	if trailing != len(line) {
+		b.WriteString(e.colors.whitespace + line[trailing:] + e.colors.reset)
+	}
+	if newline {
+		b.WriteByte('\n')
+	}
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func isBlankLine(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if !isSpaceByte(line[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *diffEmitter) render(w io.Writer) error {
+	c := e.colors
+
+	var b strings.Builder
+	for _, s := range e.symbols {
+		switch s.kind {
+		case symbolMeta:
+			b.WriteString(c.meta + s.line + c.reset + "\n")
+		case symbolFilePair:
+			b.WriteString(c.meta + s.line + c.reset)
+			if strings.Contains(s.line[4:], " ") {
+				b.WriteString("\t")
+			}
+			b.WriteString("\n")
+		case symbolFrag:
+			b.WriteString(c.frag + s.line + c.reset)
+			if s.function != "" {
+				b.WriteString(c.context + " " + c.reset + c.function + s.function + c.reset)
+			}
+			b.WriteString("\n")
+		case symbolContext:
+			e.writeLine(&b, c.context, ' ', s.line)
+		case symbolMinus:
+			color := c.old
+			if s.flags&movedLine != 0 {
+				color = c.oldMoved[s.flags&(movedAlt|movedDim)>>1]
+			}
+			e.writeLine(&b, color, '-', s.line)
+		case symbolPlus:
+			color := c.new
+			if s.flags&movedLine != 0 {
+				color = c.newMoved[s.flags&(movedAlt|movedDim)>>1]
+			}
+
+			switch {
+			case c.whitespace == "":
+				e.writeLine(&b, color, '+', s.line)
+			case s.flags&blankAtEOF != 0:
+				e.writeLine(&b, c.whitespace, '+', s.line)
+			default:
+				e.writeLine(&b, color, '+', "")
+				e.writeWhitespace(&b, color, s.line)
+			}
+		case symbolIncomplete, symbolWordsContext:
+			e.writeLine(&b, c.context, 0, s.line)
+		case symbolWordsPorcelain:
+			e.writeLine(&b, c.context, 0, s.line)
+			b.WriteString("~\n")
+		case symbolPlain, symbolWords:
+			b.WriteString(s.line)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func countTrailingBlank(data []byte) int {
+	/*
+		git's count_trailing_blank, the first line of data is never counted
+	*/
+	if len(data) == 0 {
+		return 0
+	}
+
+	ptr := len(data) - 1
+	if data[ptr] == '\n' {
+		ptr--
+	}
+
+	ret := 0
+	for 0 < ptr {
+		prev := ptr
+		for prev >= 0 && data[prev] != '\n' {
+			prev--
+		}
+		if !isBlankLine(string(data[prev+1 : ptr+1])) {
+			break
+		}
+
+		ret++
+		ptr = prev - 1
+	}
+
+	return ret
+}
+
+func trailingBlankStart(a []byte, b []byte) (int, int) {
+	/*
+		the first of the blank lines at the end of a and b, 0 when b does not end in more
+		blank lines than a
+	*/
+	blankA, blankB := countTrailingBlank(a), countTrailingBlank(b)
+	if blankB <= blankA {
+		return 0, 0
+	}
+
+	return len(diff.Split(a)) - blankA + 1, len(diff.Split(b)) - blankB + 1
+}
+
+type diffWords struct {
+	re        *regexp.Regexp
+	style     diff.WordStyle
+	porcelain bool
+	minus     strings.Builder
+	plus      strings.Builder
+}
+
+func (e *diffEmitter) flushWords(words *diffWords) error {
+	if words.minus.Len() == 0 && words.plus.Len() == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	if err := diff.WriteWordDiff(&b, words.minus.String(), words.plus.String(), words.re, words.style); err != nil {
+		return err
+	}
+	words.minus.Reset()
+	words.plus.Reset()
+
+	e.emit(symbolWords, b.String(), 0)
+	return nil
+}
+
+func (e *diffEmitter) emitHunks(a []byte, b []byte, hunks []diff.Hunk, words *diffWords) error {
+	/*
+		the lines of the hunks as symbols, with words the removed and added lines are collected
+		until the next context line or hunk and written as a word diff
+		like git the line numbers run one ahead, they only decide which added blank lines are
+		at the end of the file
+	*/
+	eofOld, eofNew := 0, 0
+	if e.colors.whitespace != "" {
+		eofOld, eofNew = trailingBlankStart(a, b)
+	}
+
+	for _, hunk := range hunks {
+		if words != nil {
+			if err := e.flushWords(words); err != nil {
+				return err
+			}
+		}
+
+		header := hunk.Header()
+		if hunk.Function != "" {
+			header = strings.TrimSuffix(header, " "+hunk.Function)
+		}
+		e.symbols = append(e.symbols, diffSymbol{kind: symbolFrag, line: header, function: hunk.Function})
+
+		lnoOld, lnoNew := hunk.OldStart, hunk.NewStart
+		if hunk.OldLines == 0 {
+			lnoOld--
+		}
+		if hunk.NewLines == 0 {
+			lnoNew--
+		}
+
+		for _, line := range hunk.Lines {
+			text := line.Text
+			incomplete := !strings.HasSuffix(text, "\n")
+			if incomplete {
+				text += "\n"
+			}
+
+			if words != nil {
+				switch line.Op {
+				case '-':
+					words.minus.WriteString(text)
+				case '+':
+					words.plus.WriteString(text)
+				default:
+					if err := e.flushWords(words); err != nil {
+						return err
+					}
+					if words.porcelain {
+						e.emit(symbolWordsPorcelain, " "+text, 0)
+					} else {
+						e.emit(symbolWordsContext, text, 0)
+					}
+				}
+				continue
+			}
+
+			switch line.Op {
+			case '-':
+				lnoOld++
+				e.emit(symbolMinus, text, 0)
+			case '+':
+				lnoNew++
+				flags := 0
+				if eofOld != 0 && eofOld <= lnoOld && eofNew <= lnoNew && isBlankLine(text) {
+					flags = blankAtEOF
+				}
+				e.emit(symbolPlus, text, flags)
+			default:
+				lnoOld++
+				lnoNew++
+				e.emit(symbolContext, text, 0)
+			}
+
+			if incomplete {
+				lnoOld++
+				e.emit(symbolIncomplete, "\\ No newline at end of file\n", 0)
+			}
+		}
+	}
+
+	if words != nil {
+		return e.flushWords(words)
+	}
+
+	return nil
+}
+
+type movedEntry struct {
+	symbol    int
+	nextLine  *movedEntry
+	nextMatch *movedEntry
+}
+
+type movedLists struct {
+	add *movedEntry
+	del *movedEntry
+}
+
+func (e *diffEmitter) movedEntries() []movedLists {
+	/*
+		every added and removed line gets the id of its content, the lines with the same id are
+		chained newest first and every line points at the next one of the same run
+	*/
+	ids := map[string]int{}
+	ret := []movedLists{}
+
+	var prev *movedEntry
+	for n := range e.symbols {
+		s := &e.symbols[n]
+		if s.kind != symbolPlus && s.kind != symbolMinus {
+			prev = nil
+			continue
+		}
+
+		id, ok := ids[s.line]
+		if !ok {
+			id = len(ret)
+			ids[s.line] = id
+			ret = append(ret, movedLists{})
+		}
+		s.id = id
+
+		entry := &movedEntry{symbol: n}
+		if prev != nil && e.symbols[prev.symbol].kind == s.kind {
+			prev.nextLine = entry
+		}
+		prev = entry
+
+		if s.kind == symbolPlus {
+			entry.nextMatch = ret[id].add
+			ret[id].add = entry
+		} else {
+			entry.nextMatch = ret[id].del
+			ret[id].del = entry
+		}
+	}
+
+	return ret
+}
+
+func (e *diffEmitter) adjustLastBlock(mode string, n int, blockLength int) bool {
+	/*
+		a block with fewer than 20 alphanumeric chars is not worth showing as moved, false when
+		the block ending before n is empty or was unmarked
+	*/
+	if mode == ColorMovedPlain {
+		return blockLength > 0
+	}
+
+	alnum := 0
+	for i := 1; i <= blockLength; i++ {
+		line := e.symbols[n-i].line
+		for j := 0; j < len(line); j++ {
+			if c := line[j]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+				alnum++
+				if alnum >= colorMovedMinAlnum {
+					return true
+				}
+			}
+		}
+	}
+
+	for i := 1; i <= blockLength; i++ {
+		e.symbols[n-i].flags &^= movedLine | movedAlt
+	}
+
+	return false
+}
+
+func (e *diffEmitter) markMoved(mode string) {
+	/*
+		git's mark_color_as_moved, a removed line that is added somewhere else, or the other way
+		around, is moved, runs of such lines matching a run on the other side form blocks and
+		zebra mode alternates the color of neighbouring blocks
+	*/
+	lists := e.movedEntries()
+
+	pmb := []*movedEntry{}
+	flipped, blockLength := false, 0
+	movedKind := -1
+
+	n := 0
+	for ; n < len(e.symbols); n++ {
+		var match *movedEntry
+		s := &e.symbols[n]
+
+		switch s.kind {
+		case symbolPlus:
+			match = lists[s.id].del
+		case symbolMinus:
+			match = lists[s.id].add
+		default:
+			flipped = false
+		}
+
+		if len(pmb) > 0 && (match == nil || s.kind != movedKind) {
+			if !e.adjustLastBlock(mode, n, blockLength) && blockLength > 1 {
+				match = nil
+				n -= blockLength
+			}
+			pmb = pmb[:0]
+			blockLength = 0
+			flipped = false
+		}
+		if match == nil {
+			movedKind = -1
+			continue
+		}
+
+		if mode == ColorMovedPlain {
+			s.flags |= movedLine
+			continue
+		}
+
+		advanced := pmb[:0]
+		for _, m := range pmb {
+			if m.nextLine != nil && e.symbols[m.nextLine.symbol].id == s.id {
+				advanced = append(advanced, m.nextLine)
+			}
+		}
+		pmb = advanced
+
+		if len(pmb) == 0 {
+			contiguous := e.adjustLastBlock(mode, n, blockLength)
+
+			if !contiguous && blockLength > 1 {
+				n -= blockLength
+			} else {
+				for m := match; m != nil; m = m.nextMatch {
+					pmb = append(pmb, m)
+				}
+			}
+
+			if contiguous && len(pmb) > 0 && movedKind == s.kind {
+				flipped = !flipped
+			} else {
+				flipped = false
+			}
+
+			if len(pmb) > 0 {
+				movedKind = s.kind
+			} else {
+				movedKind = -1
+			}
+
+			blockLength = 0
+		}
+
+		if len(pmb) > 0 {
+			blockLength++
+			s.flags |= movedLine
+			if flipped && mode != ColorMovedBlocks {
+				s.flags |= movedAlt
+			}
+		}
+	}
+
+	e.adjustLastBlock(mode, n, blockLength)
+}
+
+func (e *diffEmitter) dimMoved() {
+	/*
+		git's dim_moved_lines, only the first and last lines of a moved block keep their color
+	*/
+	isChange := func(s *diffSymbol) bool {
+		return s.kind == symbolPlus || s.kind == symbolMinus
+	}
+	zebra := movedLine | movedAlt
+
+	for n := range e.symbols {
+		l := &e.symbols[n]
+		if !isChange(l) || l.flags&movedLine == 0 {
+			continue
+		}
+
+		var prev, next *diffSymbol
+		if n > 0 && isChange(&e.symbols[n-1]) {
+			prev = &e.symbols[n-1]
+		}
+		if n+1 < len(e.symbols) && isChange(&e.symbols[n+1]) {
+			next = &e.symbols[n+1]
+		}
+
+		if prev != nil && prev.flags&zebra == l.flags&zebra && next != nil && next.flags&zebra == l.flags&zebra {
+			l.flags |= movedDim
+			continue
+		}
+
+		if prev != nil && prev.flags&movedLine != 0 && prev.flags&movedAlt != l.flags&movedAlt {
+			continue
+		}
+		if next != nil && next.flags&movedLine != 0 && next.flags&movedAlt != l.flags&movedAlt {
+			continue
+		}
+
+		l.flags |= movedDim
+	}
+}
@@ -0,0 +1,680 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/neet-007/git_in_go/internal/diff"
+)
+
+type DiffOptions struct {
+	Diff        diff.Options
+	Renames     bool
+	Copies      bool
+	RenameScore int
+	Patch       bool
+	Stat        bool
+	NumStat     bool
+	NameOnly    bool
+	NameStatus  bool
+	Color       bool
+	ColorMoved  string
+	WordDiff    string
+	WordRegex   *regexp.Regexp
+}
+
+type DiffEntry struct {
+	Path     string
+	Mode     string
+	Sha      string
+	worktree bool
+}
+
+type DiffFilePair struct {
+	Status byte
+	Score  int
+	Old    DiffEntry
+	New    DiffEntry
+}
+
+func (repo *Repository) DiffTreeEntries(ref string) (map[string]DiffEntry, error) {
+	leaves, err := repo.treeToLeafDict(ref, "")
+	if err != nil {
+		return map[string]DiffEntry{}, err
+	}
+
+	ret := map[string]DiffEntry{}
+	for name, leaf := range *leaves {
+		ret[name] = DiffEntry{Path: name, Mode: string(leaf.Mode), Sha: leaf.Sha}
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) DiffIndexEntries(index *GitIndex) map[string]DiffEntry {
+	ret := map[string]DiffEntry{}
+	for _, e := range index.Entries {
+		ret[e.Name] = DiffEntry{Path: e.Name, Mode: fmt.Sprintf("%02o%04o", e.ModeType, e.ModePerms), Sha: e.Sha}
+	}
+
+	return ret
+}
+
+func (repo *Repository) DiffWorktreeEntries(index *GitIndex) (map[string]DiffEntry, error) {
+	/*
+		the files of the index as they are in the worktree, files missing from the worktree
+		are left out
+	*/
+	ret := map[string]DiffEntry{}
+	for _, e := range index.Entries {
+		info, err := os.Lstat(filepath.Join(repo.Worktree, filepath.FromSlash(e.Name)))
+		if err != nil {
+			continue
+		}
+
+		entry := DiffEntry{Path: e.Name, Mode: "100644", worktree: true}
+		switch {
+		case e.ModeType == 0b1110:
+			entry.Mode, entry.Sha, entry.worktree = "160000", e.Sha, false
+			ret[e.Name] = entry
+			continue
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Mode = "120000"
+		case info.IsDir():
+			continue
+		case info.Mode().Perm()&0o111 != 0:
+			entry.Mode = "100755"
+		}
+
+		entry.Sha, err = repo.worktreeFileSha(e.Name)
+		if err != nil {
+			return map[string]DiffEntry{}, err
+		}
+
+		ret[e.Name] = entry
+	}
+
+	return ret, nil
+}
+
+func diffPathMatch(name string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+
+	for _, path := range paths {
+		if pathspecMatch(name, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func diffModeType(mode string) string {
+	if strings.HasPrefix(mode, "100") {
+		return "100"
+	}
+
+	return mode
+}
+
+func DiffPairs(old map[string]DiffEntry, new map[string]DiffEntry, paths []string) []DiffFilePair {
+	/*
+		paths: default val is [], every path, otherwise worktree relative paths and directories
+		the changed files between old and new sorted by path, A, D, M or T when a file changes
+		between a regular file, a symlink and a submodule
+	*/
+	names := []string{}
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	ret := []DiffFilePair{}
+	for _, name := range names {
+		if !diffPathMatch(name, paths) {
+			continue
+		}
+
+		a, inOld := old[name]
+		b, inNew := new[name]
+		switch {
+		case !inOld:
+			ret = append(ret, DiffFilePair{Status: 'A', New: b})
+		case !inNew:
+			ret = append(ret, DiffFilePair{Status: 'D', Old: a})
+		case diffModeType(a.Mode) != diffModeType(b.Mode):
+			ret = append(ret, DiffFilePair{Status: 'T', Old: a, New: b})
+		case a.Sha != b.Sha || a.Mode != b.Mode:
+			ret = append(ret, DiffFilePair{Status: 'M', Old: a, New: b})
+		}
+	}
+
+	return ret
+}
+
+func (repo *Repository) diffContent(entry DiffEntry) ([]byte, error) {
+	if entry.Mode == "" {
+		return []byte{}, nil
+	}
+	if entry.Mode == "160000" {
+		return []byte("Subproject commit " + entry.Sha + "\n"), nil
+	}
+
+	if entry.worktree {
+		fullPath := filepath.Join(repo.Worktree, filepath.FromSlash(entry.Path))
+		if entry.Mode == "120000" {
+			target, err := os.Readlink(fullPath)
+			return []byte(target), err
+		}
+
+		return os.ReadFile(fullPath)
+	}
+
+	obj, err := repo.ObjectRead(entry.Sha)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	blob, ok := obj.(*GitBlob)
+	if !ok {
+		return []byte{}, fmt.Errorf("expected blob for path:%s sha:%s\n", entry.Path, entry.Sha)
+	}
+
+	return blob.BlobData, nil
+}
+
+func diffRenameName(a string, b string) string {
+	/*
+		git's pprint_rename, the common leading and trailing directories are written once
+		around braces, like dir/{a => b}/file
+	*/
+	pfx := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			pfx = i + 1
+		}
+	}
+
+	at := func(s string, i int) byte {
+		if i == len(s) {
+			return 0
+		}
+		return s[i]
+	}
+
+	sfx := 0
+	adjust := 0
+	if pfx > 0 {
+		adjust = 1
+	}
+	for i, j := len(a), len(b); pfx-adjust <= i && pfx-adjust <= j && at(a, i) == at(b, j); i, j = i-1, j-1 {
+		if at(a, i) == '/' {
+			sfx = len(a) - i
+		}
+	}
+
+	midA := max(len(a)-pfx-sfx, 0)
+	midB := max(len(b)-pfx-sfx, 0)
+	if pfx+sfx == 0 {
+		return a + " => " + b
+	}
+
+	return a[:pfx] + "{" + a[pfx:pfx+midA] + " => " + b[pfx:pfx+midB] + "}" + a[len(a)-sfx:]
+}
+
+func diffPrintName(pair DiffFilePair) string {
+	switch pair.Status {
+	case 'D':
+		return pair.Old.Path
+	case 'R', 'C':
+		return diffRenameName(pair.Old.Path, pair.New.Path)
+	}
+
+	return pair.New.Path
+}
+
+type diffStatFile struct {
+	name    string
+	binary  bool
+	added   int
+	deleted int
+}
+
+func (repo *Repository) diffStatOf(pair DiffFilePair, opts diff.Options) (diffStatFile, error) {
+	/*
+		counts the added and deleted lines, or the sizes in bytes for binary files
+	*/
+	ret := diffStatFile{name: diffPrintName(pair)}
+
+	a, err := repo.diffContent(pair.Old)
+	if err != nil {
+		return ret, err
+	}
+	b, err := repo.diffContent(pair.New)
+	if err != nil {
+		return ret, err
+	}
+
+	if diff.IsBinary(a) || diff.IsBinary(b) {
+		ret.binary = true
+		ret.deleted, ret.added = len(a), len(b)
+		return ret, nil
+	}
+
+	for _, c := range diff.Diff(diff.Split(a), diff.Split(b), opts) {
+		ret.deleted += c.OldLines
+		ret.added += c.NewLines
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) diffAbbrev(sha string) string {
+	if sha == nullSha {
+		return sha[:7]
+	}
+
+	return repo.ObjectAbbrev(sha, 7)
+}
+
+func (repo *Repository) diffWritePatchOne(e *diffEmitter, pair DiffFilePair, opts DiffOptions, words *diffWords) error {
+	/*
+		one file of a patch, pair.Old or pair.New has an empty mode when the file is created
+		or deleted
+	*/
+	old, new := pair.Old, pair.New
+	nameOld, nameNew := old.Path, new.Path
+	if old.Mode == "" {
+		nameOld = nameNew
+	}
+	if new.Mode == "" {
+		nameNew = nameOld
+	}
+
+	header := []string{fmt.Sprintf("diff --git a/%s b/%s", nameOld, nameNew)}
+	labelOld, labelNew := "a/"+nameOld, "b/"+nameNew
+	oldSha, newSha := old.Sha, new.Sha
+
+	switch {
+	case old.Mode == "":
+		header = append(header, "new file mode "+new.Mode)
+		labelOld, oldSha = "/dev/null", nullSha
+	case new.Mode == "":
+		header = append(header, "deleted file mode "+old.Mode)
+		labelNew, newSha = "/dev/null", nullSha
+	case old.Mode != new.Mode:
+		header = append(header, "old mode "+old.Mode, "new mode "+new.Mode)
+	}
+
+	switch pair.Status {
+	case 'R':
+		header = append(header, fmt.Sprintf("similarity index %d%%", pair.Score*100/MaxRenameScore), "rename from "+nameOld, "rename to "+nameNew)
+	case 'C':
+		header = append(header, fmt.Sprintf("similarity index %d%%", pair.Score*100/MaxRenameScore), "copy from "+nameOld, "copy to "+nameNew)
+	}
+
+	if oldSha != newSha {
+		index := fmt.Sprintf("index %s..%s", repo.diffAbbrev(oldSha), repo.diffAbbrev(newSha))
+		if old.Mode == new.Mode {
+			index += " " + old.Mode
+		}
+		header = append(header, index)
+	}
+
+	a, err := repo.diffContent(old)
+	if err != nil {
+		return err
+	}
+	b, err := repo.diffContent(new)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range header {
+		e.emit(symbolMeta, line, 0)
+	}
+
+	if diff.IsBinary(a) || diff.IsBinary(b) {
+		if string(a) != string(b) {
+			e.emit(symbolPlain, fmt.Sprintf("Binary files %s and %s differ\n", labelOld, labelNew), 0)
+		}
+		return nil
+	}
+
+	linesA, linesB := diff.Split(a), diff.Split(b)
+	hunks := diff.Hunks(linesA, linesB, diff.Diff(linesA, linesB, opts.Diff), opts.Diff)
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	e.emit(symbolFilePair, "--- "+labelOld, 0)
+	e.emit(symbolFilePair, "+++ "+labelNew, 0)
+
+	return e.emitHunks(a, b, hunks, words)
+}
+
+func (repo *Repository) DiffWritePatch(w io.Writer, pairs []DiffFilePair, opts DiffOptions) error {
+	/*
+		like git, a change between a file and a symlink is written as a deletion and a creation
+		moved lines are found across all files, so the whole patch is collected before it is
+		written
+	*/
+	e := &diffEmitter{colors: newDiffColors(opts.Color)}
+
+	var words *diffWords
+	if opts.WordDiff != "" {
+		style, err := diff.NewWordStyle(opts.WordDiff)
+		if err != nil {
+			return err
+		}
+		style.Old.Color, style.New.Color, style.Context.Color = e.colors.old, e.colors.new, e.colors.context
+		style.Reset = e.colors.reset
+
+		words = &diffWords{re: opts.WordRegex, style: style, porcelain: opts.WordDiff == diff.WordsPorcelain}
+	}
+
+	for _, pair := range pairs {
+		if pair.Status == 'T' {
+			if err := repo.diffWritePatchOne(e, DiffFilePair{Status: 'D', Old: pair.Old}, opts, words); err != nil {
+				return err
+			}
+			pair = DiffFilePair{Status: 'A', New: pair.New}
+		}
+
+		if err := repo.diffWritePatchOne(e, pair, opts, words); err != nil {
+			return err
+		}
+	}
+
+	if opts.Color && opts.ColorMoved != "" && opts.ColorMoved != ColorMovedNo {
+		e.markMoved(opts.ColorMoved)
+		if opts.ColorMoved == ColorMovedDimmedZebra {
+			e.dimMoved()
+		}
+	}
+
+	return e.render(w)
+}
+
+func diffStatColumns() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	return 80
+}
+
+func scaleLinear(it int, width int, maxChange int) int {
+	if it == 0 {
+		return 0
+	}
+
+	return 1 + it*(width-1)/maxChange
+}
+
+func (repo *Repository) DiffWriteStat(w io.Writer, pairs []DiffFilePair, opts DiffOptions) error {
+	/*
+		git's diffstat, names and graphs share the width of the terminal, taken from COLUMNS
+		or 80, the graph gets at most 3/8 of it when both do not fit
+	*/
+	colors := newDiffColors(opts.Color)
+
+	files := []diffStatFile{}
+	for _, pair := range pairs {
+		file, err := repo.diffStatOf(pair, opts.Diff)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	maxLen, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+	for _, file := range files {
+		maxLen = max(maxLen, len(file.name))
+
+		if file.binary {
+			binWidth = max(binWidth, 14+len(strconv.Itoa(file.added))+len(strconv.Itoa(file.deleted)))
+			numberWidth = 3
+			continue
+		}
+
+		maxChange = max(maxChange, file.added+file.deleted)
+	}
+
+	width := diffStatColumns()
+	numberWidth = max(numberWidth, len(strconv.Itoa(maxChange)))
+	width = max(width, 16+6+numberWidth)
+
+	graphWidth := binWidth - 4
+	if maxChange+4 > binWidth {
+		graphWidth = maxChange
+	}
+	nameWidth := maxLen
+
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	adds, dels := 0, 0
+	for _, file := range files {
+		prefix, name := "", file.name
+		length := nameWidth
+		if nameWidth < len(name) {
+			prefix = "..."
+			length = max(length-3, 0)
+			name = name[len(name)-length:]
+			if i := strings.Index(name, "/"); i != -1 {
+				name = name[i:]
+			}
+		}
+		padding := max(length-len(name), 0)
+
+		if file.binary {
+			if _, err := fmt.Fprintf(w, " %s%s%*s | %*s", prefix, name, padding, "", numberWidth, "Bin"); err != nil {
+				return err
+			}
+			if file.added == 0 && file.deleted == 0 {
+				if _, err := io.WriteString(w, "\n"); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, " %s%d%s -> %s%d%s bytes\n", colors.old, file.deleted, colors.reset, colors.new, file.added, colors.reset); err != nil {
+				return err
+			}
+			continue
+		}
+
+		adds += file.added
+		dels += file.deleted
+
+		add, del := file.added, file.deleted
+		if graphWidth <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add != 0 && del != 0 {
+				total = 2
+			}
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+
+		space := ""
+		if file.added+file.deleted != 0 {
+			space = " "
+		}
+		graph := ""
+		if add > 0 {
+			graph += colors.new + strings.Repeat("+", add) + colors.reset
+		}
+		if del > 0 {
+			graph += colors.old + strings.Repeat("-", del) + colors.reset
+		}
+		if _, err := fmt.Fprintf(w, " %s%s%*s | %*d%s%s\n", prefix, name, padding, "", numberWidth, file.added+file.deleted, space, graph); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n", diffStatSummary(len(files), adds, dels))
+	return err
+}
+
+func diffStatSummary(files int, insertions int, deletions int) string {
+	if files == 0 {
+		return " 0 files changed"
+	}
+
+	plural := func(n int, one string, many string) string {
+		if n == 1 {
+			return fmt.Sprintf(one, n)
+		}
+		return fmt.Sprintf(many, n)
+	}
+
+	ret := plural(files, " %d file changed", " %d files changed")
+	if insertions != 0 || deletions == 0 {
+		ret += plural(insertions, ", %d insertion(+)", ", %d insertions(+)")
+	}
+	if deletions != 0 || insertions == 0 {
+		ret += plural(deletions, ", %d deletion(-)", ", %d deletions(-)")
+	}
+
+	return ret
+}
+
+func (repo *Repository) DiffWriteNumStat(w io.Writer, pairs []DiffFilePair, opts diff.Options) error {
+	for _, pair := range pairs {
+		file, err := repo.diffStatOf(pair, opts)
+		if err != nil {
+			return err
+		}
+
+		if file.binary {
+			_, err = fmt.Fprintf(w, "-\t-\t%s\n", file.name)
+		} else {
+			_, err = fmt.Fprintf(w, "%d\t%d\t%s\n", file.added, file.deleted, file.name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func DiffWriteNames(w io.Writer, pairs []DiffFilePair, status bool) error {
+	for _, pair := range pairs {
+		name := pair.New.Path
+		if pair.Status == 'D' {
+			name = pair.Old.Path
+		}
+
+		var err error
+		switch {
+		case status && (pair.Status == 'R' || pair.Status == 'C'):
+			_, err = fmt.Fprintf(w, "%c%03d\t%s\t%s\n", pair.Status, pair.Score*100/MaxRenameScore, pair.Old.Path, name)
+		case status:
+			_, err = fmt.Fprintf(w, "%c\t%s\n", pair.Status, name)
+		default:
+			_, err = fmt.Fprintf(w, "%s\n", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func DiffWriteSummary(w io.Writer, pairs []DiffFilePair) error {
+	/*
+		git's --summary, created and deleted files, renames, copies and mode changes
+	*/
+	var b strings.Builder
+	for _, pair := range pairs {
+		switch pair.Status {
+		case 'A':
+			fmt.Fprintf(&b, " create mode %s %s\n", pair.New.Mode, pair.New.Path)
+		case 'D':
+			fmt.Fprintf(&b, " delete mode %s %s\n", pair.Old.Mode, pair.Old.Path)
+		case 'R', 'C':
+			kind := "rename"
+			if pair.Status == 'C' {
+				kind = "copy"
+			}
+			fmt.Fprintf(&b, " %s %s (%d%%)\n", kind, diffRenameName(pair.Old.Path, pair.New.Path), pair.Score*100/MaxRenameScore)
+			if pair.Old.Mode != pair.New.Mode {
+				fmt.Fprintf(&b, " mode change %s => %s\n", pair.Old.Mode, pair.New.Mode)
+			}
+		default:
+			if pair.Old.Mode != pair.New.Mode {
+				fmt.Fprintf(&b, " mode change %s => %s %s\n", pair.Old.Mode, pair.New.Mode, pair.New.Path)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (repo *Repository) DiffWrite(w io.Writer, pairs []DiffFilePair, opts DiffOptions) error {
+	/*
+		opts.Patch: default val is true when no other format is asked for
+		names come first, then numstat and stat, then the patch after a blank line
+	*/
+	if opts.NameOnly || opts.NameStatus {
+		return DiffWriteNames(w, pairs, opts.NameStatus)
+	}
+
+	if opts.NumStat {
+		if err := repo.DiffWriteNumStat(w, pairs, opts.Diff); err != nil {
+			return err
+		}
+	}
+	if opts.Stat {
+		if err := repo.DiffWriteStat(w, pairs, opts); err != nil {
+			return err
+		}
+	}
+
+	if !opts.Patch && (opts.Stat || opts.NumStat) {
+		return nil
+	}
+
+	if (opts.Stat || opts.NumStat) && len(pairs) > 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	return repo.DiffWritePatch(w, pairs, opts)
+}
@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/neet-007/git_in_go/internal/diff"
+)
+
+const (
+	MaxRenameScore      = 60000
+	DefaultRenameScore  = 30000
+	renameCandidates    = 4
+	renameExactAttempts = 100
+	spanHashBase        = 107927
+)
+
+func ParseRenameScore(s string) int {
+	/*
+		git's similarity score, "50%", "0.5" and "5" are all half of MaxRenameScore, ""
+		is the default
+	*/
+	if s == "" {
+		return DefaultRenameScore
+	}
+
+	num, scale := 0, 1
+	dot := false
+	for _, ch := range s {
+		if !dot && ch == '.' {
+			scale = 1
+			dot = true
+		} else if ch == '%' {
+			if dot {
+				scale *= 100
+			} else {
+				scale = 100
+			}
+			break
+		} else if ch >= '0' && ch <= '9' {
+			if scale < 100000 {
+				scale *= 10
+				num = num*10 + int(ch-'0')
+			}
+		} else {
+			break
+		}
+	}
+
+	if num >= scale {
+		return MaxRenameScore
+	}
+
+	return MaxRenameScore * num / scale
+}
+
+type renameSource struct {
+	entry DiffEntry
+	used  int
+}
+
+type renameDest struct {
+	entry DiffEntry
+	src   int
+	score int
+}
+
+type renameScore struct {
+	dst       int
+	src       int
+	score     int
+	nameScore int
+}
+
+func renameScoreCompare(a renameScore, b renameScore) int {
+	/*
+		best pairs first, unused slots last
+	*/
+	if a.dst < 0 {
+		if b.dst >= 0 {
+			return 1
+		}
+		return 0
+	}
+	if b.dst < 0 {
+		return -1
+	}
+
+	if a.score == b.score {
+		return b.nameScore - a.nameScore
+	}
+
+	return b.score - a.score
+}
+
+func recordIfBetter(m []renameScore, o renameScore) {
+	worst := 0
+	for i := 1; i < len(m); i++ {
+		if renameScoreCompare(m[i], m[worst]) > 0 {
+			worst = i
+		}
+	}
+
+	if renameScoreCompare(m[worst], o) > 0 {
+		m[worst] = o
+	}
+}
+
+func basenameSame(src string, dst string) bool {
+	i, j := len(src), len(dst)
+	for i > 0 && j > 0 {
+		i--
+		j--
+		if src[i] != dst[j] {
+			return false
+		}
+		if src[i] == '/' {
+			return true
+		}
+	}
+
+	return (i == 0 || src[i-1] == '/') && (j == 0 || dst[j-1] == '/')
+}
+
+func isRegularMode(mode string) bool {
+	return strings.HasPrefix(mode, "100")
+}
+
+func spanHash(data []byte) map[uint32]int {
+	/*
+		the bytes of data counted by the hash of the chunk they are in, chunks end at a newline
+		or after 64 bytes, like git a last chunk without newline is left out and the CR of a
+		CRLF does not count in text
+	*/
+	ret := map[uint32]int{}
+	text := !diff.IsBinary(data)
+
+	var accum1, accum2 uint32
+	n := 0
+	for i := 0; i < len(data); i++ {
+		c := uint32(data[i])
+		old := accum1
+
+		if text && c == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			continue
+		}
+
+		accum1 = accum1<<7 ^ accum2>>25
+		accum2 = accum2<<7 ^ old>>25
+		accum1 += c
+		n++
+		if n < 64 && c != '\n' {
+			continue
+		}
+
+		ret[(accum1+accum2*0x61)%spanHashBase] += n
+		n = 0
+		accum1, accum2 = 0, 0
+	}
+
+	return ret
+}
+
+type renameDetector struct {
+	repo    *Repository
+	content map[string][]byte
+	spans   map[string]map[uint32]int
+}
+
+func (d *renameDetector) load(entry DiffEntry) ([]byte, error) {
+	if data, ok := d.content[entry.Sha]; ok {
+		return data, nil
+	}
+
+	data, err := d.repo.diffContent(entry)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	d.content[entry.Sha] = data
+	return data, nil
+}
+
+func (d *renameDetector) similarity(src DiffEntry, dst DiffEntry, minScore int) (int, error) {
+	/*
+		how much of the larger file is made of chunks copied from src, 0 when either side is
+		not a regular file or the sizes are too far apart to reach minScore
+	*/
+	if !isRegularMode(src.Mode) || !isRegularMode(dst.Mode) {
+		return 0, nil
+	}
+
+	a, err := d.load(src)
+	if err != nil {
+		return 0, err
+	}
+	b, err := d.load(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	maxSize, baseSize := max(len(a), len(b)), min(len(a), len(b))
+	if maxSize*(MaxRenameScore-minScore) < (maxSize-baseSize)*MaxRenameScore {
+		return 0, nil
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for _, sha := range []string{src.Sha, dst.Sha} {
+		if _, ok := d.spans[sha]; !ok {
+			d.spans[sha] = spanHash(d.content[sha])
+		}
+	}
+
+	copied := 0
+	spansB := d.spans[dst.Sha]
+	for hash, count := range d.spans[src.Sha] {
+		copied += min(count, spansB[hash])
+	}
+
+	return copied * MaxRenameScore / maxSize, nil
+}
+
+func (repo *Repository) DiffRenames(pairs []DiffFilePair, copies bool, minScore int) ([]DiffFilePair, error) {
+	/*
+		git's diffcore-rename, an added file is paired with a deleted one, or with copies a
+		modified one too, first by identical content, then by unique basenames and then by the
+		best similarity scores above minScore
+		a source used more than once is copied to all but its last use, a source that is still
+		there is only ever copied
+	*/
+	d := &renameDetector{repo: repo, content: map[string][]byte{}, spans: map[string]map[uint32]int{}}
+
+	srcs := []*renameSource{}
+	dsts := []*renameDest{}
+	for _, pair := range pairs {
+		switch {
+		case pair.Status == 'A':
+			dsts = append(dsts, &renameDest{entry: pair.New, src: -1})
+		case pair.Status == 'D':
+			srcs = append(srcs, &renameSource{entry: pair.Old})
+		case copies:
+			srcs = append(srcs, &renameSource{entry: pair.Old, used: 1})
+		}
+	}
+
+	if len(dsts) == 0 || len(srcs) == 0 {
+		return pairs, nil
+	}
+
+	record := func(dst *renameDest, src int, score int) {
+		dst.src = src
+		dst.score = score
+		srcs[src].used++
+	}
+
+	for _, dst := range dsts {
+		best, bestScore, attempts := -1, -1, renameExactAttempts
+		for i, src := range srcs {
+			if src.entry.Sha != dst.entry.Sha {
+				continue
+			}
+			if (!isRegularMode(src.entry.Mode) || !isRegularMode(dst.entry.Mode)) && src.entry.Mode != dst.entry.Mode {
+				continue
+			}
+			if src.used > 0 && !copies {
+				continue
+			}
+
+			score := 0
+			if src.used == 0 {
+				score++
+			}
+			if basenameSame(src.entry.Path, dst.entry.Path) {
+				score++
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+				if score == 2 {
+					break
+				}
+			}
+
+			attempts--
+			if attempts == 0 {
+				break
+			}
+		}
+
+		if best != -1 {
+			record(dst, best, MaxRenameScore)
+		}
+	}
+
+	remaining := func() []int {
+		ret := []int{}
+		for i, src := range srcs {
+			if copies || src.used == 0 {
+				ret = append(ret, i)
+			}
+		}
+		return ret
+	}
+
+	if !copies {
+		sources := map[string]int{}
+		for _, i := range remaining() {
+			base := path.Base(srcs[i].entry.Path)
+			if _, ok := sources[base]; ok {
+				sources[base] = -1
+			} else {
+				sources[base] = i
+			}
+		}
+		dests := map[string]int{}
+		for i, dst := range dsts {
+			if dst.src != -1 {
+				continue
+			}
+			base := path.Base(dst.entry.Path)
+			if _, ok := dests[base]; ok {
+				dests[base] = -1
+			} else {
+				dests[base] = i
+			}
+		}
+
+		minBasenameScore := minScore + (MaxRenameScore-minScore)/2
+		for _, i := range remaining() {
+			base := path.Base(srcs[i].entry.Path)
+			j, ok := dests[base]
+			if !ok || j == -1 || sources[base] == -1 || dsts[j].src != -1 {
+				continue
+			}
+
+			score, err := d.similarity(srcs[i].entry, dsts[j].entry, minScore)
+			if err != nil {
+				return pairs, err
+			}
+			if score >= minBasenameScore {
+				record(dsts[j], i, score)
+			}
+		}
+	}
+
+	candidates := remaining()
+	mx := []renameScore{}
+	for i, dst := range dsts {
+		if dst.src != -1 {
+			continue
+		}
+
+		m := make([]renameScore, renameCandidates)
+		for k := range m {
+			m[k].dst = -1
+		}
+		for _, j := range candidates {
+			score, err := d.similarity(srcs[j].entry, dst.entry, minScore)
+			if err != nil {
+				return pairs, err
+			}
+
+			nameScore := 0
+			if basenameSame(srcs[j].entry.Path, dst.entry.Path) {
+				nameScore = 1
+			}
+			recordIfBetter(m, renameScore{dst: i, src: j, score: score, nameScore: nameScore})
+		}
+		mx = append(mx, m...)
+	}
+	slices.SortStableFunc(mx, renameScoreCompare)
+
+	findRenames := func(copying bool) {
+		for _, m := range mx {
+			if m.dst < 0 || m.score < minScore {
+				break
+			}
+			if dsts[m.dst].src != -1 || !copying && srcs[m.src].used > 0 {
+				continue
+			}
+			record(dsts[m.dst], m.src, m.score)
+		}
+	}
+	findRenames(false)
+	if copies {
+		findRenames(true)
+	}
+
+	moved := make([]bool, len(srcs))
+	for i, src := range srcs {
+		moved[i] = src.used > 0
+	}
+
+	ret := []DiffFilePair{}
+	iSrc, iDst := 0, 0
+	for _, pair := range pairs {
+		switch {
+		case pair.Status == 'A':
+			dst := dsts[iDst]
+			iDst++
+			if dst.src == -1 {
+				ret = append(ret, pair)
+				continue
+			}
+
+			src := srcs[dst.src]
+			status := byte('R')
+			src.used--
+			if src.used > 0 {
+				status = 'C'
+			}
+			ret = append(ret, DiffFilePair{Status: status, Score: dst.score, Old: src.entry, New: dst.entry})
+		case pair.Status == 'D':
+			if !moved[iSrc] {
+				ret = append(ret, pair)
+			}
+			iSrc++
+		default:
+			if copies {
+				iSrc++
+			}
+			ret = append(ret, pair)
+		}
+	}
+
+	return ret, nil
+}
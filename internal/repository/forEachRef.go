@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+type ForEachRefOptions struct {
+	Format   string
+	Sort     []string
+	Count    int
+	Patterns []string
+	PointsAt string
+	Merged   string
+	Contains string
+}
+
+type refAtomValue struct {
+	Text    string
+	SortKey int64
+	Numeric bool
+}
+
+type forEachRefItem struct {
+	Ref    Ref
+	Obj    GitObject
+	Type   string
+	Peeled string
+}
+
+func (repo *Repository) ObjectPeel(sha string) (string, error) {
+	/*
+		follows annotated tags until a non tag object is reached
+	*/
+	for {
+		obj, err := repo.ObjectRead(sha)
+		if err != nil {
+			return "", err
+		}
+
+		tag, ok := obj.(*GitTag)
+		if !ok {
+			return sha, nil
+		}
+
+		object, ok := (*(*tag.Kvlm).Map)["object"]
+		if !ok || len(object) == 0 {
+			return "", fmt.Errorf("tag without object sha:%s\n", sha)
+		}
+		sha = string(object[0])
+	}
+}
+
+func refPatternMatch(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if name == pattern {
+			return true
+		}
+		if strings.HasPrefix(name, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func objectMessage(obj GitObject) string {
+	var message []byte
+	switch o := obj.(type) {
+	case *GitCommit:
+		message = joinKvlmValue((*(*o.Kvlm).Map)[""])
+	case *GitTag:
+		message = joinKvlmValue((*(*o.Kvlm).Map)[""])
+	}
+
+	return string(message)
+}
+
+func joinKvlmValue(values [][]byte) []byte {
+	ret := []byte{}
+	for _, v := range values {
+		ret = append(ret, v...)
+	}
+
+	return ret
+}
+
+func MessageSubject(message string) string {
+	paragraph := strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)[0]
+	return strings.Join(strings.Fields(strings.ReplaceAll(paragraph, "\n", " ")), " ")
+}
+
+func (repo *Repository) forEachRefAtom(item *forEachRefItem, atom string) (refAtomValue, error) {
+	name, modifier, _ := strings.Cut(atom, ":")
+
+	signatureAtom := func(key string) (refAtomValue, error) {
+		var raw [][]byte
+		switch o := item.Obj.(type) {
+		case *GitCommit:
+			raw = (*(*o.Kvlm).Map)[key]
+		case *GitTag:
+			raw = (*(*o.Kvlm).Map)[key]
+		}
+		if len(raw) == 0 {
+			return refAtomValue{Numeric: true}, nil
+		}
+
+		sig, err := ParseSignature(raw[0])
+		if err != nil {
+			return refAtomValue{}, err
+		}
+
+		return refAtomValue{Text: FormatDate(sig.When, modifier), SortKey: sig.When.Unix(), Numeric: true}, nil
+	}
+
+	switch name {
+	case "refname":
+		if modifier == "short" {
+			return refAtomValue{Text: RefShortName(item.Ref.Name)}, nil
+		}
+		return refAtomValue{Text: item.Ref.Name}, nil
+	case "objectname":
+		if modifier == "short" {
+			return refAtomValue{Text: item.Ref.Sha[:7]}, nil
+		}
+		return refAtomValue{Text: item.Ref.Sha}, nil
+	case "objecttype":
+		return refAtomValue{Text: item.Type}, nil
+	case "subject":
+		return refAtomValue{Text: MessageSubject(objectMessage(item.Obj))}, nil
+	case "authordate":
+		return signatureAtom("author")
+	case "committerdate":
+		return signatureAtom("committer")
+	case "taggerdate":
+		return signatureAtom("tagger")
+	case "creatordate":
+		if item.Type == "tag" {
+			return signatureAtom("tagger")
+		}
+		return signatureAtom("committer")
+	case "upstream":
+		if !strings.HasPrefix(item.Ref.Name, "refs/heads/") {
+			return refAtomValue{}, nil
+		}
+
+		upstream := repo.BranchUpstream(strings.TrimPrefix(item.Ref.Name, "refs/heads/"))
+		if modifier == "short" {
+			upstream = RefShortName(upstream)
+		}
+		return refAtomValue{Text: upstream}, nil
+	default:
+		return refAtomValue{}, fmt.Errorf("unknown field name: %s\n", atom)
+	}
+}
+
+func (repo *Repository) forEachRefFormat(item *forEachRefItem, format string) (string, error) {
+	var ret strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 >= len(format) {
+			ret.WriteByte(c)
+			continue
+		}
+
+		next := format[i+1]
+		switch {
+		case next == '%':
+			ret.WriteByte('%')
+			i++
+		case next == '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end == -1 {
+				return "", fmt.Errorf("malformed format string %s\n", format)
+			}
+
+			value, err := repo.forEachRefAtom(item, format[i+2:i+end])
+			if err != nil {
+				return "", err
+			}
+			ret.WriteString(value.Text)
+			i += end
+		case i+2 < len(format):
+			b, err := hex.DecodeString(format[i+1 : i+3])
+			if err != nil {
+				ret.WriteByte(c)
+				continue
+			}
+			ret.Write(b)
+			i += 2
+		default:
+			ret.WriteByte(c)
+		}
+	}
+
+	return ret.String(), nil
+}
+
+func (repo *Repository) ForEachRef(opts ForEachRefOptions) error {
+	if opts.Format == "" {
+		opts.Format = "%(objectname) %(objecttype)\t%(refname)"
+	}
+	if len(opts.Sort) == 0 {
+		opts.Sort = []string{"refname"}
+	}
+
+	refs, err := repo.RefListFlat("refs/")
+	if err != nil {
+		return err
+	}
+
+	pointsAt := ""
+	if opts.PointsAt != "" {
+		pointsAt, err = repo.ObjectFind(opts.PointsAt, "", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	merged := ""
+	if opts.Merged != "" {
+		merged, err = repo.ObjectFind(opts.Merged, "commit", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	contains := ""
+	if opts.Contains != "" {
+		contains, err = repo.ObjectFind(opts.Contains, "commit", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	items := []*forEachRefItem{}
+	for _, ref := range refs {
+		if !refPatternMatch(opts.Patterns, ref.Name) {
+			continue
+		}
+
+		obj, err := repo.ObjectRead(ref.Sha)
+		if err != nil {
+			return err
+		}
+		objFmt, err := obj.GetFmt()
+		if err != nil {
+			return err
+		}
+
+		peeled, err := repo.ObjectPeel(ref.Sha)
+		if err != nil {
+			return err
+		}
+
+		item := &forEachRefItem{Ref: ref, Obj: obj, Type: string(objFmt), Peeled: peeled}
+
+		if pointsAt != "" && ref.Sha != pointsAt && peeled != pointsAt {
+			continue
+		}
+
+		if merged != "" || contains != "" {
+			if _, err := repo.CommitRead(peeled); err != nil {
+				continue
+			}
+		}
+
+		if merged != "" {
+			ok, err := repo.IsAncestor(peeled, merged)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if contains != "" {
+			ok, err := repo.IsAncestor(contains, peeled)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	for _, key := range opts.Sort {
+		descending := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+
+		values := map[*forEachRefItem]refAtomValue{}
+		for _, item := range items {
+			value, err := repo.forEachRefAtom(item, key)
+			if err != nil {
+				return err
+			}
+			values[item] = value
+		}
+
+		slices.SortStableFunc(items, func(a, b *forEachRefItem) int {
+			va, vb := values[a], values[b]
+			var c int
+			if va.Numeric {
+				c = cmp.Compare(va.SortKey, vb.SortKey)
+			} else {
+				c = strings.Compare(va.Text, vb.Text)
+			}
+
+			if descending {
+				return -c
+			}
+			return c
+		})
+	}
+
+	if opts.Count > 0 && len(items) > opts.Count {
+		items = items[:opts.Count]
+	}
+
+	for _, item := range items {
+		line, err := repo.forEachRefFormat(item, opts.Format)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(line)
+	}
+
+	return nil
+}
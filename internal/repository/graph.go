@@ -0,0 +1,665 @@
+package repository
+
+import (
+	"io"
+	"slices"
+	"strings"
+)
+
+type graphState int
+
+const (
+	graphPadding graphState = iota
+	graphSkip
+	graphPreCommit
+	graphCommit
+	graphPostMerge
+	graphCollapsing
+)
+
+var graphColumnColors = []string{
+	"\033[31m", "\033[32m", "\033[33m", "\033[34m", "\033[35m", "\033[36m",
+	"\033[1;31m", "\033[1;32m", "\033[1;33m", "\033[1;34m", "\033[1;35m", "\033[1;36m",
+}
+
+const graphColorReset = "\033[m"
+
+type graphColumn struct {
+	commit string
+	color  int
+}
+
+type graphLine struct {
+	b     strings.Builder
+	width int
+}
+
+func (l *graphLine) addChars(c byte, n int) {
+	for i := 0; i < n; i++ {
+		l.b.WriteByte(c)
+	}
+	l.width += n
+}
+
+func (l *graphLine) addString(s string) {
+	l.b.WriteString(s)
+	l.width += len(s)
+}
+
+type Graph struct {
+	/*
+		a port of the lane drawing of git's graph.c, one Update per shown commit
+		and then NextLine until the commit line was printed
+	*/
+	interesting func(sha string) bool
+	parentsOf   func(sha string) []string
+	color       bool
+
+	commit             string
+	parents            []string
+	numParents         int
+	width              int
+	expansionRow       int
+	state              graphState
+	prevState          graphState
+	commitIndex        int
+	prevCommitIndex    int
+	mergeLayout        int
+	edgesAdded         int
+	prevEdgesAdded     int
+	columns            []graphColumn
+	newColumns         []graphColumn
+	mappingSize        int
+	mapping            []int
+	oldMapping         []int
+	defaultColumnColor int
+}
+
+func NewGraph(interesting func(sha string) bool, parentsOf func(sha string) []string, color bool) *Graph {
+	/*
+		interesting: whether a parent will be shown, only those get a lane
+		parentsOf: the parents to draw, already limited to the first parent when needed
+	*/
+	return &Graph{
+		interesting:        interesting,
+		parentsOf:          parentsOf,
+		color:              color,
+		state:              graphPadding,
+		prevState:          graphPadding,
+		defaultColumnColor: len(graphColumnColors) - 1,
+	}
+}
+
+func (g *Graph) writeColumn(l *graphLine, col graphColumn, c byte) {
+	if g.color && col.color < len(graphColumnColors) {
+		l.b.WriteString(graphColumnColors[col.color])
+	}
+	l.b.WriteByte(c)
+	if g.color && col.color < len(graphColumnColors) {
+		l.b.WriteString(graphColorReset)
+	}
+	l.width++
+}
+
+func (g *Graph) updateState(s graphState) {
+	g.prevState = g.state
+	g.state = s
+}
+
+func (g *Graph) findCommitColor(sha string) int {
+	for _, col := range g.columns {
+		if col.commit == sha {
+			return col.color
+		}
+	}
+
+	return g.defaultColumnColor
+}
+
+func (g *Graph) incrementColumnColor() {
+	g.defaultColumnColor = (g.defaultColumnColor + 1) % len(graphColumnColors)
+}
+
+func (g *Graph) findNewColumnByCommit(sha string) int {
+	for i, col := range g.newColumns {
+		if col.commit == sha {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (g *Graph) ensureCapacity(n int) {
+	for len(g.mapping) < 2*n {
+		g.mapping = append(g.mapping, -1)
+	}
+	for len(g.oldMapping) < 2*n {
+		g.oldMapping = append(g.oldMapping, -1)
+	}
+}
+
+func (g *Graph) insertIntoNewColumns(sha string, idx int) {
+	i := g.findNewColumnByCommit(sha)
+	if i < 0 {
+		i = len(g.newColumns)
+		g.newColumns = append(g.newColumns, graphColumn{commit: sha, color: g.findCommitColor(sha)})
+	}
+
+	mappingIdx := 0
+	if g.numParents > 1 && idx > -1 && g.mergeLayout == -1 {
+		/*
+			the first parent of a merge picks the layout of the merge line, depending on
+			whether it is in a column to the left of the merge
+		*/
+		dist := idx - i
+		shift := 1
+		if dist > 1 {
+			shift = 2*dist - 3
+		}
+
+		g.mergeLayout = 1
+		if dist > 0 {
+			g.mergeLayout = 0
+		}
+		g.edgesAdded = g.numParents + g.mergeLayout - 2
+
+		mappingIdx = g.width + (g.mergeLayout-1)*shift
+		g.width += 2 * g.mergeLayout
+	} else if g.edgesAdded > 0 && g.width >= 2 && i == g.mapping[g.width-2] {
+		/*
+			the commit was found in the last existing column, so the two edges join at once
+		*/
+		mappingIdx = g.width - 2
+		g.edgesAdded = -1
+	} else {
+		mappingIdx = g.width
+		g.width += 2
+	}
+
+	g.mapping[mappingIdx] = i
+}
+
+func (g *Graph) updateColumns() {
+	g.columns, g.newColumns = g.newColumns, []graphColumn{}
+
+	maxNewColumns := len(g.columns) + g.numParents
+	g.ensureCapacity(maxNewColumns)
+
+	g.mappingSize = 2 * maxNewColumns
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+
+	g.width = 0
+	g.prevEdgesAdded = g.edgesAdded
+	g.edgesAdded = 0
+
+	seenThis := false
+	isCommitInColumns := true
+	for i := 0; i <= len(g.columns); i++ {
+		colCommit := ""
+		if i == len(g.columns) {
+			if seenThis {
+				break
+			}
+			isCommitInColumns = false
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i].commit
+		}
+
+		if colCommit == g.commit {
+			seenThis = true
+			g.commitIndex = i
+			g.mergeLayout = -1
+			for _, p := range g.parents {
+				if g.numParents > 1 || !isCommitInColumns {
+					g.incrementColumnColor()
+				}
+				g.insertIntoNewColumns(p, i)
+			}
+			if g.numParents == 0 {
+				g.width += 2
+			}
+		} else {
+			g.insertIntoNewColumns(colCommit, -1)
+		}
+	}
+
+	for g.mappingSize > 1 && g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+}
+
+func (g *Graph) numDashedParents() int {
+	return g.numParents + g.mergeLayout - 3
+}
+
+func (g *Graph) numExpansionRows() int {
+	return g.numDashedParents() * 2
+}
+
+func (g *Graph) needsPreCommitLine() bool {
+	return g.numParents >= 3 && g.commitIndex < len(g.columns)-1 && g.expansionRow < g.numExpansionRows()
+}
+
+func (g *Graph) Update(sha string) {
+	g.commit = sha
+
+	g.parents = []string{}
+	for _, p := range g.parentsOf(sha) {
+		if g.interesting(p) && !slices.Contains(g.parents, p) {
+			g.parents = append(g.parents, p)
+		}
+	}
+	g.numParents = len(g.parents)
+
+	g.prevCommitIndex = g.commitIndex
+	g.updateColumns()
+	g.expansionRow = 0
+
+	if g.state != graphPadding {
+		g.state = graphSkip
+	} else if g.needsPreCommitLine() {
+		g.state = graphPreCommit
+	} else {
+		g.state = graphCommit
+	}
+}
+
+func (g *Graph) isMappingCorrect() bool {
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.mapping[i]
+		if target < 0 || target == i/2 {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
+
+func (g *Graph) padHorizontally(l *graphLine) {
+	if l.width < g.width {
+		l.addChars(' ', g.width-l.width)
+	}
+}
+
+func (g *Graph) outputPaddingLine(l *graphLine) {
+	for _, col := range g.newColumns {
+		g.writeColumn(l, col, '|')
+		l.addChars(' ', 1)
+	}
+}
+
+func (g *Graph) outputSkipLine(l *graphLine) {
+	l.addString("...")
+	if g.needsPreCommitLine() {
+		g.updateState(graphPreCommit)
+	} else {
+		g.updateState(graphCommit)
+	}
+}
+
+func (g *Graph) outputPreCommitLine(l *graphLine) {
+	seenThis := false
+	for i, col := range g.columns {
+		switch {
+		case col.commit == g.commit:
+			seenThis = true
+			g.writeColumn(l, col, '|')
+			l.addChars(' ', g.expansionRow)
+		case seenThis && g.expansionRow == 0:
+			if g.prevState == graphPostMerge && g.prevCommitIndex < i {
+				g.writeColumn(l, col, '\\')
+			} else {
+				g.writeColumn(l, col, '|')
+			}
+		case seenThis && g.expansionRow > 0:
+			g.writeColumn(l, col, '\\')
+		default:
+			g.writeColumn(l, col, '|')
+		}
+		l.addChars(' ', 1)
+	}
+
+	g.expansionRow++
+	if !g.needsPreCommitLine() {
+		g.updateState(graphCommit)
+	}
+}
+
+func (g *Graph) drawOctopusMerge(l *graphLine) {
+	dashedParents := g.numDashedParents()
+	for i := 0; i < dashedParents; i++ {
+		col := g.newColumns[g.mapping[(g.commitIndex+i+2)*2]]
+
+		g.writeColumn(l, col, '-')
+		if i == dashedParents-1 {
+			g.writeColumn(l, col, '.')
+		} else {
+			g.writeColumn(l, col, '-')
+		}
+	}
+}
+
+func (g *Graph) outputCommitLine(l *graphLine) {
+	seenThis := false
+	for i := 0; i <= len(g.columns); i++ {
+		var col graphColumn
+		colCommit := ""
+		if i == len(g.columns) {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			col = g.columns[i]
+			colCommit = col.commit
+		}
+
+		switch {
+		case colCommit == g.commit:
+			seenThis = true
+			l.addString("*")
+			if g.numParents > 2 {
+				g.drawOctopusMerge(l)
+			}
+		case seenThis && g.edgesAdded > 1:
+			g.writeColumn(l, col, '\\')
+		case seenThis && g.edgesAdded == 1:
+			if g.prevState == graphPostMerge && g.prevEdgesAdded > 0 && g.prevCommitIndex < i {
+				g.writeColumn(l, col, '\\')
+			} else {
+				g.writeColumn(l, col, '|')
+			}
+		case g.prevState == graphCollapsing && g.oldMapping[2*i+1] == i && g.mapping[2*i] < i:
+			g.writeColumn(l, col, '/')
+		default:
+			g.writeColumn(l, col, '|')
+		}
+		l.addChars(' ', 1)
+	}
+
+	switch {
+	case g.numParents > 1:
+		g.updateState(graphPostMerge)
+	case g.isMappingCorrect():
+		g.updateState(graphPadding)
+	default:
+		g.updateState(graphCollapsing)
+	}
+}
+
+func (g *Graph) outputPostMergeLine(l *graphLine) {
+	mergeChars := []byte{'/', '|', '\\'}
+
+	seenThis := false
+	var parentCol *graphColumn
+	for i := 0; i <= len(g.columns); i++ {
+		var col *graphColumn
+		colCommit := ""
+		if i == len(g.columns) {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			col = &g.columns[i]
+			colCommit = col.commit
+		}
+
+		switch {
+		case colCommit == g.commit:
+			seenThis = true
+			idx := g.mergeLayout
+			for j, p := range g.parents {
+				parColumn := g.findNewColumnByCommit(p)
+
+				g.writeColumn(l, g.newColumns[parColumn], mergeChars[idx])
+				if idx == 2 {
+					if g.edgesAdded > 0 || j < g.numParents-1 {
+						l.addChars(' ', 1)
+					}
+				} else {
+					idx++
+				}
+			}
+			if g.edgesAdded == 0 {
+				l.addChars(' ', 1)
+			}
+		case seenThis:
+			if g.edgesAdded > 0 {
+				g.writeColumn(l, *col, '\\')
+			} else {
+				g.writeColumn(l, *col, '|')
+			}
+			l.addChars(' ', 1)
+		default:
+			g.writeColumn(l, *col, '|')
+			if g.mergeLayout != 0 || i != g.commitIndex-1 {
+				if parentCol != nil {
+					g.writeColumn(l, *parentCol, '_')
+				} else {
+					l.addChars(' ', 1)
+				}
+			}
+		}
+
+		if col != nil && colCommit == g.parents[0] {
+			parentCol = col
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.updateState(graphPadding)
+	} else {
+		g.updateState(graphCollapsing)
+	}
+}
+
+func (g *Graph) outputCollapsingLine(l *graphLine) {
+	usedHorizontal := false
+	horizontalEdge := -1
+	horizontalEdgeTarget := -1
+
+	g.mapping, g.oldMapping = g.oldMapping, g.mapping
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.oldMapping[i]
+		if target < 0 {
+			continue
+		}
+
+		switch {
+		case target*2 == i:
+			g.mapping[i] = target
+		case g.mapping[i-1] < 0:
+			/*
+				nothing to the left, move one to the left
+			*/
+			g.mapping[i-1] = target
+			if horizontalEdge == -1 {
+				horizontalEdge = i
+				horizontalEdgeTarget = target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		case g.mapping[i-1] == target:
+			/*
+				the line to the left goes to the same parent, they merge
+			*/
+		default:
+			/*
+				cross over the line to the left
+			*/
+			g.mapping[i-2] = target
+			if horizontalEdge == -1 {
+				horizontalEdgeTarget = target
+				horizontalEdge = i - 1
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		}
+	}
+
+	copy(g.oldMapping, g.mapping[:g.mappingSize])
+
+	if g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.mapping[i]
+		switch {
+		case target < 0:
+			l.addChars(' ', 1)
+		case target*2 == i:
+			g.writeColumn(l, g.newColumns[target], '|')
+		case target == horizontalEdgeTarget && i != horizontalEdge-1:
+			if i != target*2+3 {
+				g.mapping[i] = -1
+			}
+			usedHorizontal = true
+			g.writeColumn(l, g.newColumns[target], '_')
+		default:
+			if usedHorizontal && i < horizontalEdge {
+				g.mapping[i] = -1
+			}
+			g.writeColumn(l, g.newColumns[target], '/')
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.updateState(graphPadding)
+	}
+}
+
+func (g *Graph) NextLine() (string, bool) {
+	/*
+		returns the next line of the graph and whether it was the line of the commit
+	*/
+	l := &graphLine{}
+	shownCommitLine := false
+
+	switch g.state {
+	case graphPadding:
+		g.outputPaddingLine(l)
+	case graphSkip:
+		g.outputSkipLine(l)
+	case graphPreCommit:
+		g.outputPreCommitLine(l)
+	case graphCommit:
+		g.outputCommitLine(l)
+		shownCommitLine = true
+	case graphPostMerge:
+		g.outputPostMergeLine(l)
+	case graphCollapsing:
+		g.outputCollapsingLine(l)
+	}
+
+	g.padHorizontally(l)
+	return l.b.String(), shownCommitLine
+}
+
+func (g *Graph) PaddingLine() string {
+	/*
+		a line that leaves all lanes unchanged, used between the lines of a commit message
+	*/
+	if g.state != graphCommit {
+		line, _ := g.NextLine()
+		return line
+	}
+
+	l := &graphLine{}
+	for _, col := range g.columns {
+		g.writeColumn(l, col, '|')
+		if col.commit == g.commit && g.numParents > 2 {
+			l.addChars(' ', (g.numParents-2)*2)
+		} else {
+			l.addChars(' ', 1)
+		}
+	}
+	g.padHorizontally(l)
+
+	g.prevState = graphPadding
+	return l.b.String()
+}
+
+func (g *Graph) IsCommitFinished() bool {
+	return g.state == graphPadding
+}
+
+func (g *Graph) ShowCommit(w io.Writer) {
+	/*
+		prints the lines up to and including the commit line, the commit line is not terminated
+	*/
+	if g.IsCommitFinished() {
+		io.WriteString(w, g.PaddingLine())
+		return
+	}
+
+	for {
+		line, shownCommitLine := g.NextLine()
+		io.WriteString(w, line)
+		if shownCommitLine {
+			return
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+func (g *Graph) ShowRemainder(w io.Writer) bool {
+	if g.IsCommitFinished() {
+		return false
+	}
+
+	for {
+		line, _ := g.NextLine()
+		io.WriteString(w, line)
+		if g.IsCommitFinished() {
+			return true
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+func (g *Graph) ShowCommitMsg(w io.Writer, msg string) {
+	/*
+		prints msg with the graph in front of every line but the first, then the rest of the
+		graph lines of the commit
+	*/
+	newlineTerminated := strings.HasSuffix(msg, "\n")
+
+	for rest := msg; rest != ""; {
+		line, next, found := strings.Cut(rest, "\n")
+		io.WriteString(w, line)
+		if !found {
+			break
+		}
+		io.WriteString(w, "\n")
+		if next != "" {
+			prefix, _ := g.NextLine()
+			io.WriteString(w, prefix)
+		}
+		rest = next
+	}
+
+	if g.IsCommitFinished() {
+		return
+	}
+
+	if !newlineTerminated {
+		io.WriteString(w, "\n")
+	}
+	g.ShowRemainder(w)
+	if newlineTerminated {
+		io.WriteString(w, "\n")
+	}
+}
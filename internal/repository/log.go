@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+type LogOptions struct {
+	Format   string
+	Date     string
+	Decorate bool
+	Abbrev   bool
+	Graph    bool
+	Color    bool
+	JSON     bool
+}
+
+func (repo *Repository) LogDecorations() (map[string][]string, error) {
+	/*
+		maps a commit to the refs pointing at it, in the order git shows them: HEAD first,
+		then the other refs in reverse name order
+	*/
+	ret := map[string][]string{}
+
+	refs, err := repo.RefListFlat("refs/")
+	if err != nil {
+		return ret, err
+	}
+
+	headBranch, err := repo.GetActiveBranch()
+	if err != nil {
+		headBranch = ""
+	}
+
+	for i := len(refs) - 1; i >= 0; i-- {
+		ref := refs[i]
+		if headBranch != "" && ref.Name == "refs/heads/"+headBranch {
+			continue
+		}
+
+		sha, err := repo.ObjectPeel(ref.Sha)
+		if err != nil {
+			continue
+		}
+
+		name := RefShortName(ref.Name)
+		if strings.HasPrefix(ref.Name, "refs/tags/") {
+			name = "tag: " + name
+		}
+		ret[sha] = append(ret[sha], name)
+	}
+
+	if head, err := repo.RefResolve("HEAD"); err == nil {
+		name := "HEAD"
+		if headBranch != "" {
+			name = "HEAD -> " + headBranch
+		}
+		ret[head] = append([]string{name}, ret[head]...)
+	}
+
+	return ret, nil
+}
+
+func MessageBody(message string) string {
+	/*
+		everything after the subject paragraph, "" when there is none
+	*/
+	parts := strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	body := strings.TrimLeft(parts[1], "\n")
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+
+	return body
+}
+
+func commitSignature(commit *GitCommit, key string) Signature {
+	raw, ok := (*(*commit.Kvlm).Map)[key]
+	if !ok || len(raw) == 0 {
+		return Signature{}
+	}
+
+	sig, err := ParseSignature(raw[0])
+	if err != nil {
+		return Signature{}
+	}
+
+	return sig
+}
+
+func (repo *Repository) LogFormatCommit(c *WalkCommit, format string, dateMode string, decorations map[string][]string) (string, error) {
+	/*
+		expands %H %h %T %t %P %p %an %ae %aN %aE %ad %ar %at %cn %ce %cN %cE %cd %cr %ct %s %b %B
+		%d %D %n %% and %xNN, %aN %aE %cN %cE go through the mailmap
+	*/
+	message := objectMessage(c.Commit)
+	author := commitSignature(c.Commit, "author")
+	committer := commitSignature(c.Commit, "committer")
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case '%':
+			b.WriteByte('%')
+		case 'n':
+			b.WriteByte('\n')
+		case 'H':
+			b.WriteString(c.Sha)
+		case 'h':
+			b.WriteString(repo.ObjectAbbrev(c.Sha, 7))
+		case 'T':
+			b.WriteString(commitTree(c.Commit))
+		case 't':
+			b.WriteString(repo.ObjectAbbrev(commitTree(c.Commit), 7))
+		case 'P':
+			b.WriteString(strings.Join(c.Parents, " "))
+		case 'p':
+			short := []string{}
+			for _, p := range c.Parents {
+				short = append(short, repo.ObjectAbbrev(p, 7))
+			}
+			b.WriteString(strings.Join(short, " "))
+		case 's':
+			b.WriteString(MessageSubject(message))
+		case 'b':
+			b.WriteString(MessageBody(message))
+		case 'B':
+			b.WriteString(message)
+		case 'd':
+			if decor := decorations[c.Sha]; len(decor) > 0 {
+				b.WriteString(" (" + strings.Join(decor, ", ") + ")")
+			}
+		case 'D':
+			b.WriteString(strings.Join(decorations[c.Sha], ", "))
+		case 'a', 'c':
+			sig := author
+			if format[i] == 'c' {
+				sig = committer
+			}
+			if i+1 >= len(format) {
+				b.WriteString("%" + format[i:])
+				continue
+			}
+
+			i++
+			switch format[i] {
+			case 'n':
+				b.WriteString(sig.Name)
+			case 'e':
+				b.WriteString(sig.Email)
+			case 'N':
+				name, _ := repo.MailmapRead().Map(sig.Name, sig.Email)
+				b.WriteString(name)
+			case 'E':
+				_, email := repo.MailmapRead().Map(sig.Name, sig.Email)
+				b.WriteString(email)
+			case 'd':
+				b.WriteString(FormatDate(sig.When, dateMode))
+			case 'r':
+				b.WriteString(FormatDate(sig.When, "relative"))
+			case 't':
+				b.WriteString(FormatDate(sig.When, "unix"))
+			case 'i':
+				b.WriteString(FormatDate(sig.When, "iso"))
+			case 'I':
+				b.WriteString(FormatDate(sig.When, "iso-strict"))
+			default:
+				b.WriteString(format[i-2 : i+1])
+			}
+		case 'x':
+			if i+2 < len(format) {
+				if raw, err := hex.DecodeString(format[i+1 : i+3]); err == nil {
+					b.Write(raw)
+					i += 2
+					continue
+				}
+			}
+			b.WriteString("%x")
+		default:
+			b.WriteString(format[i-1 : i+1])
+		}
+	}
+
+	return b.String(), nil
+}
+
+func indentMessage(message string) string {
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString("    " + line + "\n")
+	}
+
+	return b.String()
+}
+
+func (repo *Repository) logFormatBuiltin(c *WalkCommit, opts LogOptions, decorations map[string][]string) string {
+	/*
+		the identities go through the mailmap like git's log.mailmap
+	*/
+	message := objectMessage(c.Commit)
+	author := repo.MailmapRead().MapSignature(commitSignature(c.Commit, "author"))
+	committer := repo.MailmapRead().MapSignature(commitSignature(c.Commit, "committer"))
+
+	sha := c.Sha
+	if opts.Abbrev {
+		sha = repo.ObjectAbbrev(c.Sha, 7)
+	}
+
+	decor := ""
+	if opts.Decorate && len(decorations[c.Sha]) > 0 {
+		decor = " (" + strings.Join(decorations[c.Sha], ", ") + ")"
+	}
+
+	if opts.Format == "oneline" {
+		return fmt.Sprintf("%s%s %s\n", sha, decor, MessageSubject(message))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "commit %s%s\n", sha, decor)
+
+	if len(c.Parents) > 1 {
+		short := []string{}
+		for _, p := range c.Parents {
+			short = append(short, repo.ObjectAbbrev(p, 7))
+		}
+		fmt.Fprintf(&b, "Merge: %s\n", strings.Join(short, " "))
+	}
+
+	if opts.Format == "fuller" {
+		fmt.Fprintf(&b, "Author:     %s <%s>\n", author.Name, author.Email)
+	} else {
+		fmt.Fprintf(&b, "Author: %s <%s>\n", author.Name, author.Email)
+	}
+
+	switch opts.Format {
+	case "short":
+		fmt.Fprintf(&b, "\n%s", indentMessage(MessageSubject(message)))
+		return b.String()
+	case "full":
+		fmt.Fprintf(&b, "Commit: %s <%s>\n", committer.Name, committer.Email)
+	case "fuller":
+		fmt.Fprintf(&b, "AuthorDate: %s\n", FormatDate(author.When, opts.Date))
+		fmt.Fprintf(&b, "Commit:     %s <%s>\n", committer.Name, committer.Email)
+		fmt.Fprintf(&b, "CommitDate: %s\n", FormatDate(committer.When, opts.Date))
+	default:
+		fmt.Fprintf(&b, "Date:   %s\n", FormatDate(author.When, opts.Date))
+	}
+
+	fmt.Fprintf(&b, "\n%s", indentMessage(message))
+	return b.String()
+}
+
+func (repo *Repository) logEntry(c *WalkCommit, opts LogOptions, decorations map[string][]string) (string, bool, error) {
+	/*
+		returns the text of one commit and whether it ends the entry (terminator semantics)
+		or goes between entries (separator semantics)
+	*/
+	if slices.Contains([]string{"oneline", "short", "medium", "full", "fuller"}, opts.Format) {
+		out := repo.logFormatBuiltin(c, opts, decorations)
+		if opts.Format == "oneline" {
+			return strings.TrimSuffix(out, "\n"), true, nil
+		}
+		return out, false, nil
+	}
+
+	userFormat, separator := strings.CutPrefix(opts.Format, "format:")
+	if !separator {
+		userFormat = strings.TrimPrefix(opts.Format, "tformat:")
+	}
+
+	out, err := repo.LogFormatCommit(c, userFormat, opts.Date, decorations)
+	return out, !separator, err
+}
+
+func (repo *Repository) logGraph(w *RevWalker, commits []*WalkCommit, opts LogOptions, decorations map[string][]string) error {
+	/*
+		follows git's log-tree: separators get a graph padding line unless the previous entry
+		did not end in a newline, and the lines after a commit are drawn before the next one
+	*/
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	graph := NewGraph(w.Interesting, w.ParentsOf, opts.Color)
+	missingNewline := false
+
+	shownOne := false
+	for _, c := range commits {
+		graph.Update(c.Sha)
+		if w.Hidden(c.Sha) {
+			continue
+		}
+
+		msg, terminator, err := repo.logEntry(c, opts, decorations)
+		if err != nil {
+			return err
+		}
+
+		if shownOne && !terminator {
+			if !missingNewline {
+				out.WriteString(graph.PaddingLine())
+			}
+			out.WriteString("\n")
+		}
+
+		shownOne = true
+		graph.ShowCommit(out)
+
+		missingNewline = !strings.HasSuffix(msg, "\n")
+		graph.ShowCommitMsg(out, msg)
+
+		if terminator {
+			if !missingNewline {
+				out.WriteString(graph.PaddingLine())
+			}
+			out.WriteString("\n")
+		}
+	}
+
+	return nil
+}
+
+func (repo *Repository) Log(w *RevWalker, commits []*WalkCommit, opts LogOptions) error {
+	/*
+		opts.Format: default val is "medium", also oneline, short, full, fuller,
+		format:<fmt> (separator semantics) and tformat:<fmt> or a bare <fmt> (terminator semantics)
+		or mermaid (a gitGraph, commits should be in topological order)
+		opts.Graph: default val is false, commits should be in topological order
+		opts.JSON: default val is false, prints a json array instead of text
+	*/
+	decorations, err := repo.LogDecorations()
+	if err != nil {
+		return err
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = "medium"
+	}
+
+	visible := slices.DeleteFunc(slices.Clone(commits), func(c *WalkCommit) bool {
+		return w.Hidden(c.Sha)
+	})
+
+	if opts.JSON {
+		return repo.LogJSON(visible)
+	}
+	if format == "mermaid" {
+		return repo.LogMermaid(os.Stdout, visible)
+	}
+
+	if opts.Graph {
+		opts.Format = format
+		return repo.logGraph(w, commits, opts, decorations)
+	}
+	commits = visible
+
+	builtin := slices.Contains([]string{"oneline", "short", "medium", "full", "fuller"}, format)
+
+	for i, c := range commits {
+		if builtin {
+			opts.Format = format
+			out := repo.logFormatBuiltin(c, opts, decorations)
+			if i > 0 && format != "oneline" {
+				out = "\n" + out
+			}
+			fmt.Print(out)
+			continue
+		}
+
+		userFormat, separator := strings.CutPrefix(format, "format:")
+		if !separator {
+			userFormat = strings.TrimPrefix(format, "tformat:")
+		}
+
+		out, err := repo.LogFormatCommit(c, userFormat, opts.Date, decorations)
+		if err != nil {
+			return err
+		}
+
+		if separator {
+			if i > 0 {
+				out = "\n" + out
+			}
+		} else {
+			out += "\n"
+		}
+		fmt.Print(out)
+	}
+
+	return nil
+}
+
+func LogGraphviz(repo *Repository, commits []*WalkCommit) error {
+	/*
+		prints the body of a DOT digraph, one node per commit and one edge per parent
+	*/
+	for _, c := range commits {
+		message := MessageSubject(objectMessage(c.Commit))
+		message = strings.ReplaceAll(message, "\\", "\\\\")
+		message = strings.ReplaceAll(message, "\"", "\\\"")
+
+		fmt.Printf("  c_%s [label=\"%s: %s\"]\n", c.Sha, c.Sha[:8], message)
+
+		for _, p := range c.Parents {
+			fmt.Printf("  c_%s -> c_%s;\n", c.Sha, p)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,356 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type LogJSONPerson struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date"`
+}
+
+type LogJSONCommit struct {
+	Sha       string        `json:"sha"`
+	Tree      string        `json:"tree"`
+	Parents   []string      `json:"parents"`
+	Refs      []string      `json:"refs"`
+	Author    LogJSONPerson `json:"author"`
+	Committer LogJSONPerson `json:"committer"`
+	Subject   string        `json:"subject"`
+	Message   string        `json:"message"`
+}
+
+func (repo *Repository) logRefs() (map[string][]string, error) {
+	/*
+		maps a commit to the full names of the refs pointing at it, HEAD first
+	*/
+	ret := map[string][]string{}
+
+	if head, err := repo.RefResolve("HEAD"); err == nil {
+		ret[head] = append(ret[head], "HEAD")
+	}
+
+	refs, err := repo.RefListFlat("refs/")
+	if err != nil {
+		return ret, err
+	}
+
+	for _, ref := range refs {
+		sha, err := repo.ObjectPeel(ref.Sha)
+		if err != nil {
+			continue
+		}
+		ret[sha] = append(ret[sha], ref.Name)
+	}
+
+	return ret, nil
+}
+
+func logJSONPerson(sig Signature) LogJSONPerson {
+	return LogJSONPerson{Name: sig.Name, Email: sig.Email, Date: FormatDate(sig.When, "iso-strict")}
+}
+
+func (repo *Repository) LogJSON(commits []*WalkCommit) error {
+	/*
+		prints the commits as one json array, dates are iso-strict
+	*/
+	refs, err := repo.logRefs()
+	if err != nil {
+		return err
+	}
+
+	records := []LogJSONCommit{}
+	for _, c := range commits {
+		message := objectMessage(c.Commit)
+
+		record := LogJSONCommit{
+			Sha:       c.Sha,
+			Tree:      commitTree(c.Commit),
+			Parents:   slices.Clone(c.Parents),
+			Refs:      refs[c.Sha],
+			Author:    logJSONPerson(commitSignature(c.Commit, "author")),
+			Committer: logJSONPerson(commitSignature(c.Commit, "committer")),
+			Subject:   MessageSubject(message),
+			Message:   message,
+		}
+		if record.Parents == nil {
+			record.Parents = []string{}
+		}
+		if record.Refs == nil {
+			record.Refs = []string{}
+		}
+
+		records = append(records, record)
+	}
+
+	out, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(os.Stdout, "%s\n", out)
+	return err
+}
+
+var mermaidMergeBranch = regexp.MustCompile(`^Merge (?:remote-tracking )?branch '([^']+)'`)
+
+var mermaidBadChars = regexp.MustCompile(`[^A-Za-z0-9_./-]`)
+
+func mermaidName(name string, used map[string]bool) string {
+	name = mermaidBadChars.ReplaceAllString(name, "-")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "b-" + name
+	}
+
+	ret := name
+	for i := 2; used[ret]; i++ {
+		ret = fmt.Sprintf("%s-%d", name, i)
+	}
+	used[ret] = true
+
+	return ret
+}
+
+func mermaidString(s string) string {
+	return strings.ReplaceAll(s, "\"", "'")
+}
+
+func (repo *Repository) mermaidTips(inSet map[string]*WalkCommit) ([]Ref, error) {
+	/*
+		the branch tips to name lanes after, main or master first so the oldest lane gets
+		its name, then HEAD's branch and the other branches. A tip outside the commits is
+		moved down its first parents to the first commit that is shown
+	*/
+	tips := []Ref{}
+	for _, name := range []string{"refs/heads/main", "refs/heads/master"} {
+		if sha, err := repo.RefResolve(name); err == nil {
+			tips = append(tips, Ref{Name: name, Sha: sha})
+		}
+	}
+	if branch, err := repo.GetActiveBranch(); err == nil && branch != "" {
+		if sha, err := repo.RefResolve("HEAD"); err == nil {
+			tips = append(tips, Ref{Name: "refs/heads/" + branch, Sha: sha})
+		}
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/"} {
+		refs, err := repo.RefListFlat(prefix)
+		if err != nil {
+			return tips, err
+		}
+		tips = append(tips, refs...)
+	}
+
+	for i, tip := range tips {
+		sha := tip.Sha
+		for sha != "" {
+			if _, ok := inSet[sha]; ok {
+				break
+			}
+
+			commit, err := repo.CommitRead(sha)
+			if err != nil {
+				sha = ""
+				break
+			}
+			sha = ""
+			if ps := commitParents(commit); len(ps) > 0 {
+				sha = ps[0]
+			}
+		}
+		tips[i].Sha = sha
+	}
+
+	return tips, nil
+}
+
+func (repo *Repository) LogMermaid(w io.Writer, commits []*WalkCommit) error {
+	/*
+		prints a mermaid gitGraph, commits should be in topological order. Every commit is put
+		on the lane of a branch by following first parents from the branch tips, see
+		mermaidTips for the order, lines merged from deleted branches take the name from the
+		merge message. gitGraph can only branch from and merge the tip of a lane, so a lane is
+		branched right after its fork point and a merge is drawn before the lane it merges
+		moves on. It knows no octopus merges, the parents after the second are named in a comment
+	*/
+	inSet := map[string]*WalkCommit{}
+	for _, c := range commits {
+		inSet[c.Sha] = c
+	}
+
+	parents := func(c *WalkCommit) []string {
+		ret := []string{}
+		for _, p := range c.Parents {
+			if _, ok := inSet[p]; ok {
+				ret = append(ret, p)
+			}
+		}
+		return ret
+	}
+
+	lane := map[string]string{}
+	used := map[string]bool{}
+	claim := func(sha string, name string) {
+		if _, ok := lane[sha]; ok {
+			return
+		}
+
+		name = mermaidName(name, used)
+		for sha != "" {
+			if _, ok := lane[sha]; ok {
+				return
+			}
+			lane[sha] = name
+
+			next := ""
+			if ps := parents(inSet[sha]); len(ps) > 0 {
+				next = ps[0]
+			}
+			sha = next
+		}
+	}
+
+	tips, err := repo.mermaidTips(inSet)
+	if err != nil {
+		return err
+	}
+	for _, tip := range tips {
+		if tip.Sha != "" {
+			claim(tip.Sha, RefShortName(tip.Name))
+		}
+	}
+
+	for _, c := range commits {
+		ps := parents(c)
+		for _, p := range ps[min(1, len(ps)):] {
+			name := "branch-" + repo.ObjectAbbrev(p, 7)
+			if m := mermaidMergeBranch.FindStringSubmatch(MessageSubject(objectMessage(c.Commit))); m != nil {
+				name = m[1]
+			}
+			claim(p, name)
+		}
+	}
+
+	for _, c := range commits {
+		claim(c.Sha, "branch-"+repo.ObjectAbbrev(c.Sha, 7))
+	}
+
+	decorations, err := repo.LogDecorations()
+	if err != nil {
+		return err
+	}
+
+	forks := map[string][]string{}
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		if ps := parents(c); len(ps) > 0 && lane[ps[0]] != lane[c.Sha] && !slices.Contains(forks[ps[0]], lane[c.Sha]) {
+			forks[ps[0]] = append(forks[ps[0]], lane[c.Sha])
+		}
+	}
+
+	wanted := map[string]int{}
+	for _, c := range commits {
+		if ps := parents(c); len(ps) > 1 && lane[ps[1]] != lane[c.Sha] {
+			wanted[ps[1]]++
+		}
+	}
+
+	order := []*WalkCommit{}
+	drawn := map[string]bool{}
+	pending := slices.Clone(commits)
+	slices.Reverse(pending)
+	for len(pending) > 0 {
+		pick := -1
+		for i, c := range pending {
+			ps := parents(c)
+			if slices.ContainsFunc(ps, func(p string) bool { return !drawn[p] }) {
+				continue
+			}
+			if pick == -1 {
+				pick = i
+			}
+			if len(ps) == 0 || lane[ps[0]] != lane[c.Sha] || wanted[ps[0]] == 0 {
+				pick = i
+				break
+			}
+		}
+
+		c := pending[pick]
+		pending = slices.Delete(pending, pick, pick+1)
+		drawn[c.Sha] = true
+		order = append(order, c)
+		if ps := parents(c); len(ps) > 1 && lane[ps[1]] != lane[c.Sha] {
+			wanted[ps[1]]--
+		}
+	}
+
+	var b strings.Builder
+	current := ""
+	created := map[string]bool{}
+	laneTip := map[string]string{}
+	for _, c := range order {
+		name := lane[c.Sha]
+		ps := parents(c)
+
+		if current == "" {
+			fmt.Fprintf(&b, "%%%%{init: { 'gitGraph': {'mainBranchName': '%s'}} }%%%%\n", name)
+			b.WriteString("gitGraph\n")
+			current = name
+			created[name] = true
+		}
+
+		if !created[name] {
+			fmt.Fprintf(&b, "    branch %s\n", name)
+			created[name] = true
+		} else if name != current {
+			fmt.Fprintf(&b, "    checkout %s\n", name)
+		}
+		current = name
+
+		attrs := fmt.Sprintf("id: \"%s %s\"", repo.ObjectAbbrev(c.Sha, 7), mermaidString(MessageSubject(objectMessage(c.Commit))))
+		tags := []string{}
+		for _, decor := range decorations[c.Sha] {
+			if tag, ok := strings.CutPrefix(decor, "tag: "); ok {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > 0 {
+			attrs += fmt.Sprintf(" tag: \"%s\"", mermaidString(strings.Join(tags, ", ")))
+		}
+
+		switch {
+		case len(ps) > 1 && lane[ps[1]] != name && laneTip[lane[ps[1]]] == ps[1]:
+			fmt.Fprintf(&b, "    merge %s %s\n", lane[ps[1]], attrs)
+		case len(ps) > 1 && lane[ps[1]] != name:
+			fmt.Fprintf(&b, "    %%%% %s merges %s, which is no longer the tip of %s\n", repo.ObjectAbbrev(c.Sha, 7), repo.ObjectAbbrev(ps[1], 7), lane[ps[1]])
+			fmt.Fprintf(&b, "    commit %s\n", attrs)
+		default:
+			fmt.Fprintf(&b, "    commit %s\n", attrs)
+		}
+		if len(ps) > 2 {
+			dropped := []string{}
+			for _, p := range ps[2:] {
+				dropped = append(dropped, fmt.Sprintf("%s (%s)", repo.ObjectAbbrev(p, 7), lane[p]))
+			}
+			fmt.Fprintf(&b, "    %%%% octopus merge %s also merges %s\n", repo.ObjectAbbrev(c.Sha, 7), strings.Join(dropped, ", "))
+		}
+		laneTip[name] = c.Sha
+
+		for _, fork := range forks[c.Sha] {
+			if !created[fork] {
+				fmt.Fprintf(&b, "    branch %s\n", fork)
+				created[fork] = true
+				current = fork
+			}
+		}
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,84 @@
+package repository_test
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/repository"
+)
+
+func TestLogMermaidLanes(t *testing.T) {
+	dir := t.TempDir()
+	script := `set -e
+git init -q
+git config user.name T
+git config user.email t@t
+n=0
+c() { n=$((n+1)); GIT_COMMITTER_DATE="@$((1700000000+n)) +0000" GIT_AUTHOR_DATE="@$((1700000000+n)) +0000" git commit -q --allow-empty -m "$@"; }
+c A
+git checkout -q -b feat
+c F1
+c F2
+git checkout -q master
+n=$((n+1)); GIT_COMMITTER_DATE="@$((1700000000+n)) +0000" git merge -q --no-ff -m "Merge F1" feat~1
+c B
+git checkout -q -b e
+c E1
+git checkout -q -b o master~1
+c O1
+git checkout -q master
+n=$((n+1)); GIT_COMMITTER_DATE="@$((1700000000+n)) +0000" git merge -q -m "Octopus" feat o
+git checkout -q e`
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("setup err:%v\n%s", err, out)
+	}
+
+	repo, err := repository.FindRepo(dir, true)
+	if err != nil {
+		t.Fatalf("FindRepo err:%v\n", err)
+	}
+
+	walker := repo.NewRevWalker(repository.RevWalkOptions{All: true, MaxCount: -1, Order: "topo"})
+	if err := walker.AddRevision("HEAD"); err != nil {
+		t.Fatalf("AddRevision err:%v\n", err)
+	}
+	commits, err := walker.Walk()
+	if err != nil {
+		t.Fatalf("Walk err:%v\n", err)
+	}
+
+	var b strings.Builder
+	if err := repo.LogMermaid(&b, commits); err != nil {
+		t.Fatalf("LogMermaid err:%v\n", err)
+	}
+
+	got := regexp.MustCompile(`[0-9a-f]{7} `).ReplaceAllString(b.String(), "")
+	want := `%%{init: { 'gitGraph': {'mainBranchName': 'master'}} }%%
+gitGraph
+    commit id: "A"
+    branch feat
+    commit id: "F1"
+    checkout master
+    merge feat id: "Merge F1"
+    branch o
+    checkout master
+    commit id: "B"
+    branch e
+    commit id: "E1"
+    checkout feat
+    commit id: "F2"
+    checkout o
+    commit id: "O1"
+    checkout master
+    merge feat id: "Octopus"
+    %% octopus merge also merges (o)
+`
+	if got != want {
+		t.Fatalf("LogMermaid got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type mailmapIdent struct {
+	name  string
+	email string
+}
+
+type mailmapInfo struct {
+	mailmapIdent
+	names map[string]mailmapIdent
+}
+
+type Mailmap struct {
+	entries map[string]*mailmapInfo
+}
+
+func NewMailmap() *Mailmap {
+	return &Mailmap{entries: map[string]*mailmapInfo{}}
+}
+
+func mailmapParseIdent(line string) (string, string, string, bool) {
+	/*
+		"Name <email>" at the start of line, returns the trimmed name, the email and the rest
+	*/
+	lt := strings.IndexByte(line, '<')
+	if lt == -1 {
+		return "", "", line, false
+	}
+	gt := strings.IndexByte(line[lt:], '>')
+	if gt == -1 {
+		return "", "", line, false
+	}
+
+	return strings.TrimSpace(line[:lt]), line[lt+1 : lt+gt], line[lt+gt+1:], true
+}
+
+func (m *Mailmap) add(newName string, newEmail string, oldName string, oldEmail string) {
+	/*
+		git's add_mapping, a mapping without an old name applies to every name the old email
+		is used with
+	*/
+	if oldEmail == "" {
+		oldEmail, newEmail = newEmail, ""
+	}
+
+	info, ok := m.entries[strings.ToLower(oldEmail)]
+	if !ok {
+		info = &mailmapInfo{names: map[string]mailmapIdent{}}
+		m.entries[strings.ToLower(oldEmail)] = info
+	}
+
+	if oldName == "" {
+		if newName != "" {
+			info.name = newName
+		}
+		if newEmail != "" {
+			info.email = newEmail
+		}
+		return
+	}
+
+	info.names[strings.ToLower(oldName)] = mailmapIdent{name: newName, email: newEmail}
+}
+
+func (m *Mailmap) Parse(data []byte) {
+	/*
+		one of
+			Proper Name <commit@email>
+			<proper@email> <commit@email>
+			Proper Name <proper@email> <commit@email>
+			Proper Name <proper@email> Commit Name <commit@email>
+		per line, later lines win and "#" starts a comment
+	*/
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name1, email1, rest, ok := mailmapParseIdent(line)
+		if !ok {
+			continue
+		}
+
+		if name2, email2, _, ok := mailmapParseIdent(rest); ok {
+			m.add(name1, email1, name2, email2)
+		} else {
+			m.add(name1, email1, "", "")
+		}
+	}
+}
+
+func (m *Mailmap) Map(name string, email string) (string, string) {
+	/*
+		git's map_user, the email picks the entry and the name a more specific one when the
+		entry has any, unmapped parts are returned as they are
+	*/
+	info, ok := m.entries[strings.ToLower(email)]
+	if !ok {
+		return name, email
+	}
+
+	ident := info.mailmapIdent
+	if len(info.names) > 0 {
+		if named, ok := info.names[strings.ToLower(name)]; ok {
+			ident = named
+		}
+	}
+
+	if ident.name != "" {
+		name = ident.name
+	}
+	if ident.email != "" {
+		email = ident.email
+	}
+
+	return name, email
+}
+
+func (m *Mailmap) MapSignature(sig Signature) Signature {
+	sig.Name, sig.Email = m.Map(sig.Name, sig.Email)
+	return sig
+}
+
+func (repo *Repository) mailmapConfig(key string) string {
+	/*
+		the repo config wins over the global one
+	*/
+	if repo.Conf != nil {
+		if value := repo.Conf.Section("mailmap").Key(key).String(); value != "" {
+			return value
+		}
+	}
+
+	config, err := GitConfigRead()
+	if err != nil {
+		return ""
+	}
+
+	return config.Section("mailmap").Key(key).String()
+}
+
+func (repo *Repository) MailmapRead() *Mailmap {
+	/*
+		git's read_mailmap, .mailmap at the top of the worktree, then mailmap.blob and then
+		mailmap.file, missing or unreadable sources are skipped
+		the result is kept for the life of repo
+	*/
+	if repo.mailmap != nil {
+		return repo.mailmap
+	}
+
+	m := NewMailmap()
+	if data, err := os.ReadFile(filepath.Join(repo.Worktree, ".mailmap")); err == nil {
+		m.Parse(data)
+	}
+
+	if blob := repo.mailmapConfig("blob"); blob != "" {
+		if sha, err := repo.ObjectFind(blob, "blob", true); err == nil {
+			if obj, err := repo.ObjectRead(sha); err == nil {
+				if b, ok := obj.(*GitBlob); ok {
+					m.Parse(b.BlobData)
+				}
+			}
+		}
+	}
+
+	if file := repo.mailmapConfig("file"); file != "" {
+		if rest, ok := strings.CutPrefix(file, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				file = filepath.Join(home, rest)
+			}
+		}
+		if data, err := os.ReadFile(file); err == nil {
+			m.Parse(data)
+		}
+	}
+
+	repo.mailmap = m
+	return m
+}
+
+func (repo *Repository) CheckMailmap(contact string) (string, error) {
+	/*
+		contact is "Name <email>" or "<email>", returned mapped in the same form
+	*/
+	name, email, rest, ok := mailmapParseIdent(contact)
+	if !ok || strings.TrimSpace(rest) != "" {
+		return "", fmt.Errorf("unable to parse contact: %s\n", contact)
+	}
+
+	name, email = repo.MailmapRead().Map(name, email)
+	if name == "" {
+		return fmt.Sprintf("<%s>", email), nil
+	}
+
+	return fmt.Sprintf("%s <%s>", name, email), nil
+}
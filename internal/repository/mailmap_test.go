@@ -0,0 +1,38 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/repository"
+)
+
+func TestMailmapMap(t *testing.T) {
+	m := repository.NewMailmap()
+	m.Parse([]byte(`# comment
+Alice Real <alice@real> <a@x>
+Bee Proper <b@proper> B <a@x>
+<dee@new> <d@x>
+Cee <C@X>
+`))
+
+	cases := []struct {
+		name      string
+		email     string
+		wantName  string
+		wantEmail string
+	}{
+		{"A", "a@x", "Alice Real", "alice@real"},
+		{"B", "a@x", "Bee Proper", "b@proper"},
+		{"b", "A@X", "Bee Proper", "b@proper"},
+		{"Dee", "d@x", "Dee", "dee@new"},
+		{"x", "c@x", "Cee", "c@x"},
+		{"Q", "q@q", "Q", "q@q"},
+	}
+
+	for _, c := range cases {
+		name, email := m.Map(c.name, c.email)
+		if name != c.wantName || email != c.wantEmail {
+			t.Fatalf("Map(%q, %q) = %q, %q want %q, %q\n", c.name, c.email, name, email, c.wantName, c.wantEmail)
+		}
+	}
+}
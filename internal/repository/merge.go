@@ -0,0 +1,545 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type MergeOptions struct {
+	Tree    MergeTreeOptions
+	NoFF    bool
+	FFOnly  bool
+	Squash  bool
+	Message string
+}
+
+type MergeOutcome struct {
+	Head        string
+	Merged      string
+	Commit      string
+	UpToDate    bool
+	FastForward bool
+	Result      *MergeTreeResult
+}
+
+func (repo *Repository) MergeHeads() ([]string, error) {
+	/*
+		the commits in MERGE_HEAD, empty when no merge is in progress
+	*/
+	data, err := os.ReadFile(repo.RepoPath("MERGE_HEAD"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return []string{}, err
+	}
+
+	return strings.Fields(string(data)), nil
+}
+
+func (repo *Repository) mergeStateWrite(heads []string, message string, noFF bool) error {
+	if err := os.WriteFile(repo.RepoPath("MERGE_HEAD"), []byte(strings.Join(heads, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(repo.RepoPath("MERGE_MSG"), []byte(message), 0644); err != nil {
+		return err
+	}
+
+	mode := ""
+	if noFF {
+		mode = "no-ff"
+	}
+	return os.WriteFile(repo.RepoPath("MERGE_MODE"), []byte(mode), 0644)
+}
+
+func (repo *Repository) MergeStateClear() error {
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE"} {
+		if err := os.Remove(repo.RepoPath(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *Repository) OrigHeadWrite(sha string) error {
+	return repo.refStore("ORIG_HEAD").Write("ORIG_HEAD", RefValue{Sha: sha})
+}
+
+func MessageCleanup(message string) string {
+	/*
+		git's default commit cleanup, "#" lines are dropped along with trailing whitespace,
+		leading and trailing blank lines and repeated blank lines
+	*/
+	lines := []string{}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (repo *Repository) MergeMessage(name string) (string, error) {
+	/*
+		git's fmt-merge-msg for one head, " into <branch>" is left out for main and master
+	*/
+	message := fmt.Sprintf("Merge commit '%s'", name)
+	if ref := repo.RefDwim(name); ref != "" {
+		switch {
+		case strings.HasPrefix(ref, "refs/heads/"):
+			message = fmt.Sprintf("Merge branch '%s'", strings.TrimPrefix(ref, "refs/heads/"))
+		case strings.HasPrefix(ref, "refs/tags/"):
+			message = fmt.Sprintf("Merge tag '%s'", strings.TrimPrefix(ref, "refs/tags/"))
+		case strings.HasPrefix(ref, "refs/remotes/"):
+			message = fmt.Sprintf("Merge remote-tracking branch '%s'", strings.TrimPrefix(ref, "refs/remotes/"))
+		}
+	}
+
+	branch, err := repo.GetActiveBranch()
+	if err != nil {
+		return "", err
+	}
+	switch branch {
+	case "main", "master":
+	case "":
+		message += " into HEAD"
+	default:
+		message += " into " + branch
+	}
+
+	return message, nil
+}
+
+func mergeConflictsMessage(message string, result *MergeTreeResult) string {
+	/*
+		the conflicted paths are listed as comments below the message like git
+	*/
+	if message != "" && !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	message += "\n# Conflicts:\n"
+	seen := map[string]bool{}
+	for _, c := range result.Conflicts {
+		if !seen[c.Path] {
+			seen[c.Path] = true
+			message += "#\t" + c.Path + "\n"
+		}
+	}
+
+	return message
+}
+
+func (repo *Repository) squashMessage(head string, merged string) (string, error) {
+	/*
+		the log of the commits the squash brings in, like git's SQUASH_MSG
+	*/
+	w := repo.NewRevWalker(RevWalkOptions{MaxCount: -1})
+	if err := w.AddRevision(merged); err != nil {
+		return "", err
+	}
+	if head != "" {
+		if err := w.AddRevision("^" + head); err != nil {
+			return "", err
+		}
+	}
+
+	commits, err := w.Walk()
+	if err != nil {
+		return "", err
+	}
+
+	entries := []string{}
+	for _, c := range commits {
+		entry, _, err := repo.logEntry(c, LogOptions{Format: "medium"}, nil)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, entry)
+	}
+
+	return "Squashed commit of the following:\n\n" + strings.Join(entries, "\n"), nil
+}
+
+func (repo *Repository) WorktreeMerge(head string, result *MergeTreeResult) error {
+	/*
+		head: "" when HEAD is unborn
+		moves the worktree and the index from head to the merge result, conflicted files get
+		their markers in the worktree and their stages in the index
+	*/
+	tree, err := repo.MergeTreeWrite(result)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.WorktreeSwitch(head, tree); err != nil {
+		return err
+	}
+	if result.Clean() {
+		return nil
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+
+	conflicted := map[string]bool{}
+	for _, c := range result.Conflicts {
+		conflicted[c.Path] = true
+	}
+
+	entries := []GitIndexEntry{}
+	for _, e := range index.Entries {
+		if !conflicted[e.Name] {
+			entries = append(entries, e)
+		}
+	}
+	for _, e := range result.IndexEntries() {
+		if e.FlagStage != 0 {
+			entries = append(entries, e)
+		}
+	}
+
+	index.Entries = entries
+	return repo.IndexWrite(index)
+}
+
+func (repo *Repository) WorktreeReset(tree string) error {
+	/*
+		puts the index and the worktree back to tree for every path the index does not agree
+		with tree on, conflicted ones included, local changes to other paths are kept
+	*/
+	to, err := repo.treeToLeafDict(tree, "")
+	if err != nil {
+		return err
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{}
+	entries := []GitIndexEntry{}
+	for _, e := range index.Entries {
+		leaf, ok := (*to)[e.Name]
+		if ok && e.FlagStage == 0 && leaf.Sha == e.Sha {
+			if modeType, modePerms := treeModeToIndexMode(leaf.Mode); modeType == e.ModeType && modePerms == e.ModePerms {
+				entries = append(entries, e)
+				kept[e.Name] = true
+				continue
+			}
+		}
+
+		if !ok {
+			if err := repo.worktreeRemoveFile(e.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range *to {
+		if !kept[name] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		leaf := (*to)[name]
+		if err := repo.worktreeWriteLeaf(leaf); err != nil {
+			return err
+		}
+
+		entry, err := indexEntryFromFile(filepath.Join(repo.Worktree, filepath.FromSlash(name)), name, leaf.Sha)
+		if err != nil {
+			return err
+		}
+		entry.ModeType, entry.ModePerms = treeModeToIndexMode(leaf.Mode)
+		entries = append(entries, entry)
+	}
+
+	index.Entries = entries
+	return repo.IndexWrite(index)
+}
+
+func (repo *Repository) indexUnmerged() ([]string, error) {
+	index, err := repo.IndexRead()
+	if err != nil {
+		return []string{}, err
+	}
+
+	ret := []string{}
+	for _, e := range index.Entries {
+		if e.FlagStage != 0 && !slices.Contains(ret, e.Name) {
+			ret = append(ret, e.Name)
+		}
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) Merge(name string, opts MergeOptions) (*MergeOutcome, error) {
+	/*
+		merges name into HEAD, fast-forwarding when HEAD is an ancestor of it unless
+		opts.NoFF, a conflicted merge leaves MERGE_HEAD and MERGE_MSG for MergeContinue
+		opts.Message: default val is git's "Merge branch '<name>'"
+		opts.Squash: updates the index and the worktree without committing or MERGE_HEAD
+	*/
+	if heads, err := repo.MergeHeads(); err != nil {
+		return nil, err
+	} else if len(heads) > 0 {
+		return nil, fmt.Errorf("You have not concluded your merge (MERGE_HEAD exists).\nPlease, commit your changes before you merge.\n")
+	}
+	if unmerged, err := repo.indexUnmerged(); err != nil {
+		return nil, err
+	} else if len(unmerged) > 0 {
+		return nil, fmt.Errorf("Merging is not possible because you have unmerged files.\n")
+	}
+
+	merged, err := repo.ObjectFind(name, "commit", true)
+	if err != nil {
+		return nil, fmt.Errorf("%s - not something we can merge\n", name)
+	}
+
+	head := ""
+	if sha, err := repo.RefResolve("HEAD"); err == nil {
+		head = sha
+	}
+
+	outcome := &MergeOutcome{Head: head, Merged: merged}
+	if head != "" {
+		if outcome.UpToDate, err = repo.IsAncestor(merged, head); err != nil || outcome.UpToDate {
+			return outcome, err
+		}
+	}
+
+	fastForward := head == ""
+	if !fastForward {
+		if fastForward, err = repo.IsAncestor(head, merged); err != nil {
+			return nil, err
+		}
+	}
+	if opts.FFOnly && !fastForward {
+		return nil, fmt.Errorf("Not possible to fast-forward, aborting.\n")
+	}
+	if head == "" && (opts.NoFF || opts.Squash) {
+		return nil, fmt.Errorf("Can merge only exactly one commit into empty head\n")
+	}
+
+	if head != "" {
+		if err := repo.OrigHeadWrite(head); err != nil {
+			return nil, err
+		}
+	}
+
+	message := opts.Message
+	if message == "" {
+		if message, err = repo.MergeMessage(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Squash {
+		squash, err := repo.squashMessage(head, merged)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(repo.RepoPath("SQUASH_MSG"), []byte(squash), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if fastForward && !opts.NoFF {
+		outcome.FastForward = true
+		if err := repo.WorktreeSwitch(head, merged); err != nil {
+			return nil, err
+		}
+		if opts.Squash {
+			return outcome, nil
+		}
+
+		outcome.Commit = merged
+		return outcome, repo.HeadUpdate(merged, fmt.Sprintf("merge %s: Fast-forward", name))
+	}
+
+	tree := opts.Tree
+	tree.OursLabel, tree.TheirsLabel = "HEAD", name
+	if outcome.Result, err = repo.MergeCommits(head, merged, tree); err != nil {
+		return nil, err
+	}
+	if err := repo.WorktreeMerge(head, outcome.Result); err != nil {
+		return nil, err
+	}
+
+	if opts.Squash {
+		if outcome.Result.Clean() {
+			return outcome, nil
+		}
+		return outcome, os.WriteFile(repo.RepoPath("MERGE_MSG"), []byte(mergeConflictsMessage("", outcome.Result)), 0644)
+	}
+	if !outcome.Result.Clean() {
+		return outcome, repo.mergeStateWrite([]string{merged}, mergeConflictsMessage(message, outcome.Result), opts.NoFF)
+	}
+
+	resultTree, err := repo.MergeTreeWrite(outcome.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := repo.UserIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	if outcome.Commit, err = repo.CommitCreate(resultTree, []string{head, merged}, user, message, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return outcome, repo.HeadUpdate(outcome.Commit, fmt.Sprintf("merge %s: Merge made by the 'ort' strategy.", name))
+}
+
+func (repo *Repository) MergeContinue(message string) (string, error) {
+	/*
+		message: default val is MERGE_MSG without its comments
+		commits the resolved merge with HEAD and MERGE_HEAD as parents
+	*/
+	heads, err := repo.MergeHeads()
+	if err != nil {
+		return "", err
+	}
+	if len(heads) == 0 {
+		return "", fmt.Errorf("There is no merge in progress (MERGE_HEAD missing).\n")
+	}
+
+	if message == "" {
+		data, err := os.ReadFile(repo.RepoPath("MERGE_MSG"))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		message = string(data)
+	}
+
+	return repo.CommitIndex(MessageCleanup(message), "")
+}
+
+func (repo *Repository) MergeAbort() error {
+	/*
+		resets the index and the worktree to HEAD and forgets the merge
+	*/
+	heads, err := repo.MergeHeads()
+	if err != nil {
+		return err
+	}
+	if len(heads) == 0 {
+		return fmt.Errorf("There is no merge to abort (MERGE_HEAD missing).\n")
+	}
+
+	if err := repo.WorktreeReset("HEAD"); err != nil {
+		return err
+	}
+
+	return repo.MergeStateClear()
+}
+
+func (repo *Repository) CommitIndex(message string, reflogPrefix string) (string, error) {
+	/*
+		reflogPrefix: default val is "commit: ", "commit (initial): " or "commit (merge): "
+		commits the index on top of HEAD and the commits in MERGE_HEAD, then clears the
+		merge state, the author of a stopped cherry-pick is kept
+	*/
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("Aborting commit due to empty commit message.\n")
+	}
+
+	if unmerged, err := repo.indexUnmerged(); err != nil {
+		return "", err
+	} else if len(unmerged) > 0 {
+		return "", fmt.Errorf("Committing is not possible because you have unmerged files.\n\t%s\n", strings.Join(unmerged, "\n\t"))
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return "", err
+	}
+
+	tree, err := repo.TreeFromIndex(index)
+	if err != nil {
+		return "", err
+	}
+
+	parents := []string{}
+	if head, err := repo.RefResolve("HEAD"); err == nil {
+		parents = append(parents, head)
+	}
+
+	heads, err := repo.MergeHeads()
+	if err != nil {
+		return "", err
+	}
+	parents = append(parents, heads...)
+
+	user, err := repo.UserIdent()
+	if err != nil {
+		return "", err
+	}
+	committer := fmt.Sprintf("%s %s", user, FormatSignatureTime(time.Now()))
+
+	author := committer
+	if pick, action := repo.pickHead(); pick != "" && action == "cherry-pick" {
+		picked, err := repo.CommitRead(pick)
+		if err != nil {
+			return "", err
+		}
+		author = commitAuthor(picked)
+	}
+
+	commit, err := repo.CommitCreateAuthored(tree, parents, author, committer, message)
+	if err != nil {
+		return "", err
+	}
+
+	if reflogPrefix == "" {
+		reflogPrefix = "commit: "
+		switch {
+		case len(parents) == 0:
+			reflogPrefix = "commit (initial): "
+		case len(parents) > 1:
+			reflogPrefix = "commit (merge): "
+		}
+	}
+
+	if err := repo.HeadUpdate(commit, reflogPrefix+MessageSubject(message)); err != nil {
+		return "", err
+	}
+
+	if err := os.Remove(repo.RepoPath("SQUASH_MSG")); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if err := repo.pickStateClear(); err != nil {
+		return "", err
+	}
+
+	return commit, repo.MergeStateClear()
+}
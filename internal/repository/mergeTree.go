@@ -0,0 +1,664 @@
+package repository
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/neet-007/git_in_go/internal/diff"
+)
+
+const (
+	ConflictContent       = "content"
+	ConflictAddAdd        = "add/add"
+	ConflictModifyDelete  = "modify/delete"
+	ConflictRenameDelete  = "rename/delete"
+	ConflictRenameRename  = "rename/rename"
+	ConflictFileDirectory = "file/directory"
+	ConflictDistinctTypes = "distinct types"
+)
+
+type MergeTreeOptions struct {
+	Diff        diff.Options
+	Style       string
+	Favor       string
+	Renames     bool
+	RenameScore int
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
+}
+
+type MergeConflict struct {
+	Path   string
+	Kind   string
+	Stages [4]*DiffEntry
+}
+
+type MergeTreeResult struct {
+	Entries   map[string]DiffEntry
+	Conflicts []MergeConflict
+	Messages  []string
+}
+
+type mergeInput struct {
+	path   string
+	base   *DiffEntry
+	ours   *DiffEntry
+	theirs *DiffEntry
+	kind   string
+}
+
+/*
+origin is the side each result path came from: 0 for both, 1 for ours and 2 for theirs
+*/
+type treeMerger struct {
+	repo   *Repository
+	opts   MergeTreeOptions
+	result *MergeTreeResult
+	origin map[string]int
+}
+
+func DefaultMergeTreeOptions() MergeTreeOptions {
+	return MergeTreeOptions{
+		Diff:        diff.Options{Algorithm: diff.Histogram},
+		Style:       diff.StyleMerge,
+		Renames:     true,
+		RenameScore: DefaultRenameScore,
+	}
+}
+
+func (r *MergeTreeResult) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+func sameEntry(a *DiffEntry, b *DiffEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Sha == b.Sha && a.Mode == b.Mode
+}
+
+func entryAt(entry *DiffEntry, path string) *DiffEntry {
+	if entry == nil {
+		return nil
+	}
+
+	e := *entry
+	e.Path = path
+	return &e
+}
+
+func (repo *Repository) mergeTreeEntries(tree string) (map[string]DiffEntry, error) {
+	/*
+		"" is the empty tree
+	*/
+	if tree == "" {
+		return map[string]DiffEntry{}, nil
+	}
+
+	return repo.DiffTreeEntries(tree)
+}
+
+func (repo *Repository) mergeRenames(base map[string]DiffEntry, side map[string]DiffEntry, opts MergeTreeOptions) (map[string]string, error) {
+	/*
+		maps the base paths that side renamed to their new path
+	*/
+	ret := map[string]string{}
+	if !opts.Renames {
+		return ret, nil
+	}
+
+	pairs, err := repo.DiffRenames(DiffPairs(base, side, nil), false, opts.RenameScore)
+	if err != nil {
+		return ret, err
+	}
+
+	for _, pair := range pairs {
+		if pair.Status == 'R' {
+			ret[pair.Old.Path] = pair.New.Path
+		}
+	}
+
+	return ret, nil
+}
+
+func (m *treeMerger) conflict(path string, kind string, base *DiffEntry, ours *DiffEntry, theirs *DiffEntry) {
+	m.result.Conflicts = append(m.result.Conflicts, MergeConflict{
+		Path:   path,
+		Kind:   kind,
+		Stages: [4]*DiffEntry{nil, entryAt(base, path), entryAt(ours, path), entryAt(theirs, path)},
+	})
+}
+
+func (m *treeMerger) take(path string, entry *DiffEntry, origin int) {
+	if entry == nil {
+		return
+	}
+
+	m.result.Entries[path] = *entryAt(entry, path)
+	m.origin[path] = origin
+}
+
+func (m *treeMerger) label(label string, side *DiffEntry, path string) string {
+	/*
+		like git the path is added to the label when the side had the file somewhere else
+	*/
+	if side != nil && side.Path != path {
+		return label + ":" + side.Path
+	}
+
+	return label
+}
+
+func (m *treeMerger) mergeContent(in *mergeInput) (DiffEntry, bool, error) {
+	/*
+		the merged blob of a path both sides changed and whether it merged cleanly, binary
+		files, symlinks and submodules keep ours
+	*/
+	merged := *entryAt(in.ours, in.path)
+
+	kind := diffModeType(in.ours.Mode)
+	if kind != "100" || kind != diffModeType(in.theirs.Mode) {
+		return merged, false, nil
+	}
+
+	baseData := []byte{}
+	var err error
+	if in.base != nil {
+		if baseData, err = m.repo.diffContent(*in.base); err != nil {
+			return merged, false, err
+		}
+	}
+	oursData, err := m.repo.diffContent(*in.ours)
+	if err != nil {
+		return merged, false, err
+	}
+	theirsData, err := m.repo.diffContent(*in.theirs)
+	if err != nil {
+		return merged, false, err
+	}
+
+	if diff.IsBinary(baseData) || diff.IsBinary(oursData) || diff.IsBinary(theirsData) {
+		m.result.Messages = append(m.result.Messages, fmt.Sprintf("warning: Cannot merge binary files: %s (%s vs. %s)", in.path, m.opts.OursLabel, m.opts.TheirsLabel))
+		m.result.Messages = append(m.result.Messages, "Auto-merging "+in.path)
+		switch m.opts.Favor {
+		case diff.FavorOurs:
+			return merged, true, nil
+		case diff.FavorTheirs:
+			merged.Sha = in.theirs.Sha
+			return merged, true, nil
+		}
+		return merged, false, nil
+	}
+	m.result.Messages = append(m.result.Messages, "Auto-merging "+in.path)
+
+	data, conflicts := diff.Merge3(diff.Split(baseData), diff.Split(oursData), diff.Split(theirsData), diff.MergeOptions{
+		Diff:        m.opts.Diff,
+		Style:       m.opts.Style,
+		Favor:       m.opts.Favor,
+		OursLabel:   m.label(m.opts.OursLabel, in.ours, in.path),
+		BaseLabel:   m.label(m.opts.BaseLabel, in.base, in.path),
+		TheirsLabel: m.label(m.opts.TheirsLabel, in.theirs, in.path),
+	})
+
+	blob := &GitBlob{}
+	blob.Init(data)
+	if merged.Sha, err = ObjectWrite(blob, m.repo); err != nil {
+		return merged, false, err
+	}
+
+	return merged, conflicts == 0, nil
+}
+
+func movedPath(path string, label string) string {
+	return path + "~" + strings.ReplaceAll(label, "/", "_")
+}
+
+func (m *treeMerger) distinctTypes(in *mergeInput) {
+	/*
+		like git the regular file moves to <path>~<label of its side> so both sides are kept,
+		theirs moves when neither is one, the base stays with the side of its type
+	*/
+	stay, move, label := in.ours, in.theirs, m.opts.TheirsLabel
+	if diffModeType(in.ours.Mode) == "100" {
+		stay, move, label = in.theirs, in.ours, m.opts.OursLabel
+	}
+
+	moved := movedPath(in.path, label)
+	baseStay, baseMove := in.base, (*DiffEntry)(nil)
+	if in.base != nil && diffModeType(in.base.Mode) == diffModeType(move.Mode) {
+		baseStay, baseMove = nil, in.base
+	}
+
+	if move == in.ours {
+		m.take(in.path, stay, 2)
+		m.take(moved, move, 1)
+		m.conflict(in.path, ConflictDistinctTypes, baseStay, nil, stay)
+		m.conflict(moved, ConflictDistinctTypes, baseMove, move, nil)
+	} else {
+		m.take(in.path, stay, 1)
+		m.take(moved, move, 2)
+		m.conflict(in.path, ConflictDistinctTypes, baseStay, stay, nil)
+		m.conflict(moved, ConflictDistinctTypes, baseMove, nil, move)
+	}
+
+	m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (distinct types): %s had different types on each side; renamed one of them so each can be recorded somewhere.", in.path))
+}
+
+func (m *treeMerger) merge(in *mergeInput) error {
+	/*
+		git's three way merge of one path, a side that did not change gives way to the other
+		and changes on both sides are merged by mode and content
+	*/
+	switch {
+	case sameEntry(in.ours, in.theirs):
+		m.take(in.path, in.ours, 0)
+		return nil
+	case in.kind == "" && sameEntry(in.base, in.ours):
+		m.take(in.path, in.theirs, 2)
+		return nil
+	case in.kind == "" && sameEntry(in.base, in.theirs):
+		m.take(in.path, in.ours, 1)
+		return nil
+	case in.ours == nil || in.theirs == nil:
+		deleted, modified, survivor, origin := m.opts.OursLabel, m.opts.TheirsLabel, in.theirs, 2
+		if in.theirs == nil {
+			deleted, modified, survivor, origin = m.opts.TheirsLabel, m.opts.OursLabel, in.ours, 1
+		}
+
+		m.take(in.path, survivor, origin)
+		m.conflict(in.path, ConflictModifyDelete, in.base, in.ours, in.theirs)
+		m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.", in.path, deleted, modified, modified, in.path))
+		return nil
+	}
+
+	if diffModeType(in.ours.Mode) != diffModeType(in.theirs.Mode) {
+		m.distinctTypes(in)
+		return nil
+	}
+
+	mode, modeClean := in.ours.Mode, true
+	switch {
+	case in.base != nil && in.base.Mode == in.ours.Mode:
+		mode = in.theirs.Mode
+	case in.base != nil && in.base.Mode == in.theirs.Mode:
+	default:
+		modeClean = in.ours.Mode == in.theirs.Mode
+	}
+
+	var merged DiffEntry
+	clean := true
+	switch {
+	case in.ours.Sha == in.theirs.Sha:
+		merged = *entryAt(in.ours, in.path)
+	case in.kind == "" && in.base != nil && in.base.Sha == in.ours.Sha:
+		merged = *entryAt(in.theirs, in.path)
+	case in.kind == "" && in.base != nil && in.base.Sha == in.theirs.Sha:
+		merged = *entryAt(in.ours, in.path)
+	default:
+		var err error
+		if merged, clean, err = m.mergeContent(in); err != nil {
+			return err
+		}
+	}
+	merged.Mode = mode
+	m.result.Entries[in.path] = merged
+	m.origin[in.path] = 0
+
+	if clean && modeClean && in.kind == "" {
+		return nil
+	}
+
+	kind := in.kind
+	if kind == "" {
+		kind = ConflictContent
+		if in.base == nil {
+			kind = ConflictAddAdd
+		}
+	}
+	m.conflict(in.path, kind, in.base, in.ours, in.theirs)
+
+	if !modeClean {
+		m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (mode): %s had different modes on each side; mode of %s left in tree.", in.path, m.opts.OursLabel))
+	}
+	if !clean || kind != ConflictContent {
+		m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (%s): Merge conflict in %s", kind, in.path))
+	}
+
+	return nil
+}
+
+func (m *treeMerger) fileDirectory() {
+	/*
+		a file where the other side has a directory moves to <path>~<label of its side>
+	*/
+	dirs := map[string]bool{}
+	for name := range m.result.Entries {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	names := []string{}
+	for name := range m.result.Entries {
+		if dirs[name] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		label := m.opts.OursLabel
+		if m.origin[name] == 2 {
+			label = m.opts.TheirsLabel
+		}
+
+		moved := movedPath(name, label)
+		entry := m.result.Entries[name]
+		delete(m.result.Entries, name)
+		m.result.Entries[moved] = *entryAt(&entry, moved)
+
+		stages := [4]*DiffEntry{}
+		for i, c := range m.result.Conflicts {
+			if c.Path == name {
+				stages = c.Stages
+				m.result.Conflicts = slices.Delete(m.result.Conflicts, i, i+1)
+				break
+			}
+		}
+		if stages == [4]*DiffEntry{} {
+			stages[max(m.origin[name], 1)+1] = &entry
+		}
+		m.conflict(moved, ConflictFileDirectory, stages[1], stages[2], stages[3])
+
+		m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.", name, label, moved))
+	}
+}
+
+func (repo *Repository) MergeTrees(base string, ours string, theirs string, opts MergeTreeOptions) (*MergeTreeResult, error) {
+	/*
+		base: "" when there is no common ancestor
+		the merged tree of ours and theirs, Entries holds what ends up in the worktree, that
+		is the merged files with conflict markers for conflicted content, and Conflicts the
+		index stages of the paths that did not merge cleanly
+		renames on either side are followed so changes to the old path land on the new one
+	*/
+	baseEntries, err := repo.mergeTreeEntries(base)
+	if err != nil {
+		return nil, err
+	}
+	oursEntries, err := repo.mergeTreeEntries(ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsEntries, err := repo.mergeTreeEntries(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	oursRenames, err := repo.mergeRenames(baseEntries, oursEntries, opts)
+	if err != nil {
+		return nil, err
+	}
+	theirsRenames, err := repo.mergeRenames(baseEntries, theirsEntries, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &treeMerger{repo: repo, opts: opts, result: &MergeTreeResult{Entries: map[string]DiffEntry{}}, origin: map[string]int{}}
+	lookup := func(entries map[string]DiffEntry, name string) *DiffEntry {
+		if e, ok := entries[name]; ok {
+			return &e
+		}
+		return nil
+	}
+
+	inputs := map[string]*mergeInput{}
+	consumedOurs, consumedTheirs := map[string]bool{}, map[string]bool{}
+
+	basePaths := []string{}
+	for name := range baseEntries {
+		basePaths = append(basePaths, name)
+	}
+	slices.Sort(basePaths)
+
+	for _, name := range basePaths {
+		b := lookup(baseEntries, name)
+
+		oursPath, theirsPath := name, name
+		if renamed, ok := oursRenames[name]; ok {
+			oursPath = renamed
+		}
+		if renamed, ok := theirsRenames[name]; ok {
+			theirsPath = renamed
+		}
+
+		o, t := lookup(oursEntries, oursPath), lookup(theirsEntries, theirsPath)
+		if o != nil {
+			consumedOurs[oursPath] = true
+		}
+		if t != nil {
+			consumedTheirs[theirsPath] = true
+		}
+
+		switch {
+		case oursPath != name && theirsPath != name && oursPath != theirsPath:
+			m.take(oursPath, o, 1)
+			m.take(theirsPath, t, 2)
+			m.conflict(name, ConflictRenameRename, b, nil, nil)
+			m.conflict(oursPath, ConflictRenameRename, nil, o, nil)
+			m.conflict(theirsPath, ConflictRenameRename, nil, nil, t)
+			m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (rename/rename): %s renamed to %s in %s and to %s in %s.", name, oursPath, opts.OursLabel, theirsPath, opts.TheirsLabel))
+		case oursPath != name && t == nil:
+			m.take(oursPath, o, 1)
+			m.conflict(oursPath, ConflictRenameDelete, b, o, nil)
+			m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (rename/delete): %s renamed to %s in %s, but deleted in %s.", name, oursPath, opts.OursLabel, opts.TheirsLabel))
+		case theirsPath != name && o == nil:
+			m.take(theirsPath, t, 2)
+			m.conflict(theirsPath, ConflictRenameDelete, b, nil, t)
+			m.result.Messages = append(m.result.Messages, fmt.Sprintf("CONFLICT (rename/delete): %s renamed to %s in %s, but deleted in %s.", name, theirsPath, opts.TheirsLabel, opts.OursLabel))
+		default:
+			target := oursPath
+			if target == name {
+				target = theirsPath
+			}
+			inputs[target] = &mergeInput{path: target, base: b, ours: o, theirs: t}
+		}
+	}
+
+	addition := func(name string, e DiffEntry, ours bool) {
+		in, ok := inputs[name]
+		switch {
+		case !ok:
+			in = &mergeInput{path: name}
+			inputs[name] = in
+		case ours || in.base != nil || in.theirs != nil:
+			in.base = nil
+			in.kind = ConflictAddAdd
+		}
+
+		if ours {
+			in.ours = &e
+		} else {
+			in.theirs = &e
+		}
+	}
+
+	for name, e := range oursEntries {
+		if !consumedOurs[name] {
+			addition(name, e, true)
+		}
+	}
+	for name, e := range theirsEntries {
+		if !consumedTheirs[name] {
+			addition(name, e, false)
+		}
+	}
+
+	names := []string{}
+	for name := range inputs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := m.merge(inputs[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	m.fileDirectory()
+
+	slices.SortStableFunc(m.result.Conflicts, func(a MergeConflict, b MergeConflict) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return m.result, nil
+}
+
+func (r *MergeTreeResult) IndexEntries() []GitIndexEntry {
+	/*
+		stage 0 for the merged paths and stages 1 to 3 for the conflicted ones, the entries
+		carry no stat data
+	*/
+	conflicted := map[string]bool{}
+	ret := []GitIndexEntry{}
+	for _, c := range r.Conflicts {
+		conflicted[c.Path] = true
+		for stage := 1; stage <= 3; stage++ {
+			if e := c.Stages[stage]; e != nil {
+				modeType, modePerms := treeModeToIndexMode([]byte(e.Mode))
+				ret = append(ret, GitIndexEntry{Name: c.Path, Sha: e.Sha, ModeType: modeType, ModePerms: modePerms, FlagStage: uint16(stage)})
+			}
+		}
+	}
+
+	for name, e := range r.Entries {
+		if conflicted[name] {
+			continue
+		}
+
+		modeType, modePerms := treeModeToIndexMode([]byte(e.Mode))
+		ret = append(ret, GitIndexEntry{Name: name, Sha: e.Sha, ModeType: modeType, ModePerms: modePerms})
+	}
+
+	slices.SortStableFunc(ret, func(a GitIndexEntry, b GitIndexEntry) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return int(a.FlagStage) - int(b.FlagStage)
+	})
+
+	return ret
+}
+
+func (repo *Repository) MergeTreeWrite(r *MergeTreeResult) (string, error) {
+	/*
+		writes the tree of Entries, conflicted files included with their markers like git's
+		merge-tree
+	*/
+	index := &GitIndex{Version: 2}
+	for name, e := range r.Entries {
+		modeType, modePerms := treeModeToIndexMode([]byte(e.Mode))
+		index.Entries = append(index.Entries, GitIndexEntry{Name: name, Sha: e.Sha, ModeType: modeType, ModePerms: modePerms})
+	}
+	slices.SortFunc(index.Entries, func(a GitIndexEntry, b GitIndexEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return repo.TreeFromIndex(index)
+}
+
+func (repo *Repository) MergeBaseTree(ours string, theirs string, opts MergeTreeOptions) (string, error) {
+	bases, err := repo.MergeBases(ours, theirs)
+	if err != nil {
+		return "", err
+	}
+
+	return repo.mergeBasesTree(bases, opts)
+}
+
+func (repo *Repository) mergeBasesTree(bases []string, opts MergeTreeOptions) (string, error) {
+	/*
+		the tree of the merge bases, "" without any, several merge bases are merged into a
+		virtual one like git's recursive strategy, conflicts included
+	*/
+	if len(bases) == 0 {
+		return "", nil
+	}
+
+	commit, err := repo.CommitRead(bases[0])
+	if err != nil {
+		return "", err
+	}
+	virtual := commitTree(commit)
+
+	for i, other := range bases[1:] {
+		innerBase, err := repo.MergeBaseTree(bases[0], other, opts)
+		if err != nil {
+			return "", err
+		}
+
+		commit, err := repo.CommitRead(other)
+		if err != nil {
+			return "", err
+		}
+
+		inner := opts
+		inner.Favor = ""
+		inner.OursLabel = "Temporary merge branch 1"
+		inner.TheirsLabel = fmt.Sprintf("Temporary merge branch %d", i+2)
+		inner.BaseLabel = "merged common ancestors"
+
+		result, err := repo.MergeTrees(innerBase, virtual, commitTree(commit), inner)
+		if err != nil {
+			return "", err
+		}
+		if virtual, err = repo.MergeTreeWrite(result); err != nil {
+			return "", err
+		}
+	}
+
+	return virtual, nil
+}
+
+func (repo *Repository) MergeCommits(ours string, theirs string, opts MergeTreeOptions) (*MergeTreeResult, error) {
+	/*
+		merges the trees of two commits over the tree of their merge base
+		opts.BaseLabel: default val is the abbreviated merge base like git
+	*/
+	bases, err := repo.MergeBases(ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := repo.mergeBasesTree(bases, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.BaseLabel == "" {
+		switch len(bases) {
+		case 0:
+			opts.BaseLabel = "empty tree"
+		case 1:
+			opts.BaseLabel = repo.ObjectAbbrev(bases[0], 7)
+		default:
+			opts.BaseLabel = "merged common ancestors"
+		}
+	}
+
+	trees := []string{}
+	for _, sha := range []string{ours, theirs} {
+		commit, err := repo.CommitRead(sha)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, commitTree(commit))
+	}
+
+	return repo.MergeTrees(base, trees[0], trees[1], opts)
+}
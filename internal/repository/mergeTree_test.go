@@ -0,0 +1,97 @@
+package repository_test
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/repository"
+)
+
+func TestMergeCommitsMatchesGit(t *testing.T) {
+	const lines = `printf 'l1\nl2\nl3\nl4\nl5\nl6\nl7\nl8\nl9\n'`
+
+	cases := []struct {
+		name   string
+		base   string
+		ours   string
+		theirs string
+	}{
+		{"content", lines + " > a", "sed -i s/l2/X/ a", "sed -i s/l2/Y/ a"},
+		{"clean", lines + " > a", "sed -i s/l2/X/ a; echo n > n", "sed -i s/l8/Y/ a"},
+		{"add/add", "echo z > z", "echo 1 > a", "echo 2 > a"},
+		{"modify/delete", lines + " > a", "git rm -q a", "echo x >> a"},
+		{"rename", lines + " > a", "git mv a b", "sed -i s/l1/X/ a"},
+		{"rename/rename", lines + " > a", "git mv a b", "git mv a c"},
+		{"rename/delete", lines + " > a", "git mv a b", "git rm -q a"},
+		{"file/directory", "echo z > z", "echo 1 > a", "mkdir a; echo 2 > a/b"},
+		{"distinct types", lines + " > a", "rm a; ln -s foo a", "echo x >> a"},
+		{"mode", lines + " > a", "chmod +x a", "echo x >> a"},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		script := fmt.Sprintf(`set -e
+git init -q
+git config user.name T
+git config user.email t@t
+%s
+git add -A && git commit -qm base && git branch side
+%s
+git add -A && git commit -qm ours
+git checkout -q side
+%s
+git add -A && git commit -qm theirs`, c.base, c.ours, c.theirs)
+
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: setup err:%v\n%s", c.name, err, out)
+		}
+
+		cmd = exec.Command("git", "merge-tree", "--write-tree", "master", "side")
+		cmd.Dir = dir
+		gitOut, _ := cmd.Output()
+
+		repo, err := repository.FindRepo(dir, true)
+		if err != nil {
+			t.Fatalf("%s: FindRepo err:%v\n", c.name, err)
+		}
+
+		shas := []string{}
+		for _, name := range []string{"master", "side"} {
+			sha, err := repo.ObjectFind(name, "commit", true)
+			if err != nil {
+				t.Fatalf("%s: ObjectFind %s err:%v\n", c.name, name, err)
+			}
+			shas = append(shas, sha)
+		}
+
+		opts := repository.DefaultMergeTreeOptions()
+		opts.OursLabel, opts.TheirsLabel = "master", "side"
+		result, err := repo.MergeCommits(shas[0], shas[1], opts)
+		if err != nil {
+			t.Fatalf("%s: MergeCommits err:%v\n", c.name, err)
+		}
+		tree, err := repo.MergeTreeWrite(result)
+		if err != nil {
+			t.Fatalf("%s: MergeTreeWrite err:%v\n", c.name, err)
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s\n", tree)
+		for _, e := range result.IndexEntries() {
+			if e.FlagStage != 0 {
+				fmt.Fprintf(&b, "%06o %s %d\t%s\n", uint32(e.ModeType)<<12|uint32(e.ModePerms), e.Sha, e.FlagStage, e.Name)
+			}
+		}
+		if !result.Clean() {
+			b.WriteString("\n" + strings.Join(result.Messages, "\n") + "\n")
+		}
+
+		if b.String() != string(gitOut) {
+			t.Fatalf("%s: got\n%s\nwant\n%s\n", c.name, b.String(), gitOut)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package repository_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/repository"
+)
+
+func TestMergeConflictResolve(t *testing.T) {
+	dir := t.TempDir()
+	script := `set -e
+git init -q
+git config user.name T
+git config user.email t@t
+echo base > f; echo k > k; echo z > z
+git add -A && git commit -qm base && git branch t
+echo ours > f; echo k2 > k
+git add -A && git commit -qm ours
+git checkout -q t
+echo theirs > f; git rm -q k
+git add -A && git commit -qm theirs
+git checkout -q master`
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("setup err:%v\n%s", err, out)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd err:%v\n", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir err:%v\n", err)
+	}
+	defer os.Chdir(wd)
+
+	repo, err := repository.FindRepo(dir, true)
+	if err != nil {
+		t.Fatalf("FindRepo err:%v\n", err)
+	}
+
+	outcome, err := repo.Merge("t", repository.MergeOptions{Tree: repository.DefaultMergeTreeOptions(), Message: "Merge branch 't'"})
+	if err != nil {
+		t.Fatalf("Merge err:%v\n", err)
+	}
+	if outcome.Result.Clean() {
+		t.Fatalf("Merge want conflicts on f and k\n")
+	}
+
+	if _, err := repo.MergeContinue(""); err == nil {
+		t.Fatalf("MergeContinue with unmerged files want err\n")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "f"), []byte("resolved\n"), 0644); err != nil {
+		t.Fatalf("WriteFile err:%v\n", err)
+	}
+	if err := repo.Add([]string{"f"}); err != nil {
+		t.Fatalf("Add err:%v\n", err)
+	}
+	if err := repo.Rm([]string{"k"}, true, false); err != nil {
+		t.Fatalf("Rm err:%v\n", err)
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		t.Fatalf("IndexRead err:%v\n", err)
+	}
+	names := []string{}
+	for _, e := range index.Entries {
+		if e.FlagStage != 0 {
+			t.Fatalf("entry %s still at stage %d\n", e.Name, e.FlagStage)
+		}
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, " ") != "f z" {
+		t.Fatalf("index got %v want [f z]\n", names)
+	}
+
+	commit, err := repo.MergeContinue("")
+	if err != nil {
+		t.Fatalf("MergeContinue err:%v\n", err)
+	}
+
+	cmd = exec.Command("git", "log", "-1", "--format=%P%n%s", commit)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git log err:%v\n", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(strings.Fields(lines[0])) != 2 || lines[1] != "Merge branch 't'" {
+		t.Fatalf("merge commit got %q\n", out)
+	}
+
+	cmd = exec.Command("git", "status", "--porcelain")
+	cmd.Dir = dir
+	if out, err := cmd.Output(); err != nil || len(out) != 0 {
+		t.Fatalf("git status after continue got %q err:%v\n", out, err)
+	}
+}
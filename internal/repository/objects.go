@@ -116,12 +116,9 @@ func ObjectWrite(obj GitObject, repo *Repository) (string, error) {
 			return "", err
 		}
 
-		println("i me heeeeerer")
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			file, err := os.Create(path)
-			fmt.Printf("file path:%s\n", path)
 			if err != nil {
-				println("this errrro")
 				return "", err
 			}
 
@@ -152,22 +149,16 @@ func (repo *Repository) ObjectFind(name string, fmtType string, follow bool) (st
 		fmtType: defailt val is ""
 		follow: default val is true
 	*/
-	sha, err := repo.ObjectResolve(name)
+	shaStr, err := repo.RevParse(name)
 	if err != nil {
 		return "", fmt.Errorf("for name:%s, fmtType:%s, follow:%v error:%w\n", name, fmtType, follow, err)
 	}
 
-	if len(sha) != 1 {
-		return "", fmt.Errorf("sha candidates size is not 1 got %d found for name:%s, fmtType:%s, follow:%v\n", len(sha), name, fmtType, follow)
-	}
-
-	shaStr := sha[0]
-
 	if fmtType == "" {
 		return shaStr, nil
 	}
 
-	for {
+	if !follow {
 		obj, err := repo.ObjectRead(shaStr)
 		if err != nil {
 			return "", fmt.Errorf("for name:%s, fmtType:%s, follow:%v error:%w\n", name, fmtType, follow, err)
@@ -178,41 +169,16 @@ func (repo *Repository) ObjectFind(name string, fmtType string, follow bool) (st
 			return "", fmt.Errorf("for name:%s, fmtType:%s, follow:%v error:%w\n", name, fmtType, follow, err)
 		}
 
-		if string(objFmt) == fmtType {
-			break
-		}
-
-		if !follow {
-			return "", fmt.Errorf("not follow name:%s, fmtType:%s, follow:%v error:%w\n", name, fmtType, follow)
+		if string(objFmt) != fmtType {
+			return "", fmt.Errorf("not follow name:%s, fmtType:%s, follow:%v\n", name, fmtType, follow)
 		}
 
-		if fmtType == "tag" {
-			objTag, ok := obj.(*GitTag)
-			if !ok {
-				return "", fmt.Errorf("could not convert obj to GitTag for name:%s, fmtType:%s, follow:%v\n", name, fmtType, follow)
-			}
-
-			var combined []byte
-			for _, slice := range (*(*objTag.Kvlm).Map)["object"] {
-				combined = append(combined, slice...)
-			}
-
-			shaStr = string(combined)
-		} else if string(objFmt) == "commit" && fmtType == "tree" {
-			objCommit, ok := obj.(*GitCommit)
-			if !ok {
-				return "", fmt.Errorf("could not convert obj to GitCommit for name:%s, fmtType:%s, follow:%v\n", name, fmtType, follow)
-			}
-
-			var combined []byte
-			for _, slice := range (*(*&objCommit.Kvlm).Map)["tree"] {
-				combined = append(combined, slice...)
-			}
+		return shaStr, nil
+	}
 
-			shaStr = string(combined)
-		} else {
-			return "", fmt.Errorf("last case name:%s, fmtType:%s, follow:%v error:%w\n", name, fmtType, follow)
-		}
+	shaStr, err = repo.ObjectPeelTo(shaStr, fmtType)
+	if err != nil {
+		return "", fmt.Errorf("for name:%s, fmtType:%s, follow:%v error:%w\n", name, fmtType, follow, err)
 	}
 
 	return shaStr, nil
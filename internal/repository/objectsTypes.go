@@ -67,7 +67,6 @@ func (commit *GitCommit) Deserialize(data []byte) error {
 	if err != nil {
 		return err
 	}
-	kvlm.Sort()
 
 	commit.Kvlm = kvlm
 	return nil
@@ -77,7 +76,7 @@ func (commit *GitCommit) Init(data []byte) {
 	commit.Fmt = "commit"
 	err := commit.Deserialize(data)
 	if err != nil {
-		fmt.Printf("FIX THIS NOT THE WAY TO DO IT BUT GOT ERROR WITH INIT COMMIT:%w", err)
+		fmt.Printf("FIX THIS NOT THE WAY TO DO IT BUT GOT ERROR WITH INIT COMMIT:%v", err)
 		return
 	}
 }
@@ -104,7 +103,7 @@ func (tree *GitTree) Init(data []byte) {
 	tree.Fmt = "tree"
 	err := tree.Deserialize(data)
 	if err != nil {
-		fmt.Printf("FIX THIS NOT THE WAY TO DO IT BUT GOT ERROR WITH INIT TREE:%w\n", err)
+		fmt.Printf("FIX THIS NOT THE WAY TO DO IT BUT GOT ERROR WITH INIT TREE:%v\n", err)
 		return
 	}
 }
@@ -127,17 +126,16 @@ func (tag *GitTag) Deserialize(data []byte) error {
 	if err != nil {
 		return err
 	}
-	kvlm.Sort()
 
 	tag.Kvlm = kvlm
 	return nil
 }
 
 func (tag *GitTag) Init(data []byte) {
-	tag.Fmt = "commit"
+	tag.Fmt = "tag"
 	err := tag.Deserialize(data)
 	if err != nil {
-		fmt.Printf("FIX THIS NOT THE WAY TO DO IT BUT GOT ERROR WITH INIT COMMIT:%w", err)
+		fmt.Printf("FIX THIS NOT THE WAY TO DO IT BUT GOT ERROR WITH INIT COMMIT:%v", err)
 		return
 	}
 }
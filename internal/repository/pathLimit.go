@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+func (repo *Repository) WorktreePathspec(paths []string) ([]string, error) {
+	/*
+		turns paths relative to the current directory into paths relative to the worktree,
+		"" is the whole tree
+	*/
+	cwd, err := os.Getwd()
+	if err != nil {
+		return []string{}, err
+	}
+	if cwd, err = filepath.EvalSymlinks(cwd); err != nil {
+		return []string{}, err
+	}
+
+	ret := []string{}
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwd, path)
+		}
+
+		rel, err := filepath.Rel(repo.Worktree, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return []string{}, fmt.Errorf("%s: '%s' is outside repository at '%s'\n", path, path, repo.Worktree)
+		}
+		if rel == "." {
+			rel = ""
+		}
+
+		ret = append(ret, filepath.ToSlash(rel))
+	}
+
+	return ret, nil
+}
+
+var pathspecPatterns = map[string]*regexp.Regexp{}
+
+func pathspecWildcard(spec string) bool {
+	return strings.ContainsAny(spec, "*?[")
+}
+
+func pathspecMatch(name string, spec string) bool {
+	/*
+		a spec without wildcards matches the path itself and everything under it, with
+		wildcards the whole path has to match like git's fnmatch, * and ? also match "/"
+	*/
+	if !pathspecWildcard(spec) {
+		return spec == "" || name == spec || strings.HasPrefix(name, spec+"/")
+	}
+
+	re, ok := pathspecPatterns[spec]
+	if !ok {
+		var b strings.Builder
+		b.WriteString("^")
+		for i := 0; i < len(spec); i++ {
+			switch spec[i] {
+			case '*':
+				b.WriteString(".*")
+			case '?':
+				b.WriteString(".")
+			case '[':
+				end := strings.IndexByte(spec[i+1:], ']')
+				if end == -1 {
+					b.WriteString(`\[`)
+					continue
+				}
+				class := spec[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+				i += end + 1
+			default:
+				b.WriteString(regexp.QuoteMeta(spec[i : i+1]))
+			}
+		}
+		b.WriteString("$")
+
+		var err error
+		if re, err = regexp.Compile(b.String()); err != nil {
+			re = regexp.MustCompile("^" + regexp.QuoteMeta(spec) + "$")
+		}
+		pathspecPatterns[spec] = re
+	}
+
+	return re.MatchString(name)
+}
+
+func (w *RevWalker) prune() bool {
+	return len(w.Opts.Paths) > 0 && !w.Opts.Follow
+}
+
+func (w *RevWalker) pathEntry(tree string, path string) string {
+	/*
+		the mode and sha of path in tree, "" when it is missing, a path with wildcards
+		gets every leaf it matches
+	*/
+	key := tree + " " + path
+	if entry, ok := w.entries[key]; ok {
+		return entry
+	}
+
+	entry := ""
+	if tree != "" && pathspecWildcard(path) {
+		if leaves, err := w.repo.treeToLeafDict(tree, ""); err == nil {
+			names := []string{}
+			for name := range *leaves {
+				if pathspecMatch(name, path) {
+					names = append(names, name)
+				}
+			}
+			slices.Sort(names)
+
+			for _, name := range names {
+				leaf := (*leaves)[name]
+				entry += fmt.Sprintf("%s %s %s\n", leaf.Mode, leaf.Sha, name)
+			}
+		}
+	} else if tree != "" {
+		if leaf, err := w.repo.TreePathLookup(tree, path); err == nil {
+			entry = string(leaf.Mode) + " " + leaf.Sha
+		}
+	}
+
+	w.entries[key] = entry
+	return entry
+}
+
+func (w *RevWalker) sameEntries(a string, b string) bool {
+	for _, path := range w.Opts.Paths {
+		if w.pathEntry(a, path) != w.pathEntry(b, path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *RevWalker) simplify(c *WalkCommit) error {
+	/*
+		marks c treesame when the paths did not change against its relevant parents, without
+		FullHistory a merge keeps only the first relevant parent it is treesame to
+	*/
+	tree := commitTree(c.Commit)
+	if len(c.Parents) == 0 {
+		w.treesame[c.Sha] = w.sameEntries(tree, "")
+		return nil
+	}
+
+	relevantParents := 0
+	relevantChange := false
+	irrelevantChange := false
+	for i, p := range c.Parents {
+		relevant := !w.uninteresting[p]
+		if relevant {
+			relevantParents++
+		}
+
+		if i == 1 && w.Opts.FirstParent {
+			break
+		}
+
+		parent, err := w.Commit(p)
+		if err != nil {
+			return err
+		}
+
+		if w.sameEntries(tree, commitTree(parent.Commit)) {
+			if w.Opts.FullHistory || !relevant {
+				continue
+			}
+
+			c.Parents = []string{p}
+			w.treesame[c.Sha] = true
+			return nil
+		}
+
+		if relevant {
+			relevantChange = true
+		} else {
+			irrelevantChange = true
+		}
+	}
+
+	if relevantParents > 0 {
+		w.treesame[c.Sha] = !relevantChange
+	} else {
+		w.treesame[c.Sha] = !irrelevantChange
+	}
+
+	return nil
+}
+
+func (w *RevWalker) pruneShow(c *WalkCommit) bool {
+	/*
+		treesame commits are hidden, but merges of two relevant lines are kept when the
+		parents get rewritten so the lines can be tied together
+	*/
+	if !w.treesame[c.Sha] {
+		return true
+	}
+
+	if !w.Opts.RewriteParents {
+		return false
+	}
+
+	relevant := 0
+	for _, p := range c.Parents {
+		if !w.uninteresting[p] {
+			relevant++
+		}
+	}
+
+	return relevant >= 2
+}
+
+func (w *RevWalker) oneRelevantParent(c *WalkCommit) string {
+	if w.Opts.FirstParent || len(c.Parents) == 1 {
+		return c.Parents[0]
+	}
+
+	ret := ""
+	for _, p := range c.Parents {
+		if w.uninteresting[p] {
+			continue
+		}
+		if ret != "" {
+			return ""
+		}
+		ret = p
+	}
+
+	return ret
+}
+
+func (w *RevWalker) rewriteOne(sha string) (string, bool) {
+	/*
+		follows sha down through hidden commits, false when the line ends in a hidden root
+	*/
+	for {
+		if w.uninteresting[sha] || !w.treesame[sha] {
+			return sha, true
+		}
+
+		c, ok := w.commits[sha]
+		if !ok {
+			return sha, true
+		}
+		if len(c.Parents) == 0 {
+			return "", false
+		}
+
+		next := w.oneRelevantParent(c)
+		if next == "" {
+			return sha, true
+		}
+		sha = next
+	}
+}
+
+func (w *RevWalker) rewriteParents(c *WalkCommit) {
+	parents := []string{}
+	for _, p := range c.Parents {
+		rewritten, ok := w.rewriteOne(p)
+		if !ok || slices.Contains(parents, rewritten) {
+			continue
+		}
+		parents = append(parents, rewritten)
+	}
+
+	c.Parents = parents
+}
+
+func (w *RevWalker) followShow(c *WalkCommit) (bool, error) {
+	/*
+		--follow does not prune, like git a commit is shown when its diff against the first
+		parent touches the path, merges are never shown, and a path that was added is traced
+		back to the deleted file it was renamed from
+	*/
+	if len(c.Parents) > 1 {
+		return false, nil
+	}
+
+	tree := commitTree(c.Commit)
+	parentTree := ""
+	if len(c.Parents) == 1 {
+		parent, err := w.Commit(c.Parents[0])
+		if err != nil {
+			return false, err
+		}
+		parentTree = commitTree(parent.Commit)
+	}
+
+	mine := w.pathEntry(tree, w.followPath)
+	theirs := w.pathEntry(parentTree, w.followPath)
+	if mine == theirs {
+		return false, nil
+	}
+
+	if theirs != "" || mine == "" || parentTree == "" {
+		return true, nil
+	}
+
+	before, err := w.repo.DiffTreeEntries(parentTree)
+	if err != nil {
+		return false, err
+	}
+	after, err := w.repo.DiffTreeEntries(tree)
+	if err != nil {
+		return false, err
+	}
+
+	candidates := []DiffFilePair{}
+	for _, pair := range DiffPairs(before, after, nil) {
+		if pair.Status == 'D' || pair.Status == 'A' && pair.New.Path == w.followPath {
+			candidates = append(candidates, pair)
+		}
+	}
+
+	pairs, err := w.repo.DiffRenames(candidates, false, DefaultRenameScore)
+	if err != nil {
+		return false, err
+	}
+
+	for _, pair := range pairs {
+		if pair.Status == 'R' {
+			w.followPath = pair.Old.Path
+		}
+	}
+
+	return true, nil
+}
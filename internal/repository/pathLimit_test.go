@@ -0,0 +1,64 @@
+package repository_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/repository"
+)
+
+func TestRevWalkPathspecMatchesGit(t *testing.T) {
+	dir := t.TempDir()
+	script := `set -e
+git init -q
+git config user.name T
+git config user.email t@t
+mkdir -p src/sub docs
+echo a > README; git add -A; git commit -qm readme
+echo a > main.go; git add -A; git commit -qm main
+echo a > src/sub/x.go; git add -A; git commit -qm nested
+echo a > docs/a.txt; git add -A; git commit -qm docs
+echo b > docs/b.md; echo b > src/y.go; git add -A; git commit -qm both
+echo c > src/sub/x.go; git add -A; git commit -qm edit`
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("setup err:%v\n%s", err, out)
+	}
+
+	repo, err := repository.FindRepo(dir, true)
+	if err != nil {
+		t.Fatalf("FindRepo err:%v\n", err)
+	}
+
+	for _, spec := range []string{"*.go", "src/*", "docs/*.txt", "src/sub/?.go", "docs/[ab].*", "*.rs", "src"} {
+		cmd := exec.Command("git", "rev-list", "HEAD", "--", spec)
+		cmd.Dir = dir
+		want, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: git rev-list err:%v\n", spec, err)
+		}
+
+		walker := repo.NewRevWalker(repository.RevWalkOptions{MaxCount: -1, Paths: []string{spec}})
+		if err := walker.AddRevision("HEAD"); err != nil {
+			t.Fatalf("%s: AddRevision err:%v\n", spec, err)
+		}
+		commits, err := walker.Walk()
+		if err != nil {
+			t.Fatalf("%s: Walk err:%v\n", spec, err)
+		}
+
+		var got strings.Builder
+		for _, c := range commits {
+			if !walker.Hidden(c.Sha) {
+				got.WriteString(c.Sha + "\n")
+			}
+		}
+
+		if got.String() != string(want) {
+			t.Fatalf("%s: got\n%swant\n%s", spec, got.String(), want)
+		}
+	}
+}
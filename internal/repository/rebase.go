@@ -0,0 +1,942 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var RebaseStopped = errors.New("RebaseStopped")
+
+var rebaseEdit = errors.New("rebaseEdit")
+
+type RebaseOptions struct {
+	Onto        string
+	Interactive bool
+}
+
+type rebaseItem struct {
+	action string
+	sha    string
+	arg    string
+}
+
+var rebaseActions = map[string]string{
+	"p": "pick", "r": "reword", "e": "edit", "s": "squash", "f": "fixup", "x": "exec", "d": "drop",
+}
+
+const rebaseTodoHelp = `
+# Rebase %s..%s onto %s (%d commands)
+#
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash" but keep only the previous
+#                    commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+const commitEditHelp = `
+# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+`
+
+func (repo *Repository) Editor() string {
+	/*
+		$GIT_EDITOR, core.editor, $VISUAL, $EDITOR and then vi like git_editor
+	*/
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor
+	}
+	if repo.Conf != nil {
+		if editor := repo.Conf.Section("core").Key("editor").String(); editor != "" {
+			return editor
+		}
+	}
+	if config, err := GitConfigRead(); err == nil {
+		if editor := config.Section("core").Key("editor").String(); editor != "" {
+			return editor
+		}
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+
+	return "vi"
+}
+
+func (repo *Repository) EditorLaunch(path string) error {
+	/*
+		the editor runs through the shell so it can carry arguments, ":" does nothing
+	*/
+	editor := repo.Editor()
+	if editor == ":" {
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Dir = repo.Worktree
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("there was a problem with the editor '%s'\n", editor)
+	}
+
+	return nil
+}
+
+func (repo *Repository) editMessage(message string) (string, error) {
+	/*
+		lets the user edit message in COMMIT_EDITMSG, the result is cleaned up
+	*/
+	path := repo.RepoPath("COMMIT_EDITMSG")
+	if err := os.WriteFile(path, []byte(strings.TrimRight(message, "\n")+"\n"+commitEditHelp), 0644); err != nil {
+		return "", err
+	}
+	if err := repo.EditorLaunch(path); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return MessageCleanup(string(data)), nil
+}
+
+func (repo *Repository) rebasePath(name string) string {
+	return repo.RepoPath("rebase-merge", name)
+}
+
+func (repo *Repository) RebaseActive() bool {
+	_, err := os.Stat(repo.rebasePath("head-name"))
+	return err == nil
+}
+
+func (repo *Repository) rebaseRead(name string) string {
+	data, err := os.ReadFile(repo.rebasePath(name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func (repo *Repository) rebaseWrite(name string, value string) error {
+	return os.WriteFile(repo.rebasePath(name), []byte(value+"\n"), 0644)
+}
+
+func (repo *Repository) rebaseTodoFormat(items []rebaseItem, abbrev bool) (string, error) {
+	/*
+		abbrev: the short hashes shown in the editor, the saved todo has full ones like git
+	*/
+	var b strings.Builder
+	for _, item := range items {
+		if item.action == "exec" {
+			fmt.Fprintf(&b, "exec %s\n", item.arg)
+			continue
+		}
+
+		commit, err := repo.CommitRead(item.sha)
+		if err != nil {
+			return "", err
+		}
+
+		sha := item.sha
+		if abbrev {
+			sha = repo.ObjectAbbrev(sha, 7)
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", item.action, sha, MessageSubject(objectMessage(commit)))
+	}
+
+	return b.String(), nil
+}
+
+func (repo *Repository) rebaseTodoParse(data string) ([]rebaseItem, error) {
+	ret := []rebaseItem{}
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		action := fields[0]
+		if long, ok := rebaseActions[action]; ok {
+			action = long
+		}
+
+		switch action {
+		case "exec":
+			arg := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+			if arg == "" {
+				return []rebaseItem{}, fmt.Errorf("missing command on line %d: %s\n", i+1, line)
+			}
+			ret = append(ret, rebaseItem{action: action, arg: arg})
+		case "pick", "reword", "edit", "squash", "fixup", "drop":
+			if len(fields) < 2 {
+				return []rebaseItem{}, fmt.Errorf("missing commit on line %d: %s\n", i+1, line)
+			}
+			sha, err := repo.ObjectFind(fields[1], "commit", true)
+			if err != nil {
+				return []rebaseItem{}, fmt.Errorf("invalid line %d: %s\n", i+1, line)
+			}
+			ret = append(ret, rebaseItem{action: action, sha: sha})
+		default:
+			return []rebaseItem{}, fmt.Errorf("invalid command '%s' on line %d: %s\n", fields[0], i+1, line)
+		}
+	}
+
+	return ret, nil
+}
+
+func (repo *Repository) rebaseTodoRead(name string) ([]rebaseItem, error) {
+	data, err := os.ReadFile(repo.rebasePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []rebaseItem{}, nil
+		}
+		return []rebaseItem{}, err
+	}
+
+	return repo.rebaseTodoParse(string(data))
+}
+
+func (repo *Repository) rebaseTodoWrite(name string, items []rebaseItem) error {
+	data, err := repo.rebaseTodoFormat(items, false)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(repo.rebasePath(name), []byte(data), 0644)
+}
+
+func (repo *Repository) Rebase(w io.Writer, upstream string, branch string, opts RebaseOptions) error {
+	/*
+		branch: default val is HEAD, it is switched to first when given, without a reflog entry
+		like git
+		opts.Onto: default val is upstream
+		replays the commits of upstream..branch on top of opts.Onto, with opts.Interactive
+		the todo list is edited first, the progress is kept in .git/rebase-merge so a stop
+		is picked up by --continue, --skip and --abort
+	*/
+	if repo.RebaseActive() {
+		return fmt.Errorf("a rebase is already in progress\nhint: try \"git rebase (--continue | --abort | --skip)\"\n")
+	}
+
+	if dirty, err := repo.WorktreeDirty(); err != nil {
+		return err
+	} else if dirty {
+		return fmt.Errorf("cannot rebase: You have unstaged changes.\nPlease commit or stash them.\n")
+	}
+
+	if active, err := repo.GetActiveBranch(); err != nil {
+		return err
+	} else if branch != "" && branch != active {
+		sha, err := repo.RefResolve("refs/heads/" + branch)
+		if err != nil {
+			return fmt.Errorf("no such branch: %s\n", branch)
+		}
+		if err := repo.WorktreeSwitch("HEAD", sha); err != nil {
+			return err
+		}
+		if err := repo.SymbolicRefCreate("HEAD", "refs/heads/"+branch); err != nil {
+			return err
+		}
+	}
+
+	upstreamSha, err := repo.ObjectFind(upstream, "commit", true)
+	if err != nil {
+		return fmt.Errorf("invalid upstream '%s'\n", upstream)
+	}
+
+	ontoName, onto := upstream, upstreamSha
+	if opts.Onto != "" {
+		if onto, err = repo.ObjectFind(opts.Onto, "commit", true); err != nil {
+			return fmt.Errorf("Does not point to a valid commit '%s'\n", opts.Onto)
+		}
+		ontoName = opts.Onto
+	}
+
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+
+	headName := "detached HEAD"
+	if active, err := repo.GetActiveBranch(); err != nil {
+		return err
+	} else if active != "" {
+		headName = "refs/heads/" + active
+	}
+
+	if !opts.Interactive {
+		upToDate, err := repo.rebaseUpToDate(onto, upstreamSha, head)
+		if err != nil {
+			return err
+		}
+		if upToDate {
+			if headName == "detached HEAD" {
+				fmt.Fprintf(w, "HEAD is up to date.\n")
+			} else {
+				fmt.Fprintf(w, "Current branch %s is up to date.\n", strings.TrimPrefix(headName, "refs/heads/"))
+			}
+			return nil
+		}
+	}
+
+	walker := repo.NewRevWalker(RevWalkOptions{MaxCount: -1, Reverse: true})
+	for _, rev := range []string{"^" + upstreamSha, head} {
+		if err := walker.AddRevision(rev); err != nil {
+			return err
+		}
+	}
+	commits, err := walker.Walk()
+	if err != nil {
+		return err
+	}
+
+	todo := []rebaseItem{}
+	for _, c := range commits {
+		if len(c.Parents) < 2 {
+			todo = append(todo, rebaseItem{action: "pick", sha: c.Sha})
+		}
+	}
+
+	if _, err := repo.RepoDir(true, "rebase-merge"); err != nil {
+		return err
+	}
+
+	if opts.Interactive {
+		if todo, err = repo.rebaseTodoEdit(todo, upstreamSha, head, onto); err != nil {
+			os.RemoveAll(repo.RepoPath("rebase-merge"))
+			return err
+		}
+	}
+
+	base, done := onto, []rebaseItem{}
+	for len(todo) > 0 && todo[0].action == "pick" {
+		commit, err := repo.CommitRead(todo[0].sha)
+		if err != nil {
+			return err
+		}
+		if parents := commitParents(commit); len(parents) != 1 || parents[0] != base {
+			break
+		}
+		base, done, todo = todo[0].sha, append(done, todo[0]), todo[1:]
+	}
+
+	for name, value := range map[string]string{
+		"head-name": headName,
+		"onto":      onto,
+		"orig-head": head,
+		"msgnum":    strconv.Itoa(len(done)),
+		"end":       strconv.Itoa(len(done) + len(todo)),
+	} {
+		if err := repo.rebaseWrite(name, value); err != nil {
+			return err
+		}
+	}
+	if opts.Interactive {
+		if err := os.WriteFile(repo.rebasePath("interactive"), []byte{}, 0644); err != nil {
+			return err
+		}
+	}
+	if err := repo.rebaseTodoWrite("done", done); err != nil {
+		return err
+	}
+	if err := repo.rebaseTodoWrite("git-rebase-todo", todo); err != nil {
+		return err
+	}
+
+	if err := repo.OrigHeadWrite(head); err != nil {
+		return err
+	}
+	if err := repo.WorktreeSwitch(head, base); err != nil {
+		return err
+	}
+	if err := repo.HeadDetach(base); err != nil {
+		return err
+	}
+	if err := repo.ReflogAppend("HEAD", head, base, "rebase (start): checkout "+ontoName); err != nil {
+		return err
+	}
+
+	return repo.rebaseRun(w)
+}
+
+func (repo *Repository) rebaseUpToDate(onto string, upstream string, head string) (bool, error) {
+	/*
+		git's can_fast_forward, HEAD already sits on onto and has nothing from upstream
+		that onto lacks
+	*/
+	for _, other := range []string{onto, upstream} {
+		bases, err := repo.MergeBases(other, head)
+		if err != nil {
+			return false, err
+		}
+		if len(bases) != 1 || bases[0] != onto {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (repo *Repository) rebaseTodoEdit(todo []rebaseItem, upstream string, head string, onto string) ([]rebaseItem, error) {
+	data, err := repo.rebaseTodoFormat(todo, true)
+	if err != nil {
+		return []rebaseItem{}, err
+	}
+	data += fmt.Sprintf(rebaseTodoHelp, repo.ObjectAbbrev(upstream, 7), repo.ObjectAbbrev(head, 7), repo.ObjectAbbrev(onto, 7), len(todo))
+
+	path := repo.rebasePath("git-rebase-todo")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		return []rebaseItem{}, err
+	}
+	if err := repo.EditorLaunch(path); err != nil {
+		return []rebaseItem{}, err
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return []rebaseItem{}, err
+	}
+
+	todo, err = repo.rebaseTodoParse(string(edited))
+	if err != nil {
+		return []rebaseItem{}, err
+	}
+	if len(todo) == 0 {
+		return []rebaseItem{}, fmt.Errorf("nothing to do\n")
+	}
+
+	for _, item := range todo {
+		if item.action == "exec" || item.action == "drop" {
+			continue
+		}
+		if item.action == "squash" || item.action == "fixup" {
+			return []rebaseItem{}, fmt.Errorf("cannot '%s' without a previous commit\n", item.action)
+		}
+		break
+	}
+
+	return todo, nil
+}
+
+func (repo *Repository) rebaseRun(w io.Writer) error {
+	/*
+		each item moves from the todo to done before it runs, a stop leaves the rest of
+		the todo for --continue
+	*/
+	for {
+		todo, err := repo.rebaseTodoRead("git-rebase-todo")
+		if err != nil {
+			return err
+		}
+		if len(todo) == 0 {
+			return repo.rebaseFinish(w)
+		}
+
+		done, err := repo.rebaseTodoRead("done")
+		if err != nil {
+			return err
+		}
+		if err := repo.rebaseTodoWrite("done", append(done, todo[0])); err != nil {
+			return err
+		}
+		if err := repo.rebaseTodoWrite("git-rebase-todo", todo[1:]); err != nil {
+			return err
+		}
+		if err := repo.rebaseWrite("msgnum", strconv.Itoa(len(done)+1)); err != nil {
+			return err
+		}
+
+		var next *rebaseItem
+		if len(todo) > 1 {
+			next = &todo[1]
+		}
+
+		err = repo.rebaseStep(w, todo[0], next)
+		if errors.Is(err, rebaseEdit) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (repo *Repository) rebaseStep(w io.Writer, item rebaseItem, next *rebaseItem) error {
+	switch item.action {
+	case "drop":
+		return nil
+	case "exec":
+		fmt.Fprintf(w, "Executing: %s\n", item.arg)
+
+		cmd := exec.Command("sh", "-c", item.arg)
+		cmd.Dir = repo.Worktree
+		cmd.Stdout, cmd.Stderr = w, w
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(w, "warning: execution failed: %s\nYou can fix the problem, and then run\n\n  git rebase --continue\n\n\n", item.arg)
+			return RebaseStopped
+		}
+		return nil
+	}
+
+	commit, err := repo.CommitRead(item.sha)
+	if err != nil {
+		return err
+	}
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+
+	parents := commitParents(commit)
+	if item.action != "squash" && item.action != "fixup" && len(parents) == 1 && parents[0] == head {
+		if err := repo.WorktreeSwitch(head, item.sha); err != nil {
+			return err
+		}
+		if err := repo.HeadUpdate(item.sha, "rebase: fast-forward"); err != nil {
+			return err
+		}
+	} else {
+		p, err := repo.pickApply(w, "cherry-pick", item.sha, SequencerOptions{Tree: DefaultMergeTreeOptions()})
+		if err != nil {
+			return err
+		}
+
+		if !p.result.Clean() {
+			return repo.rebaseConflict(w, item.sha, commit, p.result)
+		}
+
+		tree, err := repo.MergeTreeWrite(p.result)
+		if err != nil {
+			return err
+		}
+		if err := repo.rebaseCommit(w, item, next, tree, false); err != nil {
+			return err
+		}
+	}
+
+	current, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+	if item.action == "reword" && current != head {
+		picked, err := repo.CommitRead(current)
+		if err != nil {
+			return err
+		}
+		return repo.rebaseAmend(w, commitTree(picked), item.action)
+	}
+	if item.action != "edit" {
+		return nil
+	}
+	if err := repo.rebaseWrite("amend", current); err != nil {
+		return err
+	}
+	if err := repo.rebaseWrite("stopped-sha", item.sha); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Stopped at %s...  %s\n", repo.ObjectAbbrev(item.sha, 7), MessageSubject(objectMessage(commit)))
+	fmt.Fprintf(w, "You can amend the commit now, with\n\n  git commit --amend \n\nOnce you are satisfied with your changes, run\n\n  git rebase --continue\n")
+	return rebaseEdit
+}
+
+func (repo *Repository) rebaseConflict(w io.Writer, sha string, commit *GitCommit, result *MergeTreeResult) error {
+	if err := os.WriteFile(repo.RepoPath("REBASE_HEAD"), []byte(sha+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := repo.rebaseWrite("stopped-sha", sha); err != nil {
+		return err
+	}
+	if err := os.WriteFile(repo.RepoPath("MERGE_MSG"), []byte(mergeConflictsMessage(objectMessage(commit), result)), 0644); err != nil {
+		return err
+	}
+
+	abbrev, subject := repo.ObjectAbbrev(sha, 7), MessageSubject(objectMessage(commit))
+	fmt.Fprintf(w, "error: could not apply %s... %s\n", abbrev, subject)
+	fmt.Fprintf(w, "hint: Resolve all conflicts manually, mark them as resolved with\nhint: \"git add/rm <conflicted_files>\", then run \"git rebase --continue\".\n")
+	fmt.Fprintf(w, "hint: You can instead skip this commit: run \"git rebase --skip\".\nhint: To abort and get back to the state before \"git rebase\", run \"git rebase --abort\".\n")
+	fmt.Fprintf(w, "Could not apply %s... %s\n", abbrev, subject)
+	return PickConflict
+}
+
+func (repo *Repository) rebaseSquashMessage(item rebaseItem, head *GitCommit, commit *GitCommit) (string, error) {
+	/*
+		git's update_squash_messages, the message of a fixup is commented out so only the
+		ones kept by squash survive the cleanup
+	*/
+	count := 1
+	var b strings.Builder
+	if data, err := os.ReadFile(repo.rebasePath("message-squash")); err == nil {
+		first, rest, _ := strings.Cut(string(data), "\n")
+		fmt.Sscanf(first, "# This is a combination of %d commits.", &count)
+		fmt.Fprintf(&b, "# This is a combination of %d commits.\n%s", count+1, rest)
+	} else {
+		fmt.Fprintf(&b, "# This is a combination of 2 commits.\n# This is the 1st commit message:\n\n%s", objectMessage(head))
+	}
+
+	message := objectMessage(commit)
+	if item.action == "squash" {
+		fmt.Fprintf(&b, "\n# This is the commit message #%d:\n\n%s", count+1, message)
+	} else {
+		fmt.Fprintf(&b, "\n# The commit message #%d will be skipped:\n\n", count+1)
+		for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+			if line == "" {
+				b.WriteString("#\n")
+			} else {
+				fmt.Fprintf(&b, "# %s\n", line)
+			}
+		}
+	}
+
+	if err := os.WriteFile(repo.rebasePath("message-squash"), []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(repo.rebasePath("current-fixups"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s %s\n", item.action, item.sha); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func (repo *Repository) rebaseCommit(w io.Writer, item rebaseItem, next *rebaseItem, tree string, resumed bool) error {
+	/*
+		commits the tree picked for item with its author on top of HEAD, squash and fixup
+		meld it into HEAD instead, resumed is a stopped pick committed by --continue whose
+		message is edited like git commit would
+	*/
+	commit, err := repo.CommitRead(item.sha)
+	if err != nil {
+		return err
+	}
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+	headCommit, err := repo.CommitRead(head)
+	if err != nil {
+		return err
+	}
+
+	message, parents, author := objectMessage(commit), []string{head}, commitAuthor(commit)
+	edit, final := resumed, true
+	action := item.action
+	if resumed {
+		action = "continue"
+	}
+
+	switch item.action {
+	case "squash", "fixup":
+		if message, err = repo.rebaseSquashMessage(item, headCommit, commit); err != nil {
+			return err
+		}
+		parents, author = commitParents(headCommit), commitAuthor(headCommit)
+
+		edit, final = false, next == nil || (next.action != "squash" && next.action != "fixup")
+		if final {
+			edit = strings.Contains(repo.rebaseRead("current-fixups"), "squash")
+			for _, name := range []string{"message-squash", "current-fixups"} {
+				if err := os.Remove(repo.rebasePath(name)); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		emptied := tree == commitTree(headCommit)
+		if originals := commitParents(commit); emptied && len(originals) > 0 {
+			parent, err := repo.CommitRead(originals[0])
+			if err != nil {
+				return err
+			}
+			emptied = commitTree(parent) != commitTree(commit)
+		}
+		if emptied {
+			return nil
+		}
+
+		if resumed {
+			data, err := os.ReadFile(repo.RepoPath("MERGE_MSG"))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				message = string(data)
+			}
+		}
+	}
+
+	if edit {
+		if message, err = repo.editMessage(message); err != nil {
+			return err
+		}
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	message = MessageCleanup(message)
+	if message == "" {
+		return fmt.Errorf("Aborting commit due to empty commit message.\n")
+	}
+
+	user, err := repo.UserIdent()
+	if err != nil {
+		return err
+	}
+	committer := fmt.Sprintf("%s %s", user, FormatSignatureTime(time.Now()))
+
+	created, err := repo.CommitCreateAuthored(tree, parents, author, committer, message)
+	if err != nil {
+		return err
+	}
+	if final {
+		subject = MessageSubject(message)
+	}
+	if err := repo.HeadUpdate(created, fmt.Sprintf("rebase (%s): %s", action, subject)); err != nil {
+		return err
+	}
+
+	if !edit {
+		return nil
+	}
+	return repo.commitSummaryWrite(w, created, !resumed || item.action == "squash" || item.action == "fixup")
+}
+
+func (repo *Repository) rebaseAmend(w io.Writer, tree string, action string) error {
+	/*
+		replaces HEAD with tree and its message edited, like git commit --amend
+	*/
+	sha, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+	head, err := repo.CommitRead(sha)
+	if err != nil {
+		return err
+	}
+
+	message, err := repo.editMessage(objectMessage(head))
+	if err != nil {
+		return err
+	}
+	if message == "" {
+		return fmt.Errorf("Aborting commit due to empty commit message.\n")
+	}
+
+	user, err := repo.UserIdent()
+	if err != nil {
+		return err
+	}
+	committer := fmt.Sprintf("%s %s", user, FormatSignatureTime(time.Now()))
+
+	created, err := repo.CommitCreateAuthored(tree, commitParents(head), commitAuthor(head), committer, message)
+	if err != nil {
+		return err
+	}
+	if err := repo.HeadUpdate(created, fmt.Sprintf("rebase (%s): %s", action, MessageSubject(message))); err != nil {
+		return err
+	}
+
+	return repo.CommitSummaryWrite(w, created)
+}
+
+func (repo *Repository) rebaseStopClear() error {
+	for _, path := range []string{repo.RepoPath("REBASE_HEAD"), repo.RepoPath("MERGE_MSG"), repo.rebasePath("stopped-sha"), repo.rebasePath("amend")} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *Repository) RebaseContinue(w io.Writer) error {
+	/*
+		commits the resolved pick that stopped, or amends HEAD with what was staged after
+		an edit, then goes on with the todo
+	*/
+	if !repo.RebaseActive() {
+		return fmt.Errorf("No rebase in progress?\n")
+	}
+
+	if unmerged, err := repo.indexUnmerged(); err != nil {
+		return err
+	} else if len(unmerged) > 0 {
+		return fmt.Errorf("you must edit all merge conflicts and then\nmark them as resolved using git add\n")
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+	tree, err := repo.TreeFromIndex(index)
+	if err != nil {
+		return err
+	}
+
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+	headCommit, err := repo.CommitRead(head)
+	if err != nil {
+		return err
+	}
+
+	amend, stopped := repo.rebaseRead("amend"), repo.rebaseRead("stopped-sha")
+	switch {
+	case tree == commitTree(headCommit) && (amend != "" || stopped == ""):
+	case amend == head:
+		if err := repo.rebaseAmend(w, tree, "continue"); err != nil {
+			return err
+		}
+	case stopped != "" && amend == "":
+		done, err := repo.rebaseTodoRead("done")
+		if err != nil {
+			return err
+		}
+		todo, err := repo.rebaseTodoRead("git-rebase-todo")
+		if err != nil {
+			return err
+		}
+
+		var next *rebaseItem
+		if len(todo) > 0 {
+			next = &todo[0]
+		}
+		if err := repo.rebaseCommit(w, done[len(done)-1], next, tree, true); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("you have staged changes in your working tree\nIf these changes are meant to be squashed into the previous commit, run:\n\n  git commit --amend\n\nThen run\n\n  git rebase --continue\n")
+	}
+
+	if err := repo.rebaseStopClear(); err != nil {
+		return err
+	}
+
+	return repo.rebaseRun(w)
+}
+
+func (repo *Repository) RebaseSkip(w io.Writer) error {
+	/*
+		drops the pick that stopped, resetting what it left in the index and the worktree
+	*/
+	if !repo.RebaseActive() {
+		return fmt.Errorf("No rebase in progress?\n")
+	}
+
+	if err := repo.WorktreeReset("HEAD"); err != nil {
+		return err
+	}
+	if err := repo.rebaseStopClear(); err != nil {
+		return err
+	}
+
+	return repo.rebaseRun(w)
+}
+
+func (repo *Repository) RebaseAbort() error {
+	/*
+		goes back to the branch and the commit the rebase started from
+	*/
+	if !repo.RebaseActive() {
+		return fmt.Errorf("No rebase in progress?\n")
+	}
+
+	headName, orig := repo.rebaseRead("head-name"), repo.rebaseRead("orig-head")
+
+	if err := repo.WorktreeReset("HEAD"); err != nil {
+		return err
+	}
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+	if err := repo.WorktreeSwitch(head, orig); err != nil {
+		return err
+	}
+
+	returning := orig
+	if strings.HasPrefix(headName, "refs/") {
+		err = repo.SymbolicRefCreate("HEAD", headName)
+		returning = headName
+	} else {
+		err = repo.HeadDetach(orig)
+	}
+	if err != nil {
+		return err
+	}
+	if err := repo.ReflogAppend("HEAD", head, orig, "rebase (abort): returning to "+returning); err != nil {
+		return err
+	}
+
+	if err := repo.rebaseStopClear(); err != nil {
+		return err
+	}
+	return os.RemoveAll(repo.RepoPath("rebase-merge"))
+}
+
+func (repo *Repository) rebaseFinish(w io.Writer) error {
+	/*
+		points the rebased branch at HEAD and checks it out again
+	*/
+	headName, onto, orig := repo.rebaseRead("head-name"), repo.rebaseRead("onto"), repo.rebaseRead("orig-head")
+
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(headName, "refs/") && head != orig {
+		if err := repo.RefCreate(strings.TrimPrefix(headName, "refs/"), head); err != nil {
+			return err
+		}
+		if err := repo.ReflogAppend(headName, orig, head, fmt.Sprintf("rebase (finish): %s onto %s", headName, onto)); err != nil {
+			return err
+		}
+	}
+	if strings.HasPrefix(headName, "refs/") {
+		if err := repo.SymbolicRefCreate("HEAD", headName); err != nil {
+			return err
+		}
+		if err := repo.ReflogAppend("HEAD", head, head, "rebase (finish): returning to "+headName); err != nil {
+			return err
+		}
+	}
+
+	if err := repo.rebaseStopClear(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(repo.RepoPath("rebase-merge")); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Successfully rebased and updated %s.\n", headName)
+	return nil
+}
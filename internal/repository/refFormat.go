@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var RefFormatInvalid = errors.New("RefFormatInvalid")
+
+type RefFormatOptions struct {
+	AllowOneLevel  bool
+	RefspecPattern bool
+	Normalize      bool
+}
+
+func refFormatError(name string, reason string) error {
+	return fmt.Errorf("'%s' is not a valid ref name: %s: %w", name, reason, RefFormatInvalid)
+}
+
+func NormalizeRefName(name string) string {
+	for strings.Contains(name, "//") {
+		name = strings.ReplaceAll(name, "//", "/")
+	}
+
+	return strings.TrimPrefix(name, "/")
+}
+
+func CheckRefFormat(name string, opts RefFormatOptions) (string, error) {
+	/*
+		implements the rules of git check-ref-format, returns the (normalized) name
+	*/
+	if opts.Normalize {
+		name = NormalizeRefName(name)
+	}
+
+	if name == "" {
+		return name, refFormatError(name, "empty name")
+	}
+	if name == "@" {
+		return name, refFormatError(name, "the name '@' is reserved")
+	}
+	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return name, refFormatError(name, "begins or ends with a slash")
+	}
+	if strings.HasSuffix(name, ".") {
+		return name, refFormatError(name, "ends with a dot")
+	}
+	if strings.Contains(name, "..") {
+		return name, refFormatError(name, "contains '..'")
+	}
+	if strings.Contains(name, "@{") {
+		return name, refFormatError(name, "contains '@{'")
+	}
+
+	stars := 0
+	for _, c := range name {
+		switch {
+		case c < 0x20 || c == 0x7f:
+			return name, refFormatError(name, "contains a control character")
+		case c == ' ' || c == '~' || c == '^' || c == ':' || c == '?' || c == '[' || c == '\\':
+			return name, refFormatError(name, fmt.Sprintf("contains '%c'", c))
+		case c == '*':
+			stars++
+		}
+	}
+
+	if stars > 0 && !(opts.RefspecPattern && stars == 1) {
+		return name, refFormatError(name, "contains '*'")
+	}
+
+	components := strings.Split(name, "/")
+	if len(components) < 2 && !opts.AllowOneLevel {
+		return name, refFormatError(name, "has only one level")
+	}
+
+	for _, component := range components {
+		if component == "" {
+			return name, refFormatError(name, "contains an empty component")
+		}
+		if strings.HasPrefix(component, ".") {
+			return name, refFormatError(name, "a component begins with a dot")
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return name, refFormatError(name, "a component ends with '.lock'")
+		}
+	}
+
+	return name, nil
+}
+
+func (repo *Repository) CheckBranchName(name string) (string, error) {
+	/*
+		expands @{-N} and checks that refs/heads/<name> is a valid ref
+	*/
+	if strings.HasPrefix(name, "@{-") && strings.HasSuffix(name, "}") {
+		n, err := strconv.Atoi(name[3 : len(name)-1])
+		if err != nil || n <= 0 {
+			return name, refFormatError(name, "invalid previous branch selector")
+		}
+
+		return repo.previousBranch(n)
+	}
+
+	if strings.HasPrefix(name, "-") {
+		return name, refFormatError(name, "a branch name can not begin with '-'")
+	}
+	if name == "HEAD" {
+		return name, refFormatError(name, "'HEAD' is not a valid branch name")
+	}
+
+	if _, err := CheckRefFormat("refs/heads/"+name, RefFormatOptions{}); err != nil {
+		return name, err
+	}
+
+	return name, nil
+}
@@ -0,0 +1,43 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/repository"
+)
+
+func TestCheckRefFormat(t *testing.T) {
+	cases := []struct {
+		name  string
+		opts  repository.RefFormatOptions
+		valid bool
+	}{
+		{"refs/heads/master", repository.RefFormatOptions{}, true},
+		{"refs/heads/feature/x-1", repository.RefFormatOptions{}, true},
+		{"master", repository.RefFormatOptions{}, false},
+		{"master", repository.RefFormatOptions{AllowOneLevel: true}, true},
+		{"../../config", repository.RefFormatOptions{}, false},
+		{"refs/heads/foo.lock", repository.RefFormatOptions{}, false},
+		{"refs/heads/.hidden", repository.RefFormatOptions{}, false},
+		{"refs/heads/a..b", repository.RefFormatOptions{}, false},
+		{"refs/heads/a@{b", repository.RefFormatOptions{}, false},
+		{"refs/heads/a.", repository.RefFormatOptions{}, false},
+		{"refs/heads/a b", repository.RefFormatOptions{}, false},
+		{"refs/heads/a~1", repository.RefFormatOptions{}, false},
+		{"refs/heads/a:b", repository.RefFormatOptions{}, false},
+		{"refs/heads/a\\b", repository.RefFormatOptions{}, false},
+		{"refs//heads/x", repository.RefFormatOptions{}, false},
+		{"refs//heads/x", repository.RefFormatOptions{Normalize: true}, true},
+		{"refs/heads/*", repository.RefFormatOptions{}, false},
+		{"refs/heads/*", repository.RefFormatOptions{RefspecPattern: true}, true},
+		{"refs/*/*", repository.RefFormatOptions{RefspecPattern: true}, false},
+		{"@", repository.RefFormatOptions{AllowOneLevel: true}, false},
+	}
+
+	for _, c := range cases {
+		_, err := repository.CheckRefFormat(c.name, c.opts)
+		if (err == nil) != c.valid {
+			t.Fatalf("CheckRefFormat(%q, %+v) valid=%v want %v err:%v\n", c.name, c.opts, err == nil, c.valid, err)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var RefNotFound = errors.New("RefNotFound")
+
+type RefValue struct {
+	Sha    string
+	Target string
+	Peeled string
+}
+
+type RefStore interface {
+	Read(name string) (RefValue, error)
+	Write(name string, value RefValue) error
+	WriteWithLog(name string, value RefValue, logs map[string]ReflogEntry) error
+	Delete(name string) error
+	List() (map[string]RefValue, error)
+	ReflogRead(name string) ([]ReflogEntry, error)
+	ReflogAppend(name string, entry ReflogEntry) error
+	ReflogDelete(name string, index int) error
+	Pack() error
+}
+
+func newRefStore(repo *Repository) RefStore {
+	if repo.Conf != nil && strings.ToLower(repo.Conf.Section("extensions").Key("refStorage").String()) == "reftable" {
+		return &reftableRefStore{repo: repo, dir: repo.RepoPath("reftable")}
+	}
+
+	return &filesRefStore{repo: repo}
+}
+
+func (repo *Repository) refStore(name string) RefStore {
+	/*
+		pseudo refs other than HEAD always live in files, whatever the ref storage is
+	*/
+	if name != "HEAD" && isPseudoRef(name) {
+		return &filesRefStore{repo: repo}
+	}
+	if repo.Refs == nil {
+		repo.Refs = newRefStore(repo)
+	}
+
+	return repo.Refs
+}
+
+func refFileWriteLocked(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("unable to create '%s.lock': file exists\n", path)
+		}
+		return err
+	}
+
+	if _, err := lock.Write(data); err != nil {
+		lock.Close()
+		os.Remove(path + ".lock")
+		return err
+	}
+	if err := lock.Close(); err != nil {
+		os.Remove(path + ".lock")
+		return err
+	}
+
+	return os.Rename(path+".lock", path)
+}
+
+type filesRefStore struct {
+	repo *Repository
+}
+
+func (s *filesRefStore) packedRead() (*map[string]string, *map[string]string, error) {
+	/*
+		returns the packed refs and the peeled value of the annotated tags in them
+	*/
+	refs := &map[string]string{}
+	peeled := &map[string]string{}
+
+	data, err := os.ReadFile(s.repo.RepoPath("packed-refs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return refs, peeled, nil
+		}
+		return refs, peeled, err
+	}
+
+	last := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "^") {
+			if last != "" {
+				(*peeled)[last] = line[1:]
+			}
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return refs, peeled, fmt.Errorf("malformed packed-refs line:%s\n", line)
+		}
+
+		(*refs)[fields[1]] = fields[0]
+		last = fields[1]
+	}
+
+	return refs, peeled, nil
+}
+
+func (s *filesRefStore) packedWrite(refs map[string]string, peeled map[string]string) error {
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteString("# pack-refs with: peeled fully-peeled sorted \n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s %s\n", refs[name], name)
+		if p, ok := peeled[name]; ok {
+			fmt.Fprintf(&b, "^%s\n", p)
+		}
+	}
+
+	return refFileWriteLocked(s.repo.RepoPath("packed-refs"), []byte(b.String()))
+}
+
+func (s *filesRefStore) Read(name string) (RefValue, error) {
+	path := s.repo.RepoPath(name)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if info, statErr := os.Stat(path); statErr == nil && !info.IsDir() {
+			return RefValue{}, err
+		}
+
+		refs, peeled, err := s.packedRead()
+		if err != nil {
+			return RefValue{}, err
+		}
+		if sha, ok := (*refs)[name]; ok {
+			return RefValue{Sha: sha, Peeled: (*peeled)[name]}, nil
+		}
+
+		return RefValue{}, fmt.Errorf("ref %s not found: %w", name, RefNotFound)
+	}
+
+	content := strings.TrimSpace(string(data))
+	if strings.HasPrefix(content, "ref: ") {
+		return RefValue{Target: strings.TrimSpace(strings.TrimPrefix(content, "ref: "))}, nil
+	}
+
+	return RefValue{Sha: content}, nil
+}
+
+func (s *filesRefStore) Write(name string, value RefValue) error {
+	content := value.Sha + "\n"
+	if value.Target != "" {
+		content = "ref: " + value.Target + "\n"
+	}
+
+	return refFileWriteLocked(s.repo.RepoPath(name), []byte(content))
+}
+
+func (s *filesRefStore) WriteWithLog(name string, value RefValue, logs map[string]ReflogEntry) error {
+	/*
+		logs: the entry to append to each named reflog once the ref is written
+	*/
+	if err := s.Write(name, value); err != nil {
+		return err
+	}
+
+	for logName, entry := range logs {
+		if err := s.ReflogAppend(logName, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *filesRefStore) Delete(name string) error {
+	found := false
+
+	err := os.Remove(s.repo.RepoPath(name))
+	if err == nil {
+		found = true
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	refs, peeled, err := s.packedRead()
+	if err != nil {
+		return err
+	}
+	if _, ok := (*refs)[name]; ok {
+		found = true
+		delete(*refs, name)
+		delete(*peeled, name)
+		if err := s.packedWrite(*refs, *peeled); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("ref %s not found: %w", name, RefNotFound)
+	}
+
+	if err := os.Remove(s.repo.RepoPath("logs", name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *filesRefStore) List() (map[string]RefValue, error) {
+	/*
+		lists everything under refs/, loose refs win over packed ones
+	*/
+	ret := map[string]RefValue{}
+
+	refs, peeled, err := s.packedRead()
+	if err != nil {
+		return ret, err
+	}
+	for name, sha := range *refs {
+		ret[name] = RefValue{Sha: sha, Peeled: (*peeled)[name]}
+	}
+
+	err = filepath.WalkDir(s.repo.RepoPath("refs"), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.repo.Gitdir, path)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		value, err := s.Read(name)
+		if err != nil {
+			return nil
+		}
+
+		ret[name] = value
+		return nil
+	})
+
+	return ret, err
+}
+
+func (s *filesRefStore) ReflogRead(name string) ([]ReflogEntry, error) {
+	data, err := os.ReadFile(s.repo.RepoPath("logs", name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ReflogEntry{}, nil
+		}
+		return []ReflogEntry{}, err
+	}
+
+	ret := []ReflogEntry{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		head, message, _ := strings.Cut(line, "\t")
+		if len(head) < 82 {
+			return []ReflogEntry{}, fmt.Errorf("malformed reflog line for ref:%s line:%s\n", name, line)
+		}
+
+		sig, err := ParseSignature([]byte(head[82:]))
+		if err != nil {
+			return []ReflogEntry{}, err
+		}
+
+		ret = append(ret, ReflogEntry{
+			Old:       head[:40],
+			New:       head[41:81],
+			Committer: sig,
+			Message:   message,
+		})
+	}
+
+	return ret, nil
+}
+
+func (s *filesRefStore) ReflogAppend(name string, entry ReflogEntry) error {
+	path, err := s.repo.RepoFile(true, "logs", name)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s %s %s\t%s\n", entry.Old, entry.New, entry.Committer.String(), entry.Message)
+	return err
+}
+
+func (s *filesRefStore) ReflogDelete(name string, index int) error {
+	/*
+		index counts from the oldest entry, the entry after it takes over its old sha
+	*/
+	entries, err := s.ReflogRead(name)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(entries) {
+		return fmt.Errorf("reflog entry %d not found for ref:%s\n", index, name)
+	}
+
+	if index+1 < len(entries) {
+		entries[index+1].Old = entries[index].Old
+	}
+	entries = slices.Delete(entries, index, index+1)
+
+	var b strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "%s %s %s\t%s\n", entry.Old, entry.New, entry.Committer.String(), entry.Message)
+	}
+
+	return refFileWriteLocked(s.repo.RepoPath("logs", name), []byte(b.String()))
+}
+
+func (s *filesRefStore) Pack() error {
+	/*
+		moves every loose ref under refs/ into packed-refs, like git pack-refs --all
+	*/
+	refs, peeled, err := s.packedRead()
+	if err != nil {
+		return err
+	}
+
+	all, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	loose := []string{}
+	for name, value := range all {
+		if value.Target != "" {
+			continue
+		}
+
+		(*refs)[name] = value.Sha
+		delete(*peeled, name)
+		if p, err := s.repo.ObjectPeel(value.Sha); err == nil && p != value.Sha {
+			(*peeled)[name] = p
+		}
+
+		if _, err := os.Stat(s.repo.RepoPath(name)); err == nil {
+			loose = append(loose, name)
+		}
+	}
+
+	if err := s.packedWrite(*refs, *peeled); err != nil {
+		return err
+	}
+
+	for _, name := range loose {
+		if err := os.Remove(s.repo.RepoPath(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
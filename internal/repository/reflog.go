@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"strings"
+	"time"
+)
+
+type ReflogEntry struct {
+	Old       string
+	New       string
+	Committer Signature
+	Message   string
+}
+
+const nullSha = "0000000000000000000000000000000000000000"
+
+func reflogIdentity() string {
+	if config, err := GitConfigRead(); err == nil {
+		if user := GitConfigUserGet(config); user != "" {
+			return user
+		}
+	}
+
+	return "wyag <wyag@example.com>"
+}
+
+func (repo *Repository) ReflogRead(ref string) ([]ReflogEntry, error) {
+	/*
+		returns the entries oldest first, as they are stored
+	*/
+	return repo.refStore(ref).ReflogRead(ref)
+}
+
+func reflogEntry(old string, new string, message string) (ReflogEntry, error) {
+	if old == "" {
+		old = nullSha
+	}
+	if new == "" {
+		new = nullSha
+	}
+
+	committer, err := ParseSignature([]byte(reflogIdentity() + " " + FormatSignatureTime(time.Now())))
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+
+	return ReflogEntry{
+		Old:       old,
+		New:       new,
+		Committer: committer,
+		Message:   strings.ReplaceAll(message, "\n", " "),
+	}, nil
+}
+
+func (repo *Repository) ReflogAppend(ref string, old string, new string, message string) error {
+	entry, err := reflogEntry(old, new, message)
+	if err != nil {
+		return err
+	}
+
+	return repo.refStore(ref).ReflogAppend(ref, entry)
+}
+
+func (repo *Repository) ReflogDelete(ref string, index int) error {
+	/*
+		index counts from the oldest entry like ReflogRead
+	*/
+	return repo.refStore(ref).ReflogDelete(ref, index)
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var RefNotSymbolic = errors.New("RefNotSymbolic")
+
+func (repo *Repository) SymbolicRefRead(name string) (string, error) {
+	value, err := repo.refStore(name).Read(name)
+	if err != nil {
+		return "", err
+	}
+
+	if value.Target == "" {
+		return "", fmt.Errorf("ref %s is not a symbolic ref: %w", name, RefNotSymbolic)
+	}
+
+	return value.Target, nil
+}
+
+func (repo *Repository) SymbolicRefCreate(name string, target string) error {
+	if name == "HEAD" && !strings.HasPrefix(target, "refs/") {
+		return fmt.Errorf("refusing to point HEAD outside of refs/: %s\n", target)
+	}
+
+	if !isPseudoRef(name) {
+		if _, err := CheckRefFormat(name, RefFormatOptions{}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := CheckRefFormat(target, RefFormatOptions{}); err != nil {
+		return err
+	}
+
+	return repo.refStore(name).Write(name, RefValue{Target: target})
+}
+
+func (repo *Repository) SymbolicRefDelete(name string) error {
+	if name == "HEAD" {
+		return fmt.Errorf("deleting the symbolic ref HEAD is not allowed\n")
+	}
+
+	if !isPseudoRef(name) {
+		if _, err := CheckRefFormat(name, RefFormatOptions{}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := repo.SymbolicRefRead(name); err != nil {
+		return err
+	}
+
+	return repo.refStore(name).Delete(name)
+}
+
+func (repo *Repository) HeadDetach(sha string) error {
+	return repo.refStore("HEAD").Write("HEAD", RefValue{Sha: sha})
+}
+
+func (repo *Repository) HeadUpdate(sha string, message string) error {
+	/*
+		moves the branch HEAD points to, or HEAD itself when detached, the ref and the
+		reflogs of the branch and HEAD are written as one update
+	*/
+	old, _ := repo.RefResolve("HEAD")
+
+	entry, err := reflogEntry(old, sha, message)
+	if err != nil {
+		return err
+	}
+
+	target, err := repo.SymbolicRefRead("HEAD")
+	if err != nil {
+		if !errors.Is(err, RefNotSymbolic) {
+			return err
+		}
+
+		return repo.refStore("HEAD").WriteWithLog("HEAD", RefValue{Sha: sha}, map[string]ReflogEntry{"HEAD": entry})
+	}
+
+	if _, err := CheckRefFormat(target, RefFormatOptions{}); err != nil {
+		return err
+	}
+
+	return repo.refStore(target).WriteWithLog(target, RefValue{Sha: sha}, map[string]ReflogEntry{target: entry, "HEAD": entry})
+}
+
+func (repo *Repository) HeadIsDetached() (bool, error) {
+	_, err := repo.SymbolicRefRead("HEAD")
+	if err == nil {
+		return false, nil
+	}
+	if errors.Is(err, RefNotSymbolic) {
+		return true, nil
+	}
+
+	return false, err
+}
+
+type Ref struct {
+	Name string
+	Sha  string
+}
+
+func (repo *Repository) RefListFlat(prefix string) ([]Ref, error) {
+	/*
+		prefix: default val is "refs/"
+		lists the refs of the ref store by their full name, sorted by name
+	*/
+	if prefix == "" {
+		prefix = "refs/"
+	}
+
+	all, err := repo.Refs.List()
+	if err != nil {
+		return []Ref{}, err
+	}
+
+	ret := []Ref{}
+	for name, value := range all {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		sha := value.Sha
+		if value.Target != "" {
+			if sha, err = repo.RefResolve(value.Target); err != nil {
+				continue
+			}
+		}
+
+		ret = append(ret, Ref{Name: name, Sha: sha})
+	}
+
+	slices.SortFunc(ret, func(a, b Ref) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return ret, nil
+}
+
+func RefShortName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+
+	return name
+}
+
+func (repo *Repository) BranchUpstream(branch string) string {
+	/*
+		returns the full name of the ref branch.<branch>.merge tracks or "" when unset
+	*/
+	if repo.Conf == nil {
+		return ""
+	}
+
+	section, err := repo.Conf.GetSection(fmt.Sprintf("branch \"%s\"", branch))
+	if err != nil {
+		return ""
+	}
+
+	remote := section.Key("remote").String()
+	merge := section.Key("merge").String()
+	if remote == "" || merge == "" {
+		return ""
+	}
+
+	if remote == "." {
+		return merge
+	}
+
+	return "refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, "refs/heads/")
+}
@@ -0,0 +1,1241 @@
+package repository
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	reftableMagic           = "REFT"
+	reftableVersion         = 1
+	reftableHeaderSize      = 24
+	reftableFooterSize      = 68
+	reftableBlockSize       = 4096
+	reftableRestartInterval = 16
+
+	reftableRefDeletion = 0
+	reftableRefVal1     = 1
+	reftableRefVal2     = 2
+	reftableRefSymref   = 3
+
+	reftableLogDeletion = 0
+	reftableLogUpdate   = 1
+)
+
+type reftableRefRecord struct {
+	Name        string
+	UpdateIndex uint64
+	Deleted     bool
+	Value       RefValue
+}
+
+type reftableLogRecord struct {
+	Name        string
+	UpdateIndex uint64
+	Deleted     bool
+	Entry       ReflogEntry
+}
+
+func (rec reftableLogRecord) key() string {
+	return reftableLogKey(rec.Name, rec.UpdateIndex)
+}
+
+func reftableLogKey(name string, updateIndex uint64) string {
+	/*
+		logs of a ref are sorted newest first, so the update index is stored reversed
+	*/
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], ^updateIndex)
+	return name + "\x00" + string(idx[:])
+}
+
+func reftablePutVarint(buf []byte, val uint64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(val & 0x7f)
+	for val >>= 7; val != 0; val >>= 7 {
+		val--
+		i--
+		tmp[i] = 0x80 | byte(val&0x7f)
+	}
+
+	return append(buf, tmp[i:]...)
+}
+
+func reftableGetVarint(data []byte, pos int) (uint64, int, error) {
+	if pos >= len(data) {
+		return 0, pos, fmt.Errorf("reftable: truncated varint\n")
+	}
+
+	c := data[pos]
+	pos++
+	val := uint64(c & 0x7f)
+	for c&0x80 != 0 {
+		if pos >= len(data) {
+			return 0, pos, fmt.Errorf("reftable: truncated varint\n")
+		}
+		c = data[pos]
+		pos++
+		val = ((val + 1) << 7) | uint64(c&0x7f)
+	}
+
+	return val, pos, nil
+}
+
+func reftableGetBytes(data []byte, pos int) ([]byte, int, error) {
+	n, pos, err := reftableGetVarint(data, pos)
+	if err != nil {
+		return nil, pos, err
+	}
+	if pos+int(n) > len(data) {
+		return nil, pos, fmt.Errorf("reftable: truncated record\n")
+	}
+
+	return data[pos : pos+int(n)], pos + int(n), nil
+}
+
+func putUint24(buf []byte, val int) {
+	buf[0] = byte(val >> 16)
+	buf[1] = byte(val >> 8)
+	buf[2] = byte(val)
+}
+
+func getUint24(buf []byte) int {
+	return int(buf[0])<<16 | int(buf[1])<<8 | int(buf[2])
+}
+
+func reftableShaBytes(sha string) ([]byte, error) {
+	if sha == "" {
+		sha = nullSha
+	}
+
+	raw, err := hex.DecodeString(sha)
+	if err != nil || len(raw) != 20 {
+		return nil, fmt.Errorf("reftable: invalid object id:%s\n", sha)
+	}
+
+	return raw, nil
+}
+
+type reftableBlockWriter struct {
+	typ       byte
+	headerLen int
+	limit     int
+	buf       []byte
+	restarts  []int
+	lastKey   string
+	entries   int
+}
+
+func newReftableBlockWriter(typ byte, headerLen int, limit int) *reftableBlockWriter {
+	/*
+		headerLen: the file header shares the first block, so it is 24 for the first ref block
+		limit: 0 means the block can grow without bound
+	*/
+	w := &reftableBlockWriter{typ: typ, headerLen: headerLen, limit: limit}
+	w.buf = make([]byte, headerLen+4)
+	w.buf[headerLen] = typ
+
+	return w
+}
+
+func (w *reftableBlockWriter) add(key string, valueType byte, payload []byte) bool {
+	/*
+		returns false when the record does not fit, the first record of a block always fits
+	*/
+	restart := w.entries%reftableRestartInterval == 0
+
+	prefix := 0
+	if !restart {
+		for prefix < len(key) && prefix < len(w.lastKey) && key[prefix] == w.lastKey[prefix] {
+			prefix++
+		}
+	}
+
+	rec := reftablePutVarint(nil, uint64(prefix))
+	rec = reftablePutVarint(rec, uint64(len(key)-prefix)<<3|uint64(valueType))
+	rec = append(rec, key[prefix:]...)
+	rec = append(rec, payload...)
+
+	restarts := len(w.restarts)
+	if restart {
+		restarts++
+	}
+	if w.limit > 0 && w.entries > 0 && len(w.buf)+len(rec)+3*restarts+2 > w.limit {
+		return false
+	}
+
+	if restart {
+		w.restarts = append(w.restarts, len(w.buf))
+	}
+	w.buf = append(w.buf, rec...)
+	w.lastKey = key
+	w.entries++
+
+	return true
+}
+
+func (w *reftableBlockWriter) finish() []byte {
+	for _, r := range w.restarts {
+		var b [3]byte
+		putUint24(b[:], r)
+		w.buf = append(w.buf, b[:]...)
+	}
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(len(w.restarts)))
+
+	putUint24(w.buf[w.headerLen+1:], len(w.buf))
+	return w.buf
+}
+
+func reftableRefPayload(rec reftableRefRecord, minUpdateIndex uint64) (byte, []byte, error) {
+	payload := reftablePutVarint(nil, rec.UpdateIndex-minUpdateIndex)
+
+	switch {
+	case rec.Deleted:
+		return reftableRefDeletion, payload, nil
+	case rec.Value.Target != "":
+		payload = reftablePutVarint(payload, uint64(len(rec.Value.Target)))
+		return reftableRefSymref, append(payload, rec.Value.Target...), nil
+	}
+
+	sha, err := reftableShaBytes(rec.Value.Sha)
+	if err != nil {
+		return 0, nil, err
+	}
+	payload = append(payload, sha...)
+
+	if rec.Value.Peeled == "" {
+		return reftableRefVal1, payload, nil
+	}
+
+	peeled, err := reftableShaBytes(rec.Value.Peeled)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return reftableRefVal2, append(payload, peeled...), nil
+}
+
+func reftableLogPayload(rec reftableLogRecord) (byte, []byte, error) {
+	if rec.Deleted {
+		return reftableLogDeletion, nil, nil
+	}
+
+	payload := []byte{}
+	for _, sha := range []string{rec.Entry.Old, rec.Entry.New} {
+		raw, err := reftableShaBytes(sha)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload = append(payload, raw...)
+	}
+
+	sig := rec.Entry.Committer
+	_, offset := sig.When.Zone()
+
+	payload = reftablePutVarint(payload, uint64(len(sig.Name)))
+	payload = append(payload, sig.Name...)
+	payload = reftablePutVarint(payload, uint64(len(sig.Email)))
+	payload = append(payload, sig.Email...)
+	payload = reftablePutVarint(payload, uint64(sig.When.Unix()))
+	payload = binary.BigEndian.AppendUint16(payload, uint16(int16(offset/60)))
+	payload = reftablePutVarint(payload, uint64(len(rec.Entry.Message)))
+	payload = append(payload, rec.Entry.Message...)
+
+	return reftableLogUpdate, payload, nil
+}
+
+func reftableHeader(minUpdateIndex uint64, maxUpdateIndex uint64) []byte {
+	header := make([]byte, reftableHeaderSize)
+	copy(header, reftableMagic)
+	header[4] = reftableVersion
+	putUint24(header[5:], reftableBlockSize)
+	binary.BigEndian.PutUint64(header[8:], minUpdateIndex)
+	binary.BigEndian.PutUint64(header[16:], maxUpdateIndex)
+
+	return header
+}
+
+func reftableSerialize(refs []reftableRefRecord, logs []reftableLogRecord, minUpdateIndex uint64, maxUpdateIndex uint64) ([]byte, error) {
+	/*
+		ref blocks are aligned to the block size, log blocks are zlib compressed and unaligned,
+		no object or index blocks are written
+	*/
+	refs = slices.Clone(refs)
+	slices.SortFunc(refs, func(a, b reftableRefRecord) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	logs = slices.Clone(logs)
+	slices.SortFunc(logs, func(a, b reftableLogRecord) int {
+		return strings.Compare(a.key(), b.key())
+	})
+
+	header := reftableHeader(minUpdateIndex, maxUpdateIndex)
+	out := []byte{}
+
+	if len(refs) > 0 {
+		w := newReftableBlockWriter('r', reftableHeaderSize, reftableBlockSize)
+		for _, rec := range refs {
+			valueType, payload, err := reftableRefPayload(rec, minUpdateIndex)
+			if err != nil {
+				return nil, err
+			}
+
+			if !w.add(rec.Name, valueType, payload) {
+				block := w.finish()
+				out = append(out, block...)
+				out = append(out, make([]byte, reftableBlockSize-len(block))...)
+
+				w = newReftableBlockWriter('r', 0, reftableBlockSize)
+				w.add(rec.Name, valueType, payload)
+			}
+		}
+		out = append(out, w.finish()...)
+		copy(out, header)
+	} else {
+		out = append(out, header...)
+	}
+
+	logOffset := 0
+	if len(logs) > 0 {
+		logOffset = len(out)
+
+		flush := func(w *reftableBlockWriter) error {
+			block := w.finish()
+
+			var compressed bytes.Buffer
+			zw := zlib.NewWriter(&compressed)
+			if _, err := zw.Write(block[4:]); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+
+			out = append(out, block[:4]...)
+			out = append(out, compressed.Bytes()...)
+			return nil
+		}
+
+		w := newReftableBlockWriter('g', 0, reftableBlockSize)
+		for _, rec := range logs {
+			valueType, payload, err := reftableLogPayload(rec)
+			if err != nil {
+				return nil, err
+			}
+
+			if !w.add(rec.key(), valueType, payload) {
+				if err := flush(w); err != nil {
+					return nil, err
+				}
+
+				w = newReftableBlockWriter('g', 0, reftableBlockSize)
+				w.add(rec.key(), valueType, payload)
+			}
+		}
+		if err := flush(w); err != nil {
+			return nil, err
+		}
+	}
+
+	footer := append([]byte{}, header...)
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint64(footer, uint64(logOffset))
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint32(footer, crc32.ChecksumIEEE(footer))
+
+	return append(out, footer...), nil
+}
+
+type reftableBlock struct {
+	data     []byte
+	recStart int
+	recEnd   int
+	restarts []int
+}
+
+func reftableBlockParse(data []byte, headerLen int, typ byte) (reftableBlock, error) {
+	/*
+		data starts at the beginning of the block, which for the first block is the file header
+	*/
+	if len(data) < headerLen+4 || data[headerLen] != typ {
+		return reftableBlock{}, fmt.Errorf("reftable: expected block of type %c\n", typ)
+	}
+
+	blockLen := getUint24(data[headerLen+1:])
+	if blockLen > len(data) || blockLen < headerLen+6 {
+		return reftableBlock{}, fmt.Errorf("reftable: invalid block length %d\n", blockLen)
+	}
+
+	count := int(binary.BigEndian.Uint16(data[blockLen-2:]))
+	recEnd := blockLen - 2 - 3*count
+	if recEnd < headerLen+4 {
+		return reftableBlock{}, fmt.Errorf("reftable: invalid restart count %d\n", count)
+	}
+
+	block := reftableBlock{data: data[:blockLen], recStart: headerLen + 4, recEnd: recEnd}
+	for i := 0; i < count; i++ {
+		block.restarts = append(block.restarts, getUint24(data[recEnd+3*i:]))
+	}
+
+	return block, nil
+}
+
+func (b reftableBlock) readKey(pos int, lastKey string) (string, byte, int, error) {
+	prefix, pos, err := reftableGetVarint(b.data, pos)
+	if err != nil {
+		return "", 0, pos, err
+	}
+
+	suffixType, pos, err := reftableGetVarint(b.data, pos)
+	if err != nil {
+		return "", 0, pos, err
+	}
+
+	suffixLen := int(suffixType >> 3)
+	if int(prefix) > len(lastKey) || pos+suffixLen > b.recEnd {
+		return "", 0, pos, fmt.Errorf("reftable: corrupt record key\n")
+	}
+
+	key := lastKey[:prefix] + string(b.data[pos:pos+suffixLen])
+	return key, byte(suffixType & 0x7), pos + suffixLen, nil
+}
+
+func (b reftableBlock) readRef(pos int, lastKey string, minUpdateIndex uint64) (reftableRefRecord, int, error) {
+	name, valueType, pos, err := b.readKey(pos, lastKey)
+	if err != nil {
+		return reftableRefRecord{}, pos, err
+	}
+
+	delta, pos, err := reftableGetVarint(b.data, pos)
+	if err != nil {
+		return reftableRefRecord{}, pos, err
+	}
+
+	rec := reftableRefRecord{Name: name, UpdateIndex: minUpdateIndex + delta}
+	switch valueType {
+	case reftableRefDeletion:
+		rec.Deleted = true
+	case reftableRefVal1, reftableRefVal2:
+		size := 20
+		if valueType == reftableRefVal2 {
+			size = 40
+		}
+		if pos+size > b.recEnd {
+			return rec, pos, fmt.Errorf("reftable: truncated ref record %s\n", name)
+		}
+
+		rec.Value.Sha = hex.EncodeToString(b.data[pos : pos+20])
+		if valueType == reftableRefVal2 {
+			rec.Value.Peeled = hex.EncodeToString(b.data[pos+20 : pos+40])
+		}
+		pos += size
+	case reftableRefSymref:
+		var target []byte
+		target, pos, err = reftableGetBytes(b.data[:b.recEnd], pos)
+		if err != nil {
+			return rec, pos, err
+		}
+		rec.Value.Target = string(target)
+	default:
+		return rec, pos, fmt.Errorf("reftable: unknown ref value type %d\n", valueType)
+	}
+
+	return rec, pos, nil
+}
+
+func (b reftableBlock) readLog(pos int, lastKey string) (reftableLogRecord, string, int, error) {
+	key, valueType, pos, err := b.readKey(pos, lastKey)
+	if err != nil {
+		return reftableLogRecord{}, key, pos, err
+	}
+	if len(key) < 9 || key[len(key)-9] != 0 {
+		return reftableLogRecord{}, key, pos, fmt.Errorf("reftable: corrupt log key\n")
+	}
+
+	rec := reftableLogRecord{
+		Name:        key[:len(key)-9],
+		UpdateIndex: ^binary.BigEndian.Uint64([]byte(key[len(key)-8:])),
+	}
+
+	switch valueType {
+	case reftableLogDeletion:
+		rec.Deleted = true
+		return rec, key, pos, nil
+	case reftableLogUpdate:
+	default:
+		return rec, key, pos, fmt.Errorf("reftable: unknown log value type %d\n", valueType)
+	}
+
+	data := b.data[:b.recEnd]
+	if pos+40 > len(data) {
+		return rec, key, pos, fmt.Errorf("reftable: truncated log record %s\n", rec.Name)
+	}
+	rec.Entry.Old = hex.EncodeToString(data[pos : pos+20])
+	rec.Entry.New = hex.EncodeToString(data[pos+20 : pos+40])
+	pos += 40
+
+	name, pos, err := reftableGetBytes(data, pos)
+	if err != nil {
+		return rec, key, pos, err
+	}
+	email, pos, err := reftableGetBytes(data, pos)
+	if err != nil {
+		return rec, key, pos, err
+	}
+	seconds, pos, err := reftableGetVarint(data, pos)
+	if err != nil {
+		return rec, key, pos, err
+	}
+	if pos+2 > len(data) {
+		return rec, key, pos, fmt.Errorf("reftable: truncated log record %s\n", rec.Name)
+	}
+	offset := int(int16(binary.BigEndian.Uint16(data[pos:]))) * 60
+	pos += 2
+	message, pos, err := reftableGetBytes(data, pos)
+	if err != nil {
+		return rec, key, pos, err
+	}
+
+	zone := time.FixedZone(fmt.Sprintf("%+03d%02d", offset/3600, abs(offset%3600)/60), offset)
+	rec.Entry.Committer = Signature{Name: string(name), Email: string(email), When: time.Unix(int64(seconds), 0).In(zone)}
+	rec.Entry.Message = string(message)
+
+	return rec, key, pos, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+type reftableTable struct {
+	name           string
+	size           int
+	data           []byte
+	blockSize      int
+	minUpdateIndex uint64
+	maxUpdateIndex uint64
+	refEnd         int
+	logOffset      int
+	footerStart    int
+}
+
+func reftableTableParse(name string, data []byte) (*reftableTable, error) {
+	if len(data) < reftableHeaderSize+reftableFooterSize || string(data[:4]) != reftableMagic {
+		return nil, fmt.Errorf("reftable: %s is not a reftable\n", name)
+	}
+	if data[4] != reftableVersion {
+		return nil, fmt.Errorf("reftable: unsupported version %d in %s\n", data[4], name)
+	}
+
+	footerStart := len(data) - reftableFooterSize
+	footer := data[footerStart:]
+	if !bytes.Equal(footer[:reftableHeaderSize], data[:reftableHeaderSize]) {
+		return nil, fmt.Errorf("reftable: footer does not match header in %s\n", name)
+	}
+	if crc32.ChecksumIEEE(footer[:reftableFooterSize-4]) != binary.BigEndian.Uint32(footer[reftableFooterSize-4:]) {
+		return nil, fmt.Errorf("reftable: footer checksum mismatch in %s\n", name)
+	}
+
+	t := &reftableTable{
+		name:           name,
+		size:           len(data),
+		data:           data,
+		blockSize:      getUint24(data[5:]),
+		minUpdateIndex: binary.BigEndian.Uint64(data[8:]),
+		maxUpdateIndex: binary.BigEndian.Uint64(data[16:]),
+		footerStart:    footerStart,
+	}
+
+	t.refEnd = footerStart
+	for _, off := range []uint64{
+		binary.BigEndian.Uint64(footer[24:]),
+		binary.BigEndian.Uint64(footer[32:]) >> 5,
+		binary.BigEndian.Uint64(footer[40:]),
+		binary.BigEndian.Uint64(footer[48:]),
+		binary.BigEndian.Uint64(footer[56:]),
+	} {
+		if off != 0 && int(off) < t.refEnd {
+			t.refEnd = int(off)
+		}
+	}
+	t.logOffset = int(binary.BigEndian.Uint64(footer[48:]))
+
+	if t.blockSize == 0 {
+		return nil, fmt.Errorf("reftable: unaligned tables are not supported: %s\n", name)
+	}
+
+	return t, nil
+}
+
+func (t *reftableTable) refBlocks() int {
+	if t.refEnd <= reftableHeaderSize || t.data[reftableHeaderSize] != 'r' {
+		return 0
+	}
+
+	return (t.refEnd + t.blockSize - 1) / t.blockSize
+}
+
+func (t *reftableTable) refBlock(i int) (reftableBlock, error) {
+	start := i * t.blockSize
+	headerLen := 0
+	if i == 0 {
+		headerLen = reftableHeaderSize
+	}
+
+	end := min(start+t.blockSize, t.refEnd)
+	return reftableBlockParse(t.data[start:end], headerLen, 'r')
+}
+
+func (t *reftableTable) refSeek(name string) (reftableRefRecord, bool, error) {
+	/*
+		binary searches the aligned blocks by their first key, then the restart points
+	*/
+	n := t.refBlocks()
+	if n == 0 {
+		return reftableRefRecord{}, false, nil
+	}
+
+	var seekErr error
+	firstKey := func(b reftableBlock) string {
+		key, _, _, err := b.readKey(b.recStart, "")
+		if err != nil {
+			seekErr = err
+		}
+		return key
+	}
+
+	lo, hi := 0, n-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		b, err := t.refBlock(mid)
+		if err != nil {
+			return reftableRefRecord{}, false, err
+		}
+		if firstKey(b) <= name {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	block, err := t.refBlock(lo)
+	if err != nil {
+		return reftableRefRecord{}, false, err
+	}
+
+	r := 0
+	lo, hi = 0, len(block.restarts)-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		key, _, _, err := block.readKey(block.restarts[mid], "")
+		if err != nil {
+			return reftableRefRecord{}, false, err
+		}
+		if key <= name {
+			r = mid
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	if seekErr != nil {
+		return reftableRefRecord{}, false, seekErr
+	}
+
+	pos := block.recStart
+	if len(block.restarts) > 0 {
+		pos = block.restarts[r]
+	}
+
+	last := ""
+	for pos < block.recEnd {
+		rec, next, err := block.readRef(pos, last, t.minUpdateIndex)
+		if err != nil {
+			return reftableRefRecord{}, false, err
+		}
+		if rec.Name == name {
+			return rec, true, nil
+		}
+		if rec.Name > name {
+			break
+		}
+
+		last = rec.Name
+		pos = next
+	}
+
+	return reftableRefRecord{}, false, nil
+}
+
+func (t *reftableTable) refAll() ([]reftableRefRecord, error) {
+	ret := []reftableRefRecord{}
+	for i := 0; i < t.refBlocks(); i++ {
+		block, err := t.refBlock(i)
+		if err != nil {
+			return ret, err
+		}
+
+		last := ""
+		for pos := block.recStart; pos < block.recEnd; {
+			rec, next, err := block.readRef(pos, last, t.minUpdateIndex)
+			if err != nil {
+				return ret, err
+			}
+
+			ret = append(ret, rec)
+			last = rec.Name
+			pos = next
+		}
+	}
+
+	return ret, nil
+}
+
+func (t *reftableTable) logAll() ([]reftableLogRecord, error) {
+	ret := []reftableLogRecord{}
+	if t.logOffset == 0 {
+		return ret, nil
+	}
+
+	for off := t.logOffset; off < t.footerStart && t.data[off] == 'g'; {
+		if off+4 > t.footerStart {
+			return ret, fmt.Errorf("reftable: truncated log block in %s\n", t.name)
+		}
+		blockLen := getUint24(t.data[off+1:])
+
+		src := bytes.NewReader(t.data[off+4 : t.footerStart])
+		zr, err := zlib.NewReader(src)
+		if err != nil {
+			return ret, err
+		}
+
+		inflated := append([]byte{}, t.data[off:off+4]...)
+		rest, err := io.ReadAll(zr)
+		if err != nil {
+			return ret, err
+		}
+		inflated = append(inflated, rest...)
+		if len(inflated) != blockLen {
+			return ret, fmt.Errorf("reftable: log block length mismatch in %s\n", t.name)
+		}
+
+		block, err := reftableBlockParse(inflated, 0, 'g')
+		if err != nil {
+			return ret, err
+		}
+
+		last := ""
+		for pos := block.recStart; pos < block.recEnd; {
+			rec, key, next, err := block.readLog(pos, last)
+			if err != nil {
+				return ret, err
+			}
+
+			ret = append(ret, rec)
+			last = key
+			pos = next
+		}
+
+		off = t.footerStart - src.Len()
+	}
+
+	return ret, nil
+}
+
+type reftableRefStore struct {
+	repo  *Repository
+	dir   string
+	stack []*reftableTable
+}
+
+func (s *reftableRefStore) listPath() string {
+	return filepath.Join(s.dir, "tables.list")
+}
+
+func (s *reftableRefStore) stackRead() ([]string, error) {
+	data, err := os.ReadFile(s.listPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return []string{}, err
+	}
+
+	ret := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			ret = append(ret, line)
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *reftableRefStore) tablesLoad(names []string) ([]*reftableTable, error) {
+	/*
+		returns the tables oldest first, in the order of tables.list, table files never
+		change once written so the ones already parsed are reused
+	*/
+	cached := map[string]*reftableTable{}
+	for _, t := range s.stack {
+		cached[t.name] = t
+	}
+
+	ret := []*reftableTable{}
+	for _, name := range names {
+		if t, ok := cached[name]; ok {
+			ret = append(ret, t)
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return ret, err
+		}
+
+		t, err := reftableTableParse(name, data)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, t)
+	}
+
+	return ret, nil
+}
+
+func (s *reftableRefStore) tables() ([]*reftableTable, error) {
+	/*
+		only tables.list is read when the stack did not change since the last call
+	*/
+	names, err := s.stackRead()
+	if err != nil {
+		return []*reftableTable{}, err
+	}
+
+	if len(names) == len(s.stack) {
+		same := true
+		for i, t := range s.stack {
+			if t.name != names[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return s.stack, nil
+		}
+	}
+
+	tables, err := s.tablesLoad(names)
+	if err != nil {
+		return tables, err
+	}
+
+	s.stack = tables
+	return tables, nil
+}
+
+func (s *reftableRefStore) lock() (func(), error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	lockPath := s.listPath() + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("unable to create '%s': file exists\n", lockPath)
+		}
+		return nil, err
+	}
+	file.Close()
+
+	return func() { os.Remove(lockPath) }, nil
+}
+
+func (s *reftableRefStore) stackWrite(names []string) error {
+	/*
+		must be called with the lock held
+	*/
+	content := ""
+	for _, name := range names {
+		content += name + "\n"
+	}
+
+	tmp := s.listPath() + ".new"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.listPath())
+}
+
+func (s *reftableRefStore) tableWrite(refs []reftableRefRecord, logs []reftableLogRecord, minUpdateIndex uint64, maxUpdateIndex uint64) (string, error) {
+	data, err := reftableSerialize(refs, logs, minUpdateIndex, maxUpdateIndex)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("0x%012x-0x%012x-%08x.ref", minUpdateIndex, maxUpdateIndex, rand.Uint32())
+	tmp := filepath.Join(s.dir, name+".temp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+
+	return name, os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *reftableRefStore) add(refs []reftableRefRecord, logs []reftableLogRecord) error {
+	/*
+		writes the records as a new table on top of the stack, they get the next update index
+		except log deletions, which keep the index of the entry they remove
+	*/
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tables, err := s.tables()
+	if err != nil {
+		return err
+	}
+
+	var updateIndex uint64 = 1
+	if len(tables) > 0 {
+		updateIndex = tables[len(tables)-1].maxUpdateIndex + 1
+	}
+
+	minUpdateIndex := updateIndex
+	for i := range refs {
+		refs[i].UpdateIndex = updateIndex
+	}
+	for i := range logs {
+		if logs[i].UpdateIndex == 0 {
+			logs[i].UpdateIndex = updateIndex
+		}
+		minUpdateIndex = min(minUpdateIndex, logs[i].UpdateIndex)
+	}
+
+	name, err := s.tableWrite(refs, logs, minUpdateIndex, updateIndex)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, t := range tables {
+		names = append(names, t.name)
+	}
+
+	if err := s.stackWrite(append(names, name)); err != nil {
+		os.Remove(filepath.Join(s.dir, name))
+		return err
+	}
+
+	return s.autoCompact()
+}
+
+func (s *reftableRefStore) autoCompact() error {
+	/*
+		must be called with the lock held, keeps the table sizes a geometric sequence,
+		every table at least twice as big as all the tables above it
+	*/
+	tables, err := s.tables()
+	if err != nil {
+		return err
+	}
+	if len(tables) < 2 {
+		return nil
+	}
+
+	start := len(tables) - 1
+	total := tables[start].size
+	for start > 0 && tables[start-1].size < 2*total {
+		start--
+		total += tables[start].size
+	}
+
+	if start == len(tables)-1 {
+		return nil
+	}
+
+	return s.compact(tables, start)
+}
+
+func (s *reftableRefStore) compact(tables []*reftableTable, start int) error {
+	/*
+		merges tables[start:] into one table, must be called with the lock held,
+		deletions can only be dropped when the merged table ends up at the bottom of the stack
+	*/
+	refs := map[string]reftableRefRecord{}
+	logs := map[string]reftableLogRecord{}
+
+	minUpdateIndex := tables[start].minUpdateIndex
+	maxUpdateIndex := tables[len(tables)-1].maxUpdateIndex
+
+	for _, t := range tables[start:] {
+		minUpdateIndex = min(minUpdateIndex, t.minUpdateIndex)
+
+		tableRefs, err := t.refAll()
+		if err != nil {
+			return err
+		}
+		for _, rec := range tableRefs {
+			refs[rec.Name] = rec
+		}
+
+		tableLogs, err := t.logAll()
+		if err != nil {
+			return err
+		}
+		for _, rec := range tableLogs {
+			logs[rec.key()] = rec
+		}
+	}
+
+	mergedRefs := []reftableRefRecord{}
+	for _, rec := range refs {
+		if rec.Deleted && start == 0 {
+			continue
+		}
+		mergedRefs = append(mergedRefs, rec)
+	}
+
+	mergedLogs := []reftableLogRecord{}
+	for _, rec := range logs {
+		if rec.Deleted && start == 0 {
+			continue
+		}
+		mergedLogs = append(mergedLogs, rec)
+	}
+
+	name, err := s.tableWrite(mergedRefs, mergedLogs, minUpdateIndex, maxUpdateIndex)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, t := range tables[:start] {
+		names = append(names, t.name)
+	}
+	names = append(names, name)
+
+	if err := s.stackWrite(names); err != nil {
+		os.Remove(filepath.Join(s.dir, name))
+		return err
+	}
+
+	for _, t := range tables[start:] {
+		os.Remove(filepath.Join(s.dir, t.name))
+	}
+
+	return nil
+}
+
+func (s *reftableRefStore) Read(name string) (RefValue, error) {
+	tables, err := s.tables()
+	if err != nil {
+		return RefValue{}, err
+	}
+
+	for i := len(tables) - 1; i >= 0; i-- {
+		rec, ok, err := tables[i].refSeek(name)
+		if err != nil {
+			return RefValue{}, err
+		}
+		if !ok {
+			continue
+		}
+		if rec.Deleted {
+			break
+		}
+
+		return rec.Value, nil
+	}
+
+	return RefValue{}, fmt.Errorf("ref %s not found: %w", name, RefNotFound)
+}
+
+func (s *reftableRefStore) Write(name string, value RefValue) error {
+	return s.WriteWithLog(name, value, nil)
+}
+
+func (s *reftableRefStore) WriteWithLog(name string, value RefValue, logs map[string]ReflogEntry) error {
+	/*
+		the ref and its log records go in one table so they share the update index
+	*/
+	if value.Target == "" && value.Peeled == "" {
+		if peeled, err := s.repo.ObjectPeel(value.Sha); err == nil && peeled != value.Sha {
+			value.Peeled = peeled
+		}
+	}
+
+	records := []reftableLogRecord{}
+	for logName, entry := range logs {
+		records = append(records, reftableLogRecord{Name: logName, Entry: entry})
+	}
+
+	return s.add([]reftableRefRecord{{Name: name, Value: value}}, records)
+}
+
+func (s *reftableRefStore) Delete(name string) error {
+	if _, err := s.Read(name); err != nil {
+		return err
+	}
+
+	entries, err := s.reflogRecords(name)
+	if err != nil {
+		return err
+	}
+
+	logs := []reftableLogRecord{}
+	for _, rec := range entries {
+		logs = append(logs, reftableLogRecord{Name: name, UpdateIndex: rec.UpdateIndex, Deleted: true})
+	}
+
+	return s.add([]reftableRefRecord{{Name: name, Deleted: true}}, logs)
+}
+
+func (s *reftableRefStore) List() (map[string]RefValue, error) {
+	tables, err := s.tables()
+	if err != nil {
+		return map[string]RefValue{}, err
+	}
+
+	ret := map[string]RefValue{}
+	for _, t := range tables {
+		recs, err := t.refAll()
+		if err != nil {
+			return ret, err
+		}
+
+		for _, rec := range recs {
+			if rec.Deleted {
+				delete(ret, rec.Name)
+				continue
+			}
+			if strings.HasPrefix(rec.Name, "refs/") {
+				ret[rec.Name] = rec.Value
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *reftableRefStore) reflogRecords(name string) ([]reftableLogRecord, error) {
+	tables, err := s.tables()
+	if err != nil {
+		return []reftableLogRecord{}, err
+	}
+
+	byIndex := map[uint64]reftableLogRecord{}
+	for _, t := range tables {
+		recs, err := t.logAll()
+		if err != nil {
+			return []reftableLogRecord{}, err
+		}
+
+		for _, rec := range recs {
+			if rec.Name != name {
+				continue
+			}
+			if rec.Deleted {
+				delete(byIndex, rec.UpdateIndex)
+				continue
+			}
+			byIndex[rec.UpdateIndex] = rec
+		}
+	}
+
+	ret := []reftableLogRecord{}
+	for _, rec := range byIndex {
+		ret = append(ret, rec)
+	}
+	slices.SortFunc(ret, func(a, b reftableLogRecord) int {
+		switch {
+		case a.UpdateIndex < b.UpdateIndex:
+			return -1
+		case a.UpdateIndex > b.UpdateIndex:
+			return 1
+		}
+		return 0
+	})
+
+	return ret, nil
+}
+
+func (s *reftableRefStore) ReflogRead(name string) ([]ReflogEntry, error) {
+	recs, err := s.reflogRecords(name)
+	if err != nil {
+		return []ReflogEntry{}, err
+	}
+
+	ret := []ReflogEntry{}
+	for _, rec := range recs {
+		ret = append(ret, rec.Entry)
+	}
+
+	return ret, nil
+}
+
+func (s *reftableRefStore) ReflogAppend(name string, entry ReflogEntry) error {
+	return s.add(nil, []reftableLogRecord{{Name: name, Entry: entry}})
+}
+
+func (s *reftableRefStore) ReflogDelete(name string, index int) error {
+	/*
+		a deletion record hides the entry, the entry after it is written again under its
+		own update index with the old sha of the deleted one
+	*/
+	recs, err := s.reflogRecords(name)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(recs) {
+		return fmt.Errorf("reflog entry %d not found for ref:%s\n", index, name)
+	}
+
+	logs := []reftableLogRecord{{Name: name, UpdateIndex: recs[index].UpdateIndex, Deleted: true}}
+	if index+1 < len(recs) {
+		next := recs[index+1]
+		next.Entry.Old = recs[index].Entry.Old
+		logs = append(logs, next)
+	}
+
+	return s.add(nil, logs)
+}
+
+func (s *reftableRefStore) Pack() error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tables, err := s.tables()
+	if err != nil {
+		return err
+	}
+	if len(tables) < 2 {
+		return nil
+	}
+
+	return s.compact(tables, 0)
+}
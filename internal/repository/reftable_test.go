@@ -0,0 +1,157 @@
+package repository_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neet-007/git_in_go/internal/repository"
+)
+
+func TestReftableRefStore(t *testing.T) {
+	repo, err := repository.CreateRepo(t.TempDir(), "reftable")
+	if err != nil {
+		t.Fatalf("CreateRepo err:%v\n", err)
+	}
+
+	branch, err := repo.GetActiveBranch()
+	if err != nil || branch != "master" {
+		t.Fatalf("GetActiveBranch got %q err:%v want master\n", branch, err)
+	}
+
+	const count = 300
+	sha := func(i int) string {
+		return fmt.Sprintf("%040x", i+1)
+	}
+
+	for i := 0; i < count; i++ {
+		if err := repo.RefCreate(fmt.Sprintf("heads/branch-%04d", i), sha(i)); err != nil {
+			t.Fatalf("RefCreate %d err:%v\n", i, err)
+		}
+	}
+
+	for i := 0; i < count; i += 2 {
+		if err := repo.Refs.Delete(fmt.Sprintf("refs/heads/branch-%04d", i)); err != nil {
+			t.Fatalf("Delete %d err:%v\n", i, err)
+		}
+	}
+
+	if err := repo.ReflogAppend("refs/heads/branch-0001", "", sha(1), "branch: Created"); err != nil {
+		t.Fatalf("ReflogAppend err:%v\n", err)
+	}
+
+	check := func() {
+		for i := 0; i < count; i++ {
+			got, err := repo.RefResolve(fmt.Sprintf("refs/heads/branch-%04d", i))
+			if i%2 == 0 {
+				if !errors.Is(err, repository.RefNotFound) {
+					t.Fatalf("deleted ref %d resolved to %s err:%v\n", i, got, err)
+				}
+				continue
+			}
+			if err != nil || got != sha(i) {
+				t.Fatalf("ref %d got %s err:%v want %s\n", i, got, err, sha(i))
+			}
+		}
+
+		refs, err := repo.RefListFlat("refs/heads/")
+		if err != nil || len(refs) != count/2 {
+			t.Fatalf("RefListFlat got %d refs err:%v want %d\n", len(refs), err, count/2)
+		}
+
+		entries, err := repo.ReflogRead("refs/heads/branch-0001")
+		if err != nil || len(entries) != 1 || entries[0].New != sha(1) || entries[0].Message != "branch: Created" {
+			t.Fatalf("ReflogRead got %+v err:%v\n", entries, err)
+		}
+	}
+
+	check()
+
+	if err := repo.Refs.Pack(); err != nil {
+		t.Fatalf("Pack err:%v\n", err)
+	}
+
+	list, err := os.ReadFile(filepath.Join(repo.Gitdir, "reftable", "tables.list"))
+	if err != nil || strings.Count(string(list), "\n") != 1 {
+		t.Fatalf("tables.list after Pack:%q err:%v\n", string(list), err)
+	}
+
+	check()
+}
+
+func TestReflogDelete(t *testing.T) {
+	for _, format := range []string{"files", "reftable"} {
+		repo, err := repository.CreateRepo(t.TempDir(), format)
+		if err != nil {
+			t.Fatalf("%s CreateRepo err:%v\n", format, err)
+		}
+
+		sha := func(i int) string {
+			return fmt.Sprintf("%040x", i+1)
+		}
+		for i := 0; i < 4; i++ {
+			old := ""
+			if i > 0 {
+				old = sha(i - 1)
+			}
+			if err := repo.ReflogAppend("refs/stash", old, sha(i), fmt.Sprintf("entry %d", i)); err != nil {
+				t.Fatalf("%s ReflogAppend %d err:%v\n", format, i, err)
+			}
+		}
+
+		if err := repo.ReflogDelete("refs/stash", 1); err != nil {
+			t.Fatalf("%s ReflogDelete err:%v\n", format, err)
+		}
+		if err := repo.ReflogDelete("refs/stash", 3); err == nil {
+			t.Fatalf("%s ReflogDelete out of range want err\n", format)
+		}
+
+		entries, err := repo.ReflogRead("refs/stash")
+		if err != nil || len(entries) != 3 {
+			t.Fatalf("%s ReflogRead got %+v err:%v\n", format, entries, err)
+		}
+		want := []string{"entry 0", "entry 2", "entry 3"}
+		for i, entry := range entries {
+			if entry.Message != want[i] {
+				t.Fatalf("%s entry %d got %q want %q\n", format, i, entry.Message, want[i])
+			}
+		}
+		if entries[1].Old != sha(0) || entries[1].New != sha(2) {
+			t.Fatalf("%s entry after the deleted one got old:%s new:%s\n", format, entries[1].Old, entries[1].New)
+		}
+	}
+}
+
+func TestReftableHeadUpdate(t *testing.T) {
+	repo, err := repository.CreateRepo(t.TempDir(), "reftable")
+	if err != nil {
+		t.Fatalf("CreateRepo err:%v\n", err)
+	}
+
+	maxUpdateIndex := func() string {
+		list, err := os.ReadFile(filepath.Join(repo.Gitdir, "reftable", "tables.list"))
+		if err != nil {
+			t.Fatalf("tables.list err:%v\n", err)
+		}
+		names := strings.Fields(string(list))
+		return strings.Split(names[len(names)-1], "-")[1]
+	}
+
+	before := maxUpdateIndex()
+	if err := repo.HeadUpdate(fmt.Sprintf("%040x", 1), "commit (initial): one"); err != nil {
+		t.Fatalf("HeadUpdate err:%v\n", err)
+	}
+	if after := maxUpdateIndex(); after != fmt.Sprintf("0x%012x", 2) || before != fmt.Sprintf("0x%012x", 1) {
+		t.Fatalf("HeadUpdate took the update index from %s to %s want one update\n", before, after)
+	}
+
+	for _, name := range []string{"refs/heads/master", "HEAD"} {
+		entries, err := repo.ReflogRead(name)
+		if err != nil || len(entries) != 1 || entries[0].Message != "commit (initial): one" {
+			t.Fatalf("ReflogRead %s got %+v err:%v\n", name, entries, err)
+		}
+	}
+}
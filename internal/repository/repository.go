@@ -1,12 +1,13 @@
 package repository
 
 import (
-	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/neet-007/git_in_go/internal/sharedtypes"
 	"github.com/neet-007/git_in_go/internal/utils"
@@ -17,6 +18,10 @@ type Repository struct {
 	Worktree string
 	Gitdir   string
 	Conf     *ini.File
+	Refs     RefStore
+
+	generations map[string]uint64
+	mailmap     *Mailmap
 }
 
 func NewRepository(path string, force bool) (*Repository, error) {
@@ -51,11 +56,23 @@ func NewRepository(path string, force bool) (*Repository, error) {
 		if err != nil {
 			panic("repositoryformatversion not found or invalid")
 		}
-		if vers != 0 {
+		if vers != 0 && vers != 1 {
 			panic(fmt.Sprintf("Unsupported repositoryformatversion %d", vers))
 		}
+		if vers == 1 {
+			for _, key := range repo.Conf.Section("extensions").Keys() {
+				if strings.ToLower(key.Name()) != "refstorage" {
+					panic(fmt.Sprintf("Unsupported extension %s", key.Name()))
+				}
+				if format := strings.ToLower(key.String()); format != "files" && format != "reftable" {
+					panic(fmt.Sprintf("Unsupported ref storage %s", key.String()))
+				}
+			}
+		}
 	}
 
+	repo.Refs = newRefStore(&repo)
+
 	return &repo, nil
 }
 
@@ -68,11 +85,18 @@ func (repo *Repository) RepoFile(mkdir bool, path ...string) (string, error) {
 		mkdir: default val is false
 	*/
 
-	if _, err := repo.RepoDir(mkdir, path[:len(path)-1]...); err != nil {
+	fullPath := repo.RepoPath(path...)
+
+	dir, err := filepath.Rel(repo.Gitdir, filepath.Dir(fullPath))
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := repo.RepoDir(mkdir, dir); err != nil {
 		return "", err
 	}
 
-	return repo.RepoPath(path...), nil
+	return fullPath, nil
 }
 
 func (repo *Repository) RepoDir(mkdir bool, path ...string) (string, error) {
@@ -84,7 +108,9 @@ func (repo *Repository) RepoDir(mkdir bool, path ...string) (string, error) {
 			return "", fmt.Errorf("dir does not exist and mkdir is false")
 		}
 
-		os.Mkdir(pathLocal, 0755)
+		if err := os.MkdirAll(pathLocal, 0755); err != nil {
+			return "", err
+		}
 		return pathLocal, nil
 	}
 
@@ -95,7 +121,17 @@ func (repo *Repository) RepoDir(mkdir bool, path ...string) (string, error) {
 	return pathLocal, nil
 }
 
-func CreateRepo(path string) (*Repository, error) {
+func CreateRepo(path string, refFormat string) (*Repository, error) {
+	/*
+		refFormat: default val is "files", the other option is "reftable"
+	*/
+	if refFormat == "" {
+		refFormat = "files"
+	}
+	if refFormat != "files" && refFormat != "reftable" {
+		return nil, fmt.Errorf("unknown ref storage format '%s'\n", refFormat)
+	}
+
 	repo, err := NewRepository(path, true)
 
 	if err != nil {
@@ -137,14 +173,38 @@ func CreateRepo(path string) (*Repository, error) {
 		return nil, err
 	}
 
-	_, err = repo.RepoDir(true, "refs", "tags")
-	if err != nil {
-		return nil, err
-	}
+	if refFormat == "files" {
+		_, err = repo.RepoDir(true, "refs", "tags")
+		if err != nil {
+			return nil, err
+		}
 
-	_, err = repo.RepoDir(true, "refs", "heads")
-	if err != nil {
-		return nil, err
+		_, err = repo.RepoDir(true, "refs", "heads")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		_, err = repo.RepoDir(true, "reftable")
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.WriteFile(repo.RepoPath("reftable", "tables.list"), []byte{}, 0644); err != nil {
+			return nil, err
+		}
+
+		_, err = repo.RepoDir(true, "refs")
+		if err != nil {
+			return nil, err
+		}
+
+		/*
+			refs/heads is a file and HEAD points to an invalid branch so tools that only
+			know the files backend refuse to work on the repository
+		*/
+		if err := os.WriteFile(repo.RepoPath("refs", "heads"), []byte("this repository uses the reftable format\n"), 0644); err != nil {
+			return nil, err
+		}
 	}
 
 	dir := repo.RepoPath("description")
@@ -167,13 +227,18 @@ func CreateRepo(path string) (*Repository, error) {
 	}
 	defer file.Close()
 
-	if _, err := file.WriteString("ref: refs/heads/master\n"); err != nil {
+	head := "ref: refs/heads/master\n"
+	if refFormat == "reftable" {
+		head = "ref: refs/heads/.invalid\n"
+	}
+
+	if _, err := file.WriteString(head); err != nil {
 		return nil, fmt.Errorf("Failed to write to file: %v", err)
 	}
 
 	dir = repo.RepoPath("config")
 
-	config, err := repoDefaultConfig()
+	config, err := repoDefaultConfig(refFormat)
 	if err != nil {
 		return nil, err
 	}
@@ -183,10 +248,19 @@ func CreateRepo(path string) (*Repository, error) {
 		return nil, err
 	}
 
+	repo.Conf = config
+	repo.Refs = newRefStore(repo)
+
+	if refFormat == "reftable" {
+		if err := repo.Refs.Write("HEAD", RefValue{Target: "refs/heads/master"}); err != nil {
+			return nil, err
+		}
+	}
+
 	return repo, nil
 }
 
-func repoDefaultConfig() (*ini.File, error) {
+func repoDefaultConfig(refFormat string) (*ini.File, error) {
 	cfg := ini.Empty()
 
 	coreSection, err := cfg.NewSection("core")
@@ -198,6 +272,16 @@ func repoDefaultConfig() (*ini.File, error) {
 	coreSection.Key("filemode").SetValue("false")
 	coreSection.Key("bare").SetValue("false")
 
+	if refFormat == "reftable" {
+		coreSection.Key("repositoryformatversion").SetValue("1")
+
+		extensionsSection, err := cfg.NewSection("extensions")
+		if err != nil {
+			return ini.Empty(), err
+		}
+		extensionsSection.Key("refStorage").SetValue("reftable")
+	}
+
 	return cfg, nil
 }
 
@@ -346,78 +430,55 @@ type RefRes struct {
 }
 
 func (repo *Repository) RefResolve(path string) (string, error) {
-	var err error
-	if !filepath.IsAbs(path) {
-		path, err = repo.RepoFile(false, path)
+	/*
+		path can be a ref name or an absolute path inside the gitdir, symbolic refs are followed
+	*/
+	name := strings.TrimSpace(path)
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(repo.Gitdir, name)
 		if err != nil {
 			return "", err
 		}
+		name = filepath.ToSlash(rel)
 	}
-	path = strings.TrimSpace(path)
 
-	ok, err := utils.IsFile(path)
-	if err != nil {
-		return "", err
-	}
-
-	if !ok {
-		return "", fmt.Errorf("not a file path:%s\n", path)
-	}
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
+	for depth := 0; depth < 5; depth++ {
+		value, err := repo.refStore(name).Read(name)
+		if err != nil {
+			return "", err
+		}
 
-	if strings.HasPrefix(string(data), "ref: ") {
-		return repo.RefResolve(strings.Replace(string(data), "ref: ", "", 1))
+		if value.Target == "" {
+			return value.Sha, nil
+		}
+		name = value.Target
 	}
 
-	return string(data[:len(data)-1]), nil
+	return "", fmt.Errorf("symbolic ref nesting is too deep:%s\n", path)
 }
 
-func (repo *Repository) RefList(path string) (*map[string]RefRes, error) {
+func (repo *Repository) RefList(prefix string) (*map[string]RefRes, error) {
 	/*
-		path: default value is ""
+		prefix: default value is "", refs are listed relative to refs/ and nested by directory
 	*/
-	var err error
-	if path == "" {
-		path, err = repo.RepoDir(false, "refs")
-		if err != nil {
-			return &map[string]RefRes{}, err
-		}
-	}
-
-	ret := map[string]RefRes{}
-
-	entries, err := os.ReadDir(path)
+	refs, err := repo.RefListFlat("refs/" + prefix)
 	if err != nil {
 		return &map[string]RefRes{}, err
 	}
 
-	for _, e := range entries {
-		can := filepath.Join(path, e.Name())
-		info, err := os.Stat(can)
-		if err != nil {
-			return &map[string]RefRes{}, err
-		}
+	ret := map[string]RefRes{}
+	for _, ref := range refs {
+		parts := strings.Split(strings.TrimPrefix(ref.Name, "refs/"), "/")
 
-		if info.IsDir() {
-			dir, err := repo.RefList(can)
-			if err != nil {
-				return &map[string]RefRes{}, err
+		level := ret
+		for _, dir := range parts[:len(parts)-1] {
+			if _, ok := level[dir]; !ok || level[dir].Dir == nil {
+				level[dir] = RefRes{Name: "", Dir: &map[string]RefRes{}}
 			}
-
-			ret[e.Name()] = RefRes{Name: "", Dir: dir}
-			continue
-		}
-
-		name, err := repo.RefResolve(can)
-		if err != nil {
-			return &map[string]RefRes{}, err
+			level = *level[dir].Dir
 		}
 
-		ret[e.Name()] = RefRes{Name: name, Dir: nil}
+		level[parts[len(parts)-1]] = RefRes{Name: ref.Sha, Dir: nil}
 	}
 
 	return &ret, nil
@@ -432,23 +493,32 @@ func (repo *Repository) ShowRefs(refs *map[string]RefRes, withHash bool, prefix
 		return fmt.Errorf("ref is nil")
 	}
 
-	for key, val := range *refs {
+	keys := make([]string, 0, len(*refs))
+	for key := range *refs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		val := (*refs)[key]
+		prefix_ := ""
+		if prefix != "" {
+			prefix_ = prefix + "/"
+		}
+
 		if val.Dir != nil {
-			err := repo.ShowRefs(val.Dir, withHash, prefix)
+			err := repo.ShowRefs(val.Dir, withHash, prefix_+key)
 			if err != nil {
 				return err
 			}
 			continue
 		}
-		hash := ""
+
 		if withHash {
-			hash = val.Name
-		}
-		prefix_ := ""
-		if prefix != "" {
-			prefix_ = prefix + "/"
+			fmt.Printf("%s %s%s\n", val.Name, prefix_, key)
+		} else {
+			fmt.Printf("%s%s\n", prefix_, key)
 		}
-		fmt.Printf("%s %s %s\n", hash, prefix_, key)
 	}
 
 	return nil
@@ -458,19 +528,41 @@ func (repo *Repository) TagCreate(name string, ref string, createTagObject bool)
 	/*
 		createTagObject: default value is false
 	*/
+	if _, err := CheckRefFormat("refs/tags/"+name, RefFormatOptions{}); err != nil {
+		return err
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+
 	sha, err := repo.ObjectFind(ref, "", false)
 	if err != nil {
 		return err
 	}
 
 	if createTagObject {
-		tag := &GitTag{}
+		objType := "commit"
+		if obj, err := repo.ObjectRead(sha); err == nil {
+			if objFmt, err := obj.GetFmt(); err == nil {
+				objType = string(objFmt)
+			}
+		}
+
+		tagger := "wyag <wyag@example.com>"
+		if config, err := GitConfigRead(); err == nil {
+			if user := GitConfigUserGet(config); user != "" {
+				tagger = user
+			}
+		}
+
+		tag := &GitTag{Fmt: "tag"}
 		tag.Kvlm = sharedtypes.NewKvlm()
-		tag.Kvlm.InsertAndSort("object", [][]byte{[]byte(sha)})
-		tag.Kvlm.InsertAndSort("type", [][]byte{[]byte("commit")})
-		tag.Kvlm.InsertAndSort("tag", [][]byte{[]byte(name)})
-		tag.Kvlm.InsertAndSort("tagger", [][]byte{[]byte("test test@example.com")})
-		tag.Kvlm.InsertAndSort("", [][]byte{[]byte("A tag generated by wyag, which won't let you customize the message!")})
+		tag.Kvlm.Insert("object", [][]byte{[]byte(sha)})
+		tag.Kvlm.Insert("type", [][]byte{[]byte(objType)})
+		tag.Kvlm.Insert("tag", [][]byte{[]byte(name)})
+		tag.Kvlm.Insert("tagger", [][]byte{[]byte(tagger + " " + FormatSignatureTime(time.Now()))})
+		tag.Kvlm.Insert("", [][]byte{[]byte("A tag generated by wyag, which won't let you customize the message!\n")})
 
 		tagSha, err := ObjectWrite(tag, repo)
 		if err != nil {
@@ -493,16 +585,11 @@ func (repo *Repository) TagCreate(name string, ref string, createTagObject bool)
 }
 
 func (repo *Repository) RefCreate(refName string, sha string) error {
-	fileName, err := repo.RepoFile(true, "refs/"+refName)
-	if err != nil {
+	if _, err := CheckRefFormat("refs/"+refName, RefFormatOptions{}); err != nil {
 		return err
 	}
 
-	file, err := os.Create(fileName)
-	defer file.Close()
-
-	file.Write([]byte(sha + "\n"))
-	return nil
+	return repo.Refs.Write("refs/"+refName, RefValue{Sha: sha})
 }
 
 func (repo *Repository) ObjectResolve(name string) ([]string, error) {
@@ -510,10 +597,8 @@ func (repo *Repository) ObjectResolve(name string) ([]string, error) {
 		return []string{}, fmt.Errorf("name is empty\n")
 	}
 
-	candidates := []string{}
-
-	if name == "HEAD" {
-		res, err := repo.RefResolve(name)
+	if ref := repo.RefDwim(name); ref != "" {
+		res, err := repo.RefResolve(ref)
 		if err != nil {
 			return []string{}, err
 		}
@@ -521,13 +606,14 @@ func (repo *Repository) ObjectResolve(name string) ([]string, error) {
 		return []string{res}, nil
 	}
 
+	candidates := []string{}
+
 	lenName := len(name)
 	if lenName < 4 || lenName > 40 {
 		return []string{}, fmt.Errorf("len name is not valid must be 4 < %d < 40 name:%s\n", lenName, name)
 	}
 
-	_, err := hex.DecodeString(name)
-	if err == nil {
+	if isHexString(name) {
 		name = strings.ToLower(name)
 		prefix := name[:2]
 		path, err := repo.RepoDir(false, "objects", prefix)
@@ -548,16 +634,6 @@ func (repo *Repository) ObjectResolve(name string) ([]string, error) {
 		}
 	}
 
-	asTag, err := repo.RefResolve("refs/tags/" + name)
-	if err == nil {
-		candidates = append(candidates, asTag)
-	}
-
-	asBranch, err := repo.RefResolve("refs/heads/" + name)
-	if err == nil {
-		candidates = append(candidates, asBranch)
-	}
-
 	return candidates, nil
 }
 
@@ -574,11 +650,7 @@ func FindRepo(path string, required bool) (*Repository, error) {
 	}
 
 	info, err := os.Stat(filepath.Join(path, ".git"))
-	if err != nil {
-		return nil, err
-	}
-
-	if info.IsDir() {
+	if err == nil && info.IsDir() {
 		repo, err := NewRepository(path, false)
 		if err != nil {
 			return nil, err
@@ -596,5 +668,5 @@ func FindRepo(path string, required bool) (*Repository, error) {
 		return nil, fmt.Errorf("No git direcotory but not required")
 	}
 
-	return FindRepo(path, required)
+	return FindRepo(parent, required)
 }
@@ -0,0 +1,569 @@
+package repository
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type WalkCommit struct {
+	Sha     string
+	Parents []string
+	Commit  *GitCommit
+	Date    time.Time
+}
+
+type RevWalkOptions struct {
+	All            bool
+	MaxCount       int
+	Order          string
+	Reverse        bool
+	FirstParent    bool
+	Since          time.Time
+	Until          time.Time
+	Paths          []string
+	FullHistory    bool
+	Follow         bool
+	RewriteParents bool
+}
+
+type RevWalker struct {
+	repo    *Repository
+	Opts    RevWalkOptions
+	include []string
+	exclude []string
+	commits map[string]*WalkCommit
+	shown   map[string]bool
+
+	uninteresting map[string]bool
+	treesame      map[string]bool
+	entries       map[string]string
+	followPath    string
+	hidden        map[string]bool
+}
+
+func (repo *Repository) NewRevWalker(opts RevWalkOptions) *RevWalker {
+	/*
+		opts.MaxCount: default val is -1, no limit
+		opts.Order: default val is "", commit date order, "date" and "topo" never show a parent before its children
+		opts.Paths: default val is [], only commits changing one of the paths, merges are simplified
+		unless opts.FullHistory, opts.Follow tracks renames of a single file instead
+		opts.RewriteParents: default val is false, the parents of shown commits skip the hidden ones
+	*/
+	return &RevWalker{
+		repo:          repo,
+		Opts:          opts,
+		commits:       map[string]*WalkCommit{},
+		shown:         map[string]bool{},
+		uninteresting: map[string]bool{},
+		treesame:      map[string]bool{},
+		entries:       map[string]string{},
+		hidden:        map[string]bool{},
+	}
+}
+
+func (w *RevWalker) Commit(sha string) (*WalkCommit, error) {
+	if c, ok := w.commits[sha]; ok {
+		return c, nil
+	}
+
+	commit, err := w.repo.CommitRead(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &WalkCommit{Sha: sha, Commit: commit}
+	for _, p := range (*(*commit.Kvlm).Map)["parent"] {
+		c.Parents = append(c.Parents, string(p))
+	}
+	if committer, ok := (*(*commit.Kvlm).Map)["committer"]; ok && len(committer) > 0 {
+		if sig, err := ParseSignature(committer[0]); err == nil {
+			c.Date = sig.When
+		}
+	}
+
+	w.commits[sha] = c
+	return c, nil
+}
+
+func (w *RevWalker) Parents(c *WalkCommit) []string {
+	if w.Opts.FirstParent && len(c.Parents) > 1 {
+		return c.Parents[:1]
+	}
+
+	return c.Parents
+}
+
+func (w *RevWalker) resolve(spec string) (string, error) {
+	if spec == "" {
+		spec = "HEAD"
+	}
+
+	return w.repo.ObjectFind(spec, "commit", true)
+}
+
+func (w *RevWalker) Include(sha string) {
+	w.include = append(w.include, sha)
+}
+
+func (w *RevWalker) Exclude(sha string) {
+	w.exclude = append(w.exclude, sha)
+}
+
+func (w *RevWalker) AddRevision(spec string) error {
+	/*
+		accepts <rev>, ^<rev>, <a>..<b> and <a>...<b>, an empty side of a range means HEAD
+	*/
+	if strings.HasPrefix(spec, "^") && !strings.Contains(spec, "..") {
+		sha, err := w.resolve(spec[1:])
+		if err != nil {
+			return err
+		}
+
+		w.Exclude(sha)
+		return nil
+	}
+
+	if left, right, ok := strings.Cut(spec, "..."); ok {
+		a, err := w.resolve(left)
+		if err != nil {
+			return err
+		}
+		b, err := w.resolve(right)
+		if err != nil {
+			return err
+		}
+
+		bases, err := w.repo.MergeBases(a, b)
+		if err != nil {
+			return err
+		}
+
+		w.Include(a)
+		w.Include(b)
+		for _, base := range bases {
+			w.Exclude(base)
+		}
+		return nil
+	}
+
+	if left, right, ok := strings.Cut(spec, ".."); ok {
+		a, err := w.resolve(left)
+		if err != nil {
+			return err
+		}
+		b, err := w.resolve(right)
+		if err != nil {
+			return err
+		}
+
+		w.Exclude(a)
+		w.Include(b)
+		return nil
+	}
+
+	sha, err := w.resolve(spec)
+	if err != nil {
+		return err
+	}
+
+	w.Include(sha)
+	return nil
+}
+
+func (w *RevWalker) addAll() error {
+	if sha, err := w.repo.ObjectFind("HEAD", "commit", true); err == nil {
+		w.Include(sha)
+	}
+
+	refs, err := w.repo.RefListFlat("refs/")
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		sha, err := w.repo.ObjectPeelTo(ref.Sha, "commit")
+		if err != nil {
+			continue
+		}
+		w.Include(sha)
+	}
+
+	return nil
+}
+
+func (w *RevWalker) Uninteresting() (map[string]bool, error) {
+	/*
+		every commit reachable from an excluded commit, all parents are followed
+	*/
+	ret := map[string]bool{}
+	queue := slices.Clone(w.exclude)
+
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+
+		if ret[sha] {
+			continue
+		}
+		ret[sha] = true
+
+		c, err := w.Commit(sha)
+		if err != nil {
+			return ret, err
+		}
+		queue = append(queue, c.Parents...)
+	}
+
+	return ret, nil
+}
+
+type walkQueueItem struct {
+	commit *WalkCommit
+	seq    int
+}
+
+type walkQueue []walkQueueItem
+
+func (q walkQueue) Len() int { return len(q) }
+func (q walkQueue) Less(i, j int) bool {
+	if !q[i].commit.Date.Equal(q[j].commit.Date) {
+		return q[i].commit.Date.After(q[j].commit.Date)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q walkQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *walkQueue) Push(x any)   { *q = append(*q, x.(walkQueueItem)) }
+func (q *walkQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+func (w *RevWalker) dateWalk(uninteresting map[string]bool) ([]*WalkCommit, error) {
+	/*
+		pops the newest commit first, like git does without any ordering option
+	*/
+	ret := []*WalkCommit{}
+	seen := map[string]bool{}
+	queue := &walkQueue{}
+	seq := 0
+
+	push := func(sha string) error {
+		if seen[sha] || uninteresting[sha] {
+			return nil
+		}
+		seen[sha] = true
+
+		c, err := w.Commit(sha)
+		if err != nil {
+			return err
+		}
+
+		heap.Push(queue, walkQueueItem{commit: c, seq: seq})
+		seq++
+		return nil
+	}
+
+	for _, sha := range w.include {
+		if err := push(sha); err != nil {
+			return ret, err
+		}
+	}
+
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(walkQueueItem).commit
+		ret = append(ret, c)
+
+		if w.prune() {
+			if err := w.simplify(c); err != nil {
+				return ret, err
+			}
+		}
+
+		for _, p := range w.Parents(c) {
+			if err := push(p); err != nil {
+				return ret, err
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+func (w *RevWalker) topoSort(commits []*WalkCommit) []*WalkCommit {
+	/*
+		"date" picks the newest commit whose children were all shown,
+		"topo" keeps going down the line it is on (lifo), which keeps branches together,
+		like git all parents count even with FirstParent
+	*/
+	indegree := map[string]int{}
+	for _, c := range commits {
+		indegree[c.Sha] += 0
+	}
+	for _, c := range commits {
+		for _, p := range c.Parents {
+			if _, ok := indegree[p]; ok {
+				indegree[p]++
+			}
+		}
+	}
+
+	ret := []*WalkCommit{}
+	if w.Opts.Order == "date" {
+		queue := &walkQueue{}
+		seq := 0
+		for _, c := range commits {
+			if indegree[c.Sha] == 0 {
+				heap.Push(queue, walkQueueItem{commit: c, seq: seq})
+				seq++
+			}
+		}
+
+		for queue.Len() > 0 {
+			c := heap.Pop(queue).(walkQueueItem).commit
+			ret = append(ret, c)
+
+			for _, p := range c.Parents {
+				if _, ok := indegree[p]; !ok {
+					continue
+				}
+				indegree[p]--
+				if indegree[p] == 0 {
+					heap.Push(queue, walkQueueItem{commit: w.commits[p], seq: seq})
+					seq++
+				}
+			}
+		}
+
+		return ret
+	}
+
+	stack := []*WalkCommit{}
+	for i := len(commits) - 1; i >= 0; i-- {
+		if indegree[commits[i].Sha] == 0 {
+			stack = append(stack, commits[i])
+		}
+	}
+
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ret = append(ret, c)
+
+		for _, p := range c.Parents {
+			if _, ok := indegree[p]; !ok {
+				continue
+			}
+			indegree[p]--
+			if indegree[p] == 0 {
+				stack = append(stack, w.commits[p])
+			}
+		}
+	}
+
+	return ret
+}
+
+func (w *RevWalker) Walk() ([]*WalkCommit, error) {
+	if w.Opts.All {
+		if err := w.addAll(); err != nil {
+			return []*WalkCommit{}, err
+		}
+	}
+
+	if w.Opts.Follow && len(w.Opts.Paths) != 1 {
+		return []*WalkCommit{}, fmt.Errorf("--follow requires exactly one pathspec\n")
+	}
+	if w.Opts.Follow {
+		w.followPath = w.Opts.Paths[0]
+	}
+
+	uninteresting, err := w.Uninteresting()
+	if err != nil {
+		return []*WalkCommit{}, err
+	}
+	w.uninteresting = uninteresting
+
+	commits, err := w.dateWalk(uninteresting)
+	if err != nil {
+		return []*WalkCommit{}, err
+	}
+
+	if w.Opts.Order == "date" || w.Opts.Order == "topo" {
+		commits = w.topoSort(commits)
+	} else if w.Opts.Order != "" {
+		return []*WalkCommit{}, fmt.Errorf("unknown commit order %s\n", w.Opts.Order)
+	}
+
+	ret := []*WalkCommit{}
+	visible := 0
+	for _, c := range commits {
+		if !w.Opts.Since.IsZero() && c.Date.Before(w.Opts.Since) {
+			continue
+		}
+		if !w.Opts.Until.IsZero() && c.Date.After(w.Opts.Until) {
+			continue
+		}
+		if w.prune() && !w.pruneShow(c) {
+			continue
+		}
+		if w.Opts.Follow {
+			show, err := w.followShow(c)
+			if err != nil {
+				return []*WalkCommit{}, err
+			}
+			w.hidden[c.Sha] = !show
+		}
+
+		w.shown[c.Sha] = true
+		if w.Opts.MaxCount < 0 || visible < w.Opts.MaxCount {
+			ret = append(ret, c)
+			if !w.hidden[c.Sha] {
+				visible++
+			}
+		}
+	}
+
+	if w.prune() && w.Opts.RewriteParents {
+		for _, c := range commits {
+			if w.shown[c.Sha] {
+				w.rewriteParents(c)
+			}
+		}
+	}
+
+	if w.Opts.Reverse {
+		slices.Reverse(ret)
+	}
+
+	return ret, nil
+}
+
+func (w *RevWalker) Interesting(sha string) bool {
+	/*
+		whether the last Walk selected the commit, including the ones cut off by MaxCount
+	*/
+	return w.shown[sha]
+}
+
+func (w *RevWalker) Hidden(sha string) bool {
+	/*
+		with Follow the walk keeps every commit, like git, but the ones not touching the
+		followed file are not printed
+	*/
+	return w.hidden[sha]
+}
+
+func (w *RevWalker) ParentsOf(sha string) []string {
+	c, err := w.Commit(sha)
+	if err != nil {
+		return []string{}
+	}
+
+	return w.Parents(c)
+}
+
+type WalkObject struct {
+	Sha  string
+	Path string
+}
+
+func (w *RevWalker) treeObjects(sha string, path string, seen map[string]bool, ret *[]WalkObject) error {
+	if seen[sha] {
+		return nil
+	}
+	seen[sha] = true
+
+	if ret != nil {
+		*ret = append(*ret, WalkObject{Sha: sha, Path: path})
+	}
+
+	obj, err := w.repo.ObjectRead(sha)
+	if err != nil {
+		return err
+	}
+
+	tree, ok := obj.(*GitTree)
+	if !ok {
+		return fmt.Errorf("expected tree for sha:%s\n", sha)
+	}
+
+	for _, leaf := range tree.Items {
+		fullPath := leaf.Path
+		if path != "" {
+			fullPath = path + "/" + leaf.Path
+		}
+
+		switch string(leaf.Mode[:2]) {
+		case "04":
+			if err := w.treeObjects(leaf.Sha, fullPath, seen, ret); err != nil {
+				return err
+			}
+		case "16":
+		default:
+			if seen[leaf.Sha] {
+				continue
+			}
+			seen[leaf.Sha] = true
+
+			if ret != nil {
+				*ret = append(*ret, WalkObject{Sha: leaf.Sha, Path: fullPath})
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *RevWalker) Objects(commits []*WalkCommit) ([]WalkObject, error) {
+	/*
+		the trees and blobs of the walked commits, objects already reachable from the
+		excluded side of the walk are left out
+	*/
+	uninteresting, err := w.Uninteresting()
+	if err != nil {
+		return []WalkObject{}, err
+	}
+
+	seen := map[string]bool{}
+	boundary := slices.Clone(w.exclude)
+	for _, c := range commits {
+		for _, p := range c.Parents {
+			if uninteresting[p] {
+				boundary = append(boundary, p)
+			}
+		}
+	}
+
+	for _, sha := range boundary {
+		c, err := w.Commit(sha)
+		if err != nil {
+			return []WalkObject{}, err
+		}
+		if err := w.treeObjects(commitTree(c.Commit), "", seen, nil); err != nil {
+			return []WalkObject{}, err
+		}
+	}
+
+	ret := []WalkObject{}
+	for _, c := range commits {
+		if err := w.treeObjects(commitTree(c.Commit), "", seen, &ret); err != nil {
+			return []WalkObject{}, err
+		}
+	}
+
+	return ret, nil
+}
+
+func commitTree(commit *GitCommit) string {
+	tree, ok := (*(*commit.Kvlm).Map)["tree"]
+	if !ok || len(tree) == 0 {
+		return ""
+	}
+
+	return string(tree[0])
+}
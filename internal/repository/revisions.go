@@ -0,0 +1,507 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func isHexString(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+func isPseudoRef(name string) bool {
+	if !strings.HasSuffix(name, "HEAD") {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (repo *Repository) RefDwim(name string) string {
+	/*
+		returns the full name of the ref name refers to following git's lookup rules,
+		or "" when no ref matches
+	*/
+	if name == "@" {
+		name = "HEAD"
+	}
+
+	rules := []string{"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD"}
+	for i, rule := range rules {
+		if i == 0 && !(strings.HasPrefix(name, "refs/") || isPseudoRef(name)) {
+			continue
+		}
+
+		full := fmt.Sprintf(rule, name)
+		if _, err := repo.RefResolve(full); err == nil {
+			return full
+		}
+	}
+
+	return ""
+}
+
+func (repo *Repository) ObjectAbbrev(sha string, minLen int) string {
+	/*
+		minLen: default val is 7
+		returns the shortest prefix of sha of at least minLen chars that is unique among loose objects
+	*/
+	if minLen <= 0 {
+		minLen = 7
+	}
+	if len(sha) <= minLen {
+		return sha
+	}
+
+	entries, err := os.ReadDir(repo.RepoPath("objects", sha[:2]))
+	if err != nil {
+		return sha[:minLen]
+	}
+
+	for n := minLen; n < len(sha); n++ {
+		unique := true
+		for _, e := range entries {
+			other := sha[:2] + e.Name()
+			if other != sha && strings.HasPrefix(other, sha[:n]) {
+				unique = false
+				break
+			}
+		}
+
+		if unique {
+			return sha[:n]
+		}
+	}
+
+	return sha
+}
+
+func revSplitPath(spec string) (string, string, bool) {
+	depth := 0
+	for i, c := range spec {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ':':
+			if depth == 0 {
+				return spec[:i], spec[i+1:], true
+			}
+		}
+	}
+
+	return spec, "", false
+}
+
+func revSplitSuffix(spec string) (string, string) {
+	depth := 0
+	for i, c := range spec {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '^', '~':
+			if depth == 0 {
+				return spec[:i], spec[i:]
+			}
+		}
+	}
+
+	return spec, ""
+}
+
+func (repo *Repository) TreePathLookup(treeSha string, path string) (GitTreeLeaf, error) {
+	path = strings.Trim(filepath.ToSlash(path), "/")
+	leaf := GitTreeLeaf{Mode: []byte("040000"), Path: "", Sha: treeSha}
+	if path == "" {
+		return leaf, nil
+	}
+
+	for _, part := range strings.Split(path, "/") {
+		if string(leaf.Mode[:2]) != "04" {
+			return GitTreeLeaf{}, fmt.Errorf("path '%s' does not exist in tree %s\n", path, treeSha)
+		}
+
+		obj, err := repo.ObjectRead(leaf.Sha)
+		if err != nil {
+			return GitTreeLeaf{}, err
+		}
+
+		tree, ok := obj.(*GitTree)
+		if !ok {
+			return GitTreeLeaf{}, fmt.Errorf("expected tree for sha:%s\n", leaf.Sha)
+		}
+
+		found := false
+		for _, item := range tree.Items {
+			if item.Path == part {
+				leaf = GitTreeLeaf{Mode: item.Mode, Path: item.Path, Sha: item.Sha}
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return GitTreeLeaf{}, fmt.Errorf("path '%s' does not exist in tree %s\n", path, treeSha)
+		}
+	}
+
+	leaf.Path = path
+	return leaf, nil
+}
+
+func (repo *Repository) ObjectPeelTo(sha string, fmtType string) (string, error) {
+	/*
+		fmtType: one of "", "object", "commit", "tree", "blob", "tag"
+		"" peels annotated tags, the rest follows tags and commits until the type is reached
+	*/
+	for {
+		obj, err := repo.ObjectRead(sha)
+		if err != nil {
+			return "", err
+		}
+
+		objFmt, err := obj.GetFmt()
+		if err != nil {
+			return "", err
+		}
+
+		if fmtType == "object" || string(objFmt) == fmtType {
+			return sha, nil
+		}
+
+		switch o := obj.(type) {
+		case *GitTag:
+			object := (*(*o.Kvlm).Map)["object"]
+			if len(object) == 0 {
+				return "", fmt.Errorf("tag without object sha:%s\n", sha)
+			}
+			sha = string(object[0])
+		case *GitCommit:
+			if fmtType != "tree" {
+				if fmtType == "" {
+					return sha, nil
+				}
+				return "", fmt.Errorf("object %s is a commit, not a %s\n", sha, fmtType)
+			}
+			tree := (*(*o.Kvlm).Map)["tree"]
+			if len(tree) == 0 {
+				return "", fmt.Errorf("commit without tree sha:%s\n", sha)
+			}
+			sha = string(tree[0])
+		default:
+			if fmtType == "" {
+				return sha, nil
+			}
+			return "", fmt.Errorf("object %s is a %s, not a %s\n", sha, string(objFmt), fmtType)
+		}
+	}
+}
+
+func (repo *Repository) previousBranch(n int) (string, error) {
+	entries, err := repo.ReflogRead("HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		message := entries[i].Message
+		if !strings.HasPrefix(message, "checkout: moving from ") {
+			continue
+		}
+
+		n--
+		if n == 0 {
+			from := strings.TrimPrefix(message, "checkout: moving from ")
+			from, _, _ = strings.Cut(from, " to ")
+			return from, nil
+		}
+	}
+
+	return "", fmt.Errorf("not enough branch switches in the HEAD reflog\n")
+}
+
+func (repo *Repository) revResolveBase(base string) (string, string, error) {
+	/*
+		returns the sha the base points to and the full ref name when it names a ref
+	*/
+	if base == "@" || base == "" {
+		base = "HEAD"
+	}
+
+	at := strings.Index(base, "@{")
+	if at == -1 || !strings.HasSuffix(base, "}") {
+		if ref := repo.RefDwim(base); ref != "" {
+			sha, err := repo.RefResolve(ref)
+			return sha, ref, err
+		}
+
+		candidates, err := repo.ObjectResolve(base)
+		if err != nil {
+			return "", "", err
+		}
+		if len(candidates) != 1 {
+			return "", "", fmt.Errorf("ambiguous argument '%s': %d candidates\n", base, len(candidates))
+		}
+
+		return candidates[0], "", nil
+	}
+
+	name := base[:at]
+	selector := base[at+2 : len(base)-1]
+
+	if strings.HasPrefix(selector, "-") {
+		if name != "" {
+			return "", "", fmt.Errorf("%s: @{-N} can not be combined with a ref\n", base)
+		}
+
+		n, err := strconv.Atoi(selector[1:])
+		if err != nil || n <= 0 {
+			return "", "", fmt.Errorf("invalid previous branch selector %s\n", base)
+		}
+
+		branch, err := repo.previousBranch(n)
+		if err != nil {
+			return "", "", err
+		}
+
+		return repo.revResolveBase(branch)
+	}
+
+	if name == "" || (name == "HEAD" && !isNumeric(selector)) {
+		branch, err := repo.GetActiveBranch()
+		if err != nil {
+			return "", "", err
+		}
+
+		switch {
+		case branch != "":
+			name = branch
+		case isNumeric(selector):
+			name = "HEAD"
+		default:
+			return "", "", fmt.Errorf("HEAD does not point to a branch\n")
+		}
+	}
+
+	ref := repo.RefDwim(name)
+	if ref == "" {
+		return "", "", fmt.Errorf("unknown ref %s\n", name)
+	}
+
+	switch {
+	case selector == "u" || selector == "upstream" || selector == "push":
+		if !strings.HasPrefix(ref, "refs/heads/") {
+			return "", "", fmt.Errorf("%s is not a branch\n", name)
+		}
+
+		upstream := repo.BranchUpstream(strings.TrimPrefix(ref, "refs/heads/"))
+		if upstream == "" {
+			return "", "", fmt.Errorf("no upstream configured for branch '%s'\n", strings.TrimPrefix(ref, "refs/heads/"))
+		}
+
+		sha, err := repo.RefResolve(upstream)
+		return sha, upstream, err
+	case isNumeric(selector):
+		n, _ := strconv.Atoi(selector)
+		entries, err := repo.ReflogRead(ref)
+		if err != nil {
+			return "", "", err
+		}
+		if n >= len(entries) {
+			return "", "", fmt.Errorf("log for '%s' only has %d entries\n", name, len(entries))
+		}
+
+		return entries[len(entries)-1-n].New, "", nil
+	default:
+		return "", "", fmt.Errorf("unsupported selector @{%s}\n", selector)
+	}
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func (repo *Repository) revApplySuffix(sha string, suffix string) (string, error) {
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+
+		if op == '^' && strings.HasPrefix(suffix, "{") {
+			end := strings.IndexByte(suffix, '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated ^{ in revision\n")
+			}
+
+			peelType := suffix[1:end]
+			suffix = suffix[end+1:]
+
+			var err error
+			sha, err = repo.ObjectPeelTo(sha, peelType)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(suffix[:digits])
+		}
+		suffix = suffix[digits:]
+
+		commit, err := repo.ObjectPeelTo(sha, "commit")
+		if err != nil {
+			return "", err
+		}
+		sha = commit
+
+		if op == '^' {
+			if n == 0 {
+				continue
+			}
+
+			parents, err := repo.CommitParents(sha)
+			if err != nil {
+				return "", err
+			}
+			if n > len(parents) {
+				return "", fmt.Errorf("commit %s has no parent %d\n", sha, n)
+			}
+
+			sha = parents[n-1]
+			continue
+		}
+
+		for range n {
+			parents, err := repo.CommitParents(sha)
+			if err != nil {
+				return "", err
+			}
+			if len(parents) == 0 {
+				return "", fmt.Errorf("commit %s has no parent\n", sha)
+			}
+
+			sha = parents[0]
+		}
+	}
+
+	return sha, nil
+}
+
+func (repo *Repository) RevParse(spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return "", fmt.Errorf("empty revision\n")
+	}
+
+	if strings.HasPrefix(spec, ":") {
+		stage := 0
+		path := spec[1:]
+		if len(path) > 2 && path[0] >= '0' && path[0] <= '3' && path[1] == ':' {
+			stage = int(path[0] - '0')
+			path = path[2:]
+		}
+
+		index, err := repo.IndexRead()
+		if err != nil {
+			return "", err
+		}
+
+		for _, e := range index.Entries {
+			if e.Name == path && int(e.FlagStage) == stage {
+				return e.Sha, nil
+			}
+		}
+
+		return "", fmt.Errorf("path '%s' is not in the index at stage %d\n", path, stage)
+	}
+
+	rev, path, hasPath := revSplitPath(spec)
+	if hasPath {
+		sha, err := repo.RevParse(rev)
+		if err != nil {
+			return "", err
+		}
+
+		tree, err := repo.ObjectPeelTo(sha, "tree")
+		if err != nil {
+			return "", err
+		}
+
+		leaf, err := repo.TreePathLookup(tree, path)
+		if err != nil {
+			return "", err
+		}
+
+		return leaf.Sha, nil
+	}
+
+	base, suffix := revSplitSuffix(spec)
+	sha, _, err := repo.revResolveBase(base)
+	if err != nil {
+		return "", err
+	}
+
+	return repo.revApplySuffix(sha, suffix)
+}
+
+func (repo *Repository) RevParseAbbrevRef(spec string) (string, error) {
+	/*
+		returns the short name of the ref spec names, "HEAD" when HEAD is detached
+	*/
+	base, suffix := revSplitSuffix(spec)
+	if suffix != "" {
+		return "", fmt.Errorf("%s does not name a ref\n", spec)
+	}
+
+	if base == "@" || base == "HEAD" {
+		branch, err := repo.GetActiveBranch()
+		if err != nil {
+			return "", err
+		}
+		if branch == "" {
+			return "HEAD", nil
+		}
+		return branch, nil
+	}
+
+	_, ref, err := repo.revResolveBase(base)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return "", fmt.Errorf("%s does not name a ref\n", spec)
+	}
+	if strings.HasPrefix(ref, "refs/remotes/") && strings.HasSuffix(ref, "/HEAD") {
+		target, err := repo.SymbolicRefRead(ref)
+		if err == nil {
+			ref = target
+		}
+	}
+
+	return RefShortName(ref), nil
+}
@@ -0,0 +1,660 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neet-007/git_in_go/internal/diff"
+	"gopkg.in/ini.v1"
+)
+
+var PickConflict = errors.New("PickConflict")
+
+type SequencerOptions struct {
+	Revert       bool
+	RecordOrigin bool
+	NoCommit     bool
+	Mainline     int
+	Tree         MergeTreeOptions
+}
+
+type sequencerItem struct {
+	action string
+	sha    string
+}
+
+func (opts SequencerOptions) action() string {
+	if opts.Revert {
+		return "revert"
+	}
+
+	return "cherry-pick"
+}
+
+func (repo *Repository) pickHead() (string, string) {
+	/*
+		the commit a stopped cherry-pick or revert was applying and which of the two it was
+	*/
+	for _, name := range []string{"CHERRY_PICK_HEAD", "REVERT_HEAD"} {
+		if data, err := os.ReadFile(repo.RepoPath(name)); err == nil {
+			action := "cherry-pick"
+			if name == "REVERT_HEAD" {
+				action = "revert"
+			}
+			return strings.TrimSpace(string(data)), action
+		}
+	}
+
+	return "", ""
+}
+
+func (repo *Repository) pickStateClear() error {
+	for _, name := range []string{"CHERRY_PICK_HEAD", "REVERT_HEAD"} {
+		if err := os.Remove(repo.RepoPath(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *Repository) sequencerActive() bool {
+	_, err := os.Stat(repo.RepoPath("sequencer", "todo"))
+	return err == nil
+}
+
+func (repo *Repository) sequencerWrite(head string, todo []sequencerItem, opts SequencerOptions) error {
+	/*
+		the same files as git's .git/sequencer, head is where --abort goes back to
+	*/
+	if _, err := repo.RepoDir(true, "sequencer"); err != nil {
+		return err
+	}
+
+	if head != "" {
+		if err := os.WriteFile(repo.RepoPath("sequencer", "head"), []byte(head+"\n"), 0644); err != nil {
+			return err
+		}
+
+		config := ini.Empty()
+		section := config.Section("options")
+		if opts.RecordOrigin {
+			section.Key("record-origin").SetValue("true")
+		}
+		if opts.NoCommit {
+			section.Key("no-commit").SetValue("true")
+		}
+		if opts.Mainline > 0 {
+			section.Key("mainline").SetValue(strconv.Itoa(opts.Mainline))
+		}
+		if err := config.SaveTo(repo.RepoPath("sequencer", "opts")); err != nil {
+			return err
+		}
+	}
+
+	var b strings.Builder
+	for _, item := range todo {
+		commit, err := repo.CommitRead(item.sha)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", strings.TrimPrefix(item.action, "cherry-"), repo.ObjectAbbrev(item.sha, 7), MessageSubject(objectMessage(commit)))
+	}
+
+	if current, err := repo.RefResolve("HEAD"); err == nil {
+		if err := os.WriteFile(repo.RepoPath("sequencer", "abort-safety"), []byte(current+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(repo.RepoPath("sequencer", "todo"), []byte(b.String()), 0644)
+}
+
+func (repo *Repository) sequencerRead() (string, []sequencerItem, SequencerOptions, error) {
+	opts := SequencerOptions{}
+
+	head, err := os.ReadFile(repo.RepoPath("sequencer", "head"))
+	if err != nil {
+		return "", nil, opts, err
+	}
+
+	if config, err := ini.Load(repo.RepoPath("sequencer", "opts")); err == nil {
+		section := config.Section("options")
+		opts.RecordOrigin = section.Key("record-origin").MustBool(false)
+		opts.NoCommit = section.Key("no-commit").MustBool(false)
+		opts.Mainline = section.Key("mainline").MustInt(0)
+	}
+
+	data, err := os.ReadFile(repo.RepoPath("sequencer", "todo"))
+	if err != nil {
+		return "", nil, opts, err
+	}
+
+	todo := []sequencerItem{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		action := fields[0]
+		switch action {
+		case "pick", "p":
+			action = "cherry-pick"
+		case "revert":
+		default:
+			return "", nil, opts, fmt.Errorf("invalid line in sequencer todo: %s\n", line)
+		}
+
+		sha, err := repo.ObjectFind(fields[1], "commit", true)
+		if err != nil {
+			return "", nil, opts, err
+		}
+		todo = append(todo, sequencerItem{action: action, sha: sha})
+	}
+
+	return strings.TrimSpace(string(head)), todo, opts, nil
+}
+
+func (repo *Repository) sequencerClear() error {
+	return os.RemoveAll(repo.RepoPath("sequencer"))
+}
+
+func (repo *Repository) PickCommits(revs []string, reverse bool) ([]string, error) {
+	/*
+		revs are single commits picked in order unless one of them is a range or an
+		exclusion, then they are walked like rev-list, oldest first when reverse
+	*/
+	walk := false
+	for _, rev := range revs {
+		if strings.Contains(rev, "..") || strings.HasPrefix(rev, "^") {
+			walk = true
+		}
+	}
+
+	ret := []string{}
+	if !walk {
+		for _, rev := range revs {
+			sha, err := repo.ObjectFind(rev, "commit", true)
+			if err != nil {
+				return []string{}, fmt.Errorf("bad revision '%s'\n", rev)
+			}
+			ret = append(ret, sha)
+		}
+		return ret, nil
+	}
+
+	w := repo.NewRevWalker(RevWalkOptions{MaxCount: -1, Reverse: reverse})
+	for _, rev := range revs {
+		if err := w.AddRevision(rev); err != nil {
+			return []string{}, err
+		}
+	}
+
+	commits, err := w.Walk()
+	if err != nil {
+		return []string{}, err
+	}
+	for _, c := range commits {
+		ret = append(ret, c.Sha)
+	}
+	if len(ret) == 0 {
+		return ret, fmt.Errorf("empty commit set passed\n")
+	}
+
+	return ret, nil
+}
+
+func commitParents(commit *GitCommit) []string {
+	ret := []string{}
+	for _, p := range (*(*commit.Kvlm).Map)["parent"] {
+		ret = append(ret, string(p))
+	}
+
+	return ret
+}
+
+func (repo *Repository) pickMessage(sha string, commit *GitCommit, parent string, opts SequencerOptions) string {
+	/*
+		the original message for a cherry-pick, with -x the origin goes after it like a
+		trailer, and git's "Revert" message for a revert
+	*/
+	message := objectMessage(commit)
+	if opts.Revert {
+		message = fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", MessageSubject(message), sha)
+		if opts.Mainline > 0 {
+			message += fmt.Sprintf(", reversing\nchanges made to %s", parent)
+		}
+		return message + ".\n"
+	}
+
+	if !opts.RecordOrigin {
+		return message
+	}
+
+	message = strings.TrimRight(message, "\n") + "\n"
+	if len(MessageTrailers(message)) == 0 {
+		message += "\n"
+	}
+	return message + fmt.Sprintf("(cherry picked from commit %s)\n", sha)
+}
+
+type pickApplied struct {
+	commit     *GitCommit
+	parent     string
+	head       string
+	baseTree   string
+	oursTree   string
+	theirsTree string
+	result     *MergeTreeResult
+}
+
+func (repo *Repository) pickApply(w io.Writer, action string, sha string, opts SequencerOptions) (*pickApplied, error) {
+	/*
+		applies the change of sha, or its inverse for a revert, to the index and the worktree
+		with a three-way merge against its parent and prints the merge messages
+	*/
+	commit, err := repo.CommitRead(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := commitParents(commit)
+	p := &pickApplied{commit: commit}
+	switch {
+	case opts.Mainline > 0 && len(parents) < 2:
+		return nil, fmt.Errorf("mainline was specified but commit %s is not a merge.\n", sha)
+	case opts.Mainline > len(parents):
+		return nil, fmt.Errorf("commit %s does not have parent %d\n", sha, opts.Mainline)
+	case opts.Mainline > 0:
+		p.parent = parents[opts.Mainline-1]
+	case len(parents) > 1:
+		return nil, fmt.Errorf("commit %s is a merge but no -m option was given.\n", sha)
+	case len(parents) == 1:
+		p.parent = parents[0]
+	}
+
+	if p.parent != "" {
+		parentCommit, err := repo.CommitRead(p.parent)
+		if err != nil {
+			return nil, err
+		}
+		p.baseTree = commitTree(parentCommit)
+	}
+	p.theirsTree = commitTree(commit)
+
+	label := fmt.Sprintf("%s (%s)", repo.ObjectAbbrev(sha, 7), MessageSubject(objectMessage(commit)))
+	tree := opts.Tree
+	tree.OursLabel, tree.TheirsLabel, tree.BaseLabel = "HEAD", label, "parent of "+label
+	if action == "revert" {
+		p.baseTree, p.theirsTree = p.theirsTree, p.baseTree
+		tree.TheirsLabel, tree.BaseLabel = tree.BaseLabel, tree.TheirsLabel
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return nil, err
+	}
+	if p.oursTree, err = repo.TreeFromIndex(index); err != nil {
+		return nil, err
+	}
+
+	if head, err := repo.RefResolve("HEAD"); err == nil {
+		p.head = head
+	}
+	if !opts.NoCommit && p.head != "" {
+		headCommit, err := repo.CommitRead(p.head)
+		if err != nil {
+			return nil, err
+		}
+		if commitTree(headCommit) != p.oursTree {
+			return nil, fmt.Errorf("your local changes would be overwritten by %s.\nhint: commit your changes or stash them to proceed.\n", action)
+		}
+	}
+
+	if p.result, err = repo.MergeTrees(p.baseTree, p.oursTree, p.theirsTree, tree); err != nil {
+		return nil, err
+	}
+
+	from := p.oursTree
+	if len(index.Entries) == 0 {
+		from = ""
+	}
+	if err := repo.WorktreeMerge(from, p.result); err != nil {
+		return nil, err
+	}
+
+	for _, message := range p.result.Messages {
+		fmt.Fprintf(w, "%s\n", message)
+	}
+
+	return p, nil
+}
+
+func commitAuthor(commit *GitCommit) string {
+	return string((*(*commit.Kvlm).Map)["author"][0])
+}
+
+func (repo *Repository) pickOne(w io.Writer, action string, sha string, opts SequencerOptions) error {
+	/*
+		picks sha and commits it with the original author unless opts.NoCommit
+	*/
+	p, err := repo.pickApply(w, action, sha, opts)
+	if err != nil {
+		return err
+	}
+	commit, result := p.commit, p.result
+
+	pickHead, verb := "CHERRY_PICK_HEAD", "apply"
+	if action == "revert" {
+		pickHead, verb = "REVERT_HEAD", "revert"
+	}
+
+	message := repo.pickMessage(sha, commit, p.parent, opts)
+	if !result.Clean() {
+		if !opts.NoCommit {
+			if err := os.WriteFile(repo.RepoPath(pickHead), []byte(sha+"\n"), 0644); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(repo.RepoPath("MERGE_MSG"), []byte(mergeConflictsMessage(message, result)), 0644); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "error: could not %s %s... %s\n", verb, repo.ObjectAbbrev(sha, 7), MessageSubject(objectMessage(commit)))
+		return PickConflict
+	}
+
+	if opts.NoCommit {
+		return os.WriteFile(repo.RepoPath("MERGE_MSG"), []byte(message), 0644)
+	}
+
+	resultTree, err := repo.MergeTreeWrite(result)
+	if err != nil {
+		return err
+	}
+	if resultTree == p.oursTree && p.baseTree != p.theirsTree {
+		if action == "cherry-pick" {
+			if err := os.WriteFile(repo.RepoPath(pickHead), []byte(sha+"\n"), 0644); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(repo.RepoPath("MERGE_MSG"), []byte(message), 0644); err != nil {
+			return err
+		}
+		return fmt.Errorf("The previous %s is now empty, possibly due to conflict resolution.\nUse '%s --skip' to skip this commit.\n", action, action)
+	}
+
+	user, err := repo.UserIdent()
+	if err != nil {
+		return err
+	}
+	committer := fmt.Sprintf("%s %s", user, FormatSignatureTime(time.Now()))
+	author := committer
+	if action == "cherry-pick" {
+		author = commitAuthor(commit)
+	}
+
+	parentsNew := []string{}
+	if p.head != "" {
+		parentsNew = append(parentsNew, p.head)
+	}
+
+	created, err := repo.CommitCreateAuthored(resultTree, parentsNew, author, committer, message)
+	if err != nil {
+		return err
+	}
+	if err := repo.HeadUpdate(created, fmt.Sprintf("%s: %s", action, MessageSubject(message))); err != nil {
+		return err
+	}
+
+	return repo.CommitSummaryWrite(w, created)
+}
+
+func (repo *Repository) CommitSummaryWrite(w io.Writer, sha string) error {
+	/*
+		git's print_commit_summary as after a cherry-pick, the author when it is not the
+		committer, the author date and a shortstat with the summary against the first parent
+	*/
+	return repo.commitSummaryWrite(w, sha, true)
+}
+
+func (repo *Repository) commitSummaryWrite(w io.Writer, sha string, date bool) error {
+	/*
+		date: git commit only shows the author date when it was taken from another commit
+	*/
+	commit, err := repo.CommitRead(sha)
+	if err != nil {
+		return err
+	}
+
+	branch, err := repo.GetActiveBranch()
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		branch = "detached HEAD"
+	}
+
+	parents := commitParents(commit)
+	if len(parents) == 0 {
+		branch += " (root-commit)"
+	}
+
+	message := objectMessage(commit)
+	author, committer := commitSignature(commit, "author"), commitSignature(commit, "committer")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s %s] %s\n", branch, repo.ObjectAbbrev(sha, 7), MessageSubject(message))
+	if author.Name != committer.Name || author.Email != committer.Email {
+		fmt.Fprintf(&b, " Author: %s <%s>\n", author.Name, author.Email)
+	}
+	if date {
+		fmt.Fprintf(&b, " Date: %s\n", FormatDate(author.When, "default"))
+	}
+
+	pairs, err := repo.commitDiffPairs(&WalkCommit{Sha: sha, Parents: parents, Commit: commit}, DiffOptions{Renames: true, RenameScore: DefaultRenameScore})
+	if err != nil {
+		return err
+	}
+
+	adds, dels := 0, 0
+	for _, pair := range pairs {
+		stat, err := repo.diffStatOf(pair, diff.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		adds += stat.added
+		dels += stat.deleted
+	}
+	fmt.Fprintf(&b, "%s\n", diffStatSummary(len(pairs), adds, dels))
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+
+	return DiffWriteSummary(w, pairs)
+}
+
+func (repo *Repository) sequencerRun(w io.Writer, todo []sequencerItem, opts SequencerOptions) error {
+	/*
+		picks the items in order, the rest is saved for --continue when one stops
+	*/
+	for i, item := range todo {
+		err := repo.pickOne(w, item.action, item.sha, opts)
+		if err == nil {
+			continue
+		}
+
+		if len(todo) > 1 || repo.sequencerActive() {
+			if err := repo.sequencerWrite("", todo[i:], opts); err != nil {
+				return err
+			}
+		}
+
+		if errors.Is(err, PickConflict) {
+			action := item.action
+			fmt.Fprintf(w, "hint: After resolving the conflicts, mark them with\nhint: \"git add/rm <pathspec>\", then run\nhint: \"git %s --continue\".\n", action)
+			fmt.Fprintf(w, "hint: You can instead skip this commit with \"git %s --skip\".\nhint: To abort and get back to the state before \"git %s\",\nhint: run \"git %s --abort\".\n", action, action, action)
+		}
+		return err
+	}
+
+	return repo.sequencerClear()
+}
+
+func (repo *Repository) Sequencer(w io.Writer, commits []string, opts SequencerOptions) error {
+	/*
+		cherry-picks or reverts commits in order, returns PickConflict when one stops on
+		conflicts, --continue, --skip and --abort pick it up from there
+	*/
+	if repo.sequencerActive() {
+		return fmt.Errorf("%s is already in progress\nhint: try \"git %s (--continue | --abort | --quit)\"\n", opts.action(), opts.action())
+	}
+	if pick, _ := repo.pickHead(); pick != "" {
+		return fmt.Errorf("%s is already in progress\n", opts.action())
+	}
+
+	todo := []sequencerItem{}
+	for _, sha := range commits {
+		todo = append(todo, sequencerItem{action: opts.action(), sha: sha})
+	}
+
+	if len(todo) > 1 {
+		head := ""
+		if sha, err := repo.RefResolve("HEAD"); err == nil {
+			head = sha
+		}
+		if err := repo.sequencerWrite(head, todo, opts); err != nil {
+			return err
+		}
+	}
+
+	return repo.sequencerRun(w, todo, opts)
+}
+
+func (repo *Repository) SequencerContinue(w io.Writer, action string) error {
+	/*
+		commits the resolved pick with its original message and author, then goes on with
+		the rest of the sequence
+	*/
+	todo, opts := []sequencerItem{}, SequencerOptions{Revert: action == "revert"}
+	if repo.sequencerActive() {
+		var err error
+		if _, todo, opts, err = repo.sequencerRead(); err != nil {
+			return err
+		}
+		opts.Revert = action == "revert"
+	}
+
+	pick, _ := repo.pickHead()
+	if pick == "" && len(todo) == 0 {
+		return fmt.Errorf("no %s in progress\n", action)
+	}
+
+	if pick != "" {
+		data, err := os.ReadFile(repo.RepoPath("MERGE_MSG"))
+		if err != nil {
+			return err
+		}
+
+		sha, err := repo.CommitIndex(MessageCleanup(string(data)), action+": ")
+		if err != nil {
+			return err
+		}
+		if err := repo.CommitSummaryWrite(w, sha); err != nil {
+			return err
+		}
+	}
+
+	if len(todo) > 0 && todo[0].sha == pick {
+		todo = todo[1:]
+	}
+
+	return repo.sequencerRun(w, todo, opts)
+}
+
+func (repo *Repository) SequencerSkip(w io.Writer, action string) error {
+	/*
+		drops the pick that stopped, resetting what it left in the index and the worktree,
+		it is always the first item of the saved sequence
+	*/
+	if pick, _ := repo.pickHead(); pick == "" && !repo.sequencerActive() {
+		return fmt.Errorf("no %s in progress\n", action)
+	}
+
+	if err := repo.WorktreeReset("HEAD"); err != nil {
+		return err
+	}
+	if err := repo.pickStateClear(); err != nil {
+		return err
+	}
+	if err := repo.MergeStateClear(); err != nil {
+		return err
+	}
+
+	if !repo.sequencerActive() {
+		return nil
+	}
+
+	_, todo, opts, err := repo.sequencerRead()
+	if err != nil {
+		return err
+	}
+	opts.Revert = action == "revert"
+	if len(todo) > 0 {
+		todo = todo[1:]
+	}
+
+	return repo.sequencerRun(w, todo, opts)
+}
+
+func (repo *Repository) SequencerAbort(action string) error {
+	/*
+		goes back to where the sequence started, or to HEAD for a single pick
+	*/
+	target := ""
+	if repo.sequencerActive() {
+		head, _, _, err := repo.sequencerRead()
+		if err != nil {
+			return err
+		}
+		target = head
+	} else if pick, _ := repo.pickHead(); pick == "" {
+		return fmt.Errorf("no %s in progress\n", action)
+	}
+
+	if target != "" {
+		if err := repo.WorktreeReset("HEAD"); err != nil {
+			return err
+		}
+		current, err := repo.RefResolve("HEAD")
+		if err != nil {
+			return err
+		}
+		if current != target {
+			if err := repo.WorktreeSwitch(current, target); err != nil {
+				return err
+			}
+			if err := repo.HeadUpdate(target, action+": abort"); err != nil {
+				return err
+			}
+		}
+	} else if err := repo.WorktreeReset("HEAD"); err != nil {
+		return err
+	}
+
+	if err := repo.pickStateClear(); err != nil {
+		return err
+	}
+	if err := repo.MergeStateClear(); err != nil {
+		return err
+	}
+
+	return repo.sequencerClear()
+}
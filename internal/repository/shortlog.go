@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+type ShortlogOptions struct {
+	Summary  bool
+	Numbered bool
+	Email    bool
+	Groups   []string
+}
+
+type shortlogEntry struct {
+	ident    string
+	onelines []string
+}
+
+func MessageTrailers(message string) [][2]string {
+	/*
+		the "Key: value" lines of the last paragraph, when it is not the subject and every
+		line is a trailer or the indented continuation of one
+	*/
+	paragraphs := strings.Split(strings.Trim(message, "\n"), "\n\n")
+	if len(paragraphs) < 2 {
+		return [][2]string{}
+	}
+
+	ret := [][2]string{}
+	for _, line := range strings.Split(strings.TrimRight(paragraphs[len(paragraphs)-1], "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(ret) > 0 {
+			ret[len(ret)-1][1] += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return [][2]string{}
+		}
+		ret = append(ret, [2]string{key, strings.TrimSpace(value)})
+	}
+
+	return ret
+}
+
+func ParseShortlogGroup(group string) (string, error) {
+	/*
+		author, committer or trailer:<key>, the key is matched case insensitively
+	*/
+	switch {
+	case group == "author", group == "committer":
+		return group, nil
+	case strings.HasPrefix(group, "trailer:") && len(group) > len("trailer:"):
+		return "trailer:" + strings.ToLower(strings.TrimPrefix(group, "trailer:")), nil
+	}
+
+	return "", fmt.Errorf("unknown group type: %s\n", group)
+}
+
+func shortlogIdent(sig Signature, email bool) string {
+	if email {
+		return fmt.Sprintf("%s <%s>", sig.Name, sig.Email)
+	}
+
+	return sig.Name
+}
+
+func (repo *Repository) shortlogIdents(c *WalkCommit, opts ShortlogOptions) []string {
+	/*
+		the identities c is credited to after the mailmap, once each even when several groups
+		name them
+	*/
+	mailmap := repo.MailmapRead()
+	ret := []string{}
+	add := func(ident string) {
+		if ident != "" && !slices.Contains(ret, ident) {
+			ret = append(ret, ident)
+		}
+	}
+
+	for _, group := range opts.Groups {
+		switch group {
+		case "author", "committer":
+			add(shortlogIdent(mailmap.MapSignature(commitSignature(c.Commit, group)), opts.Email))
+		default:
+			key := strings.TrimPrefix(group, "trailer:")
+			for _, trailer := range MessageTrailers(objectMessage(c.Commit)) {
+				if strings.ToLower(trailer[0]) != key {
+					continue
+				}
+
+				if sig, err := ParseSignature([]byte(trailer[1])); err == nil {
+					add(shortlogIdent(mailmap.MapSignature(sig), opts.Email))
+				} else {
+					add(trailer[1])
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func shortlogOneline(message string) string {
+	/*
+		the subject without a leading "[PATCH ...]" like git
+	*/
+	subject := MessageSubject(message)
+	if strings.HasPrefix(subject, "[PATCH") {
+		if end := strings.IndexByte(subject, ']'); end != -1 {
+			subject = strings.TrimLeft(subject[end+1:], " \t")
+		}
+	}
+	if subject == "" {
+		return "<none>"
+	}
+
+	return subject
+}
+
+func (repo *Repository) Shortlog(w io.Writer, commits []*WalkCommit, opts ShortlogOptions) error {
+	/*
+		opts.Groups: default val is ["author"]
+		identities are sorted by name, or by the number of commits with Numbered, and list
+		their subjects oldest first
+	*/
+	if len(opts.Groups) == 0 {
+		opts.Groups = []string{"author"}
+	}
+
+	entries := map[string]*shortlogEntry{}
+	for _, c := range commits {
+		oneline := ""
+		if !opts.Summary {
+			oneline = shortlogOneline(objectMessage(c.Commit))
+		}
+
+		for _, ident := range repo.shortlogIdents(c, opts) {
+			entry, ok := entries[ident]
+			if !ok {
+				entry = &shortlogEntry{ident: ident}
+				entries[ident] = entry
+			}
+			entry.onelines = append(entry.onelines, oneline)
+		}
+	}
+
+	sorted := []*shortlogEntry{}
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	slices.SortFunc(sorted, func(a *shortlogEntry, b *shortlogEntry) int {
+		return strings.Compare(a.ident, b.ident)
+	})
+	if opts.Numbered {
+		slices.SortStableFunc(sorted, func(a *shortlogEntry, b *shortlogEntry) int {
+			return len(b.onelines) - len(a.onelines)
+		})
+	}
+
+	var b strings.Builder
+	for _, entry := range sorted {
+		if opts.Summary {
+			fmt.Fprintf(&b, "%6d\t%s\n", len(entry.onelines), entry.ident)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s (%d):\n", entry.ident, len(entry.onelines))
+		for i := len(entry.onelines) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "      %s\n", entry.onelines[i])
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
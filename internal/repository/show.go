@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+type ShowOptions struct {
+	Log     LogOptions
+	Diff    DiffOptions
+	NoPatch bool
+}
+
+type showState struct {
+	repo        *Repository
+	w           io.Writer
+	opts        ShowOptions
+	decorations map[string][]string
+	shownOne    bool
+}
+
+func (repo *Repository) commitDiffPairs(c *WalkCommit, opts DiffOptions) ([]DiffFilePair, error) {
+	/*
+		the changes of c against its first parent, or against the empty tree for a root commit
+	*/
+	old := map[string]DiffEntry{}
+	if len(c.Parents) > 0 {
+		var err error
+		if old, err = repo.DiffTreeEntries(c.Parents[0]); err != nil {
+			return []DiffFilePair{}, err
+		}
+	}
+
+	new, err := repo.DiffTreeEntries(commitTree(c.Commit))
+	if err != nil {
+		return []DiffFilePair{}, err
+	}
+
+	pairs := DiffPairs(old, new, nil)
+	if opts.Renames || opts.Copies {
+		return repo.DiffRenames(pairs, opts.Copies, opts.RenameScore)
+	}
+
+	return pairs, nil
+}
+
+func (s *showState) commit(sha string, commit *GitCommit) error {
+	/*
+		the log entry followed by the diff against the parent, merges only get the log entry
+		since the combined diff is not supported
+	*/
+	c := &WalkCommit{Sha: sha, Commit: commit}
+	for _, p := range (*(*commit.Kvlm).Map)["parent"] {
+		c.Parents = append(c.Parents, string(p))
+	}
+
+	msg, terminator, err := s.repo.logEntry(c, s.opts.Log, s.decorations)
+	if err != nil {
+		return err
+	}
+
+	if s.shownOne && !terminator {
+		msg = "\n" + msg
+	}
+	if terminator {
+		msg += "\n"
+	}
+	s.shownOne = true
+
+	if _, err := io.WriteString(s.w, msg); err != nil {
+		return err
+	}
+
+	if s.opts.NoPatch || len(c.Parents) > 1 {
+		return nil
+	}
+
+	pairs, err := s.repo.commitDiffPairs(c, s.opts.Diff)
+	if err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	if s.opts.Log.Format != "oneline" {
+		separator := "\n"
+		if s.opts.Diff.Patch && s.opts.Diff.Stat {
+			separator = "---\n"
+		}
+		if _, err := io.WriteString(s.w, separator); err != nil {
+			return err
+		}
+	}
+
+	return s.repo.DiffWrite(s.w, pairs, s.opts.Diff)
+}
+
+func (s *showState) tag(tag *GitTag) error {
+	/*
+		git's show_tag_object, the name and tagger of the tag then its message unindented
+	*/
+	var b strings.Builder
+	if s.shownOne {
+		b.WriteString("\n")
+	}
+	s.shownOne = true
+
+	fmt.Fprintf(&b, "tag %s\n", tagField(tag, "tag"))
+	if raw := tagField(tag, "tagger"); raw != "" {
+		if sig, err := ParseSignature([]byte(raw)); err == nil {
+			fmt.Fprintf(&b, "Tagger: %s <%s>\n", sig.Name, sig.Email)
+			fmt.Fprintf(&b, "Date:   %s\n", FormatDate(sig.When, s.opts.Log.Date))
+		}
+	}
+
+	if message := objectMessage(tag); message != "" {
+		fmt.Fprintf(&b, "\n%s", message)
+	}
+
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+func (s *showState) tree(name string, tree *GitTree) error {
+	var b strings.Builder
+	if s.shownOne {
+		b.WriteString("\n")
+	}
+	s.shownOne = true
+
+	fmt.Fprintf(&b, "tree %s\n\n", name)
+	for _, leaf := range tree.Items {
+		if string(leaf.Mode[:2]) == "04" {
+			fmt.Fprintf(&b, "%s/\n", leaf.Path)
+		} else {
+			fmt.Fprintf(&b, "%s\n", leaf.Path)
+		}
+	}
+
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+func (repo *Repository) Show(w io.Writer, names []string, opts ShowOptions) error {
+	/*
+		names: default val is HEAD, anything rev-parse takes including <rev>:<path>
+		commits are shown like log with their patch, tags with their metadata followed by the
+		tagged object, trees as a listing under the given name and blobs raw
+	*/
+	s := &showState{repo: repo, w: w, opts: opts, decorations: map[string][]string{}}
+	if s.opts.Log.Format == "" {
+		s.opts.Log.Format = "medium"
+	}
+	if opts.Log.Decorate {
+		decorations, err := repo.LogDecorations()
+		if err != nil {
+			return err
+		}
+		s.decorations = decorations
+	}
+
+	if len(names) == 0 {
+		names = []string{"HEAD"}
+	}
+
+	for _, name := range names {
+		sha, err := repo.ObjectFind(name, "", true)
+		if err != nil {
+			return err
+		}
+
+		seen := []string{}
+		for !slices.Contains(seen, sha) {
+			seen = append(seen, sha)
+
+			obj, err := repo.ObjectRead(sha)
+			if err != nil {
+				return err
+			}
+
+			switch o := obj.(type) {
+			case *GitCommit:
+				err = s.commit(sha, o)
+			case *GitTag:
+				if err = s.tag(o); err == nil {
+					sha = tagField(o, "object")
+				}
+			case *GitTree:
+				err = s.tree(name, o)
+			case *GitBlob:
+				_, err = w.Write(o.BlobData)
+			default:
+				objFmt, _ := obj.GetFmt()
+				err = fmt.Errorf("unknown object type %s for %s\n", string(objFmt), name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
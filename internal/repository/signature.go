@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+func ParseSignature(raw []byte) (Signature, error) {
+	/*
+		parses "Name <email> 1700000000 +0100" as found in author, committer and tagger
+	*/
+	lt := bytes.IndexByte(raw, '<')
+	gt := bytes.LastIndexByte(raw, '>')
+	if lt == -1 || gt == -1 || gt < lt {
+		return Signature{}, fmt.Errorf("malformed signature:%s\n", string(raw))
+	}
+
+	sig := Signature{
+		Name:  strings.TrimSpace(string(raw[:lt])),
+		Email: string(raw[lt+1 : gt]),
+	}
+
+	fields := strings.Fields(string(raw[gt+1:]))
+	if len(fields) < 1 {
+		return sig, nil
+	}
+
+	epoch, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return sig, fmt.Errorf("malformed signature time:%s\n", string(raw))
+	}
+
+	loc := time.UTC
+	if len(fields) > 1 && len(fields[1]) == 5 {
+		hours, errH := strconv.Atoi(fields[1][1:3])
+		minutes, errM := strconv.Atoi(fields[1][3:5])
+		if errH == nil && errM == nil {
+			offset := hours*3600 + minutes*60
+			if fields[1][0] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone(fields[1], offset)
+		}
+	}
+
+	sig.When = time.Unix(epoch, 0).In(loc)
+	return sig, nil
+}
+
+func (sig Signature) String() string {
+	return fmt.Sprintf("%s <%s> %s", sig.Name, sig.Email, FormatSignatureTime(sig.When))
+}
+
+func FormatDate(when time.Time, mode string) string {
+	/*
+		mode: default val is "", one of default, iso, iso-strict, rfc, short, raw, unix, relative
+	*/
+	switch mode {
+	case "iso", "iso8601":
+		return when.Format("2006-01-02 15:04:05 -0700")
+	case "iso-strict", "iso8601-strict":
+		return when.Format("2006-01-02T15:04:05-07:00")
+	case "rfc", "rfc2822":
+		return when.Format("Mon, 2 Jan 2006 15:04:05 -0700")
+	case "short":
+		return when.Format("2006-01-02")
+	case "raw":
+		return FormatSignatureTime(when)
+	case "unix":
+		return strconv.FormatInt(when.Unix(), 10)
+	case "relative":
+		return formatRelativeDate(when, time.Now())
+	default:
+		return when.Format("Mon Jan 2 15:04:05 2006 -0700")
+	}
+}
+
+func formatRelativeDate(when time.Time, now time.Time) string {
+	diff := now.Sub(when)
+	if diff < 0 {
+		return "in the future"
+	}
+
+	seconds := int64(diff.Seconds())
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s ago", n, unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+
+	switch {
+	case seconds < 90:
+		return plural(seconds, "second")
+	case seconds < 90*60:
+		return plural((seconds+30)/60, "minute")
+	case seconds < 36*3600:
+		return plural((seconds+1800)/3600, "hour")
+	case seconds < 14*86400:
+		return plural((seconds+43200)/86400, "day")
+	case seconds < 70*86400:
+		return plural((seconds+302400)/604800, "week")
+	case seconds < 365*86400:
+		return plural((seconds+1296000)/2592000, "month")
+	default:
+		return plural((seconds+15768000)/31536000, "year")
+	}
+}
+
+func ParseDateSpec(spec string, now time.Time) (time.Time, error) {
+	/*
+		accepts what --since and --until usually get: a unix timestamp, an iso or rfc date,
+		"now", "yesterday" and relative dates such as "2 weeks ago" or "2.weeks.ago"
+	*/
+	spec = strings.TrimSpace(spec)
+	lower := strings.ToLower(spec)
+
+	switch lower {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	if epoch, err := strconv.ParseInt(strings.TrimPrefix(spec, "@"), 10, 64); err == nil {
+		return time.Unix(epoch, 0), nil
+	}
+
+	for _, layout := range []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon Jan 2 15:04:05 2006 -0700",
+	} {
+		if t, err := time.ParseInLocation(layout, spec, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	fields := strings.Fields(strings.ReplaceAll(lower, ".", " "))
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		if err == nil {
+			unit := strings.TrimSuffix(fields[1], "s")
+			switch unit {
+			case "second":
+				return now.Add(-time.Duration(n) * time.Second), nil
+			case "minute":
+				return now.Add(-time.Duration(n) * time.Minute), nil
+			case "hour":
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case "day":
+				return now.AddDate(0, 0, -n), nil
+			case "week":
+				return now.AddDate(0, 0, -7*n), nil
+			case "month":
+				return now.AddDate(0, -n, 0), nil
+			case "year":
+				return now.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date '%s'\n", spec)
+}
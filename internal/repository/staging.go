@@ -2,11 +2,15 @@ package repository
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
 	"os"
+	"slices"
+	"strings"
 )
 
 type fTime struct {
@@ -90,6 +94,9 @@ func (repo *Repository) IndexRead() (*GitIndex, error) {
 	}
 	raw, err := os.ReadFile(indexFile)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return &GitIndex{Version: 2, Entries: []GitIndexEntry{}}, nil
+		}
 		return nil, err
 	}
 
@@ -142,7 +149,7 @@ func (repo *Repository) IndexRead() (*GitIndex, error) {
 		flags := binary.BigEndian.Uint16(content[idx+60 : idx+62])
 
 		flagAssumeValid := (flags & 0b1000000000000000) != 0
-		flagStage := flags & 0b0011000000000000
+		flagStage := (flags & 0b0011000000000000) >> 12
 		nameLength := flags & 0b0000111111111111
 
 		idx += 62
@@ -198,134 +205,65 @@ func (repo *Repository) IndexWrite(index *GitIndex) error {
 		return err
 	}
 
-	file, err := os.OpenFile(indexFile, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		return err
-	}
-
-	dirc := make([]byte, 4, 4)
-	for _, c := range "DIRC" {
-		dirc = append(dirc, byte(c))
-	}
-
-	_, err = file.Write(dirc)
-	if err != nil {
-		return err
-	}
+	slices.SortStableFunc(index.Entries, func(a, b GitIndexEntry) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return int(a.FlagStage) - int(b.FlagStage)
+	})
 
-	_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, index.Version))
-	if err != nil {
-		return err
+	version := index.Version
+	if version == 0 {
+		version = 2
 	}
 
-	_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, uint32(len(index.Entries))))
-	if err != nil {
-		return err
-	}
+	buf := []byte("DIRC")
+	buf = binary.BigEndian.AppendUint32(buf, version)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(index.Entries)))
 
-	idx := 0
 	for _, e := range index.Entries {
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.CTime.Seconds))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.CTime.Nanoseconds))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.MTime.Seconds))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.MTime.Nanoseconds))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.Dev))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.Ino))
-		if err != nil {
-			return err
-		}
-
-		mode := (e.ModeType << 12) | e.ModePerms
-		_, err = file.Write(binary.BigEndian.AppendUint16([]byte{}, mode))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.UId))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.GId))
-		if err != nil {
-			return err
-		}
-
-		_, err = file.Write(binary.BigEndian.AppendUint32([]byte{}, e.FSize))
-		if err != nil {
-			return err
-		}
-
-		shaBytes := make([]byte, len(e.Sha))
-		for _, c := range e.Sha {
-			shaBytes = append(shaBytes, byte(c))
-		}
-		_, err = file.Write(shaBytes)
-		if err != nil {
-			return err
+		entryStart := len(buf)
+
+		buf = binary.BigEndian.AppendUint32(buf, e.CTime.Seconds)
+		buf = binary.BigEndian.AppendUint32(buf, e.CTime.Nanoseconds)
+		buf = binary.BigEndian.AppendUint32(buf, e.MTime.Seconds)
+		buf = binary.BigEndian.AppendUint32(buf, e.MTime.Nanoseconds)
+		buf = binary.BigEndian.AppendUint32(buf, e.Dev)
+		buf = binary.BigEndian.AppendUint32(buf, e.Ino)
+
+		mode := (uint32(e.ModeType) << 12) | uint32(e.ModePerms)
+		buf = binary.BigEndian.AppendUint32(buf, mode)
+		buf = binary.BigEndian.AppendUint32(buf, e.UId)
+		buf = binary.BigEndian.AppendUint32(buf, e.GId)
+		buf = binary.BigEndian.AppendUint32(buf, e.FSize)
+
+		shaBytes, err := hex.DecodeString(e.Sha)
+		if err != nil || len(shaBytes) != 20 {
+			return fmt.Errorf("index entry has invalid sha:%s name:%s\n", e.Sha, e.Name)
 		}
+		buf = append(buf, shaBytes...)
 
 		var flagAssumedValid uint16
 		if e.FlagAssumedValid {
 			flagAssumedValid = 0x1 << 15
-		} else {
-			flagAssumedValid = 0
-		}
-
-		lenNameBytes := len(e.Name)
-		nameBytes := make([]byte, lenNameBytes)
-		for _, c := range e.Name {
-			nameBytes = append(nameBytes, byte(c))
 		}
 
-		var nameLength int = lenNameBytes
-		if lenNameBytes >= 0xFFF {
+		nameLength := len(e.Name)
+		if nameLength >= 0xFFF {
 			nameLength = 0xFFF
 		}
 
-		file.Write(binary.BigEndian.AppendUint16([]byte{}, (flagAssumedValid | e.FlagStage | uint16(nameLength))))
-
-		file.Write(nameBytes)
-		_, err = file.Write([]byte{0})
-
-		idx += 62 + len(nameBytes) + 1
+		buf = binary.BigEndian.AppendUint16(buf, flagAssumedValid|(e.FlagStage&0b11)<<12|uint16(nameLength))
+		buf = append(buf, []byte(e.Name)...)
+		buf = append(buf, 0)
 
-		if idx%8 != 0 {
-			pad := 8 - (idx % 8)
-			paddingBytes := make([]byte, pad)
-
-			_, err = file.Write(paddingBytes)
-			if err != nil {
-				return err
-			}
+		for (len(buf)-entryStart)%8 != 0 {
+			buf = append(buf, 0)
 		}
 	}
 
-	return nil
+	checksum := sha1.Sum(buf)
+	buf = append(buf, checksum[:]...)
+
+	return os.WriteFile(indexFile, buf, 0644)
 }
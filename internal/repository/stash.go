@@ -0,0 +1,701 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var StashConflict = errors.New("StashConflict")
+
+type StashOptions struct {
+	Message   string
+	Untracked bool
+	Paths     []string
+}
+
+type stashCommits struct {
+	sha       string
+	base      string
+	baseTree  string
+	indexTree string
+	tree      string
+	untracked string
+}
+
+func (repo *Repository) worktreeIndexEntry(name string) (GitIndexEntry, error) {
+	/*
+		writes the worktree file as a blob and returns its index entry
+	*/
+	fullPath := filepath.Join(repo.Worktree, filepath.FromSlash(name))
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return GitIndexEntry{}, err
+	}
+
+	var sha string
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return GitIndexEntry{}, err
+		}
+
+		blob := &GitBlob{}
+		blob.Init([]byte(target))
+		sha, err = ObjectWrite(blob, repo)
+		if err != nil {
+			return GitIndexEntry{}, err
+		}
+	} else {
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return GitIndexEntry{}, err
+		}
+		defer file.Close()
+
+		if sha, err = ObjectHash(file, "blob", repo); err != nil {
+			return GitIndexEntry{}, err
+		}
+	}
+
+	return indexEntryFromFile(fullPath, name, sha)
+}
+
+func (repo *Repository) indexFromTree(tree string, keep *GitIndex) (*GitIndex, error) {
+	/*
+		the entries of tree, an entry of keep with the same name, sha and mode keeps its
+		stat data, the others get none so they are hashed again when compared
+	*/
+	leaves, err := repo.treeToLeafDict(tree, "")
+	if err != nil {
+		return nil, err
+	}
+
+	kept := map[string]GitIndexEntry{}
+	for _, e := range keep.Entries {
+		if e.FlagStage == 0 {
+			kept[e.Name] = e
+		}
+	}
+
+	entries := []GitIndexEntry{}
+	for name, leaf := range *leaves {
+		modeType, modePerms := treeModeToIndexMode(leaf.Mode)
+		if e, ok := kept[name]; ok && e.Sha == leaf.Sha && e.ModeType == modeType && e.ModePerms == modePerms {
+			entries = append(entries, e)
+			continue
+		}
+
+		entries = append(entries, GitIndexEntry{ModeType: modeType, ModePerms: modePerms, Sha: leaf.Sha, Name: name})
+	}
+
+	return &GitIndex{Version: keep.Version, Entries: entries}, nil
+}
+
+func (repo *Repository) stashHeadMessage() (string, string, error) {
+	/*
+		the branch and the "<abbrev> <subject>" of HEAD git names a stash after
+	*/
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("You do not have the initial commit yet\n")
+	}
+	commit, err := repo.CommitRead(head)
+	if err != nil {
+		return "", "", err
+	}
+
+	branch, err := repo.GetActiveBranch()
+	if err != nil {
+		return "", "", err
+	}
+	if branch == "" {
+		branch = "(no branch)"
+	}
+
+	return branch, fmt.Sprintf("%s %s", repo.ObjectAbbrev(head, 7), MessageSubject(objectMessage(commit))), nil
+}
+
+func (repo *Repository) StashPush(w io.Writer, opts StashOptions) error {
+	/*
+		opts.Paths: default val is [], every path, otherwise only changes to them are saved
+		and reset
+		saves the index and the worktree like git stash, a commit of the worktree whose
+		parents are HEAD, a commit of the index and with opts.Untracked a commit of the
+		untracked files, then resets them to HEAD
+	*/
+	branch, headLine, err := repo.stashHeadMessage()
+	if err != nil {
+		return err
+	}
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+	headCommit, err := repo.CommitRead(head)
+	if err != nil {
+		return err
+	}
+	headTree := commitTree(headCommit)
+
+	if unmerged, err := repo.indexUnmerged(); err != nil {
+		return err
+	} else if len(unmerged) > 0 {
+		return fmt.Errorf("%s: needs merge\ncould not save index tree\n", unmerged[0])
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range opts.Paths {
+		matched := false
+		for _, e := range index.Entries {
+			matched = matched || diffPathMatch(e.Name, []string{path})
+		}
+		if _, err := os.Lstat(filepath.Join(repo.Worktree, filepath.FromSlash(path))); !matched && (!opts.Untracked || err != nil) {
+			return fmt.Errorf("pathspec '%s' did not match any file(s) known to git\nDid you forget to 'git add'?\n", path)
+		}
+	}
+
+	indexTree, err := repo.TreeFromIndex(index)
+	if err != nil {
+		return err
+	}
+
+	worktree := &GitIndex{Version: index.Version, Entries: []GitIndexEntry{}}
+	for _, e := range index.Entries {
+		if !diffPathMatch(e.Name, opts.Paths) {
+			worktree.Entries = append(worktree.Entries, e)
+			continue
+		}
+
+		entry, err := repo.worktreeIndexEntry(e.Name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		worktree.Entries = append(worktree.Entries, entry)
+	}
+	tree, err := repo.TreeFromIndex(worktree)
+	if err != nil {
+		return err
+	}
+
+	untracked := []string{}
+	if opts.Untracked {
+		if untracked, err = repo.WorktreeUntracked(index, opts.Paths); err != nil {
+			return err
+		}
+	}
+
+	if indexTree == headTree && tree == headTree && len(untracked) == 0 {
+		fmt.Fprintf(w, "No local changes to save\n")
+		return nil
+	}
+
+	user, err := repo.UserIdent()
+	if err != nil {
+		return err
+	}
+	sig := fmt.Sprintf("%s %s", user, FormatSignatureTime(time.Now()))
+
+	indexCommit, err := repo.CommitCreateAuthored(indexTree, []string{head}, sig, sig, fmt.Sprintf("index on %s: %s", branch, headLine))
+	if err != nil {
+		return err
+	}
+	parents := []string{head, indexCommit}
+
+	if len(untracked) > 0 {
+		files := &GitIndex{Version: index.Version, Entries: []GitIndexEntry{}}
+		for _, name := range untracked {
+			entry, err := repo.worktreeIndexEntry(name)
+			if err != nil {
+				return err
+			}
+			files.Entries = append(files.Entries, entry)
+		}
+
+		untrackedTree, err := repo.TreeFromIndex(files)
+		if err != nil {
+			return err
+		}
+		untrackedCommit, err := repo.CommitCreateAuthored(untrackedTree, []string{}, sig, sig, fmt.Sprintf("untracked files on %s: %s", branch, headLine))
+		if err != nil {
+			return err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+
+	message := fmt.Sprintf("WIP on %s: %s", branch, headLine)
+	if opts.Message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+
+	stash, err := repo.CommitCreateAuthored(tree, parents, sig, sig, message)
+	if err != nil {
+		return err
+	}
+
+	old, _ := repo.RefResolve("refs/stash")
+	if err := repo.RefCreate("stash", stash); err != nil {
+		return err
+	}
+	if err := repo.ReflogAppend("refs/stash", old, stash, message); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Saved working directory and index state %s\n", message)
+
+	if len(opts.Paths) == 0 {
+		if err := repo.stashHeadReflog(); err != nil {
+			return err
+		}
+	}
+
+	if err := repo.worktreeResetPaths(headTree, opts.Paths); err != nil {
+		return err
+	}
+	for _, name := range untracked {
+		if err := repo.worktreeRemoveFile(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *Repository) stashHeadReflog() error {
+	/*
+		git resets to HEAD behind the scenes when it stashes and when it brings back
+		the index, which leaves a reset entry in the HEAD reflog
+	*/
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+
+	return repo.ReflogAppend("HEAD", head, head, "reset: moving to HEAD")
+}
+
+func (repo *Repository) worktreeResetPaths(tree string, paths []string) error {
+	/*
+		paths: default val is [], every path
+		like git reset --hard limited to paths, files already matching tree are left alone
+	*/
+	to, err := repo.treeToLeafDict(tree, "")
+	if err != nil {
+		return err
+	}
+
+	index, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+
+	entries := []GitIndexEntry{}
+	seen := map[string]bool{}
+	for _, e := range index.Entries {
+		if !diffPathMatch(e.Name, paths) {
+			entries = append(entries, e)
+			seen[e.Name] = true
+			continue
+		}
+
+		leaf, ok := (*to)[e.Name]
+		if !ok {
+			if err := repo.worktreeRemoveFile(e.Name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		modeType, modePerms := treeModeToIndexMode(leaf.Mode)
+		if e.FlagStage == 0 && e.Sha == leaf.Sha && e.ModeType == modeType && e.ModePerms == modePerms {
+			if sha, err := repo.worktreeFileSha(e.Name); err == nil && sha == e.Sha {
+				entries = append(entries, e)
+				seen[e.Name] = true
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range *to {
+		if !seen[name] && diffPathMatch(name, paths) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		leaf := (*to)[name]
+		if err := repo.worktreeWriteLeaf(leaf); err != nil {
+			return err
+		}
+
+		entry, err := indexEntryFromFile(filepath.Join(repo.Worktree, filepath.FromSlash(name)), name, leaf.Sha)
+		if err != nil {
+			return err
+		}
+		entry.ModeType, entry.ModePerms = treeModeToIndexMode(leaf.Mode)
+		entries = append(entries, entry)
+	}
+
+	index.Entries = entries
+	return repo.IndexWrite(index)
+}
+
+func (repo *Repository) stashResolve(rev string) (string, int, *stashCommits, error) {
+	/*
+		rev: default val is "refs/stash@{0}", a bare number is stash@{n}
+		returns the name used for messages, n of stash@{n} or -1 when rev is not a stash
+		reflog entry, and the commits of the stash
+	*/
+	if rev == "" {
+		rev = "refs/stash@{0}"
+	}
+	if isNumeric(rev) {
+		rev = "stash@{" + rev + "}"
+	}
+
+	n := -1
+	if at := strings.Index(rev, "@{"); at != -1 && strings.HasSuffix(rev, "}") {
+		if name := rev[:at]; name == "stash" || name == "refs/stash" || repo.RefDwim(name) == "refs/stash" {
+			if i, err := strconv.Atoi(rev[at+2 : len(rev)-1]); err == nil {
+				n = i
+			}
+		}
+	}
+
+	if n != -1 {
+		if _, err := repo.RefResolve("refs/stash"); err != nil {
+			return "", 0, nil, fmt.Errorf("No stash entries found.\n")
+		}
+		entries, err := repo.ReflogRead("refs/stash")
+		if err != nil {
+			return "", 0, nil, err
+		}
+		if n >= len(entries) {
+			return "", 0, nil, fmt.Errorf("log for 'stash' only has %d entries\n", len(entries))
+		}
+	}
+
+	sha, err := repo.ObjectFind(rev, "commit", true)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("%s is not a valid reference\n", rev)
+	}
+	commit, err := repo.CommitRead(sha)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	parents := commitParents(commit)
+	if len(parents) < 2 {
+		return "", 0, nil, fmt.Errorf("'%s' is not a stash-like commit\n", rev)
+	}
+
+	s := &stashCommits{sha: sha, base: parents[0], tree: commitTree(commit)}
+	for i, parent := range parents {
+		c, err := repo.CommitRead(parent)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		switch i {
+		case 0:
+			s.baseTree = commitTree(c)
+		case 1:
+			s.indexTree = commitTree(c)
+		case 2:
+			s.untracked = commitTree(c)
+		}
+	}
+
+	return rev, n, s, nil
+}
+
+func (repo *Repository) StashList(w io.Writer) error {
+	entries, err := repo.ReflogRead("refs/stash")
+	if err != nil {
+		return err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		fmt.Fprintf(w, "stash@{%d}: %s\n", len(entries)-1-i, entries[i].Message)
+	}
+
+	return nil
+}
+
+func (repo *Repository) StashShow(w io.Writer, rev string, opts DiffOptions) error {
+	/*
+		the changes of the stash against the commit it was made on, a diffstat unless
+		opts.Patch
+	*/
+	_, _, s, err := repo.stashResolve(rev)
+	if err != nil {
+		return err
+	}
+
+	base, err := repo.DiffTreeEntries(s.baseTree)
+	if err != nil {
+		return err
+	}
+	tree, err := repo.DiffTreeEntries(s.tree)
+	if err != nil {
+		return err
+	}
+
+	pairs := DiffPairs(base, tree, nil)
+	if opts.Renames {
+		if pairs, err = repo.DiffRenames(pairs, opts.Copies, opts.RenameScore); err != nil {
+			return err
+		}
+	}
+
+	if !opts.Patch {
+		opts.Stat = true
+	}
+	return repo.DiffWrite(w, pairs, opts)
+}
+
+func (repo *Repository) StashApply(w io.Writer, rev string, index bool) error {
+	/*
+		index: default val is false, also brings back what was staged
+		merges the stash into the worktree with the commit it was made on as the base,
+		returns StashConflict when files are left with conflicts
+	*/
+	_, _, s, err := repo.stashResolve(rev)
+	if err != nil {
+		return err
+	}
+
+	if unmerged, err := repo.indexUnmerged(); err != nil {
+		return err
+	} else if len(unmerged) > 0 {
+		return fmt.Errorf("%s: needs merge\ncould not write index\n", unmerged[0])
+	}
+
+	current, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+	oursTree, err := repo.TreeFromIndex(current)
+	if err != nil {
+		return err
+	}
+
+	opts := DefaultMergeTreeOptions()
+	opts.OursLabel, opts.BaseLabel, opts.TheirsLabel = "Updated upstream", "Stash base", "Stashed changes"
+
+	indexTree := ""
+	if index && s.indexTree != s.baseTree {
+		result, err := repo.MergeTrees(s.baseTree, oursTree, s.indexTree, opts)
+		if err != nil {
+			return err
+		}
+		if !result.Clean() {
+			return fmt.Errorf("Conflicts in index. Try without --index.\n")
+		}
+		if indexTree, err = repo.MergeTreeWrite(result); err != nil {
+			return err
+		}
+		if err := repo.stashHeadReflog(); err != nil {
+			return err
+		}
+	}
+
+	result, err := repo.MergeTrees(s.baseTree, oursTree, s.tree, opts)
+	if err != nil {
+		return err
+	}
+
+	from := oursTree
+	if len(current.Entries) == 0 {
+		from = ""
+	}
+	if err := repo.WorktreeMerge(from, result); err != nil {
+		return err
+	}
+
+	for _, message := range result.Messages {
+		fmt.Fprintf(w, "%s\n", message)
+	}
+
+	if !result.Clean() {
+		if index {
+			fmt.Fprintf(w, "Index was not unstashed.\n")
+		}
+		return StashConflict
+	}
+
+	merged, err := repo.IndexRead()
+	if err != nil {
+		return err
+	}
+
+	if indexTree != "" {
+		restored, err := repo.indexFromTree(indexTree, merged)
+		if err != nil {
+			return err
+		}
+		if err := repo.IndexWrite(restored); err != nil {
+			return err
+		}
+	} else if err := repo.indexUnstageUnlessNew(oursTree, merged); err != nil {
+		return err
+	}
+
+	return repo.stashRestoreUntracked(w, s.untracked)
+}
+
+func (repo *Repository) stashRestoreUntracked(w io.Writer, tree string) error {
+	/*
+		writes back the untracked files of the stash, when one of them is already there
+		nothing is written and StashConflict is returned as the rest is already applied
+	*/
+	if tree == "" {
+		return nil
+	}
+
+	leaves, err := repo.treeToLeafDict(tree, "")
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range *leaves {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if _, err := os.Lstat(filepath.Join(repo.Worktree, filepath.FromSlash(name))); err == nil {
+			fmt.Fprintf(w, "%s already exists, no checkout\nerror: could not restore untracked files from stash\n", name)
+			return StashConflict
+		}
+	}
+	for _, name := range names {
+		if err := repo.worktreeWriteLeaf((*leaves)[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *Repository) indexUnstageUnlessNew(tree string, index *GitIndex) error {
+	/*
+		git's unstage_changes_unless_new, every entry goes back to tree except the files
+		tree does not have, those stay added
+	*/
+	restored, err := repo.indexFromTree(tree, index)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, e := range restored.Entries {
+		names[e.Name] = true
+	}
+	for _, e := range index.Entries {
+		if !names[e.Name] {
+			restored.Entries = append(restored.Entries, e)
+		}
+	}
+
+	return repo.IndexWrite(restored)
+}
+
+func (repo *Repository) StashDrop(w io.Writer, rev string) error {
+	/*
+		removes the entry from the stash reflog, refs/stash moves to the next one or goes
+		away with the last
+	*/
+	name, n, s, err := repo.stashResolve(rev)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("'%s' is not a stash reference\n", name)
+	}
+
+	entries, err := repo.ReflogRead("refs/stash")
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 1 {
+		if err := repo.refStore("refs/stash").Delete("refs/stash"); err != nil {
+			return err
+		}
+	} else {
+		if err := repo.ReflogDelete("refs/stash", len(entries)-1-n); err != nil {
+			return err
+		}
+		if n == 0 {
+			if err := repo.refStore("refs/stash").Write("refs/stash", RefValue{Sha: entries[len(entries)-2].New}); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Dropped %s (%s)\n", name, s.sha)
+	return nil
+}
+
+func (repo *Repository) StashBranch(w io.Writer, branch string, rev string) error {
+	/*
+		checks out a new branch at the commit the stash was made on, the stash is applied
+		there with its index
+	*/
+	_, _, s, err := repo.stashResolve(rev)
+	if err != nil {
+		return err
+	}
+
+	if _, err := repo.RefResolve("refs/heads/" + branch); err == nil {
+		return fmt.Errorf("a branch named '%s' already exists\n", branch)
+	}
+	if _, err := CheckRefFormat("refs/heads/"+branch, RefFormatOptions{}); err != nil {
+		return err
+	}
+
+	head, err := repo.RefResolve("HEAD")
+	if err != nil {
+		return err
+	}
+	from, err := repo.GetActiveBranch()
+	if err != nil {
+		return err
+	}
+	if from == "" {
+		from = head
+	}
+
+	if err := repo.WorktreeSwitch(head, s.base); err != nil {
+		return err
+	}
+	if err := repo.RefCreate("heads/"+branch, s.base); err != nil {
+		return err
+	}
+	if err := repo.ReflogAppend("refs/heads/"+branch, "", s.base, "branch: Created from "+s.base); err != nil {
+		return err
+	}
+	if err := repo.SymbolicRefCreate("HEAD", "refs/heads/"+branch); err != nil {
+		return err
+	}
+	if err := repo.ReflogAppend("HEAD", head, s.base, fmt.Sprintf("checkout: moving from %s to %s", from, branch)); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Switched to a new branch '%s'\n", branch)
+	return nil
+}
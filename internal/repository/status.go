@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,22 +10,15 @@ import (
 )
 
 func (repo *Repository) GetActiveBranch() (string, error) {
-	headFile, err := repo.RepoFile(false, "HEAD")
-	if err != nil {
-		return "", err
-	}
-
-	fileData, err := os.ReadFile(headFile)
+	target, err := repo.SymbolicRefRead("HEAD")
 	if err != nil {
+		if errors.Is(err, RefNotSymbolic) {
+			return "", nil
+		}
 		return "", err
 	}
 
-	data := string(fileData)
-	if strings.HasPrefix(data, "ref: refs/heads/") {
-		return data[16:], nil
-	}
-
-	return "", nil
+	return strings.TrimPrefix(target, "refs/heads/"), nil
 }
 
 func (repo *Repository) StatusBranch() error {
@@ -34,7 +28,14 @@ func (repo *Repository) StatusBranch() error {
 	}
 
 	if branch != "" {
-		fmt.Printf("On branch %s.", branch)
+		fmt.Printf("On branch %s\n", branch)
+
+		if _, err := repo.RefResolve("HEAD"); err != nil {
+			fmt.Printf("\nNo commits yet\n")
+		}
+		fmt.Println()
+
+		return nil
 	}
 
 	sha, err := repo.ObjectFind("HEAD", "", true)
@@ -42,7 +43,7 @@ func (repo *Repository) StatusBranch() error {
 		return err
 	}
 
-	fmt.Printf("HEAD detached at %s.\n", sha)
+	fmt.Printf("HEAD detached at %s\n\n", sha[:7])
 	return nil
 }
 
@@ -89,29 +90,84 @@ func (repo *Repository) treeToDict(ref, prefix string) (*map[string]string, erro
 func (repo *Repository) StatusHeadIndex(index *GitIndex) error {
 	fmt.Println("Changes to be committed:")
 
-	head, err := repo.treeToDict("HEAD", "")
+	head := map[string]DiffEntry{}
+	if _, err := repo.RefResolve("HEAD"); err == nil {
+		head, err = repo.DiffTreeEntries("HEAD")
+		if err != nil {
+			return err
+		}
+	}
+
+	merged, unmerged := indexSplitUnmerged(index)
+	for name := range unmerged {
+		delete(head, name)
+	}
+
+	pairs, err := repo.DiffRenames(DiffPairs(head, repo.DiffIndexEntries(merged), nil), false, DefaultRenameScore)
 	if err != nil {
 		return err
 	}
 
-	for _, e := range index.Entries {
-		if _, ok := (*head)[e.Name]; ok {
-			if (*head)[e.Name] != e.Sha {
-				fmt.Printf("  modified:%s\n", e.Name)
-			}
-			delete(*head, e.Name)
-		} else {
-			fmt.Printf("  added:  %s\n", e.Name)
+	for _, pair := range pairs {
+		switch pair.Status {
+		case 'A':
+			fmt.Printf("  added:  %s\n", pair.New.Path)
+		case 'D':
+			fmt.Printf("  deleted: %s\n", pair.Old.Path)
+		case 'R':
+			fmt.Printf("  renamed: %s -> %s\n", pair.Old.Path, pair.New.Path)
+		default:
+			fmt.Printf("  modified:%s\n", pair.New.Path)
 		}
 	}
 
-	for e := range *head {
-		fmt.Printf("  deleted: %s\n", e)
+	if len(unmerged) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	for name := range unmerged {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	fmt.Println()
+	fmt.Println("Unmerged paths:")
+	for _, name := range names {
+		fmt.Printf("  %s: %s\n", unmergedStatus[unmerged[name]], name)
 	}
 
 	return nil
 }
 
+var unmergedStatus = map[int]string{
+	0b001: "both deleted",
+	0b010: "added by us",
+	0b011: "deleted by them",
+	0b100: "added by them",
+	0b101: "deleted by us",
+	0b110: "both added",
+	0b111: "both modified",
+}
+
+func indexSplitUnmerged(index *GitIndex) (*GitIndex, map[string]int) {
+	/*
+		returns the index without its conflicted paths and for each conflicted path the
+		stages it has as bits, bit 0 for the base up to bit 2 for theirs
+	*/
+	merged := &GitIndex{Version: index.Version, Entries: []GitIndexEntry{}}
+	unmerged := map[string]int{}
+	for _, e := range index.Entries {
+		if e.FlagStage == 0 {
+			merged.Entries = append(merged.Entries, e)
+			continue
+		}
+		unmerged[e.Name] |= 1 << (e.FlagStage - 1)
+	}
+
+	return merged, unmerged
+}
+
 func (repo *Repository) StatusIndexWorktree(index *GitIndex) error {
 	fmt.Println("Changes not staged for commit:")
 
@@ -152,6 +208,13 @@ func (repo *Repository) StatusIndexWorktree(index *GitIndex) error {
 	for _, e := range index.Entries {
 		fullPath := filepath.Join(repo.Worktree, e.Name)
 
+		if e.FlagStage != 0 {
+			if i := slices.Index(allFiles, e.Name); i != -1 {
+				allFiles = slices.Delete(allFiles, i, i+1)
+			}
+			continue
+		}
+
 		stat, err := os.Stat(fullPath)
 		if err != nil {
 			fmt.Printf("deleted: %s\n", e.Name)
@@ -181,7 +244,7 @@ func (repo *Repository) StatusIndexWorktree(index *GitIndex) error {
 
 		i := slices.Index(allFiles, e.Name)
 		if i != -1 {
-			slices.Delete(allFiles, i, i+1)
+			allFiles = slices.Delete(allFiles, i, i+1)
 		}
 
 	}
@@ -192,10 +255,96 @@ func (repo *Repository) StatusIndexWorktree(index *GitIndex) error {
 	for _, f := range allFiles {
 		// @TODO If a full directory is untracked, we should display its name without its contents.
 		res, err := CheckIgnore(ignore, f)
-		if err == nil && res {
+		if err == nil && !res {
 			fmt.Printf(" %s\n", f)
 		}
 	}
 
 	return nil
 }
+
+func (repo *Repository) WorktreeDirty() (bool, error) {
+	/*
+		true when the index or a tracked file differs from HEAD, untracked files do not count
+	*/
+	index, err := repo.IndexRead()
+	if err != nil {
+		return false, err
+	}
+
+	head := &map[string]string{}
+	if _, err := repo.RefResolve("HEAD"); err == nil {
+		head, err = repo.treeToDict("HEAD", "")
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if len(index.Entries) != len(*head) {
+		return true, nil
+	}
+
+	for _, e := range index.Entries {
+		if sha, ok := (*head)[e.Name]; !ok || sha != e.Sha {
+			return true, nil
+		}
+
+		sha, err := repo.worktreeFileSha(e.Name)
+		if err != nil || sha != e.Sha {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (repo *Repository) WorktreeUntracked(index *GitIndex, paths []string) ([]string, error) {
+	/*
+		paths: default val is [], every path
+		the files of the worktree that are neither in the index nor ignored, sorted
+	*/
+	ignore, err := repo.GitIgnoreRead()
+	if err != nil {
+		return []string{}, err
+	}
+
+	tracked := map[string]bool{}
+	for _, e := range index.Entries {
+		tracked[e.Name] = true
+	}
+
+	ret := []string{}
+	err = filepath.WalkDir(repo.Worktree, func(fullPath string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if fullPath == repo.Gitdir {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(repo.Worktree, fullPath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if tracked[name] || !diffPathMatch(name, paths) {
+			return nil
+		}
+		if ignored, err := CheckIgnore(ignore, name); err == nil && ignored {
+			return nil
+		}
+
+		ret = append(ret, name)
+		return nil
+	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	slices.Sort(ret)
+	return ret, nil
+}
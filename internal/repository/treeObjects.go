@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"slices"
+	"strings"
 )
 
 type GitTreeLeaf struct {
@@ -75,70 +76,35 @@ func TreeParser(raw []byte) ([]*GitTreeLeaf, error) {
 	return ret, nil
 }
 
+func treeLeafSortKey(leaf *GitTreeLeaf) string {
+	if string(leaf.Mode[:2]) == "04" || string(leaf.Mode[:2]) == "40" {
+		return leaf.Path + "/"
+	}
+
+	return leaf.Path
+}
+
 func TreeSerialize(tree *GitTree) ([]byte, error) {
 	if tree == nil {
 		return []byte{}, fmt.Errorf("tree is nil")
 	}
-	//SORT THIS LIKE GIT
-	slices.SortFunc((*tree).Items, func(a, b *GitTreeLeaf) int {
-		var objType []byte
-		if len(a.Mode) == 5 {
-			objType = a.Mode[:1]
-		} else {
-			objType = a.Mode[:2]
-		}
-
-		objTypeNumStr := string(objType)
-		switch {
-		case objTypeNumStr == "04":
-			a.Path += "/"
-		case objTypeNumStr == "10":
-			break
-		case objTypeNumStr == "12":
-			a.Path += "/"
-		case objTypeNumStr == "16":
-			a.Path += "/"
-		default:
-			return 0
-		}
-
-		if len(b.Mode) == 5 {
-			objType = b.Mode[:1]
-		} else {
-			objType = b.Mode[:2]
-		}
-
-		objTypeNumStr = string(objType)
-		switch {
-		case objTypeNumStr == "04":
-			b.Path += "/"
-		case objTypeNumStr == "10":
-			break
-		case objTypeNumStr == "12":
-			b.Path += "/"
-		case objTypeNumStr == "16":
-			b.Path += "/"
-		default:
-			return 0
-		}
-
-		if a.Path < b.Path {
-			return -1
-		}
-		if a.Path > b.Path {
-			return 1
-		}
 
-		return 0
+	slices.SortFunc((*tree).Items, func(a, b *GitTreeLeaf) int {
+		return strings.Compare(treeLeafSortKey(a), treeLeafSortKey(b))
 	})
 	ret := make([]byte, 0)
 
 	for _, leaf := range tree.Items {
-		ret = append(ret, leaf.Mode...)
+		shaBytes, err := hex.DecodeString(leaf.Sha)
+		if err != nil || len(shaBytes) != 20 {
+			return []byte{}, fmt.Errorf("tree leaf has invalid sha:%s path:%s\n", leaf.Sha, leaf.Path)
+		}
+
+		ret = append(ret, bytes.TrimLeft(leaf.Mode, "0")...)
 		ret = append(ret, ' ')
 		ret = append(ret, []byte(leaf.Path)...)
 		ret = append(ret, '\x00')
-		ret = append(ret, []byte(leaf.Sha)...)
+		ret = append(ret, shaBytes...)
 	}
 
 	return ret, nil
@@ -59,12 +59,12 @@ func KvlmParserWrapper(raw *[]byte, start int, parsed *sharedtypes.Kvlm) (*share
 	return KvlmParser(raw, start, parsed)
 }
 func KvlmParser(raw *[]byte, start int, parsed *sharedtypes.Kvlm) (*sharedtypes.Kvlm, error) {
-	spc := bytes.IndexByte((*raw)[start:], ' ') + start
-	nl := bytes.IndexByte((*raw)[start:], '\n') + start
+	spc := bytes.IndexByte((*raw)[start:], ' ')
+	nl := bytes.IndexByte((*raw)[start:], '\n')
 
 	if spc < 0 || nl < spc {
-		if start != nl {
-			return nil, fmt.Errorf("final message reached but nl != start nl:%d start:%d\n", nl, start)
+		if nl != 0 {
+			return nil, fmt.Errorf("final message reached but nl != start nl:%d start:%d\n", nl+start, start)
 		}
 
 		val := append((*(*parsed).Map)[""], (*raw)[start+1:])
@@ -72,22 +72,35 @@ func KvlmParser(raw *[]byte, start int, parsed *sharedtypes.Kvlm) (*sharedtypes.
 
 		return parsed, nil
 	}
+	spc += start
 
 	key := (*raw)[start:spc]
 
 	end := start
 	for {
-		end = bytes.IndexByte((*raw)[start:], '\n') + start
-		if end == -1 || end+1 >= len(*raw) || (*raw)[end+1] != ' ' {
+		next := bytes.IndexByte((*raw)[end:], '\n')
+		if next == -1 {
+			end = len(*raw)
 			break
 		}
+		end += next
+		if end+1 >= len(*raw) || (*raw)[end+1] != ' ' {
+			break
+		}
+		end++
 	}
 
+	value := bytes.ReplaceAll((*raw)[spc+1:end], []byte("\n "), []byte("\n"))
+
 	val, ok := (*(*parsed).Map)[string(key)]
 	if !ok {
-		(*parsed).Insert(string(key), [][]byte{(*raw)[spc+1 : end]})
+		(*parsed).Insert(string(key), [][]byte{value})
 	} else {
-		(*parsed).Insert(string(key), append(val, (*raw)[spc+1:end]))
+		(*parsed).Insert(string(key), append(val, value))
+	}
+
+	if end >= len(*raw) {
+		return parsed, nil
 	}
 
 	return KvlmParser(raw, end+1, parsed)
@@ -108,12 +121,12 @@ func KvlmSerialize(kvlm *sharedtypes.Kvlm) ([]byte, error) {
 		if !ok {
 			return []byte{}, fmt.Errorf("key does not have value in kvml key:%s\n", key)
 		}
-		ret = append(ret, []byte(key)...)
-		ret = append(ret, ' ')
 		for _, b := range val {
-			ret = append(ret, b...)
+			ret = append(ret, []byte(key)...)
+			ret = append(ret, ' ')
+			ret = append(ret, bytes.ReplaceAll(b, []byte("\n"), []byte("\n "))...)
+			ret = append(ret, '\n')
 		}
-		ret = append(ret, '\n')
 	}
 
 	val, ok := (*(*kvlm).Map)[""]
@@ -124,7 +137,6 @@ func KvlmSerialize(kvlm *sharedtypes.Kvlm) ([]byte, error) {
 	for _, b := range val {
 		ret = append(ret, b...)
 	}
-	ret = append(ret, '\n')
 
 	return ret, nil
 }
@@ -4,10 +4,232 @@ import (
 	"flag"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/neet-007/git_in_go/internal/bridges"
+	"github.com/neet-007/git_in_go/internal/diff"
+	"github.com/neet-007/git_in_go/internal/repository"
 )
 
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type abbrevFlag int
+
+func (a *abbrevFlag) String() string {
+	return strconv.Itoa(int(*a))
+}
+
+func (a *abbrevFlag) Set(value string) error {
+	if value == "true" {
+		*a = 7
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+
+	*a = abbrevFlag(n)
+	return nil
+}
+
+func (a *abbrevFlag) IsBoolFlag() bool {
+	return true
+}
+
+type markFlag string
+
+func (m *markFlag) String() string {
+	return string(*m)
+}
+
+func (m *markFlag) Set(value string) error {
+	if value == "true" {
+		*m = "-dirty"
+		return nil
+	}
+
+	*m = markFlag(value)
+	return nil
+}
+
+func (m *markFlag) IsBoolFlag() bool {
+	return true
+}
+
+func countShorthand(args []string) []string {
+	/*
+		rewrites git's -<n> into -n <n>, flag does not know about numeric flags
+	*/
+	ret := []string{}
+	for _, arg := range args {
+		if len(arg) > 1 && arg[0] == '-' {
+			if _, err := strconv.Atoi(arg[1:]); err == nil {
+				ret = append(ret, "-n", arg[1:])
+				continue
+			}
+		}
+		ret = append(ret, arg)
+	}
+
+	return ret
+}
+
+type optionalFlag struct {
+	set   bool
+	value string
+}
+
+func (o *optionalFlag) String() string {
+	return o.value
+}
+
+func (o *optionalFlag) Set(value string) error {
+	/*
+		a flag with an optional value, a bare flag keeps the default value
+	*/
+	o.set = true
+	if value != "true" {
+		o.value = value
+	}
+
+	return nil
+}
+
+func (o *optionalFlag) IsBoolFlag() bool {
+	return true
+}
+
+func colorWanted(color optionalFlag) bool {
+	/*
+		--color takes always, never or auto, a bare --color is always and auto colors
+		only when stdout is a terminal
+	*/
+	if !color.set {
+		return false
+	}
+
+	switch color.value {
+	case "always":
+		return true
+	case "never":
+		return false
+	case "auto":
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+
+	log.Fatal("option 'color' expects \"always\", \"auto\", or \"never\"")
+	return false
+}
+
+func valueShorthand(args []string, letters string) []string {
+	/*
+		rewrites git's -U<n>, -M<n>% and the like into -U=<n>, for every letter in letters
+	*/
+	ret := []string{}
+	for _, arg := range args {
+		if len(arg) > 2 && arg[0] == '-' && strings.IndexByte(letters, arg[1]) != -1 && arg[2] != '=' {
+			arg = arg[:2] + "=" + arg[2:]
+		}
+		ret = append(ret, arg)
+	}
+
+	return ret
+}
+
+func shortFlags(fs *flag.FlagSet, args []string) []string {
+	/*
+		rewrites bundled single letter flags like -sne into -s -n -e and attached values
+		like -n1 into -n=1, flag only knows one flag per argument
+	*/
+	isBool := func(f *flag.Flag) bool {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		return ok && b.IsBoolFlag()
+	}
+
+	ret := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return append(ret, args[i:]...)
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if f := fs.Lookup(name); f != nil {
+			ret = append(ret, arg)
+			if !isBool(f) && i+1 < len(args) {
+				ret = append(ret, args[i+1])
+				i++
+			}
+			continue
+		}
+		if arg[1] == '-' || strings.Contains(arg, "=") {
+			ret = append(ret, arg)
+			continue
+		}
+
+		expanded := []string{}
+		valueNext := false
+		for j := 1; j < len(arg); j++ {
+			f := fs.Lookup(arg[j : j+1])
+			if f == nil {
+				expanded = nil
+				break
+			}
+			if isBool(f) {
+				expanded = append(expanded, "-"+arg[j:j+1])
+				continue
+			}
+
+			if j+1 < len(arg) {
+				expanded = append(expanded, "-"+arg[j:j+1]+"="+arg[j+1:])
+			} else {
+				expanded = append(expanded, "-"+arg[j:j+1])
+				valueNext = true
+			}
+			break
+		}
+
+		if expanded == nil {
+			ret = append(ret, arg)
+			continue
+		}
+		ret = append(ret, expanded...)
+		if valueNext && i+1 < len(args) {
+			ret = append(ret, args[i+1])
+			i++
+		}
+	}
+
+	return ret
+}
+
+func splitPathspec(args []string) ([]string, []string) {
+	/*
+		everything after "--" is a path, flag would eat the "--" itself
+	*/
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+
+	return args, []string{}
+}
+
 func main() {
 
 	args := os.Args
@@ -15,21 +237,297 @@ func main() {
 	switch args[1] {
 	case "add":
 		bridges.CmdAdd(args[2:]...)
+	case "blame":
+		var rangesFlag stringSliceFlag
+		var ignoreWhitespaceFlag bool
+		var movesFlag optionalFlag
+		var porcelainFlag bool
+
+		blameCmd := flag.NewFlagSet("blame", flag.ExitOnError)
+		blameCmd.Var(&rangesFlag, "L", "only blame the lines start,end, can be repeated")
+		blameCmd.BoolVar(&ignoreWhitespaceFlag, "w", false, "ignore whitespace when comparing versions")
+		blameCmd.Var(&movesFlag, "M", "detect lines moved within the file, optionally with a minimum score")
+		blameCmd.BoolVar(&porcelainFlag, "porcelain", false, "print a format meant for tools")
+
+		blameArgs, blamePaths := splitPathspec(args[2:])
+		blameCmd.Parse(shortFlags(blameCmd, valueShorthand(blameArgs, "LM")))
+
+		moveScore := 0
+		if movesFlag.value != "" {
+			score, err := strconv.Atoi(movesFlag.value)
+			if err != nil {
+				log.Fatalf("invalid -M score '%s'", movesFlag.value)
+			}
+			moveScore = score
+		}
+
+		bridges.CmdBlame(blameCmd.Args(), blamePaths, repository.BlameOptions{
+			Ranges:           rangesFlag,
+			IgnoreWhitespace: ignoreWhitespaceFlag,
+			Moves:            movesFlag.set,
+			MoveScore:        moveScore,
+			Porcelain:        porcelainFlag,
+		})
 	case "cat-file":
 		bridges.CmdCatFile(args...)
 	case "check-ignore":
 		bridges.CmdCheckIgnore(args[2:]...)
+	case "check-mailmap":
+		var stdinFlag bool
+
+		checkMailmapCmd := flag.NewFlagSet("check-mailmap", flag.ExitOnError)
+		checkMailmapCmd.BoolVar(&stdinFlag, "stdin", false, "also read contacts from stdin, one per line")
+
+		checkMailmapCmd.Parse(shortFlags(checkMailmapCmd, args[2:]))
+
+		positionalArgs := checkMailmapCmd.Args()
+
+		if len(positionalArgs) == 0 && !stdinFlag {
+			log.Fatal("You must provide at least one contact for check-mailmap")
+		}
+
+		bridges.CmdCheckMailmap(positionalArgs, stdinFlag)
+	case "check-ref-format":
+		var branchFlag bool
+		var allowOneLevelFlag bool
+		var refspecPatternFlag bool
+		var normalizeFlag bool
+
+		checkRefFormatCmd := flag.NewFlagSet("check-ref-format", flag.ExitOnError)
+		checkRefFormatCmd.BoolVar(&branchFlag, "branch", false, "check the name as a branch name and print it")
+		checkRefFormatCmd.BoolVar(&allowOneLevelFlag, "allow-onelevel", false, "allow names with a single component")
+		checkRefFormatCmd.BoolVar(&refspecPatternFlag, "refspec-pattern", false, "allow a single '*' in the name")
+		checkRefFormatCmd.BoolVar(&normalizeFlag, "normalize", false, "collapse slashes and print the name")
+
+		checkRefFormatCmd.Parse(shortFlags(checkRefFormatCmd, args[2:]))
+
+		positionalArgs := checkRefFormatCmd.Args()
+
+		if len(positionalArgs) != 1 {
+			log.Fatal("You must provide exactly one name for check-ref-format")
+		}
+
+		bridges.CmdCheckRefFormat(positionalArgs[0], branchFlag, repository.RefFormatOptions{
+			AllowOneLevel:  allowOneLevelFlag,
+			RefspecPattern: refspecPatternFlag,
+			Normalize:      normalizeFlag,
+		})
 	case "checkout":
-		bridges.CmdCheckout(args[2], args[3])
+		if len(args) < 3 {
+			log.Fatal("You must provide a branch or commit for checkout")
+		}
+
+		if len(args) == 3 {
+			bridges.CmdCheckout(args[2], "")
+		} else {
+			bridges.CmdCheckout(args[2], args[3])
+		}
+	case "cherry-pick":
+		var continueFlag bool
+		var skipFlag bool
+		var abortFlag bool
+		var recordOriginFlag bool
+		var noCommitFlag bool
+		var mainlineFlag int
+		var strategyOptionFlag string
+
+		cherryPickCmd := flag.NewFlagSet("cherry-pick", flag.ExitOnError)
+		cherryPickCmd.BoolVar(&continueFlag, "continue", false, "commit the resolved cherry-pick and go on with the rest")
+		cherryPickCmd.BoolVar(&skipFlag, "skip", false, "drop the cherry-pick that stopped and go on with the rest")
+		cherryPickCmd.BoolVar(&abortFlag, "abort", false, "go back to where the cherry-pick started")
+		cherryPickCmd.BoolVar(&recordOriginFlag, "x", false, "append the commit the change was picked from to the message")
+		cherryPickCmd.BoolVar(&noCommitFlag, "n", false, "apply the changes to the index and the worktree without committing")
+		cherryPickCmd.BoolVar(&noCommitFlag, "no-commit", false, "same as n")
+		cherryPickCmd.IntVar(&mainlineFlag, "m", 0, "the parent number of a merge to diff against")
+		cherryPickCmd.IntVar(&mainlineFlag, "mainline", 0, "same as m")
+		cherryPickCmd.StringVar(&strategyOptionFlag, "X", "", "ours or theirs to resolve content conflicts to that side")
+
+		cherryPickCmd.Parse(shortFlags(cherryPickCmd, args[2:]))
+
+		positionalArgs := cherryPickCmd.Args()
+		if !(continueFlag || skipFlag || abortFlag) && len(positionalArgs) == 0 {
+			log.Fatal("You must provide at least one commit for cherry-pick")
+		}
+
+		opts := repository.SequencerOptions{Revert: false, RecordOrigin: recordOriginFlag, NoCommit: noCommitFlag, Mainline: mainlineFlag, Tree: repository.DefaultMergeTreeOptions()}
+		switch strategyOptionFlag {
+		case "":
+		case diff.FavorOurs, diff.FavorTheirs:
+			opts.Tree.Favor = strategyOptionFlag
+		default:
+			log.Fatalf("unknown strategy option: -X%s", strategyOptionFlag)
+		}
+
+		bridges.CmdCherryPick(positionalArgs, continueFlag, skipFlag, abortFlag, opts)
 	case "commit":
 		var messageFlag string
 
 		commitCmd := flag.NewFlagSet("hash-object", flag.ExitOnError)
 		commitCmd.StringVar(&messageFlag, "m", "", "the message of the commit")
 
-		commitCmd.Parse(args[2:])
+		commitCmd.Parse(shortFlags(commitCmd, args[2:]))
 
 		bridges.CmdCommit(messageFlag)
+	case "describe":
+		var tagsFlag bool
+		var allFlag bool
+		var longFlag bool
+		var alwaysFlag bool
+		var abbrevFlag int
+		var matchFlag stringSliceFlag
+		var dirtyFlag markFlag
+
+		describeCmd := flag.NewFlagSet("describe", flag.ExitOnError)
+		describeCmd.BoolVar(&tagsFlag, "tags", false, "use lightweight tags too")
+		describeCmd.BoolVar(&allFlag, "all", false, "use any ref")
+		describeCmd.BoolVar(&longFlag, "long", false, "always print the long format, even on a tag")
+		describeCmd.BoolVar(&alwaysFlag, "always", false, "print the abbreviated sha when no tag describes the commit")
+		describeCmd.IntVar(&abbrevFlag, "abbrev", 7, "abbreviate the sha to this many chars, 0 prints only the tag")
+		describeCmd.Var(&matchFlag, "match", "only consider tags matching this glob, can be repeated")
+		describeCmd.Var(&dirtyFlag, "dirty", "append a mark, -dirty by default, when the worktree differs from HEAD")
+
+		describeCmd.Parse(shortFlags(describeCmd, args[2:]))
+
+		if longFlag && abbrevFlag == 0 {
+			log.Fatal("options '--long' and '--abbrev=0' cannot be used together")
+		}
+
+		opts := repository.DescribeOptions{Tags: tagsFlag, All: allFlag, Long: longFlag, Always: alwaysFlag, Abbrev: abbrevFlag, Match: matchFlag, Dirty: string(dirtyFlag)}
+		bridges.CmdDescribe(describeCmd.Args(), opts)
+	case "diff":
+		var cachedFlag bool
+		var stagedFlag bool
+		var patchFlag bool
+		var statFlag bool
+		var numStatFlag bool
+		var nameOnlyFlag bool
+		var nameStatusFlag bool
+		var exitCodeFlag bool
+		var unifiedFlag int
+		var interHunkFlag int
+		var algorithmFlag string
+		var noIndentHeuristicFlag bool
+		var renamesFlag optionalFlag
+		var copiesFlag optionalFlag
+		var noRenamesFlag bool
+		colorFlag := optionalFlag{value: "always"}
+		colorMovedFlag := optionalFlag{value: "default"}
+		wordDiffFlag := optionalFlag{value: diff.WordsPlain}
+		var wordDiffRegexFlag string
+		var colorWordsFlag optionalFlag
+
+		diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+		diffCmd.BoolVar(&cachedFlag, "cached", false, "compare the index to HEAD or the given commit")
+		diffCmd.BoolVar(&stagedFlag, "staged", false, "same as cached")
+		diffCmd.BoolVar(&patchFlag, "p", false, "print the patch, the default without another format")
+		diffCmd.BoolVar(&patchFlag, "patch", false, "same as p")
+		diffCmd.BoolVar(&statFlag, "stat", false, "print a diffstat")
+		diffCmd.BoolVar(&numStatFlag, "numstat", false, "print the added and deleted lines of every file")
+		diffCmd.BoolVar(&nameOnlyFlag, "name-only", false, "print only the names of the changed files")
+		diffCmd.BoolVar(&nameStatusFlag, "name-status", false, "print the names and the status of the changed files")
+		diffCmd.BoolVar(&exitCodeFlag, "exit-code", false, "exit with 1 when there are differences")
+		diffCmd.IntVar(&unifiedFlag, "U", 3, "lines of context")
+		diffCmd.IntVar(&unifiedFlag, "unified", 3, "lines of context")
+		diffCmd.IntVar(&interHunkFlag, "inter-hunk-context", 0, "merge hunks separated by up to this many lines")
+		diffCmd.StringVar(&algorithmFlag, "diff-algorithm", "myers", "myers, minimal, patience or histogram")
+		diffCmd.BoolVar(&noIndentHeuristicFlag, "no-indent-heuristic", false, "do not slide changes to block boundaries")
+		diffCmd.Var(&renamesFlag, "M", "detect renames, optionally with a minimum similarity like 50%")
+		diffCmd.Var(&renamesFlag, "find-renames", "same as M")
+		diffCmd.Var(&copiesFlag, "C", "detect copies from modified files as well as renames")
+		diffCmd.Var(&copiesFlag, "find-copies", "same as C")
+		diffCmd.BoolVar(&noRenamesFlag, "no-renames", false, "do not detect renames")
+		diffCmd.Var(&colorFlag, "color", "color the patch and the diffstat, always, never or auto")
+		diffCmd.Var(&colorMovedFlag, "color-moved", "color moved lines, no, default, plain, blocks, zebra or dimmed-zebra")
+		diffCmd.Var(&wordDiffFlag, "word-diff", "diff words instead of lines, plain, color or porcelain")
+		diffCmd.StringVar(&wordDiffRegexFlag, "word-diff-regex", "", "regex matching a word, implies word-diff")
+		diffCmd.Var(&colorWordsFlag, "color-words", "same as word-diff=color, optionally with a word regex")
+
+		diffArgs, diffPaths := splitPathspec(args[2:])
+		diffCmd.Parse(shortFlags(diffCmd, valueShorthand(diffArgs, "UMC")))
+
+		algorithm, err := diff.ParseAlgorithm(algorithmFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		diffOpts := diff.Options{Algorithm: algorithm, Context: unifiedFlag, InterHunkContext: interHunkFlag, IndentHeuristic: !noIndentHeuristicFlag}
+		renameScore := renamesFlag.value
+		if copiesFlag.set {
+			renameScore = copiesFlag.value
+		}
+
+		colorMoved := repository.ColorMovedNo
+		if colorMovedFlag.set {
+			if colorMoved, err = repository.ParseColorMoved(colorMovedFlag.value); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		wordDiff, wordRegex := "", wordDiffRegexFlag
+		if wordDiffFlag.set || wordRegex != "" {
+			wordDiff = wordDiffFlag.value
+		}
+		if colorWordsFlag.set {
+			wordDiff = diff.WordsColor
+			if colorWordsFlag.value != "" {
+				wordRegex = colorWordsFlag.value
+			}
+		}
+		if wordDiff != "" {
+			if _, err := diff.NewWordStyle(wordDiff); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		var wordRe *regexp.Regexp
+		if wordRegex != "" {
+			if wordRe, err = diff.CompileWordRegex(wordRegex); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		bridges.CmdDiff(diffCmd.Args(), diffPaths, cachedFlag || stagedFlag, exitCodeFlag, repository.DiffOptions{
+			Diff:        diffOpts,
+			Renames:     !noRenamesFlag,
+			Copies:      copiesFlag.set,
+			RenameScore: repository.ParseRenameScore(renameScore),
+			Patch:       patchFlag || !(statFlag || numStatFlag || nameOnlyFlag || nameStatusFlag),
+			Stat:        statFlag,
+			NumStat:     numStatFlag,
+			NameOnly:    nameOnlyFlag,
+			NameStatus:  nameStatusFlag,
+			Color:       colorWanted(colorFlag) || wordDiff == diff.WordsColor,
+			ColorMoved:  colorMoved,
+			WordDiff:    wordDiff,
+			WordRegex:   wordRe,
+		})
+	case "for-each-ref":
+		var formatFlag string
+		var sortFlag stringSliceFlag
+		var countFlag int
+		var pointsAtFlag string
+		var mergedFlag string
+		var containsFlag string
+
+		forEachRefCmd := flag.NewFlagSet("for-each-ref", flag.ExitOnError)
+		forEachRefCmd.StringVar(&formatFlag, "format", "", "format of every printed ref")
+		forEachRefCmd.Var(&sortFlag, "sort", "field to sort on, prefix with - for descending order")
+		forEachRefCmd.IntVar(&countFlag, "count", 0, "stop after printing this many refs")
+		forEachRefCmd.StringVar(&pointsAtFlag, "points-at", "", "only refs pointing at the object")
+		forEachRefCmd.StringVar(&mergedFlag, "merged", "", "only refs reachable from the commit")
+		forEachRefCmd.StringVar(&containsFlag, "contains", "", "only refs containing the commit")
+
+		forEachRefCmd.Parse(shortFlags(forEachRefCmd, args[2:]))
+
+		bridges.CmdForEachRef(repository.ForEachRefOptions{
+			Format:   formatFlag,
+			Sort:     sortFlag,
+			Count:    countFlag,
+			Patterns: forEachRefCmd.Args(),
+			PointsAt: pointsAtFlag,
+			Merged:   mergedFlag,
+			Contains: containsFlag,
+		})
 	case "hash-object":
 		var writeFlag bool
 		var typeFlag string
@@ -38,7 +536,7 @@ func main() {
 		hashObjectCmd.BoolVar(&writeFlag, "w", false, "Write the hash to the repo")
 		hashObjectCmd.StringVar(&typeFlag, "t", "", "Specify the type of the hash")
 
-		hashObjectCmd.Parse(args[2:])
+		hashObjectCmd.Parse(shortFlags(hashObjectCmd, args[2:]))
 
 		positionalArgs := hashObjectCmd.Args()
 
@@ -48,20 +546,105 @@ func main() {
 
 		bridges.CmdHashObject(writeFlag, typeFlag, positionalArgs[0])
 	case "init":
-		bridges.CmdInit(args...)
-	case "log":
-		if len(args) < 3 {
-			bridges.CmdLog("HEAD")
+		var refFormatFlag string
+
+		initCmd := flag.NewFlagSet("init", flag.ExitOnError)
+		initCmd.StringVar(&refFormatFlag, "ref-format", "files", "ref storage format, files or reftable")
+
+		initCmd.Parse(shortFlags(initCmd, args[2:]))
+
+		positionalArgs := initCmd.Args()
+
+		if len(positionalArgs) == 0 {
+			bridges.CmdInit(".", refFormatFlag)
 		} else {
-			bridges.CmdLog(args[2])
+			bridges.CmdInit(positionalArgs[0], refFormatFlag)
+		}
+	case "log":
+		var graphvizFlag bool
+		var onelineFlag bool
+		var formatFlag string
+		var dateFlag string
+		var decorateFlag bool
+		var allFlag bool
+		var maxCountFlag int
+		var topoOrderFlag bool
+		var dateOrderFlag bool
+		var reverseFlag bool
+		var firstParentFlag bool
+		var sinceFlag string
+		var untilFlag string
+		var graphFlag bool
+		colorFlag := optionalFlag{value: "always"}
+		var fullHistoryFlag bool
+		var followFlag bool
+		var jsonFlag bool
+
+		logCmd := flag.NewFlagSet("log", flag.ExitOnError)
+		logCmd.BoolVar(&graphvizFlag, "graphviz", false, "print the history as a graphviz DOT digraph")
+		logCmd.BoolFunc("oneline", "one line per commit with the abbreviated sha, same as format=oneline", func(string) error {
+			onelineFlag, formatFlag = true, "oneline"
+			return nil
+		})
+		logCmd.Func("format", "oneline, short, medium, full, fuller, mermaid, format:<fmt> or tformat:<fmt>", func(value string) error {
+			formatFlag = value
+			return nil
+		})
+		logCmd.Func("pretty", "same as format", func(value string) error {
+			formatFlag = value
+			return nil
+		})
+		logCmd.StringVar(&dateFlag, "date", "", "default, iso, iso-strict, rfc, short, raw, unix or relative")
+		logCmd.BoolVar(&decorateFlag, "decorate", false, "show the refs pointing at every commit")
+		logCmd.BoolVar(&allFlag, "all", false, "walk from every ref and HEAD")
+		logCmd.IntVar(&maxCountFlag, "max-count", -1, "stop after this many commits")
+		logCmd.IntVar(&maxCountFlag, "n", -1, "stop after this many commits")
+		logCmd.BoolVar(&topoOrderFlag, "topo-order", false, "no parent before its children, keep lines of history together")
+		logCmd.BoolVar(&dateOrderFlag, "date-order", false, "no parent before its children, otherwise by commit date")
+		logCmd.BoolVar(&reverseFlag, "reverse", false, "print the selected commits in reverse")
+		logCmd.BoolVar(&firstParentFlag, "first-parent", false, "only follow the first parent of merges")
+		logCmd.StringVar(&sinceFlag, "since", "", "only commits newer than the date")
+		logCmd.StringVar(&untilFlag, "until", "", "only commits older than the date")
+		logCmd.BoolVar(&graphFlag, "graph", false, "draw the branch and merge lines next to the commits")
+		logCmd.Var(&colorFlag, "color", "color the lines of the graph, always, never or auto")
+		logCmd.BoolVar(&fullHistoryFlag, "full-history", false, "do not simplify merges when limiting to paths")
+		logCmd.BoolVar(&followFlag, "follow", false, "continue the history of a single file past renames")
+		logCmd.BoolVar(&jsonFlag, "json", false, "print the commits as a json array")
+
+		logArgs, logPaths := splitPathspec(args[2:])
+		logCmd.Parse(shortFlags(logCmd, countShorthand(logArgs)))
+
+		order := ""
+		if dateOrderFlag {
+			order = "date"
+		}
+		if topoOrderFlag || (graphFlag || formatFlag == "mermaid") && order == "" {
+			order = "topo"
+		}
+
+		if reverseFlag && graphFlag {
+			log.Fatal("options '--reverse' and '--graph' cannot be used together")
 		}
+
+		logOpts := repository.LogOptions{Format: formatFlag, Date: dateFlag, Decorate: decorateFlag, Graph: graphFlag, Color: colorWanted(colorFlag), JSON: jsonFlag, Abbrev: onelineFlag}
+
+		bridges.CmdLog(logCmd.Args(), logPaths, repository.RevWalkOptions{
+			All:            allFlag,
+			MaxCount:       maxCountFlag,
+			Order:          order,
+			Reverse:        reverseFlag,
+			FirstParent:    firstParentFlag,
+			FullHistory:    fullHistoryFlag,
+			Follow:         followFlag,
+			RewriteParents: graphFlag,
+		}, sinceFlag, untilFlag, logOpts, graphvizFlag)
 	case "ls-files":
 		var verboseFlag bool
 
 		lsFilesCmd := flag.NewFlagSet("ls-files", flag.ExitOnError)
 		lsFilesCmd.BoolVar(&verboseFlag, "verbose", false, "recursively print the tree")
 
-		lsFilesCmd.Parse(args[2:])
+		lsFilesCmd.Parse(shortFlags(lsFilesCmd, args[2:]))
 
 		positionalArgs := lsFilesCmd.Args()
 
@@ -76,7 +659,7 @@ func main() {
 		lsTreeCmd := flag.NewFlagSet("ls-tree", flag.ExitOnError)
 		lsTreeCmd.BoolVar(&recursiceFlag, "r", false, "recursively print the tree")
 
-		lsTreeCmd.Parse(args[2:])
+		lsTreeCmd.Parse(shortFlags(lsTreeCmd, args[2:]))
 
 		positionalArgs := lsTreeCmd.Args()
 
@@ -85,39 +668,560 @@ func main() {
 		}
 
 		bridges.CmdLsTree(positionalArgs[0], recursiceFlag)
+	case "merge":
+		var noFFFlag bool
+		var ffOnlyFlag bool
+		var squashFlag bool
+		var abortFlag bool
+		var continueFlag bool
+		var messageFlag string
+		var conflictFlag string
+		var strategyOptionFlag string
+
+		mergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+		mergeCmd.BoolVar(&noFFFlag, "no-ff", false, "create a merge commit even when the merge could fast-forward")
+		mergeCmd.BoolVar(&ffOnlyFlag, "ff-only", false, "refuse to merge unless it is a fast-forward")
+		mergeCmd.BoolVar(&squashFlag, "squash", false, "update the index and the worktree without committing")
+		mergeCmd.BoolVar(&abortFlag, "abort", false, "reset to HEAD and forget the merge in progress")
+		mergeCmd.BoolVar(&continueFlag, "continue", false, "commit the merge once the conflicts are resolved")
+		mergeCmd.StringVar(&messageFlag, "m", "", "the message of the merge commit")
+		mergeCmd.StringVar(&conflictFlag, "conflict", diff.StyleMerge, "conflict style, merge, diff3 or zdiff3")
+		mergeCmd.StringVar(&strategyOptionFlag, "X", "", "ours or theirs to resolve content conflicts to that side")
+
+		mergeCmd.Parse(shortFlags(mergeCmd, args[2:]))
+
+		positionalArgs := mergeCmd.Args()
+		switch {
+		case abortFlag || continueFlag:
+			if len(positionalArgs) != 0 {
+				log.Fatal("--abort and --continue take no arguments")
+			}
+		case len(positionalArgs) != 1:
+			log.Fatal("You must provide one commit to merge")
+		case noFFFlag && ffOnlyFlag:
+			log.Fatal("--no-ff and --ff-only are incompatible")
+		case squashFlag && noFFFlag:
+			log.Fatal("--squash and --no-ff are incompatible")
+		}
+
+		style, err := diff.ParseMergeStyle(conflictFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts := repository.MergeOptions{Tree: repository.DefaultMergeTreeOptions(), NoFF: noFFFlag, FFOnly: ffOnlyFlag, Squash: squashFlag, Message: messageFlag}
+		opts.Tree.Style = style
+		switch strategyOptionFlag {
+		case "":
+		case diff.FavorOurs, diff.FavorTheirs:
+			opts.Tree.Favor = strategyOptionFlag
+		default:
+			log.Fatalf("unknown strategy option: -X%s", strategyOptionFlag)
+		}
+
+		name := ""
+		if len(positionalArgs) == 1 {
+			name = positionalArgs[0]
+		}
+
+		bridges.CmdMerge(name, abortFlag, continueFlag, opts)
+	case "merge-base":
+		var allFlag bool
+		var octopusFlag bool
+		var isAncestorFlag bool
+		var forkPointFlag bool
+
+		mergeBaseCmd := flag.NewFlagSet("merge-base", flag.ExitOnError)
+		mergeBaseCmd.BoolVar(&allFlag, "all", false, "print all best common ancestors")
+		mergeBaseCmd.BoolVar(&allFlag, "a", false, "same as all")
+		mergeBaseCmd.BoolVar(&octopusFlag, "octopus", false, "the best common ancestors of all commits")
+		mergeBaseCmd.BoolVar(&isAncestorFlag, "is-ancestor", false, "exit with 0 when the first commit is an ancestor of the second")
+		mergeBaseCmd.BoolVar(&forkPointFlag, "fork-point", false, "where a commit forked from a ref, using the ref's reflog")
+
+		mergeBaseCmd.Parse(shortFlags(mergeBaseCmd, args[2:]))
+
+		positionalArgs := mergeBaseCmd.Args()
+
+		switch {
+		case isAncestorFlag && len(positionalArgs) != 2:
+			log.Fatal("--is-ancestor takes exactly two commits")
+		case forkPointFlag && (len(positionalArgs) < 1 || len(positionalArgs) > 2):
+			log.Fatal("--fork-point takes a ref and an optional commit")
+		case octopusFlag && len(positionalArgs) < 1:
+			log.Fatal("You must provide at least one commit for merge-base --octopus")
+		case !isAncestorFlag && !forkPointFlag && !octopusFlag && len(positionalArgs) < 2:
+			log.Fatal("You must provide at least two commits for merge-base")
+		}
+
+		bridges.CmdMergeBase(positionalArgs, allFlag, octopusFlag, isAncestorFlag, forkPointFlag)
+	case "merge-file":
+		var stdoutFlag bool
+		var diff3Flag bool
+		var zdiff3Flag bool
+		var labelsFlag stringSliceFlag
+		var oursFlag bool
+		var theirsFlag bool
+		var unionFlag bool
+		var algorithmFlag string
+		var markerSizeFlag int
+
+		mergeFileCmd := flag.NewFlagSet("merge-file", flag.ExitOnError)
+		mergeFileCmd.BoolVar(&stdoutFlag, "p", false, "print the result instead of writing it to the current file")
+		mergeFileCmd.BoolVar(&stdoutFlag, "stdout", false, "same as p")
+		mergeFileCmd.BoolVar(&diff3Flag, "diff3", false, "show the base in conflicts")
+		mergeFileCmd.BoolVar(&zdiff3Flag, "zdiff3", false, "show the base in conflicts without the lines both sides share")
+		mergeFileCmd.Var(&labelsFlag, "L", "labels of current, base and other in that order, can be repeated")
+		mergeFileCmd.BoolVar(&oursFlag, "ours", false, "resolve conflicts to the current side")
+		mergeFileCmd.BoolVar(&theirsFlag, "theirs", false, "resolve conflicts to the other side")
+		mergeFileCmd.BoolVar(&unionFlag, "union", false, "resolve conflicts to both sides")
+		mergeFileCmd.StringVar(&algorithmFlag, "diff-algorithm", "myers", "myers, minimal, patience or histogram")
+		mergeFileCmd.IntVar(&markerSizeFlag, "marker-size", diff.DefaultMarkerSize, "length of the conflict markers")
+
+		mergeFileCmd.Parse(shortFlags(mergeFileCmd, args[2:]))
+
+		positionalArgs := mergeFileCmd.Args()
+		if len(positionalArgs) != 3 {
+			log.Fatal("You must provide current, base and other files for merge-file")
+		}
+		if len(labelsFlag) > 3 {
+			log.Fatal("too many labels on the command line")
+		}
+
+		algorithm, err := diff.ParseAlgorithm(algorithmFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts := diff.MergeOptions{Diff: diff.Options{Algorithm: algorithm}, Style: diff.StyleMerge, MarkerSize: markerSizeFlag}
+		switch {
+		case zdiff3Flag:
+			opts.Style = diff.StyleZdiff3
+		case diff3Flag:
+			opts.Style = diff.StyleDiff3
+		}
+		switch {
+		case oursFlag:
+			opts.Favor = diff.FavorOurs
+		case theirsFlag:
+			opts.Favor = diff.FavorTheirs
+		case unionFlag:
+			opts.Favor = diff.FavorUnion
+		}
+		labels := []*string{&opts.OursLabel, &opts.BaseLabel, &opts.TheirsLabel}
+		for i, label := range labelsFlag {
+			*labels[i] = label
+		}
+
+		bridges.CmdMergeFile(positionalArgs[0], positionalArgs[1], positionalArgs[2], stdoutFlag, opts)
+	case "merge-tree":
+		var writeTreeFlag bool
+		var nameOnlyFlag bool
+		var noMessagesFlag bool
+		var conflictFlag string
+		var strategyOptionFlag string
+		var noRenamesFlag bool
+
+		mergeTreeCmd := flag.NewFlagSet("merge-tree", flag.ExitOnError)
+		mergeTreeCmd.BoolVar(&writeTreeFlag, "write-tree", true, "write the merged tree, the only mode there is")
+		mergeTreeCmd.BoolVar(&nameOnlyFlag, "name-only", false, "print only the names of the conflicted paths")
+		mergeTreeCmd.BoolVar(&noMessagesFlag, "no-messages", false, "do not print the conflict messages")
+		mergeTreeCmd.StringVar(&conflictFlag, "conflict", diff.StyleMerge, "conflict style, merge, diff3 or zdiff3")
+		mergeTreeCmd.StringVar(&strategyOptionFlag, "X", "", "ours or theirs to resolve content conflicts to that side")
+		mergeTreeCmd.BoolVar(&noRenamesFlag, "no-renames", false, "do not detect renames")
+
+		mergeTreeCmd.Parse(shortFlags(mergeTreeCmd, args[2:]))
+
+		positionalArgs := mergeTreeCmd.Args()
+		if len(positionalArgs) != 2 {
+			log.Fatal("You must provide two commits for merge-tree")
+		}
+
+		style, err := diff.ParseMergeStyle(conflictFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts := repository.DefaultMergeTreeOptions()
+		opts.Style = style
+		opts.Renames = !noRenamesFlag
+		switch strategyOptionFlag {
+		case "":
+		case diff.FavorOurs, diff.FavorTheirs:
+			opts.Favor = strategyOptionFlag
+		default:
+			log.Fatalf("unknown strategy option: -X%s", strategyOptionFlag)
+		}
+
+		bridges.CmdMergeTree(positionalArgs[0], positionalArgs[1], nameOnlyFlag, !noMessagesFlag, opts)
+	case "name-rev":
+		var tagsFlag bool
+		var nameOnlyFlag bool
+		var allFlag bool
+		var refsFlag stringSliceFlag
+
+		nameRevCmd := flag.NewFlagSet("name-rev", flag.ExitOnError)
+		nameRevCmd.BoolVar(&tagsFlag, "tags", false, "only use tags to name the commits")
+		nameRevCmd.BoolVar(&nameOnlyFlag, "name-only", false, "print only the name")
+		nameRevCmd.BoolVar(&allFlag, "all", false, "name every commit reachable from a ref")
+		nameRevCmd.Var(&refsFlag, "refs", "only use refs matching this glob, can be repeated")
+
+		nameRevCmd.Parse(shortFlags(nameRevCmd, args[2:]))
+
+		positionalArgs := nameRevCmd.Args()
+		if len(positionalArgs) == 0 && !allFlag {
+			log.Fatal("You must provide a commit for name-rev")
+		}
+
+		opts := repository.NameRevOptions{Tags: tagsFlag, NameOnly: nameOnlyFlag, Refs: refsFlag}
+		bridges.CmdNameRev(positionalArgs, allFlag, opts)
+	case "pack-refs":
+		bridges.CmdPackRefs()
+	case "rebase":
+		var interactiveFlag bool
+		var ontoFlag string
+		var continueFlag bool
+		var skipFlag bool
+		var abortFlag bool
+
+		rebaseCmd := flag.NewFlagSet("rebase", flag.ExitOnError)
+		rebaseCmd.BoolVar(&interactiveFlag, "i", false, "edit the list of commits to rebase first")
+		rebaseCmd.BoolVar(&interactiveFlag, "interactive", false, "same as i")
+		rebaseCmd.StringVar(&ontoFlag, "onto", "", "replay the commits on this commit instead of upstream")
+		rebaseCmd.BoolVar(&continueFlag, "continue", false, "go on once the stopped commit is resolved")
+		rebaseCmd.BoolVar(&skipFlag, "skip", false, "drop the stopped commit and go on")
+		rebaseCmd.BoolVar(&abortFlag, "abort", false, "go back to the branch the rebase started from")
+
+		rebaseCmd.Parse(shortFlags(rebaseCmd, args[2:]))
+
+		positionalArgs := rebaseCmd.Args()
+		switch {
+		case continueFlag || skipFlag || abortFlag:
+			if len(positionalArgs) != 0 {
+				log.Fatal("--continue, --skip and --abort take no arguments")
+			}
+		case len(positionalArgs) == 0 || len(positionalArgs) > 2:
+			log.Fatal("You must provide an upstream and optionally a branch for rebase")
+		}
+
+		upstream, branch := "", ""
+		if len(positionalArgs) > 0 {
+			upstream = positionalArgs[0]
+		}
+		if len(positionalArgs) > 1 {
+			branch = positionalArgs[1]
+		}
+
+		bridges.CmdRebase(upstream, branch, continueFlag, skipFlag, abortFlag, repository.RebaseOptions{Onto: ontoFlag, Interactive: interactiveFlag})
+	case "rev-list":
+		var allFlag bool
+		var maxCountFlag int
+		var topoOrderFlag bool
+		var dateOrderFlag bool
+		var reverseFlag bool
+		var firstParentFlag bool
+		var fullHistoryFlag bool
+		var sinceFlag string
+		var untilFlag string
+		var objectsFlag bool
+		var countFlag bool
+
+		revListCmd := flag.NewFlagSet("rev-list", flag.ExitOnError)
+		revListCmd.BoolVar(&allFlag, "all", false, "walk from every ref and HEAD")
+		revListCmd.IntVar(&maxCountFlag, "max-count", -1, "stop after this many commits")
+		revListCmd.IntVar(&maxCountFlag, "n", -1, "stop after this many commits")
+		revListCmd.BoolVar(&topoOrderFlag, "topo-order", false, "no parent before its children, keep lines of history together")
+		revListCmd.BoolVar(&dateOrderFlag, "date-order", false, "no parent before its children, otherwise by commit date")
+		revListCmd.BoolVar(&reverseFlag, "reverse", false, "print the selected commits in reverse")
+		revListCmd.BoolVar(&firstParentFlag, "first-parent", false, "only follow the first parent of merges")
+		revListCmd.BoolVar(&fullHistoryFlag, "full-history", false, "do not simplify merges when limiting to paths")
+		revListCmd.StringVar(&sinceFlag, "since", "", "only commits newer than the date")
+		revListCmd.StringVar(&untilFlag, "until", "", "only commits older than the date")
+		revListCmd.BoolVar(&objectsFlag, "objects", false, "also print the trees and blobs of the commits")
+		revListCmd.BoolVar(&countFlag, "count", false, "print the number of commits instead")
+
+		revListArgs, revListPaths := splitPathspec(args[2:])
+		revListCmd.Parse(shortFlags(revListCmd, countShorthand(revListArgs)))
+
+		positionalArgs := revListCmd.Args()
+
+		if len(positionalArgs) == 0 && !allFlag {
+			log.Fatal("You must provide a revision for rev-list")
+		}
+
+		order := ""
+		if dateOrderFlag {
+			order = "date"
+		}
+		if topoOrderFlag {
+			order = "topo"
+		}
+
+		bridges.CmdRevList(positionalArgs, revListPaths, repository.RevWalkOptions{
+			All:         allFlag,
+			MaxCount:    maxCountFlag,
+			Order:       order,
+			Reverse:     reverseFlag,
+			FirstParent: firstParentFlag,
+			FullHistory: fullHistoryFlag,
+		}, sinceFlag, untilFlag, objectsFlag, countFlag)
 	case "rev-parse":
 		var typeFlag string
+		var verifyFlag bool
+		var shortFlag abbrevFlag
+		var abbrevRefFlag bool
+		var showToplevelFlag bool
+		var gitDirFlag bool
 
 		revParseCmd := flag.NewFlagSet("rev-parse", flag.ExitOnError)
 		revParseCmd.StringVar(&typeFlag, "git-type", "", "expceted type")
+		revParseCmd.BoolVar(&verifyFlag, "verify", false, "expect exactly one valid revision")
+		revParseCmd.Var(&shortFlag, "short", "abbreviate the sha, optionally to this many chars")
+		revParseCmd.BoolVar(&abbrevRefFlag, "abbrev-ref", false, "print the short name of the ref")
+		revParseCmd.BoolVar(&showToplevelFlag, "show-toplevel", false, "print the path of the worktree")
+		revParseCmd.BoolVar(&gitDirFlag, "git-dir", false, "print the path of the git dir")
 
-		revParseCmd.Parse(args[2:])
+		revParseCmd.Parse(shortFlags(revParseCmd, args[2:]))
 
 		positionalArgs := revParseCmd.Args()
 
-		if len(positionalArgs) == 0 {
+		if len(positionalArgs) == 0 && !showToplevelFlag && !gitDirFlag {
 			log.Fatal("You must provide a dir or file path for rev-parse")
 		}
 
-		bridges.CmdRevParse(typeFlag, positionalArgs[0])
+		bridges.CmdRevParse(typeFlag, positionalArgs, verifyFlag, int(shortFlag), abbrevRefFlag, showToplevelFlag, gitDirFlag)
+	case "revert":
+		var continueFlag bool
+		var skipFlag bool
+		var abortFlag bool
+		var noCommitFlag bool
+		var mainlineFlag int
+		var strategyOptionFlag string
+
+		revertCmd := flag.NewFlagSet("revert", flag.ExitOnError)
+		revertCmd.BoolVar(&continueFlag, "continue", false, "commit the resolved revert and go on with the rest")
+		revertCmd.BoolVar(&skipFlag, "skip", false, "drop the revert that stopped and go on with the rest")
+		revertCmd.BoolVar(&abortFlag, "abort", false, "go back to where the revert started")
+		revertCmd.BoolVar(&noCommitFlag, "n", false, "apply the changes to the index and the worktree without committing")
+		revertCmd.BoolVar(&noCommitFlag, "no-commit", false, "same as n")
+		revertCmd.IntVar(&mainlineFlag, "m", 0, "the parent number of a merge to diff against")
+		revertCmd.IntVar(&mainlineFlag, "mainline", 0, "same as m")
+		revertCmd.StringVar(&strategyOptionFlag, "X", "", "ours or theirs to resolve content conflicts to that side")
+
+		revertCmd.Parse(shortFlags(revertCmd, args[2:]))
+
+		positionalArgs := revertCmd.Args()
+		if !(continueFlag || skipFlag || abortFlag) && len(positionalArgs) == 0 {
+			log.Fatal("You must provide at least one commit for revert")
+		}
+
+		opts := repository.SequencerOptions{Revert: true, NoCommit: noCommitFlag, Mainline: mainlineFlag, Tree: repository.DefaultMergeTreeOptions()}
+		switch strategyOptionFlag {
+		case "":
+		case diff.FavorOurs, diff.FavorTheirs:
+			opts.Tree.Favor = strategyOptionFlag
+		default:
+			log.Fatalf("unknown strategy option: -X%s", strategyOptionFlag)
+		}
+
+		bridges.CmdCherryPick(positionalArgs, continueFlag, skipFlag, abortFlag, opts)
 	case "rm":
 		bridges.CmdRm(args[2:]...)
+	case "shortlog":
+		var summaryFlag bool
+		var numberedFlag bool
+		var emailFlag bool
+		var committerFlag bool
+		var groupFlag stringSliceFlag
+
+		shortlogCmd := flag.NewFlagSet("shortlog", flag.ExitOnError)
+		shortlogCmd.BoolVar(&summaryFlag, "s", false, "print only the number of commits of every identity")
+		shortlogCmd.BoolVar(&summaryFlag, "summary", false, "same as s")
+		shortlogCmd.BoolVar(&numberedFlag, "n", false, "sort by the number of commits")
+		shortlogCmd.BoolVar(&numberedFlag, "numbered", false, "same as n")
+		shortlogCmd.BoolVar(&emailFlag, "e", false, "show the email of every identity")
+		shortlogCmd.BoolVar(&emailFlag, "email", false, "same as e")
+		shortlogCmd.BoolVar(&committerFlag, "c", false, "group by committer instead of author")
+		shortlogCmd.BoolVar(&committerFlag, "committer", false, "same as c")
+		shortlogCmd.Var(&groupFlag, "group", "author, committer or trailer:<key>, can be repeated")
+
+		shortlogArgs, shortlogPaths := splitPathspec(args[2:])
+		shortlogCmd.Parse(shortFlags(shortlogCmd, shortlogArgs))
+
+		groups := []string{}
+		for _, group := range groupFlag {
+			group, err := repository.ParseShortlogGroup(group)
+			if err != nil {
+				log.Fatal(err)
+			}
+			groups = append(groups, group)
+		}
+		if committerFlag {
+			groups = append(groups, "committer")
+		}
+
+		bridges.CmdShortlog(shortlogCmd.Args(), shortlogPaths, repository.ShortlogOptions{
+			Summary:  summaryFlag,
+			Numbered: numberedFlag,
+			Email:    emailFlag,
+			Groups:   groups,
+		})
+	case "show":
+		var onelineFlag bool
+		var formatFlag string
+		var dateFlag string
+		var decorateFlag bool
+		var noPatchFlag bool
+		var patchFlag bool
+		var statFlag bool
+		var numStatFlag bool
+		var nameOnlyFlag bool
+		var nameStatusFlag bool
+		var unifiedFlag int
+		var noRenamesFlag bool
+		colorFlag := optionalFlag{value: "always"}
+
+		showCmd := flag.NewFlagSet("show", flag.ExitOnError)
+		showCmd.BoolVar(&onelineFlag, "oneline", false, "one line per commit with the abbreviated sha")
+		showCmd.StringVar(&formatFlag, "format", "", "oneline, short, medium, full, fuller, format:<fmt> or tformat:<fmt>")
+		showCmd.StringVar(&formatFlag, "pretty", "", "same as format")
+		showCmd.StringVar(&dateFlag, "date", "", "default, iso, iso-strict, rfc, short, raw, unix or relative")
+		showCmd.BoolVar(&decorateFlag, "decorate", false, "show the refs pointing at every commit")
+		showCmd.BoolVar(&noPatchFlag, "s", false, "do not print the diff of commits")
+		showCmd.BoolVar(&noPatchFlag, "no-patch", false, "same as s")
+		showCmd.BoolVar(&patchFlag, "p", false, "print the patch, the default without another format")
+		showCmd.BoolVar(&patchFlag, "patch", false, "same as p")
+		showCmd.BoolVar(&statFlag, "stat", false, "print a diffstat")
+		showCmd.BoolVar(&numStatFlag, "numstat", false, "print the added and deleted lines of every file")
+		showCmd.BoolVar(&nameOnlyFlag, "name-only", false, "print only the names of the changed files")
+		showCmd.BoolVar(&nameStatusFlag, "name-status", false, "print the names and the status of the changed files")
+		showCmd.IntVar(&unifiedFlag, "U", 3, "lines of context")
+		showCmd.IntVar(&unifiedFlag, "unified", 3, "lines of context")
+		showCmd.BoolVar(&noRenamesFlag, "no-renames", false, "do not detect renames")
+		showCmd.Var(&colorFlag, "color", "color the patch and the diffstat, always, never or auto")
+
+		showCmd.Parse(shortFlags(showCmd, valueShorthand(args[2:], "U")))
+
+		logOpts := repository.LogOptions{Format: formatFlag, Date: dateFlag, Decorate: decorateFlag}
+		if onelineFlag {
+			logOpts.Format = "oneline"
+			logOpts.Abbrev = true
+		}
+
+		diffOpts := diff.DefaultOptions()
+		diffOpts.Context = unifiedFlag
+
+		bridges.CmdShow(showCmd.Args(), repository.ShowOptions{
+			Log: logOpts,
+			Diff: repository.DiffOptions{
+				Diff:        diffOpts,
+				Renames:     !noRenamesFlag,
+				RenameScore: repository.DefaultRenameScore,
+				Patch:       patchFlag || !(statFlag || numStatFlag || nameOnlyFlag || nameStatusFlag),
+				Stat:        statFlag,
+				NumStat:     numStatFlag,
+				NameOnly:    nameOnlyFlag,
+				NameStatus:  nameStatusFlag,
+				Color:       colorWanted(colorFlag),
+				ColorMoved:  repository.ColorMovedNo,
+			},
+			NoPatch: noPatchFlag,
+		})
 	case "show-ref":
 		bridges.CmdShowRef(args[0])
+	case "stash":
+		var untrackedFlag bool
+		var messageFlag string
+		var indexFlag bool
+		var patchFlag bool
+
+		command, stashArgs := "push", args[2:]
+		if len(stashArgs) > 0 && !strings.HasPrefix(stashArgs[0], "-") {
+			command, stashArgs = stashArgs[0], stashArgs[1:]
+		}
+
+		stashCmd := flag.NewFlagSet("stash "+command, flag.ExitOnError)
+		switch command {
+		case "push":
+			stashCmd.BoolVar(&untrackedFlag, "u", false, "also save the untracked files and remove them")
+			stashCmd.BoolVar(&untrackedFlag, "include-untracked", false, "same as u")
+			stashCmd.StringVar(&messageFlag, "m", "", "the description of the stash")
+			stashCmd.StringVar(&messageFlag, "message", "", "same as m")
+		case "apply", "pop":
+			stashCmd.BoolVar(&indexFlag, "index", false, "also bring back the changes that were staged")
+		case "show":
+			stashCmd.BoolVar(&patchFlag, "p", false, "show the changes as a patch instead of a diffstat")
+			stashCmd.BoolVar(&patchFlag, "patch", false, "same as p")
+		case "list", "drop", "branch":
+		default:
+			log.Fatalf("unknown stash subcommand: %s", command)
+		}
+
+		stashArgs, stashPaths := splitPathspec(stashArgs)
+		stashCmd.Parse(shortFlags(stashCmd, stashArgs))
+
+		positionalArgs := stashCmd.Args()
+		switch {
+		case command == "push" && len(positionalArgs) > 0:
+			stashPaths = append(positionalArgs, stashPaths...)
+			positionalArgs = []string{}
+		case command == "branch" && (len(positionalArgs) == 0 || len(positionalArgs) > 2):
+			log.Fatal("You must provide a branch name and optionally a stash for stash branch")
+		case command == "list" && len(positionalArgs) > 0:
+			log.Fatal("stash list takes no arguments")
+		case command != "branch" && len(positionalArgs) > 1:
+			log.Fatalf("Too many revisions specified: %s", strings.Join(positionalArgs, " "))
+		}
+
+		bridges.CmdStash(command, positionalArgs, repository.StashOptions{
+			Message:   messageFlag,
+			Untracked: untrackedFlag,
+			Paths:     stashPaths,
+		}, indexFlag, repository.DiffOptions{
+			Diff:        diff.DefaultOptions(),
+			Renames:     true,
+			RenameScore: repository.DefaultRenameScore,
+			Patch:       patchFlag,
+			Stat:        !patchFlag,
+		})
 	case "status":
 		bridges.CmdStatus()
+	case "symbolic-ref":
+		var deleteFlag bool
+		var shortFlag bool
+		var quietFlag bool
+
+		symbolicRefCmd := flag.NewFlagSet("symbolic-ref", flag.ExitOnError)
+		symbolicRefCmd.BoolVar(&deleteFlag, "d", false, "delete the symbolic ref")
+		symbolicRefCmd.BoolVar(&shortFlag, "short", false, "shorten the printed ref")
+		symbolicRefCmd.BoolVar(&quietFlag, "q", false, "do not error out when the ref is not symbolic")
+
+		symbolicRefCmd.Parse(shortFlags(symbolicRefCmd, args[2:]))
+
+		positionalArgs := symbolicRefCmd.Args()
+
+		if len(positionalArgs) == 0 || len(positionalArgs) > 2 {
+			log.Fatal("You must provide a name and optionally a target for symbolic-ref")
+		}
+
+		if len(positionalArgs) == 1 {
+			bridges.CmdSymbolicRef(positionalArgs[0], "", deleteFlag, shortFlag, quietFlag)
+		} else {
+			bridges.CmdSymbolicRef(positionalArgs[0], positionalArgs[1], deleteFlag, shortFlag, quietFlag)
+		}
 	case "tag":
 		var tagObjectFlag bool
 
 		tagObjectCmd := flag.NewFlagSet("tag", flag.ExitOnError)
 		tagObjectCmd.BoolVar(&tagObjectFlag, "a", false, "recursively print the tree")
 
-		tagObjectCmd.Parse(args[2:])
+		tagObjectCmd.Parse(shortFlags(tagObjectCmd, args[2:]))
 
 		positionalArgs := tagObjectCmd.Args()
 
 		if len(positionalArgs) == 0 {
 			bridges.CmdTag("", "", tagObjectFlag)
+		} else if len(positionalArgs) == 1 {
+			bridges.CmdTag(positionalArgs[0], "", tagObjectFlag)
 		} else {
 			bridges.CmdTag(positionalArgs[0], positionalArgs[1], tagObjectFlag)
 		}